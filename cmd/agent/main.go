@@ -16,8 +16,9 @@ import (
 )
 
 const (
-	defaultKeyAlg = "RSA"
-	exitTimeout   = 5 * time.Second
+	defaultKeyAlg     = "RSA"
+	defaultOutboxFile = "/data/outbox.db"
+	exitTimeout       = 5 * time.Second
 )
 
 func main() {
@@ -25,6 +26,12 @@ func main() {
 
 	keyAlg := flag.String("key-alg", defaultKeyAlg, "Key algorithm for private keys generation")
 	enrollmentToken := flag.String("jwt", "", "Enrollment token (JWT) (required)")
+	imageDir := flag.String("image-dir", "", "Directory for image transfers, a temporary directory is used when empty")
+	imageTrustRoot := flag.String("image-trust-root", "", "PEM file of the public keys images must be signed with (required unless -allow-unsigned-images is set)")
+	allowUnsignedImages := flag.Bool("allow-unsigned-images", false, "Load images without verifying their signatures when no trust root is set (development only)")
+	modulePolicy := flag.String("module-policy", "", "JSON file of the policy modules must comply with, privileged containers, added capabilities and bind mounts are denied when empty")
+	secretsDir := flag.String("secrets-dir", "", "Host directory for module secret files, mounted into the agent at the same path (required for modules with secret files)")
+	outboxFile := flag.String("outbox-file", defaultOutboxFile, "Database file for undelivered module messages, messages are kept only in memory when empty")
 
 	flag.Parse()
 
@@ -41,8 +48,14 @@ func main() {
 
 	ctx := context.Background()
 	agentApp, err := app.NewAgentApp(ctx, app.AgentAppConfig{
-		KeyAlg: *keyAlg,
-		JWT:    *enrollmentToken,
+		KeyAlg:              *keyAlg,
+		JWT:                 *enrollmentToken,
+		ImageDir:            *imageDir,
+		ImageTrustRoot:      *imageTrustRoot,
+		AllowUnsignedImages: *allowUnsignedImages,
+		ModulePolicy:        *modulePolicy,
+		SecretsDir:          *secretsDir,
+		OutboxFile:          *outboxFile,
 	})
 	if err != nil {
 		panic(err)
@@ -24,6 +24,8 @@ const (
 
 	defaultCertFilePath = "/certs/ca-cert.pem"
 	defaultKeyFilePath  = "/certs/ca-key.pem"
+	defaultDatabaseFile = "/data/controller.db"
+	defaultImageDir     = "/data/images"
 )
 
 var pairListRegex = regexp.MustCompile(`^([^\s:]+:[^\s:]+)(,[^\s:]+:[^\s:]+)*$`)
@@ -42,8 +44,25 @@ func main() {
 		apiKeyFile = defaultKeyFilePath
 	}
 
+	databaseFile, ok := os.LookupEnv(constants.ControllerEnvDatabaseFile)
+	if !ok {
+		databaseFile = defaultDatabaseFile
+	}
+
+	imageDir, ok := os.LookupEnv(constants.ControllerEnvImageDir)
+	if !ok {
+		imageDir = defaultImageDir
+	}
+
+	imageSigningKeyFile := os.Getenv(constants.ControllerEnvImageSigningKeyFile)
+	secretsKeyFile := os.Getenv(constants.ControllerEnvSecretsKeyFile)
+	webhookCertFile := os.Getenv(constants.ControllerEnvWebhookCertFile)
+	webhookKeyFile := os.Getenv(constants.ControllerEnvWebhookKeyFile)
+	webhookCAFile := os.Getenv(constants.ControllerEnvWebhookCAFile)
+
 	enrollmentToken := os.Getenv(constants.ControllerEnvEnrollmentToken)
 	apiCredentials := os.Getenv(constants.ControllerEnvAPICredentials)
+	apiExecUsers := os.Getenv(constants.ControllerEnvAPIExecUsers)
 
 	// Check required fields
 	if enrollmentToken == "" {
@@ -51,6 +70,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	if secretsKeyFile == "" {
+		log.Error().Msgf("Error: %s environment variable is required", constants.ControllerEnvSecretsKeyFile)
+		os.Exit(1)
+	}
+
 	if apiCredentials == "" {
 		log.Error().Msgf("Error: %s environment variable is required", constants.ControllerEnvAPICredentials)
 		os.Exit(1)
@@ -65,6 +89,7 @@ func main() {
 	// Set up the configuration
 	cfg := &app.ControllerAppConfig{}
 	cfg.ApiCredentials = credentials
+	cfg.ExecUsers = parseUserList(apiExecUsers)
 	cfg.OpenZiti.KeyAlg = "RSA"
 	cfg.OpenZiti.EnrollmentToken = enrollmentToken
 	cfg.RESTapi.Address = constants.ControllerAPIAddress
@@ -73,6 +98,13 @@ func main() {
 	cfg.MetricsApi.Address = constants.ControllerMetricsAPIAddress
 	cfg.MetricsApi.CertFile = apiCertFile
 	cfg.MetricsApi.KeyFile = apiKeyFile
+	cfg.Database.File = databaseFile
+	cfg.Images.Dir = imageDir
+	cfg.Images.SigningKeyFile = imageSigningKeyFile
+	cfg.Secrets.KeyFile = secretsKeyFile
+	cfg.Webhooks.CertFile = webhookCertFile
+	cfg.Webhooks.KeyFile = webhookKeyFile
+	cfg.Webhooks.CAFile = webhookCAFile
 
 	controllerApp, err := app.NewControllerApp(cfg)
 	if err != nil {
@@ -144,3 +176,14 @@ func parseAPICredentials(credentials string) (map[string]string, error) {
 
 	return parsedCredentials, nil
 }
+
+// parseUserList parses a comma separated list of usernames.
+func parseUserList(users string) []string {
+	parsedUsers := []string{}
+	for _, user := range strings.Split(users, ",") {
+		if user = strings.TrimSpace(user); user != "" {
+			parsedUsers = append(parsedUsers, user)
+		}
+	}
+	return parsedUsers
+}
@@ -5,7 +5,6 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
-	"io"
 	"sync"
 	"time"
 
@@ -14,9 +13,11 @@ import (
 	"github.com/pajtaand/dmap-zero/internal/agent/manager"
 	"github.com/pajtaand/dmap-zero/internal/agent/rest"
 	"github.com/pajtaand/dmap-zero/internal/agent/service"
+	"github.com/pajtaand/dmap-zero/internal/common/blobstore"
 	"github.com/pajtaand/dmap-zero/internal/common/constants"
 	"github.com/pajtaand/dmap-zero/internal/common/database"
 	mm "github.com/pajtaand/dmap-zero/internal/common/manager"
+	"github.com/pajtaand/dmap-zero/internal/common/signing"
 	"github.com/pajtaand/dmap-zero/internal/common/utils"
 	"github.com/pajtaand/dmap-zero/internal/common/wrapper"
 	pb "github.com/pajtaand/dmap-zero/internal/proto"
@@ -29,6 +30,22 @@ import (
 type AgentAppConfig struct {
 	JWT    string
 	KeyAlg string
+	// ImageDir keeps image transfers across agent restarts, a temporary directory is used when empty
+	ImageDir string
+	// ImageTrustRoot is a PEM file of the Ed25519 public keys images must be signed with, it's
+	// required unless AllowUnsignedImages is set
+	ImageTrustRoot string
+	// AllowUnsignedImages disables signature verification when no trust root is configured
+	AllowUnsignedImages bool
+	// ModulePolicy is a JSON file of the policy modules must comply with, the default policy
+	// denying privileged containers, added capabilities and bind mounts is used when empty
+	ModulePolicy string
+	// SecretsDir is the host directory module secret files are written to, it must be mounted into
+	// the agent at the same path. Modules with secret files can't be started when it's empty
+	SecretsDir string
+	// OutboxFile keeps undelivered module messages across agent restarts, messages are kept only
+	// in memory when empty
+	OutboxFile string
 }
 
 type AgentApp struct {
@@ -41,6 +58,9 @@ type AgentApp struct {
 	webhookManager         *manager.WebhookManager
 	configManager          *manager.ConfigManager
 	endpointManager        *manager.EndpointManager
+	topicManager           *manager.TopicManager
+	outboxManager          *manager.OutboxManager
+	outboxDatabase         database.Database
 	receiveServiceClient   pb.ReceiveServiceClient
 	setupServiceClient     pb.SetupServiceClient
 	phonehomeServiceClient pb.PhonehomeServiceClient
@@ -53,7 +73,6 @@ type AgentApp struct {
 
 	identityName           string
 	moduleServerChosenPort int
-	database               *database.KVStore
 }
 
 func NewAgentApp(ctx context.Context, cfg AgentAppConfig) (*AgentApp, error) {
@@ -74,7 +93,7 @@ func NewAgentApp(ctx context.Context, cfg AgentAppConfig) (*AgentApp, error) {
 
 	log.Debug().Msg("Generating certificates for module REST API")
 	certExpiration := time.Now().Add(constants.AgentModuleServerCertificateValidity)
-	cert, certPEM, err := utils.GenerateCertificate(constants.AgentDockerHostAddress, certExpiration)
+	cert, certPEM, err := utils.GenerateCertificate(constants.AgentDockerHostAddress, certExpiration, constants.AgentModuleHostName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate key and certificate: %v", err)
 	}
@@ -105,18 +124,51 @@ func NewAgentApp(ctx context.Context, cfg AgentAppConfig) (*AgentApp, error) {
 	agent.identityName = identity
 	log.Info().Msgf("Agent OpenZiti identity: %s", identity)
 
-	log.Debug().Msg("Connecting to database")
-	agent.database = database.NewKVStore()
+	log.Debug().Msg("Opening image store")
+	var blobStore *blobstore.BlobStore
+	if cfg.ImageDir == "" {
+		blobStore, err = blobstore.NewTempBlobStore()
+	} else {
+		blobStore, err = blobstore.NewBlobStore(cfg.ImageDir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image store: %v", err)
+	}
+
+	var verifier *signing.Verifier
+	if cfg.ImageTrustRoot == "" {
+		if !cfg.AllowUnsignedImages {
+			return nil, errors.New("image trust root is required, unsigned images can only be allowed explicitly")
+		}
+		log.Warn().Msg("No image trust root configured, unsigned images are allowed and signatures will not be verified")
+	} else {
+		keys, err := signing.LoadPublicKeys(cfg.ImageTrustRoot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load image trust root: %v", err)
+		}
+		verifier, err = signing.NewVerifier(keys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create image verifier: %v", err)
+		}
+		log.Info().Msgf("Image signatures are verified against %d trusted keys", len(keys))
+	}
 
 	log.Debug().Msg("Creating managers")
-	imageManager, err := manager.NewImageManager(agent.dockerWrapper, agent.database)
+	imageManager, err := manager.NewImageManager(agent.dockerWrapper, blobStore, verifier)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create ImageManager: %v", err)
 	}
 	agent.imageManager = imageManager
 
-	agentAPIBaseUrl := fmt.Sprintf("https://%s:%d/api/v1", constants.AgentDockerHostAddress, agent.moduleServerChosenPort)
-	moduleManager, err := manager.NewModuleManager(agent.dockerWrapper, agent.moduleAuthStore, certPEM, agentAPIBaseUrl)
+	modulePolicy := manager.NewModulePolicyDefault()
+	if cfg.ModulePolicy != "" {
+		modulePolicy, err = manager.LoadModulePolicy(cfg.ModulePolicy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load module policy: %v", err)
+		}
+	}
+
+	moduleManager, err := manager.NewModuleManager(agent.dockerWrapper, agent.moduleAuthStore, modulePolicy, certPEM, agent.moduleServerChosenPort, cfg.SecretsDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create ModuleManager: %v", err)
 	}
@@ -140,6 +192,12 @@ func NewAgentApp(ctx context.Context, cfg AgentAppConfig) (*AgentApp, error) {
 	}
 	agent.webhookManager = webhookManager
 
+	topicManager, err := manager.NewTopicManager()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create TopicManager: %v", err)
+	}
+	agent.topicManager = topicManager
+
 	log.Debug().Msg("Creating grpc clients")
 	controllerConn, err := grpc.NewClient(
 		fmt.Sprintf("passthrough:///%s", constants.OpenZitiServiceController),
@@ -155,6 +213,24 @@ func NewAgentApp(ctx context.Context, cfg AgentAppConfig) (*AgentApp, error) {
 	agent.setupServiceClient = pb.NewSetupServiceClient(agent.controllerConn)
 	agent.phonehomeServiceClient = pb.NewPhonehomeServiceClient(agent.controllerConn)
 
+	log.Debug().Msg("Opening outbox")
+	if cfg.OutboxFile == "" {
+		log.Warn().Msg("No outbox file configured, undelivered messages will not survive a restart")
+		agent.outboxDatabase = database.NewKVStore()
+	} else {
+		db, err := database.NewBoltStore(cfg.OutboxFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open outbox: %v", err)
+		}
+		agent.outboxDatabase = db
+	}
+
+	outboxManager, err := manager.NewOutboxManager(agent.outboxDatabase, agent.endpointManager, agent.receiveServiceClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OutboxManager: %v", err)
+	}
+	agent.outboxManager = outboxManager
+
 	log.Debug().Msg("Creating agent services")
 	pingService, err := service.NewPingService()
 	if err != nil {
@@ -168,21 +244,21 @@ func NewAgentApp(ctx context.Context, cfg AgentAppConfig) (*AgentApp, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new ImageService: %v", err)
 	}
-	moduleService, err := service.NewModuleService(agent.moduleManager, agent.imageManager, agent.configManager, agent.webhookManager)
+	moduleService, err := service.NewModuleService(agent.moduleManager, agent.imageManager, agent.configManager, agent.webhookManager, agent.topicManager)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new ModuleService: %v", err)
 	}
-	shareService, err := service.NewShareService(agent.webhookManager)
+	shareService, err := service.NewShareService(agent.webhookManager, agent.moduleManager, agent.topicManager)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new ShareService: %v", err)
 	}
 
 	log.Debug().Msg("Creating module services")
-	controllerService, err := service.NewControllerService(agent.receiveServiceClient)
+	controllerService, err := service.NewControllerService(agent.outboxManager)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create ControllerService: %v", err)
 	}
-	endpointService, err := service.NewEndpointService(agent.endpointManager)
+	endpointService, err := service.NewEndpointService(agent.endpointManager, agent.outboxManager)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create EndpointService: %v", err)
 	}
@@ -190,6 +266,18 @@ func NewAgentApp(ctx context.Context, cfg AgentAppConfig) (*AgentApp, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create WebhookService: %v", err)
 	}
+	topicService, err := service.NewTopicService(agent.topicManager, agent.webhookManager, agent.moduleManager, agent.outboxManager, agent.identityName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create TopicService: %v", err)
+	}
+	outboxService, err := service.NewOutboxService(agent.outboxManager)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OutboxService: %v", err)
+	}
+	healthService, err := service.NewHealthService(agent.moduleManager)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HealthService: %v", err)
+	}
 
 	log.Debug().Msg("Preparing servers")
 	agentListener, err := agent.openZitiWrapper.ListenWithOptions(constants.OpenZitiServiceAgent, &ziti.ListenOptions{
@@ -225,7 +313,11 @@ func NewAgentApp(ctx context.Context, cfg AgentAppConfig) (*AgentApp, error) {
 		endpointService,
 		controllerService,
 		webhookService,
+		topicService,
+		outboxService,
+		healthService,
 	)
+	agent.moduleManager.SetAPIBinder(agent.moduleServer)
 
 	log.Info().Msg("Agent initialization was successful")
 	return agent, nil
@@ -242,89 +334,18 @@ func (a *AgentApp) DownloadConfiguration() error {
 	return nil
 }
 
+// DownloadImagesAndStartModules brings a freshly started agent to the desired state, missing
+// images are pulled by the reconciliation, see downloadImage.
 func (a *AgentApp) DownloadImagesAndStartModules() error {
-	log.Info().Msg("Requesting available images")
-
-	stream, err := a.setupServiceClient.ImageRequest(context.Background(), &emptypb.Empty{})
-	if err != nil {
-		return fmt.Errorf("failed to start stream: %v", err)
-	}
-
-	var imageID, imageName string
-	var imageData []byte
-	for {
-		chunk, err := stream.Recv()
-		if err != nil {
-			if err == io.EOF {
-				if len(imageData) == 0 {
-					log.Info().Msg("No images received from controller")
-					return nil
-				}
-				log.Info().Msgf("Image successfully received: imageID=%s, imageName=%s", imageID, imageName)
-
-				if _, err := a.imageManager.AddImageWithID(imageID, imageName, imageData); err != nil {
-					log.Error().Err(err).Msgf("Failed to add image to the ImageManager: imageID=%s, imageName=%s", imageID, imageName)
-				}
-				break // continue with modules setup
-			}
-			return fmt.Errorf("failed to receive data: %v", err)
-		}
-		if imageID == "" {
-			imageID = chunk.Id
-			imageName = chunk.Name
-		} else if imageID != chunk.Id {
-			log.Info().Msgf("Image successfully received: imageID=%s, imageName=%s", imageID, imageName)
-
-			if _, err := a.imageManager.AddImageWithID(imageID, imageName, imageData); err != nil {
-				log.Error().Err(err).Msgf("Failed to add image to the ImageManager: imageID=%s, imageName=%s", imageID, imageName)
-			}
+	log.Info().Msg("Requesting desired state")
 
-			imageID = chunk.Id
-			imageName = chunk.Name
-			imageData = []byte{}
-		}
-		imageData = append(imageData, chunk.Content...)
-	}
-
-	log.Info().Msg("Requesting running modules")
-	resp, err := a.setupServiceClient.ModuleRequest(context.Background(), &emptypb.Empty{})
+	state, err := a.phonehome()
 	if err != nil {
-		return fmt.Errorf("failed to reveice module configuration: %v", err)
-	}
-
-	log.Debug().Msgf("Received configuration for %d modules", len(resp.Configs))
-	for ind, cfg := range resp.Configs {
-		log.Debug().Msgf("[%d] Module data: %v", ind, cfg)
-
-		moduleID := cfg.Module.Id
-		imageID := cfg.Image.Id
-		moduleCfg := a.configManager.GetConfiguration()
-
-		// extend agent's configuration with module configuration
-		for k, v := range cfg.Env {
-			moduleCfg[k] = v
-		}
-
-		image, err := a.imageManager.GetImage(imageID)
-		if err != nil {
-			log.Error().Err(err).Msgf("failed to get image, imageID=%s", imageID)
-			continue
-		}
-		imageRef := image.GetReference()
-
-		log.Info().Msgf("Starting module moduleID=%s, imageID=%s, moduleCfg=%v", moduleID, imageID, moduleCfg)
-
-		if err := a.webhookManager.AddModule(moduleID); err != nil {
-			log.Error().Err(err).Msg("failed to add module to webhook manager")
-			continue
-		}
-
-		if _, err := a.moduleManager.StartModule(moduleID, imageRef, moduleCfg); err != nil {
-			log.Error().Err(err).Msg("failed to start module")
-			continue
-		}
+		return fmt.Errorf("failed to receive desired state: %v", err)
 	}
+	log.Debug().Msgf("Received desired state: %d images, %d modules", len(state.Images), len(state.Modules))
 
+	a.reconcile(state)
 	return nil
 }
 
@@ -383,37 +404,58 @@ func (a *AgentApp) repeatPhonehome(ctx context.Context) {
 			// context cancelled
 			return
 		default:
-			func() {
-				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-				defer cancel()
+			state, err := a.phonehome()
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to phone home")
+			} else {
+				a.reconcile(state)
+			}
+		}
+		time.Sleep(constants.AgentPhonehomeInterval)
+	}
+}
 
-				phonehomeData := &pb.PhonehomeData{
-					Images:  map[string]*pb.ImageInfo{},
-					Modules: map[string]*pb.ModuleInfo{},
-				}
-				for _, image := range a.imageManager.ListImages() {
-					phonehomeData.Images[image.GetID()] = &pb.ImageInfo{
-						Id:   image.GetID(),
-						Name: image.GetName(),
-						Size: int64(image.GetSize()),
-					}
-				}
-				for _, module := range a.moduleManager.ListModules() {
-					phonehomeData.Modules[module.GetID()] = &pb.ModuleInfo{
-						Id:     module.GetID(),
-						Status: pb.ModuleStatus_UNKNOWN,
-					}
-				}
+// phonehome reports the agent's state to the controller and returns the desired state.
+func (a *AgentApp) phonehome() (*pb.DesiredState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
 
-				log.Debug().Msg("Phoning home...")
-				_, err := a.phonehomeServiceClient.Phonehome(ctx, phonehomeData)
-				if err != nil {
-					log.Error().Err(err).Msg("Failed to phone home")
-				}
-			}()
+	phonehomeData := &pb.PhonehomeData{
+		Images:          map[string]*pb.ImageInfo{},
+		Modules:         map[string]*pb.ModuleInfo{},
+		RejectedImages:  a.imageManager.RejectedImages(),
+		RejectedModules: a.moduleManager.RejectedModules(),
+		VolumeUsage:     a.moduleManager.VolumeUsage(),
+		Subscriptions:   map[string]*pb.TopicSubscribers{},
+	}
+	for _, image := range a.imageManager.ListImages() {
+		phonehomeData.Images[image.GetID()] = &pb.ImageInfo{
+			Id:     image.GetID(),
+			Name:   image.GetName(),
+			Size:   int64(image.GetSize()),
+			Digest: image.GetDigest(),
+		}
+	}
+	for topic, modules := range a.topicManager.Subscriptions() {
+		phonehomeData.Subscriptions[topic] = &pb.TopicSubscribers{
+			Modules: modules,
+		}
+	}
+	for _, module := range a.moduleManager.ListModules() {
+		status, err := a.moduleManager.GetModuleStatus(module.GetID())
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to get module status: moduleID=%s", module.GetID())
+		}
+		phonehomeData.Modules[module.GetID()] = &pb.ModuleInfo{
+			Id:           module.GetID(),
+			Status:       status,
+			RestartCount: int32(module.GetRestartCount()),
+			Revision:     int32(module.GetRevision()),
 		}
-		time.Sleep(constants.AgentPhonehomeInterval)
 	}
+
+	log.Debug().Msg("Phoning home...")
+	return a.phonehomeServiceClient.Phonehome(ctx, phonehomeData)
 }
 
 func (a *AgentApp) Run(ctx context.Context) error {
@@ -460,7 +502,9 @@ func (a *AgentApp) Run(ctx context.Context) error {
 
 	ctx, cancel := context.WithCancel(ctx)
 	go a.repeatPhonehome(ctx)
+	go a.moduleManager.Supervise(ctx)
 	go a.pingAgents(ctx)
+	go a.outboxManager.Run(ctx)
 
 	log.Info().Msg("Agent successfully started")
 	wg.Wait()
@@ -494,5 +538,8 @@ func (a *AgentApp) Clean(ctx context.Context) error {
 	if err := a.controllerConn.Close(); err != nil {
 		return fmt.Errorf("failed to close controller connection: %v", err)
 	}
+	if err := a.outboxDatabase.Close(); err != nil {
+		return fmt.Errorf("failed to close outbox: %v", err)
+	}
 	return nil
 }
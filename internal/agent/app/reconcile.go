@@ -0,0 +1,340 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"time"
+
+	"github.com/pajtaand/dmap-zero/internal/agent/manager"
+	"github.com/pajtaand/dmap-zero/internal/common/blobstore"
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	pb "github.com/pajtaand/dmap-zero/internal/proto"
+	"github.com/rs/zerolog/log"
+)
+
+// reconcile converges the agent to the desired state received from the controller. Missing images
+// are downloaded, missing modules are started, and modules and images the controller no longer
+// knows about are removed. Module volumes are removed according to their retention. The agents
+// with modules subscribed to each topic are replaced by the ones the controller reported.
+func (a *AgentApp) reconcile(state *pb.DesiredState) {
+	if state == nil {
+		return
+	}
+
+	remoteSubscribers := map[string][]string{}
+	for _, subscription := range state.Subscriptions {
+		if subscription.Agent == a.identityName {
+			continue
+		}
+		remoteSubscribers[subscription.Topic] = append(remoteSubscribers[subscription.Topic], subscription.Agent)
+	}
+	a.topicManager.SetRemoteSubscribers(remoteSubscribers)
+
+	desiredImages := map[string]bool{}
+	for _, image := range state.Images {
+		desiredImages[image.Id] = true
+		if a.imageManager.ImageExists(image.Id) || a.imageManager.IsRejected(image.Id, image.Signature) {
+			continue
+		}
+		log.Info().Msgf("Reconciling missing image: imageID=%s, imageName=%s", image.Id, image.Name)
+		if err := a.downloadImage(image); err != nil {
+			log.Error().Err(err).Msgf("Failed to download image: imageID=%s", image.Id)
+		}
+	}
+
+	desiredModules := map[string]bool{}
+	for _, cfg := range state.Modules {
+		moduleID := cfg.Module.Id
+		desiredModules[moduleID] = true
+		if a.moduleManager.IsRejected(moduleID, int(cfg.Revision)) {
+			continue
+		}
+		if err := a.moduleManager.CheckRevision(moduleID, int(cfg.Revision), a.moduleEnv(cfg), cfg.Secrets, manager.ModuleResourcesFromProto(cfg.Resources), manager.ModuleSecurityFromProto(cfg.Security), manager.ModuleStorageFromProto(cfg.Storage)); err != nil {
+			log.Error().Err(err).Msgf("Module revision can't run: moduleID=%s, revision=%d", moduleID, cfg.Revision)
+			continue
+		}
+		if module, err := a.moduleManager.GetModule(moduleID); err == nil {
+			if module.GetRevision() != int(cfg.Revision) && a.runsModuleSpec(module, cfg) {
+				log.Info().Msgf("Module revision changed without its image, configuration or container options: moduleID=%s, revision=%d", moduleID, cfg.Revision)
+				module.SetRevision(int(cfg.Revision))
+			}
+			if module.GetRevision() == int(cfg.Revision) && module.HasSecrets(cfg.Secrets) {
+				module.SetRestartPolicy(manager.RestartPolicyFromProto(cfg.RestartPolicy))
+				continue
+			}
+			if module.GetRevision() == int(cfg.Revision) {
+				log.Info().Msgf("Reconciling rotated module secrets: moduleID=%s", moduleID)
+			} else {
+				log.Info().Msgf("Reconciling module revision: moduleID=%s, revision=%d, desiredRevision=%d", moduleID, module.GetRevision(), cfg.Revision)
+			}
+			if err := a.stopModule(moduleID); err != nil {
+				log.Error().Err(err).Msgf("Failed to stop module: moduleID=%s", moduleID)
+				continue
+			}
+		} else {
+			log.Info().Msgf("Reconciling missing module: moduleID=%s", moduleID)
+		}
+		if err := a.startModule(cfg); err != nil {
+			log.Error().Err(err).Msgf("Failed to start module: moduleID=%s", moduleID)
+		}
+	}
+
+	for imageID := range a.imageManager.RejectedImages() {
+		if !desiredImages[imageID] {
+			a.imageManager.ForgetRejection(imageID)
+		}
+	}
+	for moduleID := range a.moduleManager.RejectedModules() {
+		if !desiredModules[moduleID] {
+			a.moduleManager.ForgetRejection(moduleID)
+		}
+	}
+
+	usedImageRefs := map[string]bool{}
+	for _, module := range a.moduleManager.ListModules() {
+		moduleID := module.GetID()
+		if desiredModules[moduleID] {
+			usedImageRefs[module.GetImageReference()] = true
+			continue
+		}
+		log.Info().Msgf("Reconciling orphaned module: moduleID=%s", moduleID)
+		if err := a.stopModule(moduleID); err != nil {
+			log.Error().Err(err).Msgf("Failed to stop module: moduleID=%s", moduleID)
+			continue
+		}
+		if err := a.moduleManager.RemoveVolumes(moduleID, constants.ModuleVolumeRetentionUntilStop); err != nil {
+			log.Error().Err(err).Msgf("Failed to remove module volumes: moduleID=%s", moduleID)
+		}
+	}
+
+	existingModules := map[string]bool{}
+	for _, moduleID := range state.ExistingModules {
+		existingModules[moduleID] = true
+	}
+	if err := a.moduleManager.RemoveDeletedModuleVolumes(existingModules); err != nil {
+		log.Error().Err(err).Msg("Failed to remove volumes of deleted modules")
+	}
+
+	for _, image := range a.imageManager.ListImages() {
+		imageID := image.GetID()
+		if desiredImages[imageID] || usedImageRefs[image.GetReference()] {
+			continue
+		}
+		log.Info().Msgf("Reconciling orphaned image: imageID=%s", imageID)
+		if err := a.imageManager.RemoveImage(imageID); err != nil {
+			log.Error().Err(err).Msgf("Failed to remove image: imageID=%s", imageID)
+		}
+	}
+}
+
+// downloadImage downloads the image from the controller. When the controller indexed the image
+// tarball, only the layers docker doesn't have yet are transferred, otherwise the whole tarball is.
+func (a *AgentApp) downloadImage(image *pb.ImageInfo) error {
+	presentLayers, err := a.imageManager.PresentLayers()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to list present layers, all layers will be downloaded")
+	}
+
+	archive, err := a.setupServiceClient.ImageArchiveRequest(context.Background(), &pb.ImageArchiveRequest{
+		Id:            image.Id,
+		PresentLayers: presentLayers,
+	})
+	if err != nil {
+		log.Warn().Err(err).Msgf("Image archive unavailable, downloading whole image: imageID=%s", image.Id)
+		return a.downloadWholeImage(image)
+	}
+
+	if err := a.imageManager.VerifyArchive(image.Id, image.Signature, archive); err != nil {
+		return err
+	}
+	if err := a.downloadLayers(image, archive); err != nil {
+		return err
+	}
+	_, err = a.imageManager.AddImageFromArchive(image.Id, image.Name, image.Digest, image.Signature, archive)
+	if err == nil || errors.Is(err, errs.ErrConflict) {
+		return nil
+	}
+	if errors.Is(err, errs.ErrSignatureInvalid) {
+		return err
+	}
+
+	reused := false
+	for _, entry := range archive.Entries {
+		reused = reused || entry.Present
+		entry.Present = false
+	}
+	if !reused {
+		return fmt.Errorf("failed to add image to the ImageManager: %v", err)
+	}
+
+	// docker didn't reuse the present layers, e.g. they were removed in the meantime
+	log.Warn().Err(err).Msgf("Failed to load image with present layers, downloading all layers: imageID=%s", image.Id)
+	if err := a.downloadLayers(image, archive); err != nil {
+		return err
+	}
+	if _, err := a.imageManager.AddImageFromArchive(image.Id, image.Name, image.Digest, image.Signature, archive); err != nil && !errors.Is(err, errs.ErrConflict) {
+		return fmt.Errorf("failed to add image to the ImageManager: %v", err)
+	}
+	return nil
+}
+
+// downloadLayers downloads the layers of the archive that aren't present on the agent.
+func (a *AgentApp) downloadLayers(image *pb.ImageInfo, archive *pb.ImageArchive) error {
+	var downloaded, skipped int
+	for _, entry := range archive.Entries {
+		if entry.Digest == "" {
+			continue
+		}
+		if entry.Present {
+			skipped++
+			continue
+		}
+		if err := a.downloadData(image.Id, entry.Digest, entry.Size); err != nil {
+			return fmt.Errorf("failed to download layer: digest=%s: %v", entry.Digest, err)
+		}
+		downloaded++
+	}
+	log.Info().Msgf("Image layers received: imageID=%s, downloaded=%d, skipped=%d", image.Id, downloaded, skipped)
+	return nil
+}
+
+func (a *AgentApp) downloadWholeImage(image *pb.ImageInfo) error {
+	if err := a.downloadData(image.Id, image.Digest, image.Size); err != nil {
+		return err
+	}
+
+	log.Info().Msgf("Image successfully received: imageID=%s, imageName=%s, digest=%s", image.Id, image.Name, image.Digest)
+	if _, err := a.imageManager.AddImageWithID(image.Id, image.Name, image.Digest, image.Signature); err != nil && !errors.Is(err, errs.ErrConflict) {
+		return fmt.Errorf("failed to add image to the ImageManager: %v", err)
+	}
+	return nil
+}
+
+// downloadData pulls the image data of the given digest, the whole tarball or one of its layers,
+// to disk. An interrupted transfer is resumed from the data already written, the data is
+// committed once its digest was verified.
+func (a *AgentApp) downloadData(imageID, digest string, size int64) error {
+	if a.imageManager.ImageDataExists(digest) {
+		return nil // committed by an earlier attempt
+	}
+
+	partial, err := a.imageManager.OpenPartialImage(digest)
+	if err != nil {
+		return fmt.Errorf("failed to open partial image: %v", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := a.receiveImageData(imageID, digest, size, partial)
+		if err == nil {
+			break
+		}
+		if attempt >= constants.AgentImageDownloadRetries {
+			partial.Close() // keep received data for the next reconciliation
+			return fmt.Errorf("failed to receive data after %d attempts: %v", attempt, err)
+		}
+		log.Warn().Err(err).Msgf("Image download interrupted: imageID=%s, digest=%s, offset=%d, attempt=%d", imageID, digest, partial.Offset(), attempt)
+		time.Sleep(constants.AgentImageDownloadRetryDelay)
+	}
+
+	if err := partial.Commit(); err != nil {
+		return fmt.Errorf("failed to verify image data: %v", err)
+	}
+	return nil
+}
+
+// receiveImageData streams the image data from the current offset of the partial data.
+func (a *AgentApp) receiveImageData(imageID, digest string, size int64, partial *blobstore.PartialBlob) error {
+	if partial.Offset() >= size {
+		return nil
+	}
+	log.Debug().Msgf("Requesting image data: imageID=%s, digest=%s, offset=%d, size=%d", imageID, digest, partial.Offset(), size)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := a.setupServiceClient.ImageDataRequest(ctx, &pb.ImageChunkRequest{
+		Id:     imageID,
+		Digest: digest,
+		Offset: partial.Offset(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start stream: %v", err)
+	}
+
+	for {
+		chunk, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				if partial.Offset() < size {
+					return fmt.Errorf("stream ended at offset %d of %d", partial.Offset(), size)
+				}
+				return nil
+			}
+			return fmt.Errorf("failed to receive data: %v", err)
+		}
+		if err := partial.Append(chunk.Offset, chunk.Content); err != nil {
+			return err
+		}
+	}
+}
+
+// moduleEnv returns the agent's configuration extended with the module configuration, secrets are
+// still referenced by name.
+func (a *AgentApp) moduleEnv(cfg *pb.ModuleConfiguration) map[string]string {
+	moduleCfg := maps.Clone(a.configManager.GetConfiguration())
+	for k, v := range cfg.Env {
+		moduleCfg[k] = v
+	}
+	return moduleCfg
+}
+
+// runsModuleSpec reports whether the module already runs the image, configuration, secrets and
+// container options.
+func (a *AgentApp) runsModuleSpec(module *manager.Module, cfg *pb.ModuleConfiguration) bool {
+	image, err := a.imageManager.GetImage(cfg.Image.Id)
+	if err != nil {
+		return false
+	}
+	return module.RunsSpec(image.GetReference(), a.moduleEnv(cfg), cfg.Secrets, manager.ModuleResourcesFromProto(cfg.Resources), manager.ModuleSecurityFromProto(cfg.Security), manager.ModuleStorageFromProto(cfg.Storage))
+}
+
+func (a *AgentApp) startModule(cfg *pb.ModuleConfiguration) error {
+	moduleID := cfg.Module.Id
+	imageID := cfg.Image.Id
+	moduleCfg := a.moduleEnv(cfg)
+
+	image, err := a.imageManager.GetImage(imageID)
+	if err != nil {
+		return fmt.Errorf("failed to get image, imageID=%s: %v", imageID, err)
+	}
+	imageRef := image.GetReference()
+
+	log.Info().Msgf("Starting module moduleID=%s, revision=%d, imageID=%s, moduleCfg=%v", moduleID, cfg.Revision, imageID, moduleCfg)
+
+	if err := a.webhookManager.AddModule(moduleID); err != nil {
+		return fmt.Errorf("failed to add module to webhook manager: %v", err)
+	}
+
+	resources := manager.ModuleResourcesFromProto(cfg.Resources)
+	security := manager.ModuleSecurityFromProto(cfg.Security)
+	storage := manager.ModuleStorageFromProto(cfg.Storage)
+	if _, err := a.moduleManager.StartModule(moduleID, int(cfg.Revision), imageRef, moduleCfg, cfg.Secrets, resources, security, storage, manager.RestartPolicyFromProto(cfg.RestartPolicy)); err != nil {
+		return fmt.Errorf("failed to start module: %v", err)
+	}
+	return nil
+}
+
+func (a *AgentApp) stopModule(moduleID string) error {
+	if err := a.moduleManager.StopModule(moduleID); err != nil {
+		return fmt.Errorf("failed to stop module: %v", err)
+	}
+	if err := a.webhookManager.RemoveModule(moduleID); err != nil && !errors.Is(err, errs.ErrNotFound) {
+		return fmt.Errorf("failed to remove module from webhook manager: %v", err)
+	}
+	a.topicManager.RemoveModule(moduleID)
+	return nil
+}
@@ -1,10 +1,14 @@
 package dto
 
+import "time"
+
 type ControllerPushBlobRequest struct {
 	SourceModuleID   string
 	ReceiverModuleID string
 	Blob             []byte
+	TTL              time.Duration
 }
 
 type ControllerPushBlobResponse struct {
+	ID string
 }
@@ -1,5 +1,10 @@
 package dto
 
+import (
+	"io"
+	"time"
+)
+
 type ListEndpointsRequest struct {
 	SourceModuleID string
 }
@@ -17,7 +22,39 @@ type EndpointPushBlobRequest struct {
 	ReceiverIdentityID string
 	ReceiverModuleID   string
 	Blob               []byte
+	TTL                time.Duration
 }
 
 type EndpointPushBlobResponse struct {
+	ID string
+}
+
+type EndpointPushStreamRequest struct {
+	SourceModuleID     string
+	ReceiverIdentityID string
+	ReceiverModuleID   string
+	Body               io.Reader
+}
+
+type EndpointPushStreamResponse struct {
+	ID         string
+	Size       int64
+	Delivered  bool
+	Recipients []DeliveryRecipient
+}
+
+type EndpointCallRequest struct {
+	SourceModuleID     string
+	ReceiverIdentityID string
+	ReceiverModuleID   string
+	Blob               []byte
+	Timeout            time.Duration
+}
+
+type EndpointCallResponse struct {
+	ID         string
+	Reply      []byte
+	Delivered  bool
+	TimedOut   bool
+	Recipients []DeliveryRecipient
 }
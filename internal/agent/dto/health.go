@@ -0,0 +1,9 @@
+package dto
+
+type ReportHealthRequest struct {
+	SourceModuleID string
+	Healthy        bool
+}
+
+type ReportHealthResponse struct {
+}
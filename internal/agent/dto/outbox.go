@@ -0,0 +1,30 @@
+package dto
+
+import "time"
+
+type GetOutboxMessageRequest struct {
+	SourceModuleID string
+	ID             string
+}
+
+type GetOutboxMessageResponse struct {
+	ID                 string
+	Destination        string
+	ReceiverIdentityID string
+	ReceiverModuleID   string
+	Topic              string
+	Status             string
+	Attempts           int
+	LastError          string
+	CreatedAt          time.Time
+	ExpiresAt          time.Time
+	FinishedAt         time.Time
+	Recipients         []DeliveryRecipient
+}
+
+type DeliveryRecipient struct {
+	IdentityID string
+	ModuleID   string
+	Outcome    string
+	Error      string
+}
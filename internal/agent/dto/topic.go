@@ -0,0 +1,38 @@
+package dto
+
+import "time"
+
+type SubscribeTopicRequest struct {
+	SourceModuleID string
+	Topic          string
+}
+
+type SubscribeTopicResponse struct {
+}
+
+type UnsubscribeTopicRequest struct {
+	SourceModuleID string
+	Topic          string
+}
+
+type UnsubscribeTopicResponse struct {
+}
+
+type ListTopicsRequest struct {
+	SourceModuleID string
+}
+
+type ListTopicsResponse struct {
+	Topics []string
+}
+
+type PublishTopicRequest struct {
+	SourceModuleID string
+	Topic          string
+	Blob           []byte
+	TTL            time.Duration
+}
+
+type PublishTopicResponse struct {
+	ID string
+}
@@ -7,6 +7,13 @@ type WebhookEvent string
 const (
 	EventControllerData WebhookEvent = "CONTROLLER_DATA"
 	EventEndpointData   WebhookEvent = "ENDPOINT_DATA"
+	// EventEndpointCall webhooks answer calls of other endpoints, the response body is returned
+	// to the caller
+	EventEndpointCall WebhookEvent = "ENDPOINT_CALL"
+	// EventTopicData webhooks receive the data published to the topics the module subscribed to
+	EventTopicData WebhookEvent = "TOPIC_DATA"
+	// EventEndpointStream webhooks receive streams of other endpoints as a raw request body
+	EventEndpointStream WebhookEvent = "ENDPOINT_STREAM"
 )
 
 func ParseWebhookEvent(eventStr string) (WebhookEvent, error) {
@@ -15,6 +22,12 @@ func ParseWebhookEvent(eventStr string) (WebhookEvent, error) {
 		return EventControllerData, nil
 	case string(EventEndpointData):
 		return EventEndpointData, nil
+	case string(EventEndpointCall):
+		return EventEndpointCall, nil
+	case string(EventTopicData):
+		return EventTopicData, nil
+	case string(EventEndpointStream):
+		return EventEndpointStream, nil
 	default:
 		return "", errors.New("invalid event")
 	}
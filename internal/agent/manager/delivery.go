@@ -0,0 +1,47 @@
+package manager
+
+import (
+	"github.com/pajtaand/dmap-zero/internal/common/delivery"
+	pb "github.com/pajtaand/dmap-zero/internal/proto"
+)
+
+type DeliveryOutcome = delivery.Outcome
+
+const (
+	DeliveryOutcomePending       = delivery.OutcomePending
+	DeliveryOutcomeDelivered     = delivery.OutcomeDelivered
+	DeliveryOutcomeWebhookFailed = delivery.OutcomeWebhookFailed
+	DeliveryOutcomeNoSubscriber  = delivery.OutcomeNoSubscriber
+	DeliveryOutcomeUnconfirmed   = delivery.OutcomeUnconfirmed
+	DeliveryOutcomeExpired       = delivery.OutcomeExpired
+	DeliveryOutcomeUnreachable   = delivery.OutcomeUnreachable
+)
+
+// DeliveryRecipient is the outcome of a message for one receiver module. The identity is the agent
+// the module runs on, or the controller for the receivers registered there.
+type DeliveryRecipient struct {
+	IdentityID string          `json:"identityID,omitempty"`
+	ModuleID   string          `json:"moduleID,omitempty"`
+	Outcome    DeliveryOutcome `json:"outcome"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// DeliveryResult returns the result reported back to the sender for the module. An error wrapping
+// ErrNotFound means the module isn't running or registered no webhook for the data.
+func DeliveryResult(moduleID string, err error) *pb.DeliveryResult {
+	return delivery.ResultOf(moduleID, err).Proto()
+}
+
+// DeliveryRecipients converts the results reported by the receiving side, see delivery.Results.
+func DeliveryRecipients(identityID, receiverModuleID string, report *pb.DeliveryReport) []DeliveryRecipient {
+	recipients := []DeliveryRecipient{}
+	for _, result := range delivery.Results(receiverModuleID, report) {
+		recipients = append(recipients, DeliveryRecipient{
+			IdentityID: identityID,
+			ModuleID:   result.ModuleID,
+			Outcome:    result.Outcome,
+			Error:      result.Error,
+		})
+	}
+	return recipients
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 
 	"github.com/openziti/sdk-golang/ziti"
 	"github.com/pajtaand/dmap-zero/internal/common/constants"
@@ -39,30 +40,160 @@ func (mgr *EndpointManager) ListEndpoints() ([]string, error) {
 	return identityIDs, nil
 }
 
-func (mgr *EndpointManager) SendData(ctx context.Context, identityID, moduleID string, data []byte) error {
-	log.Info().Msgf("Sending data to endpoint: identityID=%s, moduleID=%s", identityID, moduleID)
+// SendData delivers the data to the module on the other agent and returns the outcome reported
+// by the other agent.
+func (mgr *EndpointManager) SendData(ctx context.Context, identityID, moduleID, messageID string, data []byte) ([]DeliveryRecipient, error) {
+	log.Info().Msgf("Sending data to endpoint: identityID=%s, moduleID=%s, messageID=%s", identityID, moduleID, messageID)
 
-	conn, err := grpc.NewClient(
-		fmt.Sprintf("passthrough:///%s", constants.OpenZitiServiceP2P),
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithContextDialer(mgr.openZitiWrapper.GetContextDialerWithOptions(&ziti.DialOptions{
-			Identity: identityID,
-		})),
-	)
+	conn, err := mgr.dial(identityID)
 	if err != nil {
-		return fmt.Errorf("failed to connect to other agent: %v", err)
+		return nil, err
 	}
 	defer conn.Close()
 
 	c := pb.NewShareServiceClient(conn)
-	if _, err = c.PushData(ctx, &pb.ShareData{
+	report, err := c.PushData(ctx, &pb.ShareData{
 		Receiver: &pb.ModuleIdentifier{
 			Id: moduleID,
 		},
-		Data: data,
-	}); err != nil {
-		return fmt.Errorf("failed to send data to other agent: %v", err)
+		Data:      data,
+		MessageId: messageID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send data to other agent: %v", err)
 	}
 
-	return nil
+	return DeliveryRecipients(identityID, moduleID, report), nil
+}
+
+// Call delivers the data to the module on the other agent and returns the reply of the module
+// with the outcome reported by the other agent, the reply is empty unless the module got the data.
+// It returns an error wrapping context.DeadlineExceeded when the reply doesn't arrive in time.
+func (mgr *EndpointManager) Call(ctx context.Context, identityID, moduleID, messageID string, data []byte) ([]byte, []DeliveryRecipient, error) {
+	log.Info().Msgf("Calling endpoint: identityID=%s, moduleID=%s, messageID=%s", identityID, moduleID, messageID)
+
+	conn, err := mgr.dial(identityID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+
+	c := pb.NewShareServiceClient(conn)
+	reply, err := c.Call(ctx, &pb.ShareData{
+		Receiver: &pb.ModuleIdentifier{
+			Id: moduleID,
+		},
+		Data:      data,
+		MessageId: messageID,
+	})
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, nil, fmt.Errorf("%w: no reply from other agent", context.DeadlineExceeded)
+		}
+		return nil, nil, fmt.Errorf("failed to call other agent: %v", err)
+	}
+
+	// agents which don't report the outcome of calls fail them instead, so a reply is a delivery
+	result := reply.Result
+	if result == nil {
+		result = DeliveryResult(moduleID, nil)
+	}
+	return reply.Data, DeliveryRecipients(identityID, moduleID, &pb.DeliveryReport{Results: []*pb.DeliveryResult{result}}), nil
+}
+
+// Publish delivers the data published to the topic to the subscribed modules on the other agent
+// and returns the outcome for each of them.
+func (mgr *EndpointManager) Publish(ctx context.Context, identityID, messageID, topic, senderModuleID string, data []byte) ([]DeliveryRecipient, error) {
+	log.Info().Msgf("Publishing to endpoint: identityID=%s, messageID=%s, topic=%s", identityID, messageID, topic)
+
+	conn, err := mgr.dial(identityID)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	c := pb.NewShareServiceClient(conn)
+	report, err := c.Publish(ctx, &pb.TopicData{
+		Topic: topic,
+		Sender: &pb.ModuleIdentifier{
+			Id: senderModuleID,
+		},
+		Data:      data,
+		MessageId: messageID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish data to other agent: %v", err)
+	}
+
+	return DeliveryRecipients(identityID, "", report), nil
+}
+
+// SendStream streams the body to the module on the other agent in chunks and returns the number
+// of bytes sent with the outcome reported by the other agent.
+func (mgr *EndpointManager) SendStream(ctx context.Context, identityID, moduleID, messageID string, body io.Reader) (int64, []DeliveryRecipient, error) {
+	log.Info().Msgf("Streaming data to endpoint: identityID=%s, moduleID=%s, messageID=%s", identityID, moduleID, messageID)
+
+	conn, err := mgr.dial(identityID)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer conn.Close()
+
+	c := pb.NewShareServiceClient(conn)
+	stream, err := c.PushStream(ctx)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to open stream to other agent: %v", err)
+	}
+
+	// the receiver is sent with the first chunk, even when the body is empty
+	var size int64
+	buf := make([]byte, constants.AgentDataStreamChunkSize)
+	for first := true; ; first = false {
+		n, readErr := io.ReadFull(body, buf)
+		if n > 0 || first {
+			chunk := &pb.ShareStreamData{
+				Data: buf[:n],
+			}
+			if first {
+				chunk.Receiver = &pb.ModuleIdentifier{
+					Id: moduleID,
+				}
+				chunk.MessageId = messageID
+			}
+			if err := stream.Send(chunk); err != nil {
+				if errors.Is(err, io.EOF) {
+					// the other agent ended the stream, its outcome is returned on close
+					break
+				}
+				return size, nil, fmt.Errorf("failed to stream data to other agent: %v", err)
+			}
+			size += int64(n)
+		}
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			return size, nil, fmt.Errorf("failed to read data: %v", readErr)
+		}
+	}
+
+	report, err := stream.CloseAndRecv()
+	if err != nil {
+		return size, nil, fmt.Errorf("failed to stream data to other agent: %v", err)
+	}
+	return size, DeliveryRecipients(identityID, moduleID, report), nil
+}
+
+func (mgr *EndpointManager) dial(identityID string) (*grpc.ClientConn, error) {
+	conn, err := grpc.NewClient(
+		fmt.Sprintf("passthrough:///%s", constants.OpenZitiServiceP2P),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(mgr.openZitiWrapper.GetContextDialerWithOptions(&ziti.DialOptions{
+			Identity: identityID,
+		})),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to other agent: %v", err)
+	}
+	return conn, nil
 }
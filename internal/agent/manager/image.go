@@ -1,15 +1,21 @@
 package manager
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"sync"
 
 	"github.com/google/uuid"
-	"github.com/pajtaand/dmap-zero/internal/common/database"
+	"github.com/pajtaand/dmap-zero/internal/common/blobstore"
 	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	"github.com/pajtaand/dmap-zero/internal/common/signing"
+	"github.com/pajtaand/dmap-zero/internal/common/utils"
 	"github.com/pajtaand/dmap-zero/internal/common/wrapper"
+	pb "github.com/pajtaand/dmap-zero/internal/proto"
 	"github.com/rs/zerolog/log"
 )
 
@@ -17,29 +23,20 @@ type Image struct {
 	id        string
 	name      string
 	reference string
-	filename  string
+	digest    string
 	size      int
 
-	mu       sync.RWMutex
-	database *database.KVStore // TODO use interface and accept whatever
+	mu sync.RWMutex
 }
 
-func NewImage(id, name, reference string, data []byte, database *database.KVStore) (*Image, error) {
-	if database == nil {
-		return nil, errors.New("database must not be nil")
-	}
-
-	fileName := fmt.Sprintf("img_%s", uuid.New().String())
-	database.Set(fileName, data)
-
+func NewImage(id, name, reference, digest string, size int) *Image {
 	return &Image{
 		id:        id,
 		name:      name,
 		reference: reference,
-		filename:  fileName,
-		size:      len(data),
-		database:  database,
-	}, nil
+		digest:    digest,
+		size:      size,
+	}
 }
 
 func (i *Image) GetID() string {
@@ -60,21 +57,10 @@ func (i *Image) GetReference() string {
 	return i.reference
 }
 
-func (i *Image) GetData() ([]byte, error) {
+func (i *Image) GetDigest() string {
 	i.mu.RLock()
-	fileName := i.filename
-	i.mu.RUnlock()
-
-	val, ok := i.database.Get(fileName)
-	if !ok {
-		return nil, fmt.Errorf("no file in database: fileName=%s", fileName)
-	}
-
-	data, ok := val.([]byte)
-	if !ok {
-		return nil, fmt.Errorf("failed to parse image to bytes: fileName=%s", fileName)
-	}
-	return data, nil
+	defer i.mu.RUnlock()
+	return i.digest
 }
 
 func (i *Image) GetSize() int {
@@ -83,81 +69,299 @@ func (i *Image) GetSize() int {
 	return i.size
 }
 
-func (i *Image) Cleanup() {
-	i.mu.RLock()
-	fileName := i.filename
-	i.mu.RUnlock()
-
-	i.database.Delete(fileName)
+type rejection struct {
+	signature []byte
+	reason    string
 }
 
+// ImageManager keeps track of the images loaded to docker. Image tarballs are transferred into
+// the blob store first and removed from it once docker loaded them. With a verifier, only images
+// signed by a trusted key are loaded.
 type ImageManager struct {
 	mu            sync.RWMutex
 	images        map[string]*Image
+	rejected      map[string]*rejection
 	dockerWrapper *wrapper.DockerClientWrapper
-	database      *database.KVStore // TODO use interface and accept whatever
+	blobStore     *blobstore.BlobStore
+	verifier      *signing.Verifier
 }
 
-func NewImageManager(dockerWrapper *wrapper.DockerClientWrapper, database *database.KVStore) (*ImageManager, error) {
+// NewImageManager creates an ImageManager, image signatures aren't verified when the verifier
+// is nil.
+func NewImageManager(dockerWrapper *wrapper.DockerClientWrapper, blobStore *blobstore.BlobStore, verifier *signing.Verifier) (*ImageManager, error) {
 	log.Debug().Msg("Creating new ImageManager")
 
 	if dockerWrapper == nil {
 		return nil, errors.New("DockerClientWrapper must not be nil")
 	}
-	if database == nil {
-		return nil, errors.New("database must not be nil")
+	if blobStore == nil {
+		return nil, errors.New("BlobStore must not be nil")
 	}
 
 	return &ImageManager{
 		images:        map[string]*Image{},
+		rejected:      map[string]*rejection{},
 		dockerWrapper: dockerWrapper,
-		database:      database,
+		blobStore:     blobStore,
+		verifier:      verifier,
 	}, nil
 }
 
-func (mgr *ImageManager) AddImage(name string, data []byte) (*Image, error) {
+// verify checks the image signature against the trust root. Rejected images are remembered, so
+// they're reported to the controller and not transferred again until their signature changes.
+func (mgr *ImageManager) verify(id string, signature []byte, configDigests func() ([]string, error)) error {
+	if mgr.verifier == nil {
+		return nil
+	}
+
+	digests, err := configDigests()
+	if err != nil {
+		err = fmt.Errorf("%w: %v", errs.ErrSignatureInvalid, err)
+	} else {
+		err = mgr.verifier.VerifyImage(digests, signature)
+	}
+	if err != nil {
+		log.Warn().Err(err).Msgf("Rejecting image: imageID=%s", id)
+		mgr.mu.Lock()
+		defer mgr.mu.Unlock()
+		mgr.rejected[id] = &rejection{
+			signature: signature,
+			reason:    err.Error(),
+		}
+		return err
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	delete(mgr.rejected, id)
+	return nil
+}
+
+// VerifyArchive checks the image signature against the configurations of the archive, before
+// any layer is transferred. Archives with duplicate entries are rejected.
+func (mgr *ImageManager) VerifyArchive(id string, signature []byte, archive *pb.ImageArchive) error {
+	return mgr.verify(id, signature, func() ([]string, error) {
+		if err := signing.CheckEntryNames(archiveEntryNames(archive)); err != nil {
+			return nil, err
+		}
+		return signing.ConfigDigests(func(name string) ([]byte, error) {
+			for _, entry := range archive.Entries {
+				if entry.Name == name && entry.Digest == "" && byte(entry.Type) == tar.TypeReg {
+					return entry.Content, nil
+				}
+			}
+			return nil, fmt.Errorf("file not found in archive: %s", name)
+		})
+	})
+}
+
+// IsRejected reports whether the image was rejected with the given signature.
+func (mgr *ImageManager) IsRejected(id string, signature []byte) bool {
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+	r, ok := mgr.rejected[id]
+	return ok && bytes.Equal(r.signature, signature)
+}
+
+// RejectedImages returns the reasons of the rejected images by image ID.
+func (mgr *ImageManager) RejectedImages() map[string]string {
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+	reasons := map[string]string{}
+	for id, r := range mgr.rejected {
+		reasons[id] = r.reason
+	}
+	return reasons
+}
+
+// ForgetRejection drops the rejection of an image the controller no longer distributes.
+func (mgr *ImageManager) ForgetRejection(id string) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	delete(mgr.rejected, id)
+}
+
+// OpenPartialImage opens the partially transferred tarball of the given digest, the transfer
+// continues from its Offset.
+func (mgr *ImageManager) OpenPartialImage(digest string) (*blobstore.PartialBlob, error) {
+	return mgr.blobStore.OpenPartial(digest)
+}
+
+// ImageDataExists reports whether verified data of the given digest is stored.
+func (mgr *ImageManager) ImageDataExists(digest string) bool {
+	return mgr.blobStore.Exists(digest)
+}
+
+func (mgr *ImageManager) AddImage(name string, src io.Reader, signature []byte) (*Image, error) {
 	log.Info().Msgf("Adding new image: %s", name)
 
-	reference, err := mgr.dockerWrapper.LoadImage(context.Background(), data)
+	digest, _, err := mgr.blobStore.Put(src)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load image to docker: %v", err)
+		return nil, fmt.Errorf("failed to store image data: %v", err)
+	}
+	return mgr.AddImageWithID(uuid.New().String(), name, digest, signature)
+}
+
+// AddImageWithID verifies and loads the committed tarball of the given digest to docker.
+func (mgr *ImageManager) AddImageWithID(id, name, digest string, signature []byte) (*Image, error) {
+	log.Info().Msgf("Adding new image with id: %s (%s), digest=%s", name, id, digest)
+
+	if mgr.ImageExists(id) {
+		return nil, errs.ErrConflict
+	}
+
+	f, err := mgr.blobStore.Open(digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image data: %v", err)
 	}
+	defer mgr.blobStore.Delete(digest)
+	defer f.Close()
 
-	imageID := uuid.New().String()
-	image, err := NewImage(imageID, name, reference, data, mgr.database)
+	info, err := f.Stat()
 	if err != nil {
-		return nil, fmt.Errorf("failed to add new image: %v", err)
+		return nil, fmt.Errorf("failed to stat image data: %v", err)
+	}
+
+	if err := mgr.verify(id, signature, func() ([]string, error) {
+		return signing.TarballConfigDigests(f)
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read image data: %v", err)
 	}
 
+	reference, err := mgr.dockerWrapper.LoadImage(context.Background(), f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load image to docker: %v", err)
+	}
+
+	image := NewImage(id, name, reference, digest, int(info.Size()))
+
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
-	mgr.images[imageID] = image
-	return image, err
+	mgr.images[id] = image
+	return image, nil
 }
 
-func (mgr *ImageManager) AddImageWithID(id, name string, data []byte) (*Image, error) {
-	log.Info().Msgf("Adding new image with id: %s (%s)", name, id)
+// PresentLayers returns the chain IDs of all layers of the images present in docker.
+func (mgr *ImageManager) PresentLayers() ([]string, error) {
+	ctx := context.Background()
+	summaries, err := mgr.dockerWrapper.ListImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	present := map[string]bool{}
+	for _, summary := range summaries {
+		info, err := mgr.dockerWrapper.InspectImage(ctx, summary.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, chainID := range utils.LayerChainIDs(info.RootFS.Layers) {
+			present[chainID] = true
+		}
+	}
+
+	chainIDs := []string{}
+	for chainID := range present {
+		chainIDs = append(chainIDs, chainID)
+	}
+	return chainIDs, nil
+}
+
+// AddImageFromArchive reassembles the image tarball from the archive entries and the committed
+// layer blobs, and loads it to docker once its signature was verified. Layers present in docker
+// are written empty, docker doesn't read them as it already has them. The layer blobs are
+// removed once the image was loaded.
+func (mgr *ImageManager) AddImageFromArchive(id, name, digest string, signature []byte, archive *pb.ImageArchive) (*Image, error) {
+	log.Info().Msgf("Adding new image from archive: %s (%s), digest=%s", name, id, digest)
 
 	if mgr.ImageExists(id) {
 		return nil, errs.ErrConflict
 	}
+	if err := mgr.VerifyArchive(id, signature, archive); err != nil {
+		return nil, err
+	}
 
-	reference, err := mgr.dockerWrapper.LoadImage(context.Background(), data)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(mgr.writeArchive(pw, archive))
+	}()
+
+	reference, err := mgr.dockerWrapper.LoadImage(context.Background(), pr)
+	pr.Close()
 	if err != nil {
 		return nil, fmt.Errorf("failed to load image to docker: %v", err)
 	}
 
-	image, err := NewImage(id, name, reference, data, mgr.database)
-	if err != nil {
-		return nil, fmt.Errorf("failed to add new image: %v", err)
+	size := 0
+	for _, entry := range archive.Entries {
+		size += int(entry.Size)
+		if entry.Digest != "" {
+			mgr.blobStore.Delete(entry.Digest)
+		}
 	}
 
+	image := NewImage(id, name, reference, digest, size)
+
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
 	mgr.images[id] = image
 	return image, nil
 }
 
+func (mgr *ImageManager) writeArchive(w io.Writer, archive *pb.ImageArchive) error {
+	if err := signing.CheckEntryNames(archiveEntryNames(archive)); err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	for _, entry := range archive.Entries {
+		header := &tar.Header{
+			Name:     entry.Name,
+			Typeflag: byte(entry.Type),
+			Mode:     entry.Mode,
+			Size:     entry.Size,
+			Linkname: entry.Linkname,
+		}
+		if entry.Present || header.Typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write archive entry: name=%s: %v", entry.Name, err)
+		}
+		if header.Size == 0 {
+			continue
+		}
+
+		if entry.Digest == "" {
+			if _, err := tw.Write(entry.Content); err != nil {
+				return fmt.Errorf("failed to write archive entry: name=%s: %v", entry.Name, err)
+			}
+			continue
+		}
+		f, err := mgr.blobStore.Open(entry.Digest)
+		if err != nil {
+			return fmt.Errorf("failed to open layer: digest=%s: %v", entry.Digest, err)
+		}
+		_, err = io.Copy(tw, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write archive entry: name=%s: %v", entry.Name, err)
+		}
+	}
+	return tw.Close()
+}
+
+func archiveEntryNames(archive *pb.ImageArchive) []string {
+	names := make([]string, 0, len(archive.Entries))
+	for _, entry := range archive.Entries {
+		names = append(names, entry.Name)
+	}
+	return names
+}
+
 func (mgr *ImageManager) GetImage(imageID string) (*Image, error) {
 	log.Info().Msgf("Getting image: %s", imageID)
 
@@ -199,8 +403,6 @@ func (mgr *ImageManager) RemoveImage(imageID string) error {
 		return fmt.Errorf("faile dto remove docker image: %v", err)
 	}
 
-	image.Cleanup()
-
 	delete(mgr.images, imageID)
 	return nil
 }
@@ -5,40 +5,88 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
 	"strconv"
 	"sync"
+	"time"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
 	"github.com/google/uuid"
 	"github.com/pajtaand/dmap-zero/internal/common/constants"
 	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
 	mm "github.com/pajtaand/dmap-zero/internal/common/manager"
+	"github.com/pajtaand/dmap-zero/internal/common/secrets"
 	"github.com/pajtaand/dmap-zero/internal/common/utils"
 	"github.com/pajtaand/dmap-zero/internal/common/wrapper"
+	pb "github.com/pajtaand/dmap-zero/internal/proto"
 	"github.com/rs/zerolog/log"
 )
 
 type Module struct {
 	id            string
+	revision      int
 	imageRef      string
 	containerID   string
-	configuration map[string]string
+	network       string            // isolated network of the module, empty with host networking
+	gateway       string            // gateway of the network, the module API is bound on it
+	configuration map[string]string // with secret references, the secrets are only in the container
+	secretsDigest string
+	secretsDir    string // secret files mounted into the container, empty without them
+	resources     *ModuleResources
+	security      *ModuleSecurity
+	storage       *ModuleStorage
 	givenPort     string
 
+	// restart supervision state
+	restartPolicy       *RestartPolicy
+	restartCount        int
+	consecutiveFailures int
+	nextRestart         time.Time
+	crashLoop           bool
+
+	// liveness reported by the module itself through the module REST API
+	livenessReported bool
+	livenessHealthy  bool
+	livenessTime     time.Time
+
 	mu sync.RWMutex
 }
 
-func NewModule(id, imageRef, containerID string, configuration map[string]string, givenPort string) *Module {
+func NewModule(id string, revision int, imageRef, containerID, network string, configuration map[string]string, secretsDigest string, resources *ModuleResources, security *ModuleSecurity, storage *ModuleStorage, givenPort string, restartPolicy *RestartPolicy) *Module {
 	if configuration == nil {
 		configuration = map[string]string{}
 	}
+	if resources == nil {
+		resources = ModuleResourcesFromProto(nil)
+	}
+	if security == nil {
+		security = ModuleSecurityFromProto(nil)
+	}
+	if storage == nil {
+		storage = ModuleStorageFromProto(nil)
+	}
+	if restartPolicy == nil {
+		restartPolicy = NewRestartPolicyNever()
+	}
 
 	return &Module{
 		id:            id,
+		revision:      revision,
 		imageRef:      imageRef,
 		containerID:   containerID,
+		network:       network,
 		configuration: configuration,
+		secretsDigest: secretsDigest,
+		resources:     resources,
+		security:      security,
+		storage:       storage,
 		givenPort:     givenPort,
+		restartPolicy: restartPolicy,
 	}
 }
 
@@ -48,6 +96,42 @@ func (m *Module) GetID() string {
 	return m.id
 }
 
+// GetRevision returns the module revision the container was started with.
+func (m *Module) GetRevision() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.revision
+}
+
+// SetRevision relabels the running container with another revision of the same image and
+// configuration, e.g. when only the placement of the module changed.
+func (m *Module) SetRevision(revision int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revision = revision
+}
+
+// RunsSpec reports whether the container runs the image with the configuration, secrets and
+// container options.
+func (m *Module) RunsSpec(imageRef string, configuration map[string]string, secretValues map[string][]byte, resources *ModuleResources, security *ModuleSecurity, storage *ModuleStorage) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.imageRef == imageRef &&
+		maps.Equal(m.configuration, configuration) &&
+		m.secretsDigest == secrets.Digest(secretValues) &&
+		*m.resources == *resources &&
+		m.security.Equal(security) &&
+		m.storage.Equal(storage)
+}
+
+// HasSecrets reports whether the container got the secret values, secrets rotated on the
+// controller don't change the module revision.
+func (m *Module) HasSecrets(secretValues map[string][]byte) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.secretsDigest == secrets.Digest(secretValues)
+}
+
 func (m *Module) GetImageReference() string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -60,30 +144,123 @@ func (m *Module) GetContainerID() string {
 	return m.containerID
 }
 
+func (m *Module) GetNetwork() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.network
+}
+
 func (m *Module) GetConfiguration() map[string]string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	return m.configuration
 }
 
+func (m *Module) GetResources() *ModuleResources {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.resources
+}
+
+func (m *Module) GetSecurity() *ModuleSecurity {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.security
+}
+
+func (m *Module) GetStorage() *ModuleStorage {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.storage
+}
+
 func (m *Module) GetGivenPort() string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	return m.givenPort
 }
 
+func (m *Module) GetRestartPolicy() *RestartPolicy {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.restartPolicy
+}
+
+func (m *Module) SetRestartPolicy(restartPolicy *RestartPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if restartPolicy == nil {
+		restartPolicy = NewRestartPolicyNever()
+	}
+	m.restartPolicy = restartPolicy
+}
+
+func (m *Module) GetRestartCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.restartCount
+}
+
+func (m *Module) IsCrashLooping() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.crashLoop
+}
+
+func (m *Module) ReportLiveness(healthy bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.livenessReported = true
+	m.livenessHealthy = healthy
+	m.livenessTime = time.Now()
+}
+
+// isLive reports whether the module considers itself healthy. Modules that never reported
+// their liveness are considered live.
+func (m *Module) isLive() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.livenessReported {
+		return true
+	}
+	return m.livenessHealthy && time.Since(m.livenessTime) < constants.AgentModuleLivenessTimeout
+}
+
+// ModuleAPIBinder serves the module API on additional addresses.
+type ModuleAPIBinder interface {
+	Bind(addr string) error
+	Unbind(addr string) error
+}
+
+type moduleRejection struct {
+	revision int
+	reason   string
+}
+
+// ModuleManager runs the module containers. Modules violating the node policy are rejected and
+// reported to the controller until another revision of them is desired.
 type ModuleManager struct {
 	mu            sync.RWMutex
 	modules       map[string]*Module
+	rejected      map[string]*moduleRejection
 	dockerWrapper *wrapper.DockerClientWrapper
 	authStore     *mm.AuthStore
+	policy        *ModulePolicy
+	apiBinder     ModuleAPIBinder
 
-	apiBaseUrl          string
+	apiPort             int
 	moduleServerCertPEM []byte
 	portCounter         int
+	secretsDir          string // host directory shared with the agent, module secret files are written to it
+
+	volumeUsageMu   sync.Mutex
+	volumeUsage     map[string]*pb.ModuleVolumeUsage
+	volumeUsageTime time.Time
 }
 
-func NewModuleManager(dockerWrapper *wrapper.DockerClientWrapper, authStore *mm.AuthStore, moduleServerCertPEM []byte, apiBaseUrl string) (*ModuleManager, error) {
+// NewModuleManager creates a ModuleManager, the default policy is used when the policy is nil.
+// Modules with secret files can only be started when the secrets directory is set.
+func NewModuleManager(dockerWrapper *wrapper.DockerClientWrapper, authStore *mm.AuthStore, policy *ModulePolicy, moduleServerCertPEM []byte, apiPort int, secretsDir string) (*ModuleManager, error) {
 	log.Debug().Msg("Creating new ModuleManager")
 
 	if dockerWrapper == nil {
@@ -95,26 +272,116 @@ func NewModuleManager(dockerWrapper *wrapper.DockerClientWrapper, authStore *mm.
 	if moduleServerCertPEM == nil {
 		return nil, errors.New("moduleServerCertPEM must not be nil")
 	}
-	if apiBaseUrl == "" {
-		return nil, errors.New("apiBaseUrl must be set")
+	if apiPort == 0 {
+		return nil, errors.New("apiPort must be set")
+	}
+	if policy == nil {
+		policy = NewModulePolicyDefault()
 	}
 
 	return &ModuleManager{
 		modules:             map[string]*Module{},
+		rejected:            map[string]*moduleRejection{},
 		dockerWrapper:       dockerWrapper,
 		authStore:           authStore,
+		policy:              policy,
 		portCounter:         constants.ModulePortRangeMin,
-		apiBaseUrl:          apiBaseUrl,
+		apiPort:             apiPort,
 		moduleServerCertPEM: moduleServerCertPEM,
+		secretsDir:          secretsDir,
 	}, nil
 }
 
-func (mgr *ModuleManager) StartModule(id, imageRef string, configuration map[string]string) (*Module, error) {
+// SetAPIBinder sets where the module API is bound on the gateways of module networks, so modules
+// on them reach the API and nothing else on the host.
+func (mgr *ModuleManager) SetAPIBinder(binder ModuleAPIBinder) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	mgr.apiBinder = binder
+}
+
+// CheckPolicy checks the module revision against the node policy. Rejected revisions are
+// remembered, so they're reported to the controller and not checked again.
+func (mgr *ModuleManager) CheckPolicy(id string, revision int, resources *ModuleResources, security *ModuleSecurity, storage *ModuleStorage) error {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	if err := mgr.policy.Check(resources, security, storage); err != nil {
+		log.Warn().Err(err).Msgf("Rejecting module: moduleID=%s, revision=%d", id, revision)
+		mgr.rejected[id] = &moduleRejection{
+			revision: revision,
+			reason:   err.Error(),
+		}
+		return err
+	}
+	delete(mgr.rejected, id)
+	return nil
+}
+
+// CheckRevision checks the module revision against the node policy and the secrets delivered with
+// its configuration. It's checked before the running revision is stopped, so a revision which is
+// rejected or misses its secrets doesn't take the running one down.
+func (mgr *ModuleManager) CheckRevision(id string, revision int, configuration map[string]string, secretValues map[string][]byte, resources *ModuleResources, security *ModuleSecurity, storage *ModuleStorage) error {
+	if err := mgr.CheckPolicy(id, revision, resources, security, storage); err != nil {
+		return fmt.Errorf("module rejected by the agent's policy: %w", err)
+	}
+	if err := CheckSecrets(configuration, storage, secretValues); err != nil {
+		return fmt.Errorf("module secrets are missing: %w", err)
+	}
+	return nil
+}
+
+// IsRejected reports whether the module revision was rejected.
+func (mgr *ModuleManager) IsRejected(id string, revision int) bool {
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+	r, ok := mgr.rejected[id]
+	return ok && r.revision == revision
+}
+
+// RejectedModules returns the rejected revisions by module ID.
+func (mgr *ModuleManager) RejectedModules() map[string]*pb.ModuleRejection {
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+	rejections := map[string]*pb.ModuleRejection{}
+	for id, r := range mgr.rejected {
+		rejections[id] = &pb.ModuleRejection{
+			Revision: int32(r.revision),
+			Reason:   r.reason,
+		}
+	}
+	return rejections
+}
+
+// ForgetRejection drops the rejection of a module the controller no longer places on the agent.
+func (mgr *ModuleManager) ForgetRejection(id string) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	delete(mgr.rejected, id)
+}
+
+// StartModule starts the module container, the secret references in the configuration are
+// replaced with the secret values only in the container's environment.
+func (mgr *ModuleManager) StartModule(id string, revision int, imageRef string, configuration map[string]string, secretValues map[string][]byte, resources *ModuleResources, security *ModuleSecurity, storage *ModuleStorage, restartPolicy *RestartPolicy) (*Module, error) {
 	log.Info().Msgf("Starting module: %s", imageRef)
 
+	if mgr.ModuleExists(id) {
+		return nil, errs.ErrConflict
+	}
+	if err := mgr.CheckPolicy(id, revision, resources, security, storage); err != nil {
+		return nil, err
+	}
+	if err := CheckSecrets(configuration, storage, secretValues); err != nil {
+		return nil, err
+	}
+	env, err := secrets.ResolveEnv(configuration, secretValues)
+	if err != nil {
+		return nil, err
+	}
+
 	// convert configuration map to variable list
 	envCfg := []string{}
-	for k, v := range configuration {
+	for k, v := range env {
 		envCfg = append(envCfg, fmt.Sprintf("%s=%s", k, v))
 	}
 
@@ -133,11 +400,18 @@ func (mgr *ModuleManager) StartModule(id, imageRef string, configuration map[str
 		}
 	}
 
+	// modules on isolated networks reach the agent through their network's gateway
+	apiHost := constants.AgentModuleHostName
+	if security.HostNetwork {
+		apiHost = constants.AgentDockerHostAddress
+	}
+	apiBaseUrl := fmt.Sprintf("https://%s:%d/api/v1", apiHost, mgr.apiPort)
+
 	// generate module api credentials
 	moduleUsername := id
 	modulePassword := uuid.New().String()
 	base64Cert := base64.StdEncoding.EncodeToString(mgr.moduleServerCertPEM)
-	envCfg = append(envCfg, fmt.Sprintf("%s=%s", constants.ModuleEnvAPIBaseUrl, mgr.apiBaseUrl))
+	envCfg = append(envCfg, fmt.Sprintf("%s=%s", constants.ModuleEnvAPIBaseUrl, apiBaseUrl))
 	envCfg = append(envCfg, fmt.Sprintf("%s=%s", constants.ModuleEnvUsername, moduleUsername))
 	envCfg = append(envCfg, fmt.Sprintf("%s=%s", constants.ModuleEnvPassword, modulePassword))
 	envCfg = append(envCfg, fmt.Sprintf("%s=%s", constants.ModuleEnvCertificate, base64Cert))
@@ -149,25 +423,149 @@ func (mgr *ModuleManager) StartModule(id, imageRef string, configuration map[str
 		return nil, fmt.Errorf("failed to inspect image, imageRef=%s, err: %v", imageRef, err)
 	}
 
+	if err := mgr.createVolumes(id, storage); err != nil {
+		return nil, fmt.Errorf("failed to create module volumes: %v", err)
+	}
+
+	hostCfg := &container.HostConfig{
+		Mounts: storage.mounts(id),
+	}
+	applyHostConfig(hostCfg, resources, security)
+
 	containerName := fmt.Sprintf("module_%s_%s", id, givenPort)
+	secretsDir, secretMounts, err := writeSecretFiles(mgr.secretsDir, containerName, storage, secretValues)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write module secrets: %v", err)
+	}
+	hostCfg.Mounts = append(hostCfg.Mounts, secretMounts...)
+	removeSecrets := func() {
+		if secretsDir != "" {
+			if err := os.RemoveAll(secretsDir); err != nil {
+				log.Error().Err(err).Msgf("Failed to remove module secrets: %s", secretsDir)
+			}
+		}
+	}
+
+	networkName, gateway := "", ""
+	if security.HostNetwork {
+		hostCfg.NetworkMode = "host"
+	} else {
+		networkName = containerName
+		gateway, err = mgr.createModuleNetwork(networkName)
+		if err != nil {
+			removeSecrets()
+			return nil, fmt.Errorf("failed to create module network: %v", err)
+		}
+		hostCfg.NetworkMode = container.NetworkMode(networkName)
+		hostCfg.ExtraHosts = []string{fmt.Sprintf("%s:%s", constants.AgentModuleHostName, gateway)}
+	}
+
 	containerID, err := mgr.dockerWrapper.RunContainer(context.Background(), &container.Config{
 		Image: imageRef,
 		Env:   envCfg,
 		Cmd:   info.Config.Cmd,
-	}, &container.HostConfig{
-		NetworkMode: "host",
-	}, nil, containerName)
+		User:  security.User,
+	}, hostCfg, nil, containerName)
 	if err != nil {
+		if networkName != "" {
+			if err := mgr.removeModuleNetwork(networkName, gateway); err != nil {
+				log.Error().Err(err).Msgf("Failed to remove module network: %s", networkName)
+			}
+		}
+		removeSecrets()
 		return nil, fmt.Errorf("failed to start module: %v", err)
 	}
 
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
-	module := NewModule(id, imageRef, containerID, configuration, givenPort)
+	module := NewModule(id, revision, imageRef, containerID, networkName, configuration, secrets.Digest(secretValues), resources, security, storage, givenPort, restartPolicy)
+	module.gateway = gateway
+	module.secretsDir = secretsDir
 	mgr.modules[id] = module
 	return module, nil
 }
 
+// createModuleNetwork creates an internal bridge network, modules on it can only reach the
+// agent, which serves the module API on the network's gateway. It returns the gateway address.
+func (mgr *ModuleManager) createModuleNetwork(name string) (string, error) {
+	networkID, err := mgr.dockerWrapper.CreateNetwork(context.Background(), name, network.CreateOptions{
+		Driver:   "bridge",
+		Internal: true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	info, err := mgr.dockerWrapper.InspectNetwork(context.Background(), networkID)
+	if err == nil {
+		err = errors.New("network has no gateway")
+		for _, cfg := range info.IPAM.Config {
+			if cfg.Gateway != "" {
+				if err = mgr.bindModuleAPI(cfg.Gateway); err == nil {
+					return cfg.Gateway, nil
+				}
+				break
+			}
+		}
+	}
+	if err := mgr.dockerWrapper.RemoveNetwork(context.Background(), networkID); err != nil {
+		log.Error().Err(err).Msgf("Failed to remove module network: %s", name)
+	}
+	return "", err
+}
+
+// removeModuleNetwork stops serving the module API on the gateway and removes the network.
+func (mgr *ModuleManager) removeModuleNetwork(name, gateway string) error {
+	if gateway != "" {
+		if err := mgr.unbindModuleAPI(gateway); err != nil {
+			log.Error().Err(err).Msgf("Failed to unbind module API from network: %s", name)
+		}
+	}
+	return mgr.dockerWrapper.RemoveNetwork(context.Background(), name)
+}
+
+func (mgr *ModuleManager) bindModuleAPI(gateway string) error {
+	mgr.mu.RLock()
+	binder := mgr.apiBinder
+	mgr.mu.RUnlock()
+	if binder == nil {
+		return errors.New("module API binder is not set")
+	}
+	return binder.Bind(net.JoinHostPort(gateway, strconv.Itoa(mgr.apiPort)))
+}
+
+func (mgr *ModuleManager) unbindModuleAPI(gateway string) error {
+	mgr.mu.RLock()
+	binder := mgr.apiBinder
+	mgr.mu.RUnlock()
+	if binder == nil {
+		return nil
+	}
+	return binder.Unbind(net.JoinHostPort(gateway, strconv.Itoa(mgr.apiPort)))
+}
+
+// GetModuleHost returns the address the agent reaches the module at. The address of modules on
+// isolated networks is looked up on each call, as it changes when their container restarts.
+func (mgr *ModuleManager) GetModuleHost(moduleID string) (string, error) {
+	module, err := mgr.GetModule(moduleID)
+	if err != nil {
+		return "", err
+	}
+	networkName := module.GetNetwork()
+	if networkName == "" {
+		return "localhost", nil
+	}
+
+	info, err := mgr.dockerWrapper.InspectContainer(context.Background(), module.GetContainerID())
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container: %v", err)
+	}
+	if info.NetworkSettings == nil || info.NetworkSettings.Networks[networkName] == nil || info.NetworkSettings.Networks[networkName].IPAddress == "" {
+		return "", fmt.Errorf("container has no address on network: %s", networkName)
+	}
+	return info.NetworkSettings.Networks[networkName].IPAddress, nil
+}
+
 func (mgr *ModuleManager) GetModule(moduleID string) (*Module, error) {
 	log.Info().Msgf("Getting module: %s", moduleID)
 
@@ -182,6 +580,60 @@ func (mgr *ModuleManager) GetModule(moduleID string) (*Module, error) {
 	return module, nil
 }
 
+// GetModuleStatus derives module status from the container state, the image HEALTHCHECK
+// and the liveness reported by the module.
+func (mgr *ModuleManager) GetModuleStatus(moduleID string) (pb.ModuleStatus, error) {
+	module, err := mgr.GetModule(moduleID)
+	if err != nil {
+		return pb.ModuleStatus_UNKNOWN, err
+	}
+	if module.IsCrashLooping() {
+		return pb.ModuleStatus_CRASH_LOOP, nil
+	}
+
+	info, err := mgr.dockerWrapper.InspectContainer(context.Background(), module.GetContainerID())
+	if err != nil {
+		return pb.ModuleStatus_UNKNOWN, fmt.Errorf("failed to inspect container: %v", err)
+	}
+	if info.State == nil {
+		return pb.ModuleStatus_UNKNOWN, nil
+	}
+
+	switch info.State.Status {
+	case "created", "restarting":
+		return pb.ModuleStatus_STARTING, nil
+	case "running":
+	default:
+		return pb.ModuleStatus_UNHEALTHY, nil
+	}
+
+	if info.State.Health != nil {
+		switch info.State.Health.Status {
+		case types.Starting:
+			return pb.ModuleStatus_STARTING, nil
+		case types.Unhealthy:
+			return pb.ModuleStatus_UNHEALTHY, nil
+		}
+	}
+
+	if !module.isLive() {
+		return pb.ModuleStatus_UNHEALTHY, nil
+	}
+	return pb.ModuleStatus_HEALTHY, nil
+}
+
+// GetModuleLogs returns the multiplexed stdout and stderr of the module's container, the
+// caller must close the reader.
+func (mgr *ModuleManager) GetModuleLogs(ctx context.Context, moduleID string, options container.LogsOptions) (io.ReadCloser, error) {
+	module, err := mgr.GetModule(moduleID)
+	if err != nil {
+		return nil, err
+	}
+	options.ShowStdout = true
+	options.ShowStderr = true
+	return mgr.dockerWrapper.ContainerLogs(ctx, module.GetContainerID(), options)
+}
+
 func (mgr *ModuleManager) ListModules() []*Module {
 	log.Info().Msg("Listing all modules")
 
@@ -213,6 +665,16 @@ func (mgr *ModuleManager) StopModule(moduleID string) error {
 	if err := mgr.dockerWrapper.RemoveContainer(context.Background(), module.GetContainerID()); err != nil {
 		return fmt.Errorf("failed to remove container: %v", err)
 	}
+	if networkName := module.GetNetwork(); networkName != "" {
+		if err := mgr.removeModuleNetwork(networkName, module.gateway); err != nil {
+			return fmt.Errorf("failed to remove network: %v", err)
+		}
+	}
+	if module.secretsDir != "" {
+		if err := os.RemoveAll(module.secretsDir); err != nil {
+			return fmt.Errorf("failed to remove secrets: %v", err)
+		}
+	}
 
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
@@ -220,3 +682,11 @@ func (mgr *ModuleManager) StopModule(moduleID string) error {
 
 	return nil
 }
+
+func (mgr *ModuleManager) ModuleExists(moduleID string) bool {
+	log.Info().Msgf("Checking if module exists: %s", moduleID)
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+	_, ok := mgr.modules[moduleID]
+	return ok
+}
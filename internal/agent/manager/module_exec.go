@@ -0,0 +1,128 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/pajtaand/dmap-zero/internal/common/wrapper"
+)
+
+const (
+	execExitPollAttempts = 20
+	execExitPollInterval = 100 * time.Millisecond
+)
+
+// ExecSession is a command running in the container of a module with its streams attached.
+type ExecSession struct {
+	id   string
+	tty  bool
+	conn *types.HijackedResponse
+
+	dockerWrapper *wrapper.DockerClientWrapper
+}
+
+// StartExec runs the command in the module's container. With tty the output is a terminal, the
+// rows and cols set its initial size.
+func (mgr *ModuleManager) StartExec(ctx context.Context, moduleID string, command []string, tty bool, rows, cols uint) (*ExecSession, error) {
+	if len(command) == 0 {
+		return nil, errors.New("command must not be empty")
+	}
+	module, err := mgr.GetModule(moduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	var consoleSize *[2]uint
+	if tty && rows > 0 && cols > 0 {
+		consoleSize = &[2]uint{rows, cols}
+	}
+	execID, err := mgr.dockerWrapper.CreateExec(ctx, module.GetContainerID(), container.ExecOptions{
+		Cmd:          command,
+		Tty:          tty,
+		ConsoleSize:  consoleSize,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	conn, err := mgr.dockerWrapper.AttachExec(ctx, execID, container.ExecAttachOptions{
+		Tty:         tty,
+		ConsoleSize: consoleSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExecSession{
+		id:            execID,
+		tty:           tty,
+		conn:          conn,
+		dockerWrapper: mgr.dockerWrapper,
+	}, nil
+}
+
+func (s *ExecSession) GetID() string {
+	return s.id
+}
+
+func (s *ExecSession) Write(p []byte) (int, error) {
+	return s.conn.Conn.Write(p)
+}
+
+// CloseStdin signals the end of the input, the output can still be read.
+func (s *ExecSession) CloseStdin() error {
+	return s.conn.CloseWrite()
+}
+
+func (s *ExecSession) Resize(ctx context.Context, rows, cols uint) error {
+	if !s.tty {
+		return nil
+	}
+	return s.dockerWrapper.ResizeExec(ctx, s.id, container.ResizeOptions{
+		Height: rows,
+		Width:  cols,
+	})
+}
+
+// CopyOutput copies the output of the command until it exits, the output of a tty is written
+// only to stdout.
+func (s *ExecSession) CopyOutput(stdout, stderr io.Writer) error {
+	var err error
+	if s.tty {
+		_, err = io.Copy(stdout, s.conn.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, s.conn.Reader)
+	}
+	return err
+}
+
+// ExitCode returns the exit code of the finished command. The streams close right before
+// docker records the exit, so it waits a moment for the command to be reported as finished.
+func (s *ExecSession) ExitCode(ctx context.Context) (int, error) {
+	for i := 0; i < execExitPollAttempts; i++ {
+		info, err := s.dockerWrapper.InspectExec(ctx, s.id)
+		if err != nil {
+			return 0, err
+		}
+		if !info.Running {
+			return info.ExitCode, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(execExitPollInterval):
+		}
+	}
+	return 0, errors.New("command is still running")
+}
+
+func (s *ExecSession) Close() {
+	s.conn.Close()
+}
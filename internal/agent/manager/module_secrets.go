@@ -0,0 +1,59 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types/mount"
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	"github.com/pajtaand/dmap-zero/internal/common/secrets"
+)
+
+// CheckSecrets returns an error wrapping ErrNotFound when a secret the module refers to wasn't
+// delivered with the module configuration.
+func CheckSecrets(configuration map[string]string, storage *ModuleStorage, values map[string][]byte) error {
+	if _, err := secrets.ResolveEnv(configuration, values); err != nil {
+		return err
+	}
+	for _, secret := range storage.Secrets {
+		if _, ok := values[secret.Secret]; !ok {
+			return fmt.Errorf("%w: secret '%s'", errs.ErrNotFound, secret.Secret)
+		}
+	}
+	return nil
+}
+
+// writeSecretFiles writes the secrets mounted into the module to a directory only the agent can
+// list and returns the directory with the read-only mounts of the files. The directory is created
+// in baseDir, which the docker daemon resolves the mount sources in, so it must be the same path
+// on the host and in the agent. No directory is created for modules without secret files.
+func writeSecretFiles(baseDir, name string, storage *ModuleStorage, values map[string][]byte) (string, []mount.Mount, error) {
+	mounts := []mount.Mount{}
+	if len(storage.Secrets) == 0 {
+		return "", mounts, nil
+	}
+	if baseDir == "" {
+		return "", nil, errors.New("secret files require a secrets directory shared with the host")
+	}
+
+	dir, err := os.MkdirTemp(baseDir, name+"_secrets_")
+	if err != nil {
+		return "", nil, err
+	}
+	for i, secret := range storage.Secrets {
+		file := filepath.Join(dir, fmt.Sprintf("%d_%s", i, secret.Secret))
+		if err := os.WriteFile(file, values[secret.Secret], 0444); err != nil {
+			os.RemoveAll(dir)
+			return "", nil, err
+		}
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   file,
+			Target:   secret.Path,
+			ReadOnly: true,
+		})
+	}
+	return dir, mounts, nil
+}
@@ -0,0 +1,198 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	pb "github.com/pajtaand/dmap-zero/internal/proto"
+)
+
+const seccompUnconfined = "unconfined"
+
+// ModuleResources limits the resources of the module container, zero means unlimited.
+type ModuleResources struct {
+	CPUs        float64
+	MemoryBytes int64
+	PidsLimit   int64
+}
+
+func ModuleResourcesFromProto(resources *pb.ModuleResources) *ModuleResources {
+	if resources == nil {
+		return &ModuleResources{}
+	}
+	return &ModuleResources{
+		CPUs:        resources.Cpus,
+		MemoryBytes: resources.MemoryBytes,
+		PidsLimit:   resources.PidsLimit,
+	}
+}
+
+// ModuleSecurity holds the security options of the module container.
+type ModuleSecurity struct {
+	ReadOnlyRootfs  bool
+	User            string
+	CapAdd          []string
+	CapDrop         []string
+	SeccompProfile  string // empty for docker's default, "unconfined" or a JSON profile
+	NoNewPrivileges bool
+	Privileged      bool
+	HostNetwork     bool
+	Tmpfs           map[string]string
+}
+
+func ModuleSecurityFromProto(security *pb.ModuleSecurity) *ModuleSecurity {
+	if security == nil {
+		return &ModuleSecurity{
+			CapAdd:  []string{},
+			CapDrop: []string{},
+			Tmpfs:   map[string]string{},
+		}
+	}
+	s := &ModuleSecurity{
+		ReadOnlyRootfs:  security.ReadOnlyRootfs,
+		User:            security.User,
+		CapAdd:          slices.Clone(security.CapAdd),
+		CapDrop:         slices.Clone(security.CapDrop),
+		SeccompProfile:  security.SeccompProfile,
+		NoNewPrivileges: security.NoNewPrivileges,
+		Privileged:      security.Privileged,
+		HostNetwork:     security.HostNetwork,
+		Tmpfs:           maps.Clone(security.Tmpfs),
+	}
+	if s.CapAdd == nil {
+		s.CapAdd = []string{}
+	}
+	if s.CapDrop == nil {
+		s.CapDrop = []string{}
+	}
+	if s.Tmpfs == nil {
+		s.Tmpfs = map[string]string{}
+	}
+	return s
+}
+
+func (s *ModuleSecurity) Equal(other *ModuleSecurity) bool {
+	return s.ReadOnlyRootfs == other.ReadOnlyRootfs &&
+		s.User == other.User &&
+		slices.Equal(s.CapAdd, other.CapAdd) &&
+		slices.Equal(s.CapDrop, other.CapDrop) &&
+		s.SeccompProfile == other.SeccompProfile &&
+		s.NoNewPrivileges == other.NoNewPrivileges &&
+		s.Privileged == other.Privileged &&
+		s.HostNetwork == other.HostNetwork &&
+		maps.Equal(s.Tmpfs, other.Tmpfs)
+}
+
+// runsAsRoot reports whether the container user is root, images are assumed to run as root
+// when no user is set.
+func (s *ModuleSecurity) runsAsRoot() bool {
+	user, _, _ := strings.Cut(s.User, ":")
+	return user == "" || user == "root" || user == "0"
+}
+
+// sameCapability compares capabilities the way docker reads them, case-insensitive and with an
+// optional CAP_ prefix.
+func sameCapability(a, b string) bool {
+	normalize := func(capability string) string {
+		capability = strings.ToUpper(strings.TrimSpace(capability))
+		return strings.TrimPrefix(capability, "CAP_")
+	}
+	return normalize(a) == normalize(b)
+}
+
+// applyHostConfig sets the resource limits and security options on the container host config.
+func applyHostConfig(hostCfg *container.HostConfig, resources *ModuleResources, security *ModuleSecurity) {
+	hostCfg.NanoCPUs = int64(resources.CPUs * 1e9)
+	hostCfg.Memory = resources.MemoryBytes
+	if resources.PidsLimit > 0 {
+		pidsLimit := resources.PidsLimit
+		hostCfg.PidsLimit = &pidsLimit
+	}
+
+	hostCfg.ReadonlyRootfs = security.ReadOnlyRootfs
+	hostCfg.CapAdd = security.CapAdd
+	hostCfg.CapDrop = security.CapDrop
+	hostCfg.Privileged = security.Privileged
+	hostCfg.Tmpfs = security.Tmpfs
+	if security.SeccompProfile != "" {
+		hostCfg.SecurityOpt = append(hostCfg.SecurityOpt, "seccomp="+security.SeccompProfile)
+	}
+	if security.NoNewPrivileges {
+		hostCfg.SecurityOpt = append(hostCfg.SecurityOpt, "no-new-privileges")
+	}
+}
+
+// ModulePolicy restricts the modules the agent runs, modules violating it are rejected. Zero
+// limits aren't enforced.
+type ModulePolicy struct {
+	AllowPrivileged        bool     `json:"allowPrivileged"`
+	AllowUnconfinedSeccomp bool     `json:"allowUnconfinedSeccomp"`
+	AllowHostNetwork       bool     `json:"allowHostNetwork"` // modules run on isolated networks otherwise
+	RequireNonRoot         bool     `json:"requireNonRoot"`
+	RequireReadOnlyRootfs  bool     `json:"requireReadOnlyRootfs"`
+	AllowedCapabilities    []string `json:"allowedCapabilities"` // capabilities modules may add, none by default
+	MaxCPUs                float64  `json:"maxCpus"`
+	MaxMemoryBytes         int64    `json:"maxMemoryBytes"`
+	MaxPids                int64    `json:"maxPids"`
+	AllowedBindMounts      []string `json:"allowedBindMounts"` // host paths modules may mount, with their subpaths
+}
+
+// NewModulePolicyDefault returns the policy of agents without a policy file, it denies
+// privileged containers, added capabilities, unconfined seccomp profiles, the host network and
+// bind mounts.
+func NewModulePolicyDefault() *ModulePolicy {
+	return &ModulePolicy{}
+}
+
+// LoadModulePolicy reads the policy from a JSON file, unset fields keep their defaults.
+func LoadModulePolicy(file string) (*ModulePolicy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %v", err)
+	}
+	policy := NewModulePolicyDefault()
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %v", err)
+	}
+	return policy, nil
+}
+
+// Check returns an error wrapping ErrNotAllowed when the module violates the policy.
+func (p *ModulePolicy) Check(resources *ModuleResources, security *ModuleSecurity, storage *ModuleStorage) error {
+	if security.Privileged && !p.AllowPrivileged {
+		return fmt.Errorf("%w: privileged containers are not allowed", errs.ErrNotAllowed)
+	}
+	if security.SeccompProfile == seccompUnconfined && !p.AllowUnconfinedSeccomp {
+		return fmt.Errorf("%w: unconfined seccomp profile is not allowed", errs.ErrNotAllowed)
+	}
+	if security.HostNetwork && !p.AllowHostNetwork {
+		return fmt.Errorf("%w: host networking is not allowed", errs.ErrNotAllowed)
+	}
+	if p.RequireNonRoot && security.runsAsRoot() {
+		return fmt.Errorf("%w: containers must run as a non-root user", errs.ErrNotAllowed)
+	}
+	if p.RequireReadOnlyRootfs && !security.ReadOnlyRootfs {
+		return fmt.Errorf("%w: containers must have a read-only root filesystem", errs.ErrNotAllowed)
+	}
+	for _, capability := range security.CapAdd {
+		if !slices.ContainsFunc(p.AllowedCapabilities, func(allowed string) bool { return sameCapability(allowed, capability) }) {
+			return fmt.Errorf("%w: capability '%s' is not allowed", errs.ErrNotAllowed, capability)
+		}
+	}
+	if p.MaxCPUs > 0 && (resources.CPUs == 0 || resources.CPUs > p.MaxCPUs) {
+		return fmt.Errorf("%w: cpus must be limited to at most %g", errs.ErrNotAllowed, p.MaxCPUs)
+	}
+	if p.MaxMemoryBytes > 0 && (resources.MemoryBytes == 0 || resources.MemoryBytes > p.MaxMemoryBytes) {
+		return fmt.Errorf("%w: memory must be limited to at most %d bytes", errs.ErrNotAllowed, p.MaxMemoryBytes)
+	}
+	if p.MaxPids > 0 && (resources.PidsLimit == 0 || resources.PidsLimit > p.MaxPids) {
+		return fmt.Errorf("%w: pids must be limited to at most %d", errs.ErrNotAllowed, p.MaxPids)
+	}
+	return checkBindMounts(storage, p.AllowedBindMounts)
+}
@@ -0,0 +1,56 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+)
+
+func TestModulePolicyCheck_Capabilities(t *testing.T) {
+	restricted := NewModulePolicyDefault()
+	restricted.AllowedCapabilities = []string{"NET_BIND_SERVICE"}
+
+	tests := []struct {
+		name    string
+		policy  *ModulePolicy
+		capAdd  []string
+		allowed bool
+	}{
+		{name: "default without capabilities", policy: NewModulePolicyDefault(), capAdd: []string{}, allowed: true},
+		{name: "default with all capabilities", policy: NewModulePolicyDefault(), capAdd: []string{"ALL"}, allowed: false},
+		{name: "default with sys admin", policy: NewModulePolicyDefault(), capAdd: []string{"SYS_ADMIN"}, allowed: false},
+		{name: "allow-listed", policy: restricted, capAdd: []string{"NET_BIND_SERVICE"}, allowed: true},
+		{name: "allow-listed with prefix", policy: restricted, capAdd: []string{"cap_net_bind_service"}, allowed: true},
+		{name: "not allow-listed", policy: restricted, capAdd: []string{"NET_BIND_SERVICE", "NET_ADMIN"}, allowed: false},
+		{name: "all with allow-list", policy: restricted, capAdd: []string{"ALL"}, allowed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			security := ModuleSecurityFromProto(nil)
+			security.CapAdd = tt.capAdd
+			err := tt.policy.Check(ModuleResourcesFromProto(nil), security, ModuleStorageFromProto(nil))
+			if tt.allowed && err != nil {
+				t.Errorf("Check() failed: %v", err)
+			}
+			if !tt.allowed && !errors.Is(err, errs.ErrNotAllowed) {
+				t.Errorf("Check() error = %v; expected %v", err, errs.ErrNotAllowed)
+			}
+		})
+	}
+}
+
+func TestModulePolicyCheck_HostNetwork(t *testing.T) {
+	security := ModuleSecurityFromProto(nil)
+	security.HostNetwork = true
+
+	policy := NewModulePolicyDefault()
+	if err := policy.Check(ModuleResourcesFromProto(nil), security, ModuleStorageFromProto(nil)); !errors.Is(err, errs.ErrNotAllowed) {
+		t.Errorf("Check() error = %v; expected %v", err, errs.ErrNotAllowed)
+	}
+
+	policy.AllowHostNetwork = true
+	if err := policy.Check(ModuleResourcesFromProto(nil), security, ModuleStorageFromProto(nil)); err != nil {
+		t.Errorf("Check() failed: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	pb "github.com/pajtaand/dmap-zero/internal/proto"
+	"github.com/rs/zerolog/log"
+)
+
+type ModuleVolume struct {
+	Name      string
+	Path      string
+	ReadOnly  bool
+	Retention string
+}
+
+type ModuleBindMount struct {
+	HostPath string
+	Path     string
+	ReadOnly bool
+}
+
+type ModuleSecretMount struct {
+	Secret string
+	Path   string
+}
+
+// ModuleStorage holds the named volumes, bind mounts and secret files of the module container.
+type ModuleStorage struct {
+	Volumes    []*ModuleVolume
+	BindMounts []*ModuleBindMount
+	Secrets    []*ModuleSecretMount
+}
+
+func ModuleStorageFromProto(storage *pb.ModuleStorage) *ModuleStorage {
+	s := &ModuleStorage{
+		Volumes:    []*ModuleVolume{},
+		BindMounts: []*ModuleBindMount{},
+		Secrets:    []*ModuleSecretMount{},
+	}
+	if storage == nil {
+		return s
+	}
+	for _, volume := range storage.Volumes {
+		s.Volumes = append(s.Volumes, &ModuleVolume{
+			Name:      volume.Name,
+			Path:      volume.Path,
+			ReadOnly:  volume.ReadOnly,
+			Retention: volume.Retention,
+		})
+	}
+	for _, bind := range storage.BindMounts {
+		s.BindMounts = append(s.BindMounts, &ModuleBindMount{
+			HostPath: bind.HostPath,
+			Path:     bind.Path,
+			ReadOnly: bind.ReadOnly,
+		})
+	}
+	for _, secret := range storage.Secrets {
+		s.Secrets = append(s.Secrets, &ModuleSecretMount{
+			Secret: secret.Secret,
+			Path:   secret.Path,
+		})
+	}
+	return s
+}
+
+func (s *ModuleStorage) Equal(other *ModuleStorage) bool {
+	return slices.EqualFunc(s.Volumes, other.Volumes, func(a, b *ModuleVolume) bool {
+		return *a == *b
+	}) && slices.EqualFunc(s.BindMounts, other.BindMounts, func(a, b *ModuleBindMount) bool {
+		return *a == *b
+	}) && slices.EqualFunc(s.Secrets, other.Secrets, func(a, b *ModuleSecretMount) bool {
+		return *a == *b
+	})
+}
+
+// moduleVolumeName returns the name of the docker volume, it is stable across revisions so the
+// data survives module updates.
+func moduleVolumeName(moduleID, name string) string {
+	return fmt.Sprintf("module_%s_%s", moduleID, name)
+}
+
+// mounts returns the volume and bind mounts of the module container, secret files are mounted
+// separately.
+func (s *ModuleStorage) mounts(moduleID string) []mount.Mount {
+	mounts := []mount.Mount{}
+	for _, volume := range s.Volumes {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeVolume,
+			Source:   moduleVolumeName(moduleID, volume.Name),
+			Target:   volume.Path,
+			ReadOnly: volume.ReadOnly,
+		})
+	}
+	for _, bind := range s.BindMounts {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   bind.HostPath,
+			Target:   bind.Path,
+			ReadOnly: bind.ReadOnly,
+		})
+	}
+	return mounts
+}
+
+// checkBindMounts returns an error wrapping ErrNotAllowed when a bind mount isn't below one of
+// the allowed host paths.
+func checkBindMounts(storage *ModuleStorage, allowedPaths []string) error {
+	for _, bind := range storage.BindMounts {
+		hostPath := filepath.Clean(bind.HostPath)
+		allowed := slices.ContainsFunc(allowedPaths, func(allowedPath string) bool {
+			allowedPath = filepath.Clean(allowedPath)
+			return hostPath == allowedPath || strings.HasPrefix(hostPath, allowedPath+string(filepath.Separator))
+		})
+		if !allowed {
+			return fmt.Errorf("%w: bind mount of host path '%s' is not allowed", errs.ErrNotAllowed, bind.HostPath)
+		}
+	}
+	return nil
+}
+
+// createVolumes creates the missing volumes of the module, existing volumes keep their data.
+func (mgr *ModuleManager) createVolumes(moduleID string, storage *ModuleStorage) error {
+	for _, volume := range storage.Volumes {
+		err := mgr.dockerWrapper.CreateVolume(context.Background(), moduleVolumeName(moduleID, volume.Name), "local", map[string]string{
+			constants.AgentVolumeLabelModule:    moduleID,
+			constants.AgentVolumeLabelName:      volume.Name,
+			constants.AgentVolumeLabelRetention: volume.Retention,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveVolumes removes the volumes of the module with the given retention.
+func (mgr *ModuleManager) RemoveVolumes(moduleID, retention string) error {
+	volumes, err := mgr.dockerWrapper.ListVolumes(context.Background(), map[string]string{
+		constants.AgentVolumeLabelModule:    moduleID,
+		constants.AgentVolumeLabelRetention: retention,
+	})
+	if err != nil {
+		return err
+	}
+	for _, volume := range volumes {
+		log.Info().Msgf("Removing module volume: moduleID=%s, volume=%s, retention=%s", moduleID, volume.Name, retention)
+		if err := mgr.dockerWrapper.RemoveVolume(context.Background(), volume.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveDeletedModuleVolumes removes the volumes kept until their module is deleted, for the
+// modules that no longer exist on the controller.
+func (mgr *ModuleManager) RemoveDeletedModuleVolumes(existingModules map[string]bool) error {
+	volumes, err := mgr.dockerWrapper.ListVolumes(context.Background(), map[string]string{
+		constants.AgentVolumeLabelRetention: constants.ModuleVolumeRetentionUntilDelete,
+	})
+	if err != nil {
+		return err
+	}
+	for _, volume := range volumes {
+		moduleID := volume.Labels[constants.AgentVolumeLabelModule]
+		if existingModules[moduleID] || mgr.ModuleExists(moduleID) {
+			continue
+		}
+		log.Info().Msgf("Removing volume of deleted module: moduleID=%s, volume=%s", moduleID, volume.Name)
+		if err := mgr.dockerWrapper.RemoveVolume(context.Background(), volume.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VolumeUsage returns the sizes of the module volumes by module ID. Computing the sizes is slow,
+// they are refreshed at most once per AgentVolumeUsageInterval.
+func (mgr *ModuleManager) VolumeUsage() map[string]*pb.ModuleVolumeUsage {
+	mgr.volumeUsageMu.Lock()
+	defer mgr.volumeUsageMu.Unlock()
+	if mgr.volumeUsage != nil && time.Since(mgr.volumeUsageTime) < constants.AgentVolumeUsageInterval {
+		return mgr.volumeUsage
+	}
+
+	volumes, err := mgr.dockerWrapper.VolumesDiskUsage(context.Background())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get volume usage")
+		return mgr.volumeUsage
+	}
+	usage := map[string]*pb.ModuleVolumeUsage{}
+	for _, volume := range volumes {
+		moduleID, ok := volume.Labels[constants.AgentVolumeLabelModule]
+		if !ok {
+			continue
+		}
+		size := int64(-1)
+		if volume.UsageData != nil {
+			size = volume.UsageData.Size
+		}
+		if usage[moduleID] == nil {
+			usage[moduleID] = &pb.ModuleVolumeUsage{
+				SizeBytes: map[string]int64{},
+			}
+		}
+		usage[moduleID].SizeBytes[volume.Labels[constants.AgentVolumeLabelName]] = size
+	}
+	mgr.volumeUsage = usage
+	mgr.volumeUsageTime = time.Now()
+	return usage
+}
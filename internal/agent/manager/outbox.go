@@ -0,0 +1,505 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/google/uuid"
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+	"github.com/pajtaand/dmap-zero/internal/common/database"
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	pb "github.com/pajtaand/dmap-zero/internal/proto"
+)
+
+type OutboxDestination string
+
+const (
+	OutboxDestinationEndpoint   OutboxDestination = "ENDPOINT"
+	OutboxDestinationController OutboxDestination = "CONTROLLER"
+	OutboxDestinationTopic      OutboxDestination = "TOPIC"
+)
+
+type OutboxStatus string
+
+const (
+	OutboxStatusPending     OutboxStatus = "PENDING"
+	OutboxStatusDelivered   OutboxStatus = "DELIVERED"
+	OutboxStatusUndelivered OutboxStatus = "UNDELIVERED" // some receivers didn't confirm they got the message
+	OutboxStatusExpired     OutboxStatus = "EXPIRED"
+)
+
+// OutboxMessage is the delivery state of a message sent by a module.
+type OutboxMessage struct {
+	ID                 string
+	Destination        OutboxDestination
+	SourceModuleID     string
+	ReceiverIdentityID string
+	ReceiverModuleID   string
+	Topic              string
+	Status             OutboxStatus
+	Attempts           int
+	LastError          string
+	CreatedAt          time.Time
+	ExpiresAt          time.Time
+	FinishedAt         time.Time // when the message was delivered or expired
+	Recipients         []DeliveryRecipient
+}
+
+const outboxKeyPrefix = "outbox/"
+
+type outboxRecord struct {
+	ID                 string              `json:"id"`
+	Destination        OutboxDestination   `json:"destination"`
+	SourceModuleID     string              `json:"sourceModuleID"`
+	ReceiverIdentityID string              `json:"receiverIdentityID"`
+	ReceiverModuleID   string              `json:"receiverModuleID"`
+	Topic              string              `json:"topic,omitempty"`
+	Data               []byte              `json:"data"`
+	Status             OutboxStatus        `json:"status"`
+	Attempts           int                 `json:"attempts"`
+	LastError          string              `json:"lastError"`
+	CreatedAt          time.Time           `json:"createdAt"`
+	ExpiresAt          time.Time           `json:"expiresAt"`
+	NextAttempt        time.Time           `json:"nextAttempt"`
+	FinishedAt         time.Time           `json:"finishedAt"`
+	Targets            []string            `json:"targets"` // identities the message is still to be delivered to
+	Recipients         []DeliveryRecipient `json:"recipients"`
+
+	inflight bool
+}
+
+func (r *outboxRecord) message() *OutboxMessage {
+	recipients := slices.Clone(r.Recipients)
+	for _, identityID := range r.Targets {
+		if !slices.ContainsFunc(recipients, func(recipient DeliveryRecipient) bool { return recipient.IdentityID == identityID }) {
+			recipients = append(recipients, DeliveryRecipient{
+				IdentityID: identityID,
+				ModuleID:   r.ReceiverModuleID,
+				Outcome:    DeliveryOutcomePending,
+			})
+		}
+	}
+	return &OutboxMessage{
+		ID:                 r.ID,
+		Destination:        r.Destination,
+		SourceModuleID:     r.SourceModuleID,
+		ReceiverIdentityID: r.ReceiverIdentityID,
+		ReceiverModuleID:   r.ReceiverModuleID,
+		Topic:              r.Topic,
+		Status:             r.Status,
+		Attempts:           r.Attempts,
+		LastError:          r.LastError,
+		CreatedAt:          r.CreatedAt,
+		ExpiresAt:          r.ExpiresAt,
+		FinishedAt:         r.FinishedAt,
+		Recipients:         recipients,
+	}
+}
+
+// target returns the identity a message for a single receiver is delivered to.
+func (r *outboxRecord) target() string {
+	if r.Destination == OutboxDestinationController {
+		return constants.OpenZitiIdentityController
+	}
+	return r.ReceiverIdentityID
+}
+
+// setRecipients replaces the outcomes of the receivers on the agent.
+func (r *outboxRecord) setRecipients(identityID string, recipients []DeliveryRecipient) {
+	r.Recipients = slices.DeleteFunc(r.Recipients, func(recipient DeliveryRecipient) bool { return recipient.IdentityID == identityID })
+	r.Recipients = append(r.Recipients, recipients...)
+}
+
+// finish marks the message as delivered when every receiver got it.
+func (r *outboxRecord) finish(now time.Time) {
+	r.Status = OutboxStatusDelivered
+	if len(r.Recipients) == 0 || slices.ContainsFunc(r.Recipients, func(recipient DeliveryRecipient) bool { return recipient.Outcome != DeliveryOutcomeDelivered }) {
+		r.Status = OutboxStatusUndelivered
+	}
+	r.FinishedAt = now
+	r.LastError = ""
+	r.Data = nil
+}
+
+// expire gives up on the agents the message wasn't delivered to yet.
+func (r *outboxRecord) expire(now time.Time) {
+	for _, identityID := range r.Targets {
+		r.setRecipients(identityID, []DeliveryRecipient{{
+			IdentityID: identityID,
+			ModuleID:   r.ReceiverModuleID,
+			Outcome:    DeliveryOutcomeExpired,
+			Error:      r.LastError,
+		}})
+	}
+	r.Targets = nil
+	r.Status = OutboxStatusExpired
+	r.FinishedAt = now
+	r.Data = nil
+}
+
+// OutboxManager stores the messages of modules until they are delivered to the other agents or
+// the controller. Failed deliveries are retried with an exponential backoff until the message
+// expires, a message published to a topic is retried only for the agents which weren't reached,
+// so the modules which got it don't receive it twice. A message to a module is retried for the
+// agents where a webhook failed, which makes webhook deliveries at least once. Finished messages are kept for a while, so
+// modules can query their status.
+type OutboxManager struct {
+	mu       sync.Mutex
+	messages map[string]*outboxRecord
+	wake     chan struct{}
+
+	database             database.Database
+	endpointManager      *EndpointManager
+	receiveServiceClient pb.ReceiveServiceClient
+}
+
+func NewOutboxManager(database database.Database, endpointManager *EndpointManager, receiveServiceClient pb.ReceiveServiceClient) (*OutboxManager, error) {
+	log.Debug().Msg("Creating new OutboxManager")
+
+	if database == nil {
+		return nil, errors.New("database must not be nil")
+	}
+	if endpointManager == nil {
+		return nil, errors.New("EndpointManager must not be nil")
+	}
+	if receiveServiceClient == nil {
+		return nil, errors.New("ReceiveServiceClient must not be nil")
+	}
+
+	mgr := &OutboxManager{
+		messages:             map[string]*outboxRecord{},
+		wake:                 make(chan struct{}, 1),
+		database:             database,
+		endpointManager:      endpointManager,
+		receiveServiceClient: receiveServiceClient,
+	}
+	if err := mgr.load(); err != nil {
+		return nil, fmt.Errorf("failed to load outbox: %v", err)
+	}
+	return mgr, nil
+}
+
+func (mgr *OutboxManager) load() error {
+	keys, err := mgr.database.Keys(outboxKeyPrefix)
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, key := range keys {
+		record := &outboxRecord{}
+		if _, err := database.GetJSON(mgr.database, key, record); err != nil {
+			return err
+		}
+		if record.Status == OutboxStatusPending {
+			pending++
+			if record.Targets == nil {
+				// stored before the targets were tracked
+				record.Targets = []string{record.target()}
+			}
+		}
+		mgr.messages[record.ID] = record
+	}
+	log.Info().Msgf("Loaded %d messages from outbox, %d pending", len(mgr.messages), pending)
+	return nil
+}
+
+// save persists the message, the caller must hold the lock.
+func (mgr *OutboxManager) save(record *outboxRecord) error {
+	return database.SetJSON(mgr.database, outboxKeyPrefix+record.ID, record)
+}
+
+// Enqueue stores the message and returns its ID, the delivery is attempted right away. The
+// message is only accepted by the outbox, its delivery is reported by its status, see GetMessage.
+// The destination is the module on the other agent or, for the controller, the receiver given by
+// the module.
+func (mgr *OutboxManager) Enqueue(destination OutboxDestination, sourceModuleID, receiverIdentityID, receiverModuleID string, data []byte, ttl time.Duration) (string, error) {
+	log.Info().Msgf("Enqueueing message: destination=%s, sourceModuleID=%s, receiverIdentityID=%s, receiverModuleID=%s, ttl=%s", destination, sourceModuleID, receiverIdentityID, receiverModuleID, ttl)
+
+	now := time.Now()
+	record := &outboxRecord{
+		ID:                 uuid.New().String(),
+		Destination:        destination,
+		SourceModuleID:     sourceModuleID,
+		ReceiverIdentityID: receiverIdentityID,
+		ReceiverModuleID:   receiverModuleID,
+		Data:               data,
+		Status:             OutboxStatusPending,
+		CreatedAt:          now,
+		ExpiresAt:          now.Add(ttl),
+		NextAttempt:        now,
+		Recipients:         []DeliveryRecipient{},
+	}
+	record.Targets = []string{record.target()}
+	if err := mgr.add(record); err != nil {
+		return "", err
+	}
+	return record.ID, nil
+}
+
+// EnqueueTopic stores the message published to the topic, which is to be delivered to the
+// subscribers on the other agents. The outcomes of the subscribers on this agent, which got the
+// message already, are recorded with it.
+func (mgr *OutboxManager) EnqueueTopic(messageID, sourceModuleID, topic string, identityIDs []string, localRecipients []DeliveryRecipient, data []byte, ttl time.Duration) error {
+	log.Info().Msgf("Enqueueing topic message: messageID=%s, sourceModuleID=%s, topic=%s, identityIDs=%v, ttl=%s", messageID, sourceModuleID, topic, identityIDs, ttl)
+
+	now := time.Now()
+	record := &outboxRecord{
+		ID:             messageID,
+		Destination:    OutboxDestinationTopic,
+		SourceModuleID: sourceModuleID,
+		Topic:          topic,
+		Data:           data,
+		Status:         OutboxStatusPending,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(ttl),
+		NextAttempt:    now,
+		Targets:        slices.Clone(identityIDs),
+		Recipients:     slices.Clone(localRecipients),
+	}
+	if len(record.Targets) == 0 {
+		record.finish(now)
+	}
+	return mgr.add(record)
+}
+
+// Record stores the outcome of a message which was delivered directly to the module on the other
+// agent, so its status can be queried like the status of the messages in the outbox. The message
+// is finished already, an error means the other agent wasn't reached.
+func (mgr *OutboxManager) Record(messageID, sourceModuleID, receiverIdentityID, receiverModuleID string, recipients []DeliveryRecipient, deliveryErr error) error {
+	log.Info().Msgf("Recording message: messageID=%s, sourceModuleID=%s, receiverIdentityID=%s, receiverModuleID=%s", messageID, sourceModuleID, receiverIdentityID, receiverModuleID)
+
+	now := time.Now()
+	record := &outboxRecord{
+		ID:                 messageID,
+		Destination:        OutboxDestinationEndpoint,
+		SourceModuleID:     sourceModuleID,
+		ReceiverIdentityID: receiverIdentityID,
+		ReceiverModuleID:   receiverModuleID,
+		Attempts:           1,
+		CreatedAt:          now,
+		ExpiresAt:          now,
+		Recipients:         slices.Clone(recipients),
+	}
+	if deliveryErr != nil {
+		record.Recipients = []DeliveryRecipient{{
+			IdentityID: receiverIdentityID,
+			ModuleID:   receiverModuleID,
+			Outcome:    DeliveryOutcomeUnreachable,
+			Error:      deliveryErr.Error(),
+		}}
+	}
+	record.finish(now)
+	if deliveryErr != nil {
+		record.LastError = deliveryErr.Error()
+	}
+	return mgr.add(record)
+}
+
+func (mgr *OutboxManager) add(record *outboxRecord) error {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	if record.Status == OutboxStatusPending {
+		pending := 0
+		for _, record := range mgr.messages {
+			if record.Status == OutboxStatusPending {
+				pending++
+			}
+		}
+		if pending >= constants.AgentOutboxMaxPendingMessages {
+			return fmt.Errorf("%w: outbox holds %d pending messages", errs.ErrLimitExceeded, pending)
+		}
+	}
+
+	if err := mgr.save(record); err != nil {
+		return fmt.Errorf("failed to save message: %v", err)
+	}
+	mgr.messages[record.ID] = record
+
+	select {
+	case mgr.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// GetMessage returns the delivery state of the message, modules only see their own messages.
+func (mgr *OutboxManager) GetMessage(sourceModuleID, messageID string) (*OutboxMessage, error) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	record, ok := mgr.messages[messageID]
+	if !ok || record.SourceModuleID != sourceModuleID {
+		return nil, errs.ErrNotFound
+	}
+	return record.message(), nil
+}
+
+// Run delivers the pending messages until the context is cancelled.
+func (mgr *OutboxManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(constants.AgentOutboxDispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		mgr.dispatch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-mgr.wake:
+		}
+	}
+}
+
+// dispatch starts the deliveries which are due, expires the messages past their TTL and forgets
+// the finished messages past their retention.
+func (mgr *OutboxManager) dispatch(ctx context.Context) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	now := time.Now()
+	for id, record := range mgr.messages {
+		switch {
+		case record.Status != OutboxStatusPending:
+			if now.Sub(record.FinishedAt) < constants.AgentOutboxRetention {
+				continue
+			}
+			if err := mgr.database.Delete(outboxKeyPrefix + id); err != nil {
+				log.Error().Err(err).Msgf("Failed to delete message from outbox: messageID=%s", id)
+				continue
+			}
+			delete(mgr.messages, id)
+		case record.inflight:
+			continue
+		case !now.Before(record.ExpiresAt):
+			log.Warn().Msgf("Message expired before it was delivered: messageID=%s, attempts=%d, lastError=%s", id, record.Attempts, record.LastError)
+			record.expire(now)
+			if err := mgr.save(record); err != nil {
+				log.Error().Err(err).Msgf("Failed to save message: messageID=%s", id)
+			}
+		case now.Before(record.NextAttempt):
+			continue
+		default:
+			record.inflight = true
+			go mgr.attempt(ctx, record)
+		}
+	}
+}
+
+type outboxResult struct {
+	recipients []DeliveryRecipient
+	err        error
+}
+
+func (mgr *OutboxManager) attempt(ctx context.Context, record *outboxRecord) {
+	// the message isn't modified while in flight, so it's read without the lock
+	ctx, cancel := context.WithTimeout(ctx, constants.AgentOutboxDeliveryTimeout)
+	results := make([]outboxResult, len(record.Targets))
+	var wg sync.WaitGroup
+	for i, identityID := range record.Targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recipients, err := mgr.deliver(ctx, record, identityID)
+			results[i] = outboxResult{recipients: recipients, err: err}
+		}()
+	}
+	wg.Wait()
+	cancel()
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	mgr.complete(record, results, time.Now())
+}
+
+// complete records the results of a delivery attempt, one for each target, and schedules a retry
+// for the targets which failed. The caller must hold the lock.
+//
+// A retry for an agent is a new delivery to every webhook of the receiver module there, so the
+// webhooks which got the message at the previous attempt receive it again. Deliveries to webhooks
+// are at least once, they can tell repeated deliveries apart by the message ID.
+func (mgr *OutboxManager) complete(record *outboxRecord, results []outboxResult, now time.Time) {
+	record.inflight = false
+	record.Attempts++
+	targets := []string{}
+	errList := []error{}
+	for i, identityID := range record.Targets {
+		result := results[i]
+		if result.err != nil {
+			targets = append(targets, identityID)
+			errList = append(errList, result.err)
+			continue
+		}
+		record.setRecipients(identityID, result.recipients)
+		if record.Destination == OutboxDestinationTopic {
+			continue
+		}
+		for _, recipient := range result.recipients {
+			if recipient.Outcome == DeliveryOutcomeWebhookFailed {
+				targets = append(targets, identityID)
+				errList = append(errList, errors.New(recipient.Error))
+				break
+			}
+		}
+	}
+	record.Targets = targets
+
+	if len(targets) > 0 {
+		backoff := retryBackoff(record.Attempts)
+		err := errors.Join(errList...)
+		log.Warn().Err(err).Msgf("Failed to deliver message, scheduling retry: messageID=%s, attempts=%d, backoff=%s", record.ID, record.Attempts, backoff)
+		record.LastError = err.Error()
+		record.NextAttempt = now.Add(backoff)
+	} else {
+		record.finish(now)
+		log.Info().Msgf("Message finished: messageID=%s, status=%s, attempts=%d", record.ID, record.Status, record.Attempts)
+	}
+	if err := mgr.save(record); err != nil {
+		log.Error().Err(err).Msgf("Failed to save message: messageID=%s", record.ID)
+	}
+}
+
+// retryBackoff returns how long to wait after the failed attempts, it doubles with every attempt
+// up to the maximum.
+func retryBackoff(attempts int) time.Duration {
+	// the backoff is capped long before the shift would overflow
+	if attempts < 1 {
+		return constants.AgentOutboxRetryBackoffMin
+	}
+	if attempts >= 16 {
+		return constants.AgentOutboxRetryBackoffMax
+	}
+	return min(constants.AgentOutboxRetryBackoffMin<<(attempts-1), constants.AgentOutboxRetryBackoffMax)
+}
+
+// deliver sends the message to the agent, or the controller, and returns the outcome for the
+// receiver modules there.
+func (mgr *OutboxManager) deliver(ctx context.Context, record *outboxRecord, identityID string) ([]DeliveryRecipient, error) {
+	switch record.Destination {
+	case OutboxDestinationEndpoint:
+		return mgr.endpointManager.SendData(ctx, identityID, record.ReceiverModuleID, record.ID, record.Data)
+	case OutboxDestinationTopic:
+		return mgr.endpointManager.Publish(ctx, identityID, record.ID, record.Topic, record.SourceModuleID, record.Data)
+	case OutboxDestinationController:
+		report, err := mgr.receiveServiceClient.PushData(ctx, &pb.ModuleControllerData{
+			Receiver: record.ReceiverModuleID,
+			Sender: &pb.ModuleIdentifier{
+				Id: record.SourceModuleID,
+			},
+			Data:      record.Data,
+			MessageId: record.ID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to send data to controller: %v", err)
+		}
+		return DeliveryRecipients(identityID, record.ReceiverModuleID, report), nil
+	default:
+		return nil, fmt.Errorf("unknown destination: %s", record.Destination)
+	}
+}
@@ -0,0 +1,203 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+	"github.com/pajtaand/dmap-zero/internal/common/database"
+)
+
+// newTestOutbox creates an outbox without delivery clients, so only the records it holds can be
+// completed and dispatch must not find any message due.
+func newTestOutbox() *OutboxManager {
+	return &OutboxManager{
+		messages: map[string]*outboxRecord{},
+		wake:     make(chan struct{}, 1),
+		database: database.NewKVStore(),
+	}
+}
+
+func newTestRecord(destination OutboxDestination, targets ...string) *outboxRecord {
+	now := time.Now()
+	return &outboxRecord{
+		ID:               "message",
+		Destination:      destination,
+		SourceModuleID:   "source",
+		ReceiverModuleID: "receiver",
+		Data:             []byte("data"),
+		Status:           OutboxStatusPending,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(time.Hour),
+		NextAttempt:      now,
+		Targets:          targets,
+		Recipients:       []DeliveryRecipient{},
+		inflight:         true,
+	}
+}
+
+func delivered(identityID string) outboxResult {
+	return outboxResult{recipients: []DeliveryRecipient{{IdentityID: identityID, ModuleID: "receiver", Outcome: DeliveryOutcomeDelivered}}}
+}
+
+func webhookFailed(identityID string) outboxResult {
+	return outboxResult{recipients: []DeliveryRecipient{{IdentityID: identityID, ModuleID: "receiver", Outcome: DeliveryOutcomeWebhookFailed, Error: "webhook returned 500"}}}
+}
+
+func outcomes(record *outboxRecord) map[string]DeliveryOutcome {
+	result := map[string]DeliveryOutcome{}
+	for _, recipient := range record.Recipients {
+		result[recipient.IdentityID] = recipient.Outcome
+	}
+	return result
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: constants.AgentOutboxRetryBackoffMin},
+		{attempts: 2, expected: 2 * constants.AgentOutboxRetryBackoffMin},
+		{attempts: 3, expected: 4 * constants.AgentOutboxRetryBackoffMin},
+		{attempts: 6, expected: 32 * constants.AgentOutboxRetryBackoffMin},
+		{attempts: 12, expected: constants.AgentOutboxRetryBackoffMax},
+		{attempts: 100, expected: constants.AgentOutboxRetryBackoffMax},
+	}
+	for _, tt := range tests {
+		if backoff := retryBackoff(tt.attempts); backoff != tt.expected {
+			t.Errorf("retryBackoff(%d) = %v; expected %v", tt.attempts, backoff, tt.expected)
+		}
+	}
+}
+
+func TestOutboxComplete_RetriesFailedTargets(t *testing.T) {
+	mgr := newTestOutbox()
+	record := newTestRecord(OutboxDestinationEndpoint, "a", "b", "c")
+	mgr.messages[record.ID] = record
+
+	now := time.Now()
+	mgr.complete(record, []outboxResult{
+		delivered("a"),
+		webhookFailed("b"),
+		{err: errors.New("agent unreachable")},
+	}, now)
+
+	if record.Status != OutboxStatusPending {
+		t.Fatalf("Status = %s; expected %s", record.Status, OutboxStatusPending)
+	}
+	if !slices.Equal(record.Targets, []string{"b", "c"}) {
+		t.Errorf("Targets = %v; expected [b c]", record.Targets)
+	}
+	if record.Attempts != 1 || !record.NextAttempt.Equal(now.Add(retryBackoff(1))) {
+		t.Errorf("Attempts = %d, NextAttempt = %v; expected 1, %v", record.Attempts, record.NextAttempt, now.Add(retryBackoff(1)))
+	}
+	if record.LastError == "" || record.inflight {
+		t.Errorf("LastError = %q, inflight = %v; expected an error and no attempt in flight", record.LastError, record.inflight)
+	}
+	if got := outcomes(record); got["a"] != DeliveryOutcomeDelivered || got["b"] != DeliveryOutcomeWebhookFailed {
+		t.Errorf("Recipients = %v; expected a delivered and b failed", record.Recipients)
+	}
+
+	// only the failed targets are attempted again
+	later := now.Add(retryBackoff(1))
+	mgr.complete(record, []outboxResult{webhookFailed("b"), {err: errors.New("agent unreachable")}}, later)
+	if record.Attempts != 2 || !record.NextAttempt.Equal(later.Add(retryBackoff(2))) {
+		t.Errorf("Attempts = %d, NextAttempt = %v; expected 2, %v", record.Attempts, record.NextAttempt, later.Add(retryBackoff(2)))
+	}
+
+	mgr.complete(record, []outboxResult{delivered("b"), delivered("c")}, later)
+	if record.Status != OutboxStatusDelivered || len(record.Targets) != 0 || record.Data != nil {
+		t.Errorf("Status = %s, Targets = %v; expected %s without targets and data", record.Status, record.Targets, OutboxStatusDelivered)
+	}
+	if got := outcomes(record); len(got) != 3 || got["b"] != DeliveryOutcomeDelivered || got["c"] != DeliveryOutcomeDelivered {
+		t.Errorf("Recipients = %v; expected every target delivered", record.Recipients)
+	}
+	if _, ok, _ := mgr.database.Get(outboxKeyPrefix + record.ID); !ok {
+		t.Errorf("message wasn't saved")
+	}
+}
+
+func TestOutboxComplete_TopicWebhookFailureIsFinal(t *testing.T) {
+	mgr := newTestOutbox()
+	record := newTestRecord(OutboxDestinationTopic, "a", "b")
+
+	mgr.complete(record, []outboxResult{delivered("a"), webhookFailed("b")}, time.Now())
+	if record.Status != OutboxStatusUndelivered || len(record.Targets) != 0 {
+		t.Errorf("Status = %s, Targets = %v; expected %s without targets", record.Status, record.Targets, OutboxStatusUndelivered)
+	}
+}
+
+func TestOutboxDispatch_Expires(t *testing.T) {
+	mgr := newTestOutbox()
+	now := time.Now()
+
+	expired := newTestRecord(OutboxDestinationEndpoint, "a", "b")
+	expired.inflight = false
+	expired.Recipients = []DeliveryRecipient{{IdentityID: "a", ModuleID: "receiver", Outcome: DeliveryOutcomeWebhookFailed}}
+	expired.LastError = "webhook returned 500"
+	expired.ExpiresAt = now.Add(-time.Second)
+	mgr.messages[expired.ID] = expired
+
+	waiting := newTestRecord(OutboxDestinationEndpoint, "a")
+	waiting.ID = "waiting"
+	waiting.inflight = false
+	waiting.NextAttempt = now.Add(time.Hour)
+	mgr.messages[waiting.ID] = waiting
+
+	finished := newTestRecord(OutboxDestinationEndpoint)
+	finished.ID = "finished"
+	finished.finish(now.Add(-constants.AgentOutboxRetention - time.Second))
+	mgr.messages[finished.ID] = finished
+
+	mgr.dispatch(context.Background())
+
+	if expired.Status != OutboxStatusExpired || expired.Data != nil || len(expired.Targets) != 0 {
+		t.Errorf("Status = %s, Targets = %v; expected %s without targets and data", expired.Status, expired.Targets, OutboxStatusExpired)
+	}
+	for _, recipient := range expired.Recipients {
+		if recipient.Outcome != DeliveryOutcomeExpired || recipient.Error != "webhook returned 500" {
+			t.Errorf("Recipient = %+v; expected %s with the last error", recipient, DeliveryOutcomeExpired)
+		}
+	}
+	if len(expired.Recipients) != 2 {
+		t.Errorf("Recipients = %v; expected a and b", expired.Recipients)
+	}
+	stored := &outboxRecord{}
+	if _, err := database.GetJSON(mgr.database, outboxKeyPrefix+expired.ID, stored); err != nil || stored.Status != OutboxStatusExpired {
+		t.Errorf("stored Status = %s, err = %v; expected %s", stored.Status, err, OutboxStatusExpired)
+	}
+
+	if waiting.Status != OutboxStatusPending || waiting.inflight {
+		t.Errorf("waiting message was attempted before its next attempt")
+	}
+	if _, ok := mgr.messages[finished.ID]; ok {
+		t.Errorf("finished message past its retention wasn't forgotten")
+	}
+}
+
+func TestOutboxRecord(t *testing.T) {
+	mgr := newTestOutbox()
+
+	if err := mgr.Record("delivered", "source", "a", "receiver", delivered("a").recipients, nil); err != nil {
+		t.Fatalf("Record() failed: %v", err)
+	}
+	if err := mgr.Record("unreachable", "source", "b", "receiver", nil, errors.New("agent unreachable")); err != nil {
+		t.Fatalf("Record() failed: %v", err)
+	}
+
+	message, err := mgr.GetMessage("source", "delivered")
+	if err != nil || message.Status != OutboxStatusDelivered || message.LastError != "" {
+		t.Errorf("GetMessage() = %+v, %v; expected %s", message, err, OutboxStatusDelivered)
+	}
+	message, err = mgr.GetMessage("source", "unreachable")
+	if err != nil || message.Status != OutboxStatusUndelivered || message.LastError != "agent unreachable" {
+		t.Fatalf("GetMessage() = %+v, %v; expected %s with the error", message, err, OutboxStatusUndelivered)
+	}
+	if len(message.Recipients) != 1 || message.Recipients[0].Outcome != DeliveryOutcomeUnreachable {
+		t.Errorf("Recipients = %v; expected b unreachable", message.Recipients)
+	}
+}
@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+	pb "github.com/pajtaand/dmap-zero/internal/proto"
+	"github.com/rs/zerolog/log"
+)
+
+// RestartPolicy describes how the agent restarts a module whose container exited.
+type RestartPolicy struct {
+	Policy     string
+	MaxRetries int // on-failure only, 0 means unlimited
+}
+
+func NewRestartPolicyNever() *RestartPolicy {
+	return &RestartPolicy{
+		Policy: constants.ModuleRestartPolicyNever,
+	}
+}
+
+func RestartPolicyFromProto(policy *pb.RestartPolicy) *RestartPolicy {
+	if policy == nil || policy.Policy == "" {
+		return NewRestartPolicyNever()
+	}
+	return &RestartPolicy{
+		Policy:     policy.Policy,
+		MaxRetries: int(policy.MaxRetries),
+	}
+}
+
+// Supervise periodically checks module containers and restarts the exited ones according
+// to their restart policy.
+func (mgr *ModuleManager) Supervise(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			// context cancelled
+			return
+		default:
+			for _, module := range mgr.ListModules() {
+				mgr.superviseModule(module)
+			}
+		}
+		time.Sleep(constants.AgentModuleSupervisionInterval)
+	}
+}
+
+func (mgr *ModuleManager) superviseModule(module *Module) {
+	moduleID := module.GetID()
+
+	info, err := mgr.dockerWrapper.InspectContainer(context.Background(), module.GetContainerID())
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to inspect module container: moduleID=%s", moduleID)
+		return
+	}
+	if info.State == nil || (info.State.Status != "exited" && info.State.Status != "dead") {
+		return
+	}
+
+	policy := module.GetRestartPolicy()
+	switch policy.Policy {
+	case constants.ModuleRestartPolicyAlways:
+	case constants.ModuleRestartPolicyOnFailure:
+		if info.State.ExitCode == 0 {
+			return
+		}
+		if policy.MaxRetries > 0 && module.GetRestartCount() >= policy.MaxRetries {
+			return
+		}
+	default:
+		return
+	}
+
+	module.mu.Lock()
+	if module.nextRestart.IsZero() {
+		// exit noticed for the first time, schedule the restart
+		startedAt, _ := time.Parse(time.RFC3339Nano, info.State.StartedAt)
+		finishedAt, _ := time.Parse(time.RFC3339Nano, info.State.FinishedAt)
+		if finishedAt.Sub(startedAt) >= constants.AgentModuleStableRunTime {
+			module.consecutiveFailures = 0
+			module.crashLoop = false
+		}
+
+		backoff := constants.AgentModuleRestartBackoffMax
+		if module.consecutiveFailures < 32 {
+			backoff = min(constants.AgentModuleRestartBackoffMin<<module.consecutiveFailures, constants.AgentModuleRestartBackoffMax)
+		}
+		module.consecutiveFailures++
+		if module.consecutiveFailures >= constants.AgentModuleCrashLoopThreshold && !module.crashLoop {
+			module.crashLoop = true
+			log.Warn().Msgf("Module is crash looping: moduleID=%s, consecutiveFailures=%d", moduleID, module.consecutiveFailures)
+		}
+		module.nextRestart = time.Now().Add(backoff)
+		module.mu.Unlock()
+
+		log.Info().Msgf("Module exited, scheduling restart: moduleID=%s, exitCode=%d, backoff=%s", moduleID, info.State.ExitCode, backoff)
+		return
+	}
+	if time.Now().Before(module.nextRestart) {
+		module.mu.Unlock()
+		return
+	}
+	module.nextRestart = time.Time{}
+	module.mu.Unlock()
+
+	if !mgr.ModuleExists(moduleID) {
+		return // module was stopped in the meantime
+	}
+
+	log.Info().Msgf("Restarting module: moduleID=%s", moduleID)
+	if err := mgr.dockerWrapper.StartContainer(context.Background(), module.GetContainerID()); err != nil {
+		log.Error().Err(err).Msgf("Failed to restart module: moduleID=%s", moduleID)
+		return
+	}
+
+	module.mu.Lock()
+	module.restartCount++
+	module.mu.Unlock()
+}
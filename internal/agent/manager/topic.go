@@ -0,0 +1,144 @@
+package manager
+
+import (
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+)
+
+var topicPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,254}$`)
+
+// ValidTopic reports whether the name can be used as a topic.
+func ValidTopic(topic string) bool {
+	return topicPattern.MatchString(topic)
+}
+
+// TopicManager keeps the topic subscriptions of the local modules and the agents other modules
+// subscribed to the topics on. The subscriptions of the other agents are learned from the
+// controller, which collects the local ones on phonehome.
+type TopicManager struct {
+	mu            sync.RWMutex
+	subscriptions map[string]map[string]bool // module IDs by topic
+	remote        map[string][]string        // agent identities by topic
+}
+
+func NewTopicManager() (*TopicManager, error) {
+	log.Debug().Msg("Creating new TopicManager")
+
+	return &TopicManager{
+		subscriptions: map[string]map[string]bool{},
+		remote:        map[string][]string{},
+	}, nil
+}
+
+func (mgr *TopicManager) Subscribe(topic, moduleID string) {
+	log.Info().Msgf("Subscribing to topic: topic=%s, moduleID=%s", topic, moduleID)
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	modules, ok := mgr.subscriptions[topic]
+	if !ok {
+		modules = map[string]bool{}
+		mgr.subscriptions[topic] = modules
+	}
+	modules[moduleID] = true
+}
+
+func (mgr *TopicManager) Unsubscribe(topic, moduleID string) error {
+	log.Info().Msgf("Unsubscribing from topic: topic=%s, moduleID=%s", topic, moduleID)
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	modules, ok := mgr.subscriptions[topic]
+	if !ok || !modules[moduleID] {
+		return errs.ErrNotFound
+	}
+	delete(modules, moduleID)
+	if len(modules) == 0 {
+		delete(mgr.subscriptions, topic)
+	}
+	return nil
+}
+
+// RemoveModule drops all subscriptions of the module.
+func (mgr *TopicManager) RemoveModule(moduleID string) {
+	log.Info().Msgf("Removing topic subscriptions of module: %s", moduleID)
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	for topic, modules := range mgr.subscriptions {
+		delete(modules, moduleID)
+		if len(modules) == 0 {
+			delete(mgr.subscriptions, topic)
+		}
+	}
+}
+
+// ListTopics returns the topics the module is subscribed to.
+func (mgr *TopicManager) ListTopics(moduleID string) []string {
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	topics := []string{}
+	for topic, modules := range mgr.subscriptions {
+		if modules[moduleID] {
+			topics = append(topics, topic)
+		}
+	}
+	slices.Sort(topics)
+	return topics
+}
+
+// Subscribers returns the local modules subscribed to the topic.
+func (mgr *TopicManager) Subscribers(topic string) []string {
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	modules := []string{}
+	for moduleID := range mgr.subscriptions[topic] {
+		modules = append(modules, moduleID)
+	}
+	slices.Sort(modules)
+	return modules
+}
+
+// Subscriptions returns the subscribed local modules by topic.
+func (mgr *TopicManager) Subscriptions() map[string][]string {
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	subscriptions := map[string][]string{}
+	for topic, modules := range mgr.subscriptions {
+		for moduleID := range modules {
+			subscriptions[topic] = append(subscriptions[topic], moduleID)
+		}
+		slices.Sort(subscriptions[topic])
+	}
+	return subscriptions
+}
+
+// SetRemoteSubscribers replaces the agents with modules subscribed to each topic.
+func (mgr *TopicManager) SetRemoteSubscribers(remote map[string][]string) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	if remote == nil {
+		remote = map[string][]string{}
+	}
+	mgr.remote = remote
+}
+
+// RemoteSubscribers returns the other agents with modules subscribed to the topic.
+func (mgr *TopicManager) RemoteSubscribers(topic string) []string {
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	return slices.Clone(mgr.remote[topic])
+}
@@ -1,10 +1,14 @@
 package manager
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"sync"
 
 	"github.com/rs/zerolog/log"
@@ -12,6 +16,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/pajtaand/dmap-zero/internal/agent/dto"
 	"github.com/pajtaand/dmap-zero/internal/agent/rest/models"
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
 	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
 	"github.com/pajtaand/dmap-zero/internal/common/utils"
 )
@@ -206,21 +211,34 @@ func (mgr *WebhookManager) WebhookExists(sourceModuleID, webhookID string) (bool
 	return ok, nil
 }
 
-func (mgr *WebhookManager) SendData(sourceEndpointID, receiverModuleID string, event dto.WebhookEvent, data []byte) error {
-	log.Info().Msgf("Sending data to webhook: sourceModuleID=%s, receiverModuleID=%s, event=%s", sourceEndpointID, receiverModuleID, event)
+// SendData delivers the data to the webhooks of the receiver module, the module is reached at
+// the given host on its given port.
+func (mgr *WebhookManager) SendData(sourceEndpointID, messageID, receiverModuleID, receiverHost string, event dto.WebhookEvent, data []byte) error {
+	log.Info().Msgf("Sending data to webhook: sourceModuleID=%s, messageID=%s, receiverModuleID=%s, event=%s", sourceEndpointID, messageID, receiverModuleID, event)
 
-	// prepare payload
-	base64String := base64.StdEncoding.EncodeToString(data)
-	webhookData := models.WebhookData{
-		SourceEndpointID: sourceEndpointID,
-		Blob:             base64String,
+	payload, err := webhookPayload(sourceEndpointID, messageID, "", data)
+	if err != nil {
+		return err
 	}
+	return mgr.sendPayload(receiverModuleID, receiverHost, event, payload)
+}
 
-	payload, err := json.Marshal(webhookData)
+// SendTopicData delivers the data published to the topic to the topic webhooks of the receiver
+// module.
+func (mgr *WebhookManager) SendTopicData(sourceEndpointID, messageID, topic, receiverModuleID, receiverHost string, data []byte) error {
+	log.Info().Msgf("Sending topic data to webhook: sourceModuleID=%s, messageID=%s, receiverModuleID=%s, topic=%s", sourceEndpointID, messageID, receiverModuleID, topic)
+
+	payload, err := webhookPayload(sourceEndpointID, messageID, topic, data)
 	if err != nil {
-		return fmt.Errorf("failed to marshal data into JSON: %v", err)
+		return err
 	}
+	return mgr.sendPayload(receiverModuleID, receiverHost, dto.EventTopicData, payload)
+}
 
+// sendPayload delivers the payload to all webhooks of the receiver module registered for the
+// event. The delivery succeeds only when every webhook accepted it, it returns ErrNotFound when
+// the module registered no webhook for the event.
+func (mgr *WebhookManager) sendPayload(receiverModuleID, receiverHost string, event dto.WebhookEvent, payload []byte) error {
 	// send payload to all registered urls concurrently
 	webhooks, err := mgr.ListWebhooksForEvent(receiverModuleID, event)
 	if err != nil {
@@ -228,8 +246,7 @@ func (mgr *WebhookManager) SendData(sourceEndpointID, receiverModuleID string, e
 	}
 
 	if len(webhooks) == 0 {
-		log.Debug().Msg("No webhooks registered. Skipping...")
-		return nil
+		return fmt.Errorf("%w: module has no %s webhook", errs.ErrNotFound, event)
 	}
 
 	var wg sync.WaitGroup
@@ -238,7 +255,7 @@ func (mgr *WebhookManager) SendData(sourceEndpointID, receiverModuleID string, e
 	for _, webhook := range webhooks {
 		wg.Add(1)
 		go func(URLPath, port string, res chan bool) {
-			address := fmt.Sprintf("http://localhost:%s%s", port, URLPath)
+			address := fmt.Sprintf("http://%s%s", net.JoinHostPort(receiverHost, port), URLPath)
 			log.Debug().Msgf("Sending data to webhook: %s", address)
 			err := utils.SendPOSTRequest(address, payload)
 			if err != nil {
@@ -252,12 +269,87 @@ func (mgr *WebhookManager) SendData(sourceEndpointID, receiverModuleID string, e
 	wg.Wait()
 	close(results)
 
-	// succeed if at least one call was successfully
+	failed := 0
 	for result := range results {
-		if result {
-			return nil
+		if !result {
+			failed++
 		}
 	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d registered webhook urls were not reached", failed, len(webhooks))
+	}
+	return nil
+}
 
-	return fmt.Errorf("none of %d registered webhook urls were reached", len(webhooks))
+// CallWebhook delivers the call to the call webhooks of the receiver module one at a time and
+// returns the response of the first webhook that answers. It returns ErrNotFound when the module
+// registered no call webhook.
+func (mgr *WebhookManager) CallWebhook(ctx context.Context, sourceEndpointID, messageID, receiverModuleID, receiverHost string, data []byte) ([]byte, error) {
+	log.Info().Msgf("Calling webhook: sourceModuleID=%s, receiverModuleID=%s, messageID=%s", sourceEndpointID, receiverModuleID, messageID)
+
+	payload, err := webhookPayload(sourceEndpointID, messageID, "", data)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks, err := mgr.ListWebhooksForEvent(receiverModuleID, dto.EventEndpointCall)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %v", err)
+	}
+	if len(webhooks) == 0 {
+		return nil, fmt.Errorf("%w: module has no %s webhook", errs.ErrNotFound, dto.EventEndpointCall)
+	}
+
+	for _, webhook := range webhooks {
+		address := fmt.Sprintf("http://%s%s", net.JoinHostPort(receiverHost, webhook.GetPort()), webhook.GetURLPath())
+		log.Debug().Msgf("Calling webhook: %s", address)
+		reply, err := utils.SendPOSTRequestWithReply(ctx, address, payload, constants.AgentEndpointCallMaxReplySize)
+		if err == nil {
+			return reply, nil
+		}
+		log.Warn().Msgf("failed to call webhook: %v", err)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, fmt.Errorf("none of %d registered webhook urls answered", len(webhooks))
+}
+
+// SendStream delivers the stream to a stream webhook of the receiver module as the raw request
+// body. A stream can be read only once, so it's delivered to a single webhook. It returns
+// ErrNotFound when the module registered no stream webhook.
+func (mgr *WebhookManager) SendStream(ctx context.Context, sourceEndpointID, messageID, receiverModuleID, receiverHost string, body io.Reader) error {
+	log.Info().Msgf("Sending stream to webhook: sourceModuleID=%s, receiverModuleID=%s, messageID=%s", sourceEndpointID, receiverModuleID, messageID)
+
+	webhooks, err := mgr.ListWebhooksForEvent(receiverModuleID, dto.EventEndpointStream)
+	if err != nil {
+		return fmt.Errorf("failed to list webhooks: %v", err)
+	}
+	if len(webhooks) == 0 {
+		return fmt.Errorf("%w: module has no %s webhook", errs.ErrNotFound, dto.EventEndpointStream)
+	}
+
+	webhook := webhooks[0]
+	address := fmt.Sprintf("http://%s%s", net.JoinHostPort(receiverHost, webhook.GetPort()), webhook.GetURLPath())
+	log.Debug().Msgf("Sending stream to webhook: %s", address)
+	header := http.Header{}
+	header.Set(constants.AgentWebhookHeaderSourceEndpoint, sourceEndpointID)
+	if messageID != "" {
+		header.Set(constants.AgentHeaderMessageID, messageID)
+	}
+	return utils.SendPOSTStream(ctx, address, header, body)
+}
+
+func webhookPayload(sourceEndpointID, messageID, topic string, data []byte) ([]byte, error) {
+	payload, err := json.Marshal(models.WebhookData{
+		SourceEndpointID: sourceEndpointID,
+		MessageID:        messageID,
+		Topic:            topic,
+		Blob:             base64.StdEncoding.EncodeToString(data),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal data into JSON: %v", err)
+	}
+	return payload, nil
 }
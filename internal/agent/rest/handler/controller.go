@@ -1,10 +1,12 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/pajtaand/dmap-zero/internal/agent/dto"
 	"github.com/pajtaand/dmap-zero/internal/agent/rest/models"
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
 	"github.com/pajtaand/dmap-zero/internal/common/utils"
 	"github.com/rs/zerolog"
 )
@@ -28,6 +30,13 @@ func (h *controllerHandler) PushBlobToController(w http.ResponseWriter, r *http.
 		panic("user not present in context")
 	}
 
+	ttl, err := ttlParam(r)
+	if err != nil {
+		log.Info().Err(err).Msg("Invalid query parameter: ttl")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+
 	req := &models.ControllerPushRequest{}
 	if err := req.FromHttpRequest(r); err != nil {
 		log.Error().Err(err).Msg("")
@@ -35,15 +44,23 @@ func (h *controllerHandler) PushBlobToController(w http.ResponseWriter, r *http.
 		return
 	}
 
-	if _, err := h.service.PushBlob(ctx, &dto.ControllerPushBlobRequest{
+	resp, err := h.service.PushBlob(ctx, &dto.ControllerPushBlobRequest{
 		SourceModuleID:   user,
 		ReceiverModuleID: req.ReceiverID,
 		Blob:             req.Blob,
-	}); err != nil {
+		TTL:              ttl,
+	})
+	if err != nil {
 		log.Error().Err(err).Msg("")
+		if errors.Is(err, errs.ErrLimitExceeded) {
+			utils.WriteErrorResponse(w, http.StatusServiceUnavailable, nil)
+			return
+		}
 		utils.WriteErrorResponse(w, http.StatusInternalServerError, nil)
 		return
 	}
 
-	utils.WriteResponse(w, http.StatusOK, nil)
+	utils.WriteResponse(w, http.StatusAccepted, &models.BlobPushResponse{
+		ID: resp.ID,
+	})
 }
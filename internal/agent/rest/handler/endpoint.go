@@ -1,11 +1,16 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/pajtaand/dmap-zero/internal/agent/dto"
 	"github.com/pajtaand/dmap-zero/internal/agent/rest/models"
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
 	"github.com/pajtaand/dmap-zero/internal/common/utils"
 	"github.com/rs/zerolog"
 )
@@ -61,6 +66,109 @@ func (h *endpointHandler) PushBlobToEndpoint(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	ttl, err := ttlParam(r)
+	if err != nil {
+		log.Info().Err(err).Msg("Invalid query parameter: ttl")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+
+	blob, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	resp, err := h.service.PushBlob(r.Context(), &dto.EndpointPushBlobRequest{
+		SourceModuleID:     user,
+		ReceiverIdentityID: ID,
+		ReceiverModuleID:   user,
+		Blob:               blob,
+		TTL:                ttl,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		if errors.Is(err, errs.ErrLimitExceeded) {
+			utils.WriteErrorResponse(w, http.StatusServiceUnavailable, nil)
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, nil)
+		return
+	}
+
+	utils.WriteResponse(w, http.StatusAccepted, &models.BlobPushResponse{
+		ID: resp.ID,
+	})
+}
+
+func (h *endpointHandler) PushStreamToEndpoint(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	ctx := r.Context()
+	user, ok := utils.GetUser(ctx)
+	if !ok {
+		panic("user not present in context")
+	}
+
+	ID := r.URL.Query().Get("id")
+	if ID == "" {
+		log.Info().Msg("Missing query parameter: ID")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	// the body is passed on as it is read, it's never held in memory as a whole
+	resp, err := h.service.PushStream(r.Context(), &dto.EndpointPushStreamRequest{
+		SourceModuleID:     user,
+		ReceiverIdentityID: ID,
+		ReceiverModuleID:   user,
+		Body:               r.Body,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, nil)
+		return
+	}
+
+	w.Header().Set(constants.AgentHeaderMessageID, resp.ID)
+	if !resp.Delivered {
+		utils.WriteErrorResponse(w, http.StatusBadGateway, nil)
+		return
+	}
+	utils.WriteResponse(w, http.StatusOK, &models.StreamPushResponse{
+		ID:   resp.ID,
+		Size: resp.Size,
+	})
+}
+
+func (h *endpointHandler) CallEndpoint(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	ctx := r.Context()
+	user, ok := utils.GetUser(ctx)
+	if !ok {
+		panic("user not present in context")
+	}
+
+	ID := r.URL.Query().Get("id")
+	if ID == "" {
+		log.Info().Msg("Missing query parameter: ID")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	timeout := constants.AgentEndpointCallTimeout
+	if s := r.URL.Query().Get("timeout"); s != "" {
+		t, err := time.ParseDuration(s)
+		if err != nil || t <= 0 || t > constants.AgentEndpointCallMaxTimeout {
+			log.Info().Msgf("Invalid query parameter: timeout=%s", s)
+			utils.WriteErrorResponse(w, http.StatusBadRequest, fmt.Errorf("timeout must be a duration up to %v", constants.AgentEndpointCallMaxTimeout))
+			return
+		}
+		timeout = t
+	}
+
 	blob, err := io.ReadAll(r.Body)
 	if err != nil {
 		log.Error().Err(err).Msg("")
@@ -68,16 +176,29 @@ func (h *endpointHandler) PushBlobToEndpoint(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if _, err := h.service.PushBlob(r.Context(), &dto.EndpointPushBlobRequest{
+	resp, err := h.service.Call(r.Context(), &dto.EndpointCallRequest{
 		SourceModuleID:     user,
 		ReceiverIdentityID: ID,
 		ReceiverModuleID:   user,
 		Blob:               blob,
-	}); err != nil {
+		Timeout:            timeout,
+	})
+	if err != nil {
 		log.Error().Err(err).Msg("")
 		utils.WriteErrorResponse(w, http.StatusInternalServerError, nil)
 		return
 	}
 
-	utils.WriteResponse(w, http.StatusOK, nil)
+	w.Header().Set(constants.AgentHeaderMessageID, resp.ID)
+	if resp.TimedOut {
+		utils.WriteErrorResponse(w, http.StatusGatewayTimeout, nil)
+		return
+	}
+	if !resp.Delivered {
+		utils.WriteErrorResponse(w, http.StatusBadGateway, nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp.Reply)
 }
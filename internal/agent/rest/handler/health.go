@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/pajtaand/dmap-zero/internal/agent/dto"
+	"github.com/pajtaand/dmap-zero/internal/agent/rest/models"
+	"github.com/pajtaand/dmap-zero/internal/common/utils"
+	"github.com/rs/zerolog"
+)
+
+type healthHandler struct {
+	service HealthService
+}
+
+func NewHealthHandler(service HealthService) *healthHandler {
+	return &healthHandler{
+		service: service,
+	}
+}
+
+func (h *healthHandler) ReportHealth(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	ctx := r.Context()
+	user, ok := utils.GetUser(ctx)
+	if !ok {
+		panic("user not present in context")
+	}
+
+	req := &models.HealthReportRequest{}
+	if err := req.FromHttpRequest(r); err != nil {
+		log.Error().Err(err).Msg("")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	if _, err := h.service.ReportHealth(ctx, &dto.ReportHealthRequest{
+		SourceModuleID: user,
+		Healthy:        *req.Healthy,
+	}); err != nil {
+		log.Error().Err(err).Msg("")
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, nil)
+		return
+	}
+
+	utils.WriteResponse(w, http.StatusOK, nil)
+}
@@ -13,6 +13,8 @@ type ControllerService interface {
 type EndpointService interface {
 	ListEndpoints(ctx context.Context, req *dto.ListEndpointsRequest) (*dto.ListEndpointsResponse, error)
 	PushBlob(ctx context.Context, req *dto.EndpointPushBlobRequest) (*dto.EndpointPushBlobResponse, error)
+	PushStream(ctx context.Context, req *dto.EndpointPushStreamRequest) (*dto.EndpointPushStreamResponse, error)
+	Call(ctx context.Context, req *dto.EndpointCallRequest) (*dto.EndpointCallResponse, error)
 }
 
 type WebhookService interface {
@@ -20,3 +22,18 @@ type WebhookService interface {
 	RegisterWebhook(ctx context.Context, req *dto.RegisterWebhookRequest) (*dto.RegisterWebhookResponse, error)
 	DeleteWebhook(ctx context.Context, req *dto.DeleteWebhookRequest) (*dto.DeleteWebhookResponse, error)
 }
+
+type TopicService interface {
+	ListTopics(ctx context.Context, req *dto.ListTopicsRequest) (*dto.ListTopicsResponse, error)
+	Subscribe(ctx context.Context, req *dto.SubscribeTopicRequest) (*dto.SubscribeTopicResponse, error)
+	Unsubscribe(ctx context.Context, req *dto.UnsubscribeTopicRequest) (*dto.UnsubscribeTopicResponse, error)
+	Publish(ctx context.Context, req *dto.PublishTopicRequest) (*dto.PublishTopicResponse, error)
+}
+
+type OutboxService interface {
+	GetMessage(ctx context.Context, req *dto.GetOutboxMessageRequest) (*dto.GetOutboxMessageResponse, error)
+}
+
+type HealthService interface {
+	ReportHealth(ctx context.Context, req *dto.ReportHealthRequest) (*dto.ReportHealthResponse, error)
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pajtaand/dmap-zero/internal/agent/dto"
+	"github.com/pajtaand/dmap-zero/internal/agent/rest/models"
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	"github.com/pajtaand/dmap-zero/internal/common/utils"
+	"github.com/rs/zerolog"
+)
+
+type outboxHandler struct {
+	service OutboxService
+}
+
+func NewOutboxHandler(service OutboxService) *outboxHandler {
+	return &outboxHandler{
+		service: service,
+	}
+}
+
+func (h *outboxHandler) GetMessage(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	ctx := r.Context()
+	user, ok := utils.GetUser(ctx)
+	if !ok {
+		panic("user not present in context")
+	}
+
+	message, err := h.service.GetMessage(r.Context(), &dto.GetOutboxMessageRequest{
+		SourceModuleID: user,
+		ID:             chi.URLParam(r, "messageID"),
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		if errors.Is(err, errs.ErrNotFound) {
+			utils.WriteErrorResponse(w, http.StatusNotFound, nil)
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, nil)
+		return
+	}
+
+	recipients := []models.DeliveryRecipient{}
+	for _, recipient := range message.Recipients {
+		recipients = append(recipients, models.DeliveryRecipient{
+			IdentityID: recipient.IdentityID,
+			ModuleID:   recipient.ModuleID,
+			Outcome:    recipient.Outcome,
+			Error:      recipient.Error,
+		})
+	}
+	resp := &models.OutboxMessage{
+		ID:                 message.ID,
+		Destination:        message.Destination,
+		ReceiverIdentityID: message.ReceiverIdentityID,
+		ReceiverModuleID:   message.ReceiverModuleID,
+		Topic:              message.Topic,
+		Status:             message.Status,
+		Attempts:           message.Attempts,
+		LastError:          message.LastError,
+		CreatedAt:          message.CreatedAt,
+		ExpiresAt:          message.ExpiresAt,
+		Recipients:         recipients,
+	}
+	if !message.FinishedAt.IsZero() {
+		resp.FinishedAt = &message.FinishedAt
+	}
+	utils.WriteResponse(w, http.StatusOK, resp)
+}
+
+// ttlParam returns how long the outbox tries to deliver the message, given by the ttl query
+// parameter.
+func ttlParam(r *http.Request) (time.Duration, error) {
+	s := r.URL.Query().Get("ttl")
+	if s == "" {
+		return constants.AgentOutboxDefaultTTL, nil
+	}
+	ttl, err := time.ParseDuration(s)
+	if err != nil || ttl <= 0 || ttl > constants.AgentOutboxMaxTTL {
+		return 0, fmt.Errorf("ttl must be a duration up to %v", constants.AgentOutboxMaxTTL)
+	}
+	return ttl, nil
+}
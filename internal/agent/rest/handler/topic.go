@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pajtaand/dmap-zero/internal/agent/dto"
+	"github.com/pajtaand/dmap-zero/internal/agent/manager"
+	"github.com/pajtaand/dmap-zero/internal/agent/rest/models"
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	"github.com/pajtaand/dmap-zero/internal/common/utils"
+	"github.com/rs/zerolog"
+)
+
+type topicHandler struct {
+	service TopicService
+}
+
+func NewTopicHandler(service TopicService) *topicHandler {
+	return &topicHandler{
+		service: service,
+	}
+}
+
+func (h *topicHandler) ListTopics(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	ctx := r.Context()
+	user, ok := utils.GetUser(ctx)
+	if !ok {
+		panic("user not present in context")
+	}
+
+	topics, err := h.service.ListTopics(r.Context(), &dto.ListTopicsRequest{
+		SourceModuleID: user,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, nil)
+		return
+	}
+
+	resp := []*models.TopicSubscription{}
+	for _, topic := range topics.Topics {
+		resp = append(resp, &models.TopicSubscription{
+			Topic: topic,
+		})
+	}
+	utils.WriteResponse(w, http.StatusOK, &resp)
+}
+
+func (h *topicHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	ctx := r.Context()
+	user, ok := utils.GetUser(ctx)
+	if !ok {
+		panic("user not present in context")
+	}
+
+	topic, ok := topicParam(r)
+	if !ok {
+		log.Info().Msgf("Invalid topic: %s", chi.URLParam(r, "topic"))
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	if _, err := h.service.Subscribe(r.Context(), &dto.SubscribeTopicRequest{
+		SourceModuleID: user,
+		Topic:          topic,
+	}); err != nil {
+		log.Error().Err(err).Msg("")
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, nil)
+		return
+	}
+
+	utils.WriteResponse(w, http.StatusNoContent, nil)
+}
+
+func (h *topicHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	ctx := r.Context()
+	user, ok := utils.GetUser(ctx)
+	if !ok {
+		panic("user not present in context")
+	}
+
+	topic, ok := topicParam(r)
+	if !ok {
+		log.Info().Msgf("Invalid topic: %s", chi.URLParam(r, "topic"))
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	if _, err := h.service.Unsubscribe(r.Context(), &dto.UnsubscribeTopicRequest{
+		SourceModuleID: user,
+		Topic:          topic,
+	}); err != nil {
+		log.Error().Err(err).Msg("")
+		if errors.Is(err, errs.ErrNotFound) {
+			utils.WriteErrorResponse(w, http.StatusNotFound, nil)
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, nil)
+		return
+	}
+
+	utils.WriteResponse(w, http.StatusNoContent, nil)
+}
+
+func (h *topicHandler) Publish(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	ctx := r.Context()
+	user, ok := utils.GetUser(ctx)
+	if !ok {
+		panic("user not present in context")
+	}
+
+	topic, ok := topicParam(r)
+	if !ok {
+		log.Info().Msgf("Invalid topic: %s", chi.URLParam(r, "topic"))
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	ttl, err := ttlParam(r)
+	if err != nil {
+		log.Info().Err(err).Msg("Invalid query parameter: ttl")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+
+	blob, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	resp, err := h.service.Publish(r.Context(), &dto.PublishTopicRequest{
+		SourceModuleID: user,
+		Topic:          topic,
+		Blob:           blob,
+		TTL:            ttl,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		if errors.Is(err, errs.ErrLimitExceeded) {
+			utils.WriteErrorResponse(w, http.StatusServiceUnavailable, nil)
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, nil)
+		return
+	}
+
+	utils.WriteResponse(w, http.StatusAccepted, &models.BlobPushResponse{
+		ID: resp.ID,
+	})
+}
+
+func topicParam(r *http.Request) (string, bool) {
+	topic := chi.URLParam(r, "topic")
+	return topic, manager.ValidTopic(topic)
+}
@@ -7,6 +7,8 @@ import (
 type EndpointHandler interface {
 	ListEndpoints(w http.ResponseWriter, r *http.Request)
 	PushBlobToEndpoint(w http.ResponseWriter, r *http.Request)
+	PushStreamToEndpoint(w http.ResponseWriter, r *http.Request)
+	CallEndpoint(w http.ResponseWriter, r *http.Request)
 }
 
 type ControllerHandler interface {
@@ -18,3 +20,18 @@ type WebhookHandler interface {
 	RegisterWebhook(w http.ResponseWriter, r *http.Request)
 	DeleteWebhook(w http.ResponseWriter, r *http.Request)
 }
+
+type TopicHandler interface {
+	ListTopics(w http.ResponseWriter, r *http.Request)
+	Subscribe(w http.ResponseWriter, r *http.Request)
+	Unsubscribe(w http.ResponseWriter, r *http.Request)
+	Publish(w http.ResponseWriter, r *http.Request)
+}
+
+type OutboxHandler interface {
+	GetMessage(w http.ResponseWriter, r *http.Request)
+}
+
+type HealthHandler interface {
+	ReportHealth(w http.ResponseWriter, r *http.Request)
+}
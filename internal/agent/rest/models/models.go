@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/pajtaand/dmap-zero/internal/common/utils"
 )
@@ -18,6 +19,37 @@ type BlobPushRequest struct {
 	ID string `json:"id"`
 }
 
+type BlobPushResponse struct {
+	ID string `json:"id"` // ID of the message in the outbox
+}
+
+type StreamPushResponse struct {
+	ID   string `json:"id"`   // ID of the message, its status is kept in the outbox
+	Size int64  `json:"size"` // number of bytes delivered
+}
+
+type OutboxMessage struct {
+	ID                 string              `json:"id"`
+	Destination        string              `json:"destination"`
+	ReceiverIdentityID string              `json:"receiverIdentityID,omitempty"`
+	ReceiverModuleID   string              `json:"receiverModuleID,omitempty"`
+	Topic              string              `json:"topic,omitempty"`
+	Status             string              `json:"status"`
+	Attempts           int                 `json:"attempts"`
+	LastError          string              `json:"lastError,omitempty"`
+	CreatedAt          time.Time           `json:"createdAt"`
+	ExpiresAt          time.Time           `json:"expiresAt"`
+	FinishedAt         *time.Time          `json:"finishedAt,omitempty"`
+	Recipients         []DeliveryRecipient `json:"recipients"`
+}
+
+type DeliveryRecipient struct {
+	IdentityID string `json:"identityID,omitempty"` // agent the module runs on, or the controller
+	ModuleID   string `json:"moduleID,omitempty"`
+	Outcome    string `json:"outcome"`
+	Error      string `json:"error,omitempty"`
+}
+
 type Webhook struct {
 	ID      string `json:"id"`
 	URLPath string `json:"urlPath"`
@@ -80,5 +112,25 @@ func (req *ControllerPushRequest) FromHttpRequest(r *http.Request) error {
 
 type WebhookData struct {
 	SourceEndpointID string `json:"sourceEndpointID"`
+	MessageID        string `json:"messageID,omitempty"`
+	Topic            string `json:"topic,omitempty"`
 	Blob             string `json:"blob"`
 }
+
+type TopicSubscription struct {
+	Topic string `json:"topic"`
+}
+
+type HealthReportRequest struct {
+	Healthy *bool `json:"healthy"`
+}
+
+func (req *HealthReportRequest) FromHttpRequest(r *http.Request) error {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return err
+	}
+	if err := utils.CheckNotNil(req, "Healthy"); err != nil {
+		return err
+	}
+	return nil
+}
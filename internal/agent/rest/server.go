@@ -3,8 +3,11 @@ package rest
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"sync"
 
 	"github.com/rs/zerolog/log"
 
@@ -17,6 +20,9 @@ import (
 type RESTServer struct {
 	r      chi.Router
 	server *http.Server
+
+	mu        sync.Mutex
+	listeners map[string]net.Listener // additional addresses bound with Bind
 }
 
 func NewRESTServer(
@@ -24,20 +30,30 @@ func NewRESTServer(
 	endpointService handler.EndpointService,
 	controllerService handler.ControllerService,
 	webhookService handler.WebhookService,
+	topicService handler.TopicService,
+	outboxService handler.OutboxService,
+	healthService handler.HealthService,
 ) *RESTServer {
 	baseAuthMiddleware := m.BasicAuth("api", authenticator)
 	endpointHandler := handler.NewEndpointHandler(endpointService)
 	controllerHandler := handler.NewControllerHandler(controllerService)
 	webhookHandler := handler.NewWebhookHandler(webhookService)
+	topicHandler := handler.NewTopicHandler(topicService)
+	outboxHandler := handler.NewOutboxHandler(outboxService)
+	healthHandler := handler.NewHealthHandler(healthService)
 
 	r := chi.NewRouter()
 	srv := &RESTServer{
-		r: r,
+		r:         r,
+		listeners: map[string]net.Listener{},
 	}
 	srv.addHandlers(
 		endpointHandler,
 		controllerHandler,
 		webhookHandler,
+		topicHandler,
+		outboxHandler,
+		healthHandler,
 		baseAuthMiddleware,
 	)
 	return srv
@@ -45,6 +61,7 @@ func NewRESTServer(
 
 func (srv *RESTServer) Run(addr string, cert *tls.Certificate) error {
 	log.Info().Msgf("Listening on https://%s/", addr)
+	srv.mu.Lock()
 	srv.server = &http.Server{
 		Addr:    addr,
 		Handler: srv.r,
@@ -52,9 +69,55 @@ func (srv *RESTServer) Run(addr string, cert *tls.Certificate) error {
 			Certificates: []tls.Certificate{*cert},
 		},
 	}
+	srv.mu.Unlock()
 	return srv.server.ListenAndServeTLS("", "")
 }
 
+// Bind serves the API on another address of the running server, e.g. the gateway of a module
+// network.
+func (srv *RESTServer) Bind(addr string) error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.server == nil {
+		return fmt.Errorf("failed to bind %s: not running", addr)
+	}
+	if _, ok := srv.listeners[addr]; ok {
+		return nil
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to bind %s: %v", addr, err)
+	}
+	srv.listeners[addr] = ln
+
+	log.Info().Msgf("Listening on https://%s/", addr)
+	go func() {
+		if err := srv.server.ServeTLS(ln, "", ""); err != nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msgf("Failed to serve on %s", addr)
+		}
+	}()
+	return nil
+}
+
+// Unbind stops serving the API on an address bound with Bind.
+func (srv *RESTServer) Unbind(addr string) error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	ln, ok := srv.listeners[addr]
+	if !ok {
+		return nil
+	}
+	delete(srv.listeners, addr)
+
+	log.Info().Msgf("Stopped listening on https://%s/", addr)
+	if err := ln.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return fmt.Errorf("failed to unbind %s: %v", addr, err)
+	}
+	return nil
+}
+
 func (srv *RESTServer) Stop(ctx context.Context) error {
 	if srv.server == nil {
 		return fmt.Errorf("failed to stop server: not running")
@@ -72,6 +135,9 @@ func (srv *RESTServer) addHandlers(
 	endpointHandler EndpointHandler,
 	controllerHandler ControllerHandler,
 	webhookHandler WebhookHandler,
+	topicHandler TopicHandler,
+	outboxHandler OutboxHandler,
+	healthHandler HealthHandler,
 	authMiddleware func(next http.Handler) http.Handler,
 ) {
 	srv.r.Use(middleware.RequestID)
@@ -84,6 +150,8 @@ func (srv *RESTServer) addHandlers(
 		r.Route("/endpoint", func(r chi.Router) {
 			r.Get("/", endpointHandler.ListEndpoints)
 			r.Post("/push", endpointHandler.PushBlobToEndpoint)
+			r.Post("/stream", endpointHandler.PushStreamToEndpoint)
+			r.Post("/call", endpointHandler.CallEndpoint)
 		})
 		r.Route("/controller", func(r chi.Router) {
 			r.Post("/push", controllerHandler.PushBlobToController)
@@ -93,5 +161,17 @@ func (srv *RESTServer) addHandlers(
 			r.Post("/", webhookHandler.RegisterWebhook)
 			r.Delete("/", webhookHandler.DeleteWebhook)
 		})
+		r.Route("/topic", func(r chi.Router) {
+			r.Get("/", topicHandler.ListTopics)
+			r.Post("/{topic}/subscription", topicHandler.Subscribe)
+			r.Delete("/{topic}/subscription", topicHandler.Unsubscribe)
+			r.Post("/{topic}/publish", topicHandler.Publish)
+		})
+		r.Route("/outbox", func(r chi.Router) {
+			r.Get("/{messageID}", outboxHandler.GetMessage)
+		})
+		r.Route("/health", func(r chi.Router) {
+			r.Post("/", healthHandler.ReportHealth)
+		})
 	})
 }
@@ -6,21 +6,21 @@ import (
 	"fmt"
 
 	"github.com/pajtaand/dmap-zero/internal/agent/dto"
-	pb "github.com/pajtaand/dmap-zero/internal/proto"
+	"github.com/pajtaand/dmap-zero/internal/agent/manager"
 	"github.com/rs/zerolog"
 )
 
 type controllerService struct {
-	receiveServiceClient pb.ReceiveServiceClient
+	outboxManager *manager.OutboxManager
 }
 
-func NewControllerService(receiveServiceClient pb.ReceiveServiceClient) (*controllerService, error) {
-	if receiveServiceClient == nil {
-		return nil, errors.New("ReceiveServiceClient must not be nil")
+func NewControllerService(outboxManager *manager.OutboxManager) (*controllerService, error) {
+	if outboxManager == nil {
+		return nil, errors.New("OutboxManager must not be nil")
 	}
 
 	return &controllerService{
-		receiveServiceClient: receiveServiceClient,
+		outboxManager: outboxManager,
 	}, nil
 }
 
@@ -28,15 +28,13 @@ func (svc *controllerService) PushBlob(ctx context.Context, request *dto.Control
 	log := zerolog.Ctx(ctx)
 	log.Info().Msg("Push blob request")
 
-	if _, err := svc.receiveServiceClient.PushData(ctx, &pb.ModuleControllerData{
-		Receiver: request.ReceiverModuleID,
-		Sender: &pb.ModuleIdentifier{
-			Id: request.SourceModuleID,
-		},
-		Data: request.Blob,
-	}); err != nil {
-		log.Error().Err(err).Msg("failed to send data to controller")
-		return nil, fmt.Errorf("failed to send data to controller: %v", err)
+	// the outbox delivers the data once the controller is reachable
+	messageID, err := svc.outboxManager.Enqueue(manager.OutboxDestinationController, request.SourceModuleID, "", request.ReceiverModuleID, request.Blob, request.TTL)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to enqueue data for controller")
+		return nil, fmt.Errorf("failed to enqueue data for controller: %w", err)
 	}
-	return &dto.ControllerPushBlobResponse{}, nil
+	return &dto.ControllerPushBlobResponse{
+		ID: messageID,
+	}, nil
 }
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 
+	"github.com/google/uuid"
 	"github.com/pajtaand/dmap-zero/internal/agent/dto"
 	"github.com/pajtaand/dmap-zero/internal/agent/manager"
 	"github.com/rs/zerolog"
@@ -12,14 +14,19 @@ import (
 
 type endpointService struct {
 	endpointManager *manager.EndpointManager
+	outboxManager   *manager.OutboxManager
 }
 
-func NewEndpointService(endpointManager *manager.EndpointManager) (*endpointService, error) {
+func NewEndpointService(endpointManager *manager.EndpointManager, outboxManager *manager.OutboxManager) (*endpointService, error) {
 	if endpointManager == nil {
 		return nil, errors.New("EndpointManager must not be nil")
 	}
+	if outboxManager == nil {
+		return nil, errors.New("OutboxManager must not be nil")
+	}
 	return &endpointService{
 		endpointManager: endpointManager,
+		outboxManager:   outboxManager,
 	}, nil
 }
 
@@ -48,8 +55,93 @@ func (svc *endpointService) PushBlob(ctx context.Context, request *dto.EndpointP
 	log := zerolog.Ctx(ctx)
 	log.Info().Msg("Push blob request")
 
-	if err := svc.endpointManager.SendData(ctx, request.ReceiverIdentityID, request.ReceiverModuleID, request.Blob); err != nil {
-		return nil, fmt.Errorf("failed to send data to IdentityID=%s, ModuleID=%s, reason: %v", request.ReceiverIdentityID, request.ReceiverModuleID, err)
+	// the outbox delivers the data once the other agent is reachable
+	messageID, err := svc.outboxManager.Enqueue(manager.OutboxDestinationEndpoint, request.SourceModuleID, request.ReceiverIdentityID, request.ReceiverModuleID, request.Blob, request.TTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue data for IdentityID=%s, ModuleID=%s, reason: %w", request.ReceiverIdentityID, request.ReceiverModuleID, err)
+	}
+	return &dto.EndpointPushBlobResponse{
+		ID: messageID,
+	}, nil
+}
+
+func (svc *endpointService) PushStream(ctx context.Context, request *dto.EndpointPushStreamRequest) (*dto.EndpointPushStreamResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Push stream request")
+
+	messageID := uuid.New().String()
+	size, recipients, err := svc.endpointManager.SendStream(ctx, request.ReceiverIdentityID, request.ReceiverModuleID, messageID, request.Body)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Failed to stream data to IdentityID=%s, ModuleID=%s after %d bytes", request.ReceiverIdentityID, request.ReceiverModuleID, size)
+	} else {
+		log.Info().Msgf("Streamed %d bytes to IdentityID=%s, ModuleID=%s", size, request.ReceiverIdentityID, request.ReceiverModuleID)
 	}
-	return &dto.EndpointPushBlobResponse{}, nil
+
+	recorded, err := svc.record(messageID, request.SourceModuleID, request.ReceiverIdentityID, request.ReceiverModuleID, recipients, err)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.EndpointPushStreamResponse{
+		ID:         messageID,
+		Size:       size,
+		Delivered:  delivered(recorded),
+		Recipients: recorded,
+	}, nil
+}
+
+func (svc *endpointService) Call(ctx context.Context, request *dto.EndpointCallRequest) (*dto.EndpointCallResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Call request")
+
+	ctx, cancel := context.WithTimeout(ctx, request.Timeout)
+	defer cancel()
+
+	messageID := uuid.New().String()
+	reply, recipients, err := svc.endpointManager.Call(ctx, request.ReceiverIdentityID, request.ReceiverModuleID, messageID, request.Blob)
+	timedOut := errors.Is(err, context.DeadlineExceeded)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Failed to call IdentityID=%s, ModuleID=%s", request.ReceiverIdentityID, request.ReceiverModuleID)
+	}
+
+	recorded, err := svc.record(messageID, request.SourceModuleID, request.ReceiverIdentityID, request.ReceiverModuleID, recipients, err)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.EndpointCallResponse{
+		ID:         messageID,
+		Reply:      reply,
+		Delivered:  delivered(recorded),
+		TimedOut:   timedOut,
+		Recipients: recorded,
+	}, nil
+}
+
+// record stores the outcome of the message delivered directly to the other agent and returns its
+// recipients as recorded.
+func (svc *endpointService) record(messageID, sourceModuleID, receiverIdentityID, receiverModuleID string, recipients []manager.DeliveryRecipient, deliveryErr error) ([]dto.DeliveryRecipient, error) {
+	if err := svc.outboxManager.Record(messageID, sourceModuleID, receiverIdentityID, receiverModuleID, recipients, deliveryErr); err != nil {
+		return nil, fmt.Errorf("failed to record message %s, reason: %v", messageID, err)
+	}
+	message, err := svc.outboxManager.GetMessage(sourceModuleID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message %s, reason: %v", messageID, err)
+	}
+	result := []dto.DeliveryRecipient{}
+	for _, recipient := range message.Recipients {
+		result = append(result, dto.DeliveryRecipient{
+			IdentityID: recipient.IdentityID,
+			ModuleID:   recipient.ModuleID,
+			Outcome:    string(recipient.Outcome),
+			Error:      recipient.Error,
+		})
+	}
+	return result, nil
+}
+
+// delivered reports whether none of the receivers failed to get the message, receivers which
+// took it without reporting the outcome count as delivered.
+func delivered(recipients []dto.DeliveryRecipient) bool {
+	return !slices.ContainsFunc(recipients, func(recipient dto.DeliveryRecipient) bool {
+		return recipient.Outcome != string(manager.DeliveryOutcomeDelivered) && recipient.Outcome != string(manager.DeliveryOutcomeUnconfirmed)
+	})
 }
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/pajtaand/dmap-zero/internal/agent/dto"
+	"github.com/pajtaand/dmap-zero/internal/agent/manager"
+	"github.com/rs/zerolog"
+)
+
+type healthService struct {
+	moduleManager *manager.ModuleManager
+}
+
+func NewHealthService(moduleManager *manager.ModuleManager) (*healthService, error) {
+	if moduleManager == nil {
+		return nil, errors.New("ModuleManager must not be nil")
+	}
+	return &healthService{
+		moduleManager: moduleManager,
+	}, nil
+}
+
+func (svc *healthService) ReportHealth(ctx context.Context, request *dto.ReportHealthRequest) (*dto.ReportHealthResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Report health request")
+
+	module, err := svc.moduleManager.GetModule(request.SourceModuleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get module: %v", err)
+	}
+
+	module.ReportLiveness(request.Healthy)
+	return &dto.ReportHealthResponse{}, nil
+}
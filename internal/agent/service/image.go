@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
 
 	"github.com/pajtaand/dmap-zero/internal/agent/manager"
 	pb "github.com/pajtaand/dmap-zero/internal/proto"
@@ -59,44 +58,13 @@ func (svc *imageService) GetImage(ctx context.Context, identifier *pb.ImageIdent
 
 	log.Info().Msgf("Retrieving image information: imageID=%s", identifier.Id)
 	return &pb.ImageInfo{
-		Id:   image.GetID(),
-		Name: image.GetName(),
-		Size: int64(image.GetSize()),
+		Id:     image.GetID(),
+		Name:   image.GetName(),
+		Size:   int64(image.GetSize()),
+		Digest: image.GetDigest(),
 	}, nil
 }
 
-func (svc *imageService) PushImage(stream pb.ImageService_PushImageServer) error {
-	log := zerolog.Ctx(stream.Context())
-	log.Info().Msg("Push image request")
-
-	var imageID, imageName string
-	var imageData []byte
-	for {
-		chunk, err := stream.Recv()
-		if err != nil {
-			if err == io.EOF {
-				log.Info().Msgf("Image successfully received: imageID=%s, imageName=%s", imageID, imageName)
-
-				if _, err := svc.imageManager.AddImageWithID(imageID, imageName, imageData); err != nil {
-					err := fmt.Errorf("failed to add image to the ImageManager: imageID=%s, imageName=%s", imageID, imageName)
-					log.Error().Err(err).Msg("")
-					return err
-				}
-
-				return stream.SendAndClose(&emptypb.Empty{})
-			}
-			log.Info().Msgf("Image upload failed: imageID=%s, imageName=%s, err: %v", imageID, imageName, err)
-			return err
-		}
-		if imageName == "" {
-			imageID = chunk.Id
-			imageName = chunk.Name
-			log.Info().Msgf("Image upload started: imageID=%s, imageName=%s", imageID, imageName)
-		}
-		imageData = append(imageData, chunk.Content...)
-	}
-}
-
 func (svc *imageService) RemoveImage(ctx context.Context, identifier *pb.ImageIdentifier) (*emptypb.Empty, error) {
 	log := zerolog.Ctx(ctx)
 	log.Info().Msgf("Remove image request: imageID=%s", identifier.Id)
@@ -1,14 +1,20 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/rs/zerolog"
 
 	"github.com/pajtaand/dmap-zero/internal/agent/manager"
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
 	pb "github.com/pajtaand/dmap-zero/internal/proto"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
@@ -19,9 +25,10 @@ type moduleService struct {
 	imageManager   *manager.ImageManager
 	configManager  *manager.ConfigManager
 	webhookManager *manager.WebhookManager
+	topicManager   *manager.TopicManager
 }
 
-func NewModuleService(moduleManager *manager.ModuleManager, imageManager *manager.ImageManager, configManager *manager.ConfigManager, webhookManager *manager.WebhookManager) (pb.ModuleServiceServer, error) {
+func NewModuleService(moduleManager *manager.ModuleManager, imageManager *manager.ImageManager, configManager *manager.ConfigManager, webhookManager *manager.WebhookManager, topicManager *manager.TopicManager) (pb.ModuleServiceServer, error) {
 	if moduleManager == nil {
 		return nil, errors.New("ModuleManager must not be nil")
 	}
@@ -34,12 +41,16 @@ func NewModuleService(moduleManager *manager.ModuleManager, imageManager *manage
 	if webhookManager == nil {
 		return nil, errors.New("WebhookManager must not be nil")
 	}
+	if topicManager == nil {
+		return nil, errors.New("TopicManager must not be nil")
+	}
 
 	return &moduleService{
 		moduleManager:  moduleManager,
 		imageManager:   imageManager,
 		configManager:  configManager,
 		webhookManager: webhookManager,
+		topicManager:   topicManager,
 	}, nil
 }
 
@@ -49,7 +60,7 @@ func (svc *moduleService) StartModule(ctx context.Context, cfg *pb.ModuleConfigu
 
 	moduleID := cfg.Module.Id
 	imageID := cfg.Image.Id
-	moduleCfg := svc.configManager.GetConfiguration()
+	moduleCfg := maps.Clone(svc.configManager.GetConfiguration())
 
 	// extend agent's configuration with module configuration
 	for k, v := range cfg.Env {
@@ -64,7 +75,39 @@ func (svc *moduleService) StartModule(ctx context.Context, cfg *pb.ModuleConfigu
 	}
 	imageRef := image.GetReference()
 
-	log.Info().Msgf("Starting module moduleID=%s, imageID=%s, moduleCfg=%v", moduleID, imageID, moduleCfg)
+	resources := manager.ModuleResourcesFromProto(cfg.Resources)
+	security := manager.ModuleSecurityFromProto(cfg.Security)
+	storage := manager.ModuleStorageFromProto(cfg.Storage)
+	if err := svc.moduleManager.CheckRevision(moduleID, int(cfg.Revision), moduleCfg, cfg.Secrets, resources, security, storage); err != nil {
+		err := fmt.Errorf("module revision can't run, moduleID=%s, err: %v", moduleID, err)
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+
+	// module might have been already started by the reconciliation loop
+	if module, err := svc.moduleManager.GetModule(moduleID); err == nil {
+		if module.GetRevision() != int(cfg.Revision) && module.RunsSpec(imageRef, moduleCfg, cfg.Secrets, resources, security, storage) {
+			module.SetRevision(int(cfg.Revision))
+		}
+		if module.GetRevision() == int(cfg.Revision) && module.HasSecrets(cfg.Secrets) {
+			log.Info().Msgf("Module is already running, moduleID=%s", moduleID)
+			return &emptypb.Empty{}, nil
+		}
+		// another revision is running, it is replaced
+		log.Info().Msgf("Replacing module revision, moduleID=%s, revision=%d, desiredRevision=%d", moduleID, module.GetRevision(), cfg.Revision)
+		if err := svc.moduleManager.StopModule(moduleID); err != nil {
+			err := fmt.Errorf("failed to stop module: %v", err)
+			log.Error().Err(err).Msg("")
+			return nil, err
+		}
+		if err := svc.webhookManager.RemoveModule(moduleID); err != nil {
+			err := fmt.Errorf("failed to remove module from webhook manager: %v", err)
+			log.Error().Err(err).Msg("")
+			return nil, err
+		}
+	}
+
+	log.Info().Msgf("Starting module moduleID=%s, revision=%d, imageID=%s, moduleCfg=%v", moduleID, cfg.Revision, imageID, moduleCfg)
 
 	if err := svc.webhookManager.AddModule(moduleID); err != nil {
 		err := fmt.Errorf("failed to add module to webhook manager: %v", err)
@@ -72,7 +115,7 @@ func (svc *moduleService) StartModule(ctx context.Context, cfg *pb.ModuleConfigu
 		return nil, err
 	}
 
-	if _, err := svc.moduleManager.StartModule(moduleID, imageRef, moduleCfg); err != nil {
+	if _, err := svc.moduleManager.StartModule(moduleID, int(cfg.Revision), imageRef, moduleCfg, cfg.Secrets, resources, security, storage, manager.RestartPolicyFromProto(cfg.RestartPolicy)); err != nil {
 		err := fmt.Errorf("failed to start module: %v", err)
 		log.Error().Err(err).Msg("")
 		return nil, err
@@ -96,6 +139,164 @@ func (svc *moduleService) StopModule(ctx context.Context, module *pb.ModuleIdent
 		log.Error().Err(err).Msg("")
 		return nil, err
 	}
+	svc.topicManager.RemoveModule(module.Id)
+
+	if err := svc.moduleManager.RemoveVolumes(module.Id, constants.ModuleVolumeRetentionUntilStop); err != nil {
+		err := fmt.Errorf("failed to remove module volumes: %v", err)
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
 
 	return &emptypb.Empty{}, nil
 }
+
+func (svc *moduleService) StreamLogs(req *pb.ModuleLogsRequest, stream pb.ModuleService_StreamLogsServer) error {
+	log := zerolog.Ctx(stream.Context())
+	log.Info().Msg("Stream logs request")
+
+	moduleID := req.GetModule().GetId()
+	logs, err := svc.moduleManager.GetModuleLogs(stream.Context(), moduleID, container.LogsOptions{
+		Since:      req.Since,
+		Tail:       req.Tail,
+		Follow:     req.Follow,
+		Timestamps: req.Timestamps,
+	})
+	if err != nil {
+		err := fmt.Errorf("failed to read module logs, moduleID=%s, err: %v", moduleID, err)
+		log.Error().Err(err).Msg("")
+		return err
+	}
+	defer logs.Close()
+	// lets the controller answer before the first line is written
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	// containers run without a TTY, so docker multiplexes both streams into one
+	stdout := &logChunkWriter{stream: stream, name: "stdout"}
+	stderr := &logChunkWriter{stream: stream, name: "stderr"}
+	if _, err := stdcopy.StdCopy(stdout, stderr, logs); err != nil && stream.Context().Err() == nil {
+		err := fmt.Errorf("failed to stream module logs, moduleID=%s, err: %v", moduleID, err)
+		log.Error().Err(err).Msg("")
+		return err
+	}
+	return nil
+}
+
+// logChunkWriter sends everything written to it as log chunks of one stream.
+type logChunkWriter struct {
+	stream pb.ModuleService_StreamLogsServer
+	name   string
+}
+
+func (w *logChunkWriter) Write(p []byte) (int, error) {
+	if err := w.stream.Send(&pb.ModuleLogChunk{
+		Stream: w.name,
+		Data:   bytes.Clone(p),
+	}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (svc *moduleService) Exec(stream pb.ModuleService_ExecServer) error {
+	ctx := stream.Context()
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Exec request")
+
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	start := req.GetStart()
+	if start == nil {
+		return errors.New("exec session must begin with a start request")
+	}
+	moduleID := start.GetModule().GetId()
+
+	session, err := svc.moduleManager.StartExec(ctx, moduleID, start.Command, start.Tty, uint(start.Rows), uint(start.Cols))
+	if err != nil {
+		err := fmt.Errorf("failed to start exec session, moduleID=%s, err: %v", moduleID, err)
+		log.Error().Err(err).Msg("")
+		return err
+	}
+	defer session.Close()
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+	log.Info().Msgf("Exec session started, moduleID=%s, execID=%s, user=%s, command=%q, tty=%v", moduleID, session.GetID(), start.User, start.Command, start.Tty)
+
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				if ctx.Err() != nil {
+					// the session was cancelled, detach even if the command ignores its input
+					session.Close()
+				} else if err := session.CloseStdin(); err != nil {
+					log.Debug().Err(err).Msg("Failed to close exec input")
+				}
+				return
+			}
+			switch r := req.Request.(type) {
+			case *pb.ExecRequest_Stdin:
+				if _, err := session.Write(r.Stdin); err != nil {
+					log.Debug().Err(err).Msg("Failed to write exec input")
+				}
+			case *pb.ExecRequest_Resize:
+				if err := session.Resize(ctx, uint(r.Resize.Rows), uint(r.Resize.Cols)); err != nil {
+					log.Debug().Err(err).Msg("Failed to resize exec terminal")
+				}
+			case *pb.ExecRequest_CloseStdin:
+				if err := session.CloseStdin(); err != nil {
+					log.Debug().Err(err).Msg("Failed to close exec input")
+				}
+			}
+		}
+	}()
+
+	stdout := &execOutputWriter{stream: stream, name: "stdout"}
+	stderr := &execOutputWriter{stream: stream, name: "stderr"}
+	if err := session.CopyOutput(stdout, stderr); err != nil && ctx.Err() == nil {
+		err := fmt.Errorf("failed to stream exec output, moduleID=%s, execID=%s, err: %v", moduleID, session.GetID(), err)
+		log.Error().Err(err).Msg("")
+		return err
+	}
+	if ctx.Err() != nil {
+		log.Info().Msgf("Exec session cancelled, moduleID=%s, execID=%s", moduleID, session.GetID())
+		return ctx.Err()
+	}
+
+	exitCode, err := session.ExitCode(ctx)
+	if err != nil {
+		err := fmt.Errorf("failed to get exec exit code, moduleID=%s, execID=%s, err: %v", moduleID, session.GetID(), err)
+		log.Error().Err(err).Msg("")
+		return err
+	}
+	log.Info().Msgf("Exec session finished, moduleID=%s, execID=%s, exitCode=%d", moduleID, session.GetID(), exitCode)
+	return stream.Send(&pb.ExecResponse{
+		Response: &pb.ExecResponse_ExitCode{
+			ExitCode: int32(exitCode),
+		},
+	})
+}
+
+// execOutputWriter sends everything written to it as exec output of one stream.
+type execOutputWriter struct {
+	stream pb.ModuleService_ExecServer
+	name   string
+}
+
+func (w *execOutputWriter) Write(p []byte) (int, error) {
+	if err := w.stream.Send(&pb.ExecResponse{
+		Response: &pb.ExecResponse_Output{
+			Output: &pb.ExecOutput{
+				Stream: w.name,
+				Data:   bytes.Clone(p),
+			},
+		},
+	}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
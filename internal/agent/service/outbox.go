@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pajtaand/dmap-zero/internal/agent/dto"
+	"github.com/pajtaand/dmap-zero/internal/agent/manager"
+	"github.com/rs/zerolog"
+)
+
+type outboxService struct {
+	outboxManager *manager.OutboxManager
+}
+
+func NewOutboxService(outboxManager *manager.OutboxManager) (*outboxService, error) {
+	if outboxManager == nil {
+		return nil, errors.New("OutboxManager must not be nil")
+	}
+	return &outboxService{
+		outboxManager: outboxManager,
+	}, nil
+}
+
+func (svc *outboxService) GetMessage(ctx context.Context, request *dto.GetOutboxMessageRequest) (*dto.GetOutboxMessageResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msgf("Get outbox message request: messageID=%s", request.ID)
+
+	message, err := svc.outboxManager.GetMessage(request.SourceModuleID, request.ID)
+	if err != nil {
+		return nil, err
+	}
+	recipients := []dto.DeliveryRecipient{}
+	for _, recipient := range message.Recipients {
+		recipients = append(recipients, dto.DeliveryRecipient{
+			IdentityID: recipient.IdentityID,
+			ModuleID:   recipient.ModuleID,
+			Outcome:    string(recipient.Outcome),
+			Error:      recipient.Error,
+		})
+	}
+	return &dto.GetOutboxMessageResponse{
+		ID:                 message.ID,
+		Destination:        string(message.Destination),
+		ReceiverIdentityID: message.ReceiverIdentityID,
+		ReceiverModuleID:   message.ReceiverModuleID,
+		Topic:              message.Topic,
+		Status:             string(message.Status),
+		Attempts:           message.Attempts,
+		LastError:          message.LastError,
+		CreatedAt:          message.CreatedAt,
+		ExpiresAt:          message.ExpiresAt,
+		FinishedAt:         message.FinishedAt,
+		Recipients:         recipients,
+	}, nil
+}
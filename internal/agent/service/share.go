@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 
 	"github.com/pajtaand/dmap-zero/internal/agent/dto"
 	"github.com/pajtaand/dmap-zero/internal/agent/manager"
@@ -12,26 +13,37 @@ import (
 	pb "github.com/pajtaand/dmap-zero/internal/proto"
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc/peer"
-	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 type shareService struct {
 	pb.UnimplementedShareServiceServer
 
 	webhookManager *manager.WebhookManager
+	moduleManager  *manager.ModuleManager
+	topicManager   *manager.TopicManager
 }
 
-func NewShareService(webhookManager *manager.WebhookManager) (pb.ShareServiceServer, error) {
+func NewShareService(webhookManager *manager.WebhookManager, moduleManager *manager.ModuleManager, topicManager *manager.TopicManager) (pb.ShareServiceServer, error) {
 	if webhookManager == nil {
 		return nil, errors.New("WebhookManager must not be nil")
 	}
+	if moduleManager == nil {
+		return nil, errors.New("ModuleManager must not be nil")
+	}
+	if topicManager == nil {
+		return nil, errors.New("TopicManager must not be nil")
+	}
 
 	return &shareService{
 		webhookManager: webhookManager,
+		moduleManager:  moduleManager,
+		topicManager:   topicManager,
 	}, nil
 }
 
-func (svc *shareService) PushData(ctx context.Context, data *pb.ShareData) (*emptypb.Empty, error) {
+// PushData delivers the data to the webhooks of the receiver module and reports the outcome, a
+// failed delivery is reported rather than returned as an error.
+func (svc *shareService) PushData(ctx context.Context, data *pb.ShareData) (*pb.DeliveryReport, error) {
 	log := zerolog.Ctx(ctx)
 	log.Info().Msg("Push data request")
 
@@ -39,16 +51,8 @@ func (svc *shareService) PushData(ctx context.Context, data *pb.ShareData) (*emp
 		return nil, errors.New("data must not be nil")
 	}
 
-	p, ok := peer.FromContext(ctx)
-	if !ok {
-		err := errors.New("failed to get peer from request context")
-		log.Error().Err(err).Msg("")
-		return nil, err
-	}
-
-	_, _, sourceIdentity, err := utils.ParseOpenZitiAddress(p.LocalAddr.String())
+	sourceIdentity, err := callerIdentity(ctx)
 	if err != nil {
-		err := fmt.Errorf("failed to parse source address: %v", err)
 		log.Error().Err(err).Msg("")
 		return nil, err
 	}
@@ -61,11 +65,181 @@ func (svc *shareService) PushData(ctx context.Context, data *pb.ShareData) (*emp
 		eventType = dto.EventEndpointData
 	}
 
-	if err := svc.webhookManager.SendData(sourceIdentity, data.Receiver.Id, eventType, data.Data); err != nil {
-		err := fmt.Errorf("failed to push data to module: %v", err)
+	receiverHost, err := svc.moduleManager.GetModuleHost(data.Receiver.Id)
+	if err != nil {
+		err = fmt.Errorf("failed to get module address: %w", err)
+	} else if err = svc.webhookManager.SendData(sourceIdentity, data.MessageId, data.Receiver.Id, receiverHost, eventType, data.Data); err != nil {
+		err = fmt.Errorf("failed to push data to module: %w", err)
+	}
+	if err != nil {
+		log.Warn().Err(err).Msgf("Message not delivered: messageID=%s", data.MessageId)
+	}
+
+	return &pb.DeliveryReport{
+		Results: []*pb.DeliveryResult{manager.DeliveryResult(data.Receiver.Id, err)},
+	}, nil
+}
+
+// Call delivers the data to a call webhook of the receiver module and returns its reply with the
+// outcome, a failed call is reported rather than returned as an error.
+func (svc *shareService) Call(ctx context.Context, data *pb.ShareData) (*pb.ShareReply, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Call request")
+
+	if data == nil {
+		return nil, errors.New("data must not be nil")
+	}
+
+	sourceIdentity, err := callerIdentity(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+	log.Info().Msgf("Caller identity: %s", sourceIdentity)
+
+	// the caller's deadline travels with the request and bounds the webhook call
+	var reply []byte
+	receiverHost, err := svc.moduleManager.GetModuleHost(data.Receiver.Id)
+	if err != nil {
+		err = fmt.Errorf("failed to get module address: %w", err)
+	} else if reply, err = svc.webhookManager.CallWebhook(ctx, sourceIdentity, data.MessageId, data.Receiver.Id, receiverHost, data.Data); err != nil {
+		err = fmt.Errorf("failed to call module: %w", err)
+	}
+	if err != nil {
+		log.Warn().Err(err).Msgf("Call not delivered: messageID=%s", data.MessageId)
+	}
+
+	return &pb.ShareReply{
+		Data:   reply,
+		Result: manager.DeliveryResult(data.Receiver.Id, err),
+	}, nil
+}
+
+// Publish delivers the data to the local subscribers of the topic and reports the outcome for
+// each of them.
+func (svc *shareService) Publish(ctx context.Context, data *pb.TopicData) (*pb.DeliveryReport, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msgf("Publish request: topic=%s", data.GetTopic())
+
+	if data == nil {
+		return nil, errors.New("data must not be nil")
+	}
+
+	sourceIdentity, err := callerIdentity(ctx)
+	if err != nil {
 		log.Error().Err(err).Msg("")
 		return nil, err
 	}
+	log.Info().Msgf("Caller identity: %s", sourceIdentity)
+
+	// the sender runs on the other agent, so every local subscriber receives the data
+	report := deliverTopicData(svc.topicManager, svc.webhookManager, svc.moduleManager, sourceIdentity, data.MessageId, data.Topic, "", data.Data)
+	if len(report.Results) == 0 {
+		// the subscriptions changed since the sender learned about them
+		report.Results = append(report.Results, &pb.DeliveryResult{
+			Outcome: pb.DeliveryOutcome_DELIVERY_NO_SUBSCRIBER,
+			Error:   "no module is subscribed to the topic",
+		})
+	}
+
+	return report, nil
+}
+
+// PushStream delivers the stream to a stream webhook of the receiver module and reports the
+// outcome, a failed delivery is reported rather than returned as an error. Errors are returned
+// only when the stream itself breaks.
+func (svc *shareService) PushStream(stream pb.ShareService_PushStreamServer) error {
+	ctx := stream.Context()
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Push stream request")
+
+	sourceIdentity, err := callerIdentity(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return err
+	}
+	log.Info().Msgf("Caller identity: %s", sourceIdentity)
 
-	return &emptypb.Empty{}, nil
+	first, err := stream.Recv()
+	if err != nil {
+		err := fmt.Errorf("failed to receive stream: %v", err)
+		log.Error().Err(err).Msg("")
+		return err
+	}
+	if first.Receiver == nil {
+		err := errors.New("receiver must be set in the first message")
+		log.Error().Err(err).Msg("")
+		return err
+	}
+
+	receiverHost, err := svc.moduleManager.GetModuleHost(first.Receiver.Id)
+	if err != nil {
+		err := fmt.Errorf("failed to get module address: %w", err)
+		log.Warn().Err(err).Msgf("Stream not delivered: messageID=%s", first.MessageId)
+		return stream.SendAndClose(&pb.DeliveryReport{
+			Results: []*pb.DeliveryResult{manager.DeliveryResult(first.Receiver.Id, err)},
+		})
+	}
+
+	// the chunks are passed to the webhook request as they arrive, a broken stream aborts it
+	body, bodyWriter := io.Pipe()
+	var streamErr error
+	streamDone := make(chan struct{})
+	go func() {
+		defer close(streamDone)
+		data := first.Data
+		for {
+			if len(data) > 0 {
+				if _, err := bodyWriter.Write(data); err != nil {
+					return // the webhook request ended
+				}
+			}
+			chunk, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				bodyWriter.Close()
+				return
+			}
+			if err != nil {
+				streamErr = err
+				bodyWriter.CloseWithError(err)
+				return
+			}
+			data = chunk.Data
+		}
+	}()
+
+	err = svc.webhookManager.SendStream(ctx, sourceIdentity, first.MessageId, first.Receiver.Id, receiverHost, body)
+	// unblocks the chunks when the webhook didn't read the whole body
+	body.Close()
+	if err != nil {
+		select {
+		case <-streamDone:
+			if streamErr != nil {
+				err := fmt.Errorf("failed to receive stream: %v", streamErr)
+				log.Error().Err(err).Msg("")
+				return err
+			}
+		default:
+		}
+		err = fmt.Errorf("failed to stream data to module: %w", err)
+		log.Warn().Err(err).Msgf("Stream not delivered: messageID=%s", first.MessageId)
+	}
+
+	return stream.SendAndClose(&pb.DeliveryReport{
+		Results: []*pb.DeliveryResult{manager.DeliveryResult(first.Receiver.Id, err)},
+	})
+}
+
+// callerIdentity returns the OpenZiti identity of the agent or controller which sent the request.
+func callerIdentity(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", errors.New("failed to get peer from request context")
+	}
+
+	_, _, sourceIdentity, err := utils.ParseOpenZitiAddress(p.LocalAddr.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to parse source address: %v", err)
+	}
+	return sourceIdentity, nil
 }
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/pajtaand/dmap-zero/internal/agent/dto"
+	"github.com/pajtaand/dmap-zero/internal/agent/manager"
+	pb "github.com/pajtaand/dmap-zero/internal/proto"
+	"github.com/rs/zerolog"
+)
+
+type topicService struct {
+	topicManager   *manager.TopicManager
+	webhookManager *manager.WebhookManager
+	moduleManager  *manager.ModuleManager
+	outboxManager  *manager.OutboxManager
+	identityName   string
+}
+
+func NewTopicService(topicManager *manager.TopicManager, webhookManager *manager.WebhookManager, moduleManager *manager.ModuleManager, outboxManager *manager.OutboxManager, identityName string) (*topicService, error) {
+	if topicManager == nil {
+		return nil, errors.New("TopicManager must not be nil")
+	}
+	if webhookManager == nil {
+		return nil, errors.New("WebhookManager must not be nil")
+	}
+	if moduleManager == nil {
+		return nil, errors.New("ModuleManager must not be nil")
+	}
+	if outboxManager == nil {
+		return nil, errors.New("OutboxManager must not be nil")
+	}
+	return &topicService{
+		topicManager:   topicManager,
+		webhookManager: webhookManager,
+		moduleManager:  moduleManager,
+		outboxManager:  outboxManager,
+		identityName:   identityName,
+	}, nil
+}
+
+func (svc *topicService) Subscribe(ctx context.Context, request *dto.SubscribeTopicRequest) (*dto.SubscribeTopicResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Subscribe topic request")
+
+	svc.topicManager.Subscribe(request.Topic, request.SourceModuleID)
+	return &dto.SubscribeTopicResponse{}, nil
+}
+
+func (svc *topicService) Unsubscribe(ctx context.Context, request *dto.UnsubscribeTopicRequest) (*dto.UnsubscribeTopicResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Unsubscribe topic request")
+
+	if err := svc.topicManager.Unsubscribe(request.Topic, request.SourceModuleID); err != nil {
+		return nil, err
+	}
+	return &dto.UnsubscribeTopicResponse{}, nil
+}
+
+func (svc *topicService) ListTopics(ctx context.Context, request *dto.ListTopicsRequest) (*dto.ListTopicsResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("List topics request")
+
+	return &dto.ListTopicsResponse{
+		Topics: svc.topicManager.ListTopics(request.SourceModuleID),
+	}, nil
+}
+
+// Publish delivers the data to the modules subscribed to the topic on this agent and queues it in
+// the outbox for the other agents with subscribed modules. The publishing module doesn't receive
+// its own data. The outcomes of all subscribers are recorded under the returned message ID.
+func (svc *topicService) Publish(ctx context.Context, request *dto.PublishTopicRequest) (*dto.PublishTopicResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msgf("Publish topic request: topic=%s", request.Topic)
+
+	messageID := uuid.New().String()
+	report := deliverTopicData(svc.topicManager, svc.webhookManager, svc.moduleManager, svc.identityName, messageID, request.Topic, request.SourceModuleID, request.Blob)
+	recipients := []manager.DeliveryRecipient{}
+	if len(report.Results) > 0 {
+		recipients = manager.DeliveryRecipients(svc.identityName, "", report)
+	}
+
+	identityIDs := []string{}
+	for _, identityID := range svc.topicManager.RemoteSubscribers(request.Topic) {
+		if identityID != svc.identityName {
+			identityIDs = append(identityIDs, identityID)
+		}
+	}
+
+	if err := svc.outboxManager.EnqueueTopic(messageID, request.SourceModuleID, request.Topic, identityIDs, recipients, request.Blob, request.TTL); err != nil {
+		return nil, fmt.Errorf("failed to enqueue message: %w", err)
+	}
+	return &dto.PublishTopicResponse{
+		ID: messageID,
+	}, nil
+}
+
+// deliverTopicData delivers the data published to the topic to the subscribed modules on this
+// agent, except for the module given to skip, and reports the outcome for each of them.
+func deliverTopicData(topicManager *manager.TopicManager, webhookManager *manager.WebhookManager, moduleManager *manager.ModuleManager, sourceIdentity, messageID, topic, skipModuleID string, data []byte) *pb.DeliveryReport {
+	report := &pb.DeliveryReport{}
+	for _, moduleID := range topicManager.Subscribers(topic) {
+		if moduleID == skipModuleID {
+			continue
+		}
+		receiverHost, err := moduleManager.GetModuleHost(moduleID)
+		if err != nil {
+			err = fmt.Errorf("failed to get module address: %w", err)
+		} else if err = webhookManager.SendTopicData(sourceIdentity, messageID, topic, moduleID, receiverHost, data); err != nil {
+			err = fmt.Errorf("failed to deliver data to module: %w", err)
+		}
+		report.Results = append(report.Results, manager.DeliveryResult(moduleID, err))
+	}
+	return report
+}
@@ -0,0 +1,247 @@
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+)
+
+const (
+	digestPrefix = "sha256:"
+	blobsDir     = "blobs"
+	partialDir   = "partial"
+)
+
+// BlobStore keeps binary blobs on disk addressed by their SHA-256 digest. Blobs are written to
+// a partial file first and moved into place only once their digest was verified.
+type BlobStore struct {
+	dir string
+}
+
+func NewBlobStore(dir string) (*BlobStore, error) {
+	if dir == "" {
+		return nil, errors.New("directory must not be empty")
+	}
+	for _, sub := range []string{blobsDir, partialDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o750); err != nil {
+			return nil, fmt.Errorf("failed to create blob directory: %v", err)
+		}
+	}
+	return &BlobStore{
+		dir: dir,
+	}, nil
+}
+
+// NewTempBlobStore creates a BlobStore in a new temporary directory.
+func NewTempBlobStore() (*BlobStore, error) {
+	dir, err := os.MkdirTemp("", "blobs-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	return NewBlobStore(dir)
+}
+
+// ValidateDigest checks the digest has the form sha256:<64 lowercase hex characters>.
+func ValidateDigest(digest string) error {
+	hexDigest, ok := strings.CutPrefix(digest, digestPrefix)
+	if !ok {
+		return fmt.Errorf("digest must start with '%s': %s", digestPrefix, digest)
+	}
+	if len(hexDigest) != sha256.Size*2 || strings.ToLower(hexDigest) != hexDigest {
+		return fmt.Errorf("invalid digest: %s", digest)
+	}
+	if _, err := hex.DecodeString(hexDigest); err != nil {
+		return fmt.Errorf("invalid digest: %s", digest)
+	}
+	return nil
+}
+
+func formatDigest(h hash.Hash) string {
+	return digestPrefix + hex.EncodeToString(h.Sum(nil))
+}
+
+func (s *BlobStore) blobPath(digest string) string {
+	return filepath.Join(s.dir, blobsDir, strings.TrimPrefix(digest, digestPrefix))
+}
+
+func (s *BlobStore) partialPath(digest string) string {
+	return filepath.Join(s.dir, partialDir, strings.TrimPrefix(digest, digestPrefix))
+}
+
+// Put streams src into the store and returns the digest and size of the written blob.
+func (s *BlobStore) Put(src io.Reader) (string, int64, error) {
+	tmp, err := os.CreateTemp(filepath.Join(s.dir, partialDir), "upload-")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), src)
+	if err != nil {
+		tmp.Close()
+		return "", 0, fmt.Errorf("failed to write blob: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", 0, fmt.Errorf("failed to sync blob: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, fmt.Errorf("failed to close blob: %v", err)
+	}
+
+	digest := formatDigest(h)
+	if err := os.Rename(tmp.Name(), s.blobPath(digest)); err != nil {
+		return "", 0, fmt.Errorf("failed to store blob: %v", err)
+	}
+	return digest, size, nil
+}
+
+// Open opens the blob for reading, errs.ErrNotFound is returned when it isn't stored.
+func (s *BlobStore) Open(digest string) (*os.File, error) {
+	if err := ValidateDigest(digest); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(s.blobPath(digest))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errs.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to open blob: %v", err)
+	}
+	return f, nil
+}
+
+func (s *BlobStore) Exists(digest string) bool {
+	if ValidateDigest(digest) != nil {
+		return false
+	}
+	_, err := os.Stat(s.blobPath(digest))
+	return err == nil
+}
+
+// Delete removes the blob and any partial data of it.
+func (s *BlobStore) Delete(digest string) error {
+	if err := ValidateDigest(digest); err != nil {
+		return err
+	}
+	for _, path := range []string{s.blobPath(digest), s.partialPath(digest)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove blob: %v", err)
+		}
+	}
+	return nil
+}
+
+// OpenPartial opens the partial blob of the given digest for appending. Data written by an
+// earlier, interrupted transfer is kept, so the transfer can continue from Offset.
+func (s *BlobStore) OpenPartial(digest string) (*PartialBlob, error) {
+	if err := ValidateDigest(digest); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(s.partialPath(digest), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open partial blob: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to stat partial blob: %v", err)
+	}
+	return &PartialBlob{
+		store:  s,
+		digest: digest,
+		file:   f,
+		offset: info.Size(),
+	}, nil
+}
+
+// PartialBlob is a blob being transferred, it is not readable from the store until committed.
+type PartialBlob struct {
+	store  *BlobStore
+	digest string
+	file   *os.File
+	offset int64
+}
+
+// Offset returns the number of bytes already written.
+func (p *PartialBlob) Offset() int64 {
+	return p.offset
+}
+
+func (p *PartialBlob) Write(b []byte) (int, error) {
+	n, err := p.file.Write(b)
+	p.offset += int64(n)
+	return n, err
+}
+
+// Append writes data that starts at the given offset of the blob. Bytes that were already
+// written are skipped, so a sender may restart from an older offset; a gap is an error.
+func (p *PartialBlob) Append(offset int64, data []byte) error {
+	if offset > p.offset {
+		return fmt.Errorf("data doesn't continue the partial blob: offset=%d, expected=%d", offset, p.offset)
+	}
+	skip := p.offset - offset
+	if skip >= int64(len(data)) {
+		return nil
+	}
+	if _, err := p.Write(data[skip:]); err != nil {
+		return fmt.Errorf("failed to write partial blob: %v", err)
+	}
+	return nil
+}
+
+// Close closes the partial blob and keeps its data for a later resume.
+func (p *PartialBlob) Close() error {
+	return p.file.Close()
+}
+
+// Discard closes the partial blob and removes its data.
+func (p *PartialBlob) Discard() error {
+	p.file.Close()
+	if err := os.Remove(p.store.partialPath(p.digest)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove partial blob: %v", err)
+	}
+	return nil
+}
+
+// Commit verifies the written data against the digest and moves the blob into the store.
+// On a mismatch the partial data is removed and errs.ErrDigestMismatch is returned.
+func (p *PartialBlob) Commit() error {
+	if err := p.file.Sync(); err != nil {
+		p.file.Close()
+		return fmt.Errorf("failed to sync partial blob: %v", err)
+	}
+	if err := p.file.Close(); err != nil {
+		return fmt.Errorf("failed to close partial blob: %v", err)
+	}
+
+	path := p.store.partialPath(p.digest)
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open partial blob: %v", err)
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to hash partial blob: %v", err)
+	}
+
+	if digest := formatDigest(h); digest != p.digest {
+		os.Remove(path)
+		return fmt.Errorf("%w: expected=%s, actual=%s", errs.ErrDigestMismatch, p.digest, digest)
+	}
+	if err := os.Rename(path, p.store.blobPath(p.digest)); err != nil {
+		return fmt.Errorf("failed to store blob: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package blobstore
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+)
+
+const helloDigest = "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+func TestBlobStore_Put(t *testing.T) {
+	store, err := NewBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewBlobStore() failed: %v", err)
+	}
+
+	digest, size, err := store.Put(bytes.NewReader([]byte("hello")))
+	if err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	if digest != helloDigest || size != 5 {
+		t.Errorf("Put() = %s, %d; expected %s, 5", digest, size, helloDigest)
+	}
+
+	f, err := store.Open(digest)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "hello" {
+		t.Errorf("Open() content = %q; expected %q", data, "hello")
+	}
+
+	if err := store.Delete(digest); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if store.Exists(digest) {
+		t.Errorf("Exists() returned true for deleted blob")
+	}
+	if _, err := store.Open(digest); !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("Open() error = %v; expected %v", err, errs.ErrNotFound)
+	}
+}
+
+func TestBlobStore_PartialResume(t *testing.T) {
+	store, err := NewBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewBlobStore() failed: %v", err)
+	}
+
+	partial, err := store.OpenPartial(helloDigest)
+	if err != nil {
+		t.Fatalf("OpenPartial() failed: %v", err)
+	}
+	if _, err := partial.Write([]byte("hel")); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	partial.Close() // interrupted transfer
+
+	partial, err = store.OpenPartial(helloDigest)
+	if err != nil {
+		t.Fatalf("OpenPartial() failed: %v", err)
+	}
+	if partial.Offset() != 3 {
+		t.Errorf("Offset() = %d; expected 3", partial.Offset())
+	}
+	if _, err := partial.Write([]byte("lo")); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	if err := partial.Commit(); err != nil {
+		t.Fatalf("Commit() failed: %v", err)
+	}
+	if !store.Exists(helloDigest) {
+		t.Errorf("Exists() returned false for committed blob")
+	}
+}
+
+func TestPartialBlob_Append(t *testing.T) {
+	store, err := NewBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewBlobStore() failed: %v", err)
+	}
+
+	partial, err := store.OpenPartial(helloDigest)
+	if err != nil {
+		t.Fatalf("OpenPartial() failed: %v", err)
+	}
+	if err := partial.Append(0, []byte("hel")); err != nil {
+		t.Fatalf("Append() failed: %v", err)
+	}
+	if err := partial.Append(0, []byte("he")); err != nil {
+		t.Fatalf("Append() of already written data failed: %v", err)
+	}
+	if err := partial.Append(4, []byte("o")); err == nil {
+		t.Errorf("Append() with a gap returned nil; expected error")
+	}
+	if err := partial.Append(1, []byte("ello")); err != nil {
+		t.Fatalf("Append() of overlapping data failed: %v", err)
+	}
+	if partial.Offset() != 5 {
+		t.Errorf("Offset() = %d; expected 5", partial.Offset())
+	}
+	if err := partial.Commit(); err != nil {
+		t.Fatalf("Commit() failed: %v", err)
+	}
+}
+
+func TestBlobStore_PartialDigestMismatch(t *testing.T) {
+	store, err := NewBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewBlobStore() failed: %v", err)
+	}
+
+	partial, err := store.OpenPartial(helloDigest)
+	if err != nil {
+		t.Fatalf("OpenPartial() failed: %v", err)
+	}
+	partial.Write([]byte("world"))
+	if err := partial.Commit(); !errors.Is(err, errs.ErrDigestMismatch) {
+		t.Errorf("Commit() error = %v; expected %v", err, errs.ErrDigestMismatch)
+	}
+	if store.Exists(helloDigest) {
+		t.Errorf("Exists() returned true for corrupted blob")
+	}
+
+	partial, err = store.OpenPartial(helloDigest)
+	if err != nil {
+		t.Fatalf("OpenPartial() failed: %v", err)
+	}
+	defer partial.Discard()
+	if partial.Offset() != 0 {
+		t.Errorf("Offset() = %d; expected corrupted data to be removed", partial.Offset())
+	}
+}
+
+func TestValidateDigest(t *testing.T) {
+	for _, digest := range []string{"", "sha256:abc", "md5:" + helloDigest[7:], "sha256:../../etc/passwd", "sha256:" + string(bytes.ToUpper([]byte(helloDigest[7:])))} {
+		if err := ValidateDigest(digest); err == nil {
+			t.Errorf("ValidateDigest(%q) returned nil; expected error", digest)
+		}
+	}
+	if err := ValidateDigest(helloDigest); err != nil {
+		t.Errorf("ValidateDigest(%q) = %v; expected nil", helloDigest, err)
+	}
+}
@@ -13,6 +13,9 @@ const (
 	LoggerKeyUserAgent   = "user_agent"
 	LoggerKeyElapsedTime = "elapsed_ms"
 	LoggerKeyStatusCode  = "status_code"
+	LoggerKeyAudit       = "audit"
+
+	PermissionModuleExec = "module-exec" // interactive sessions in module containers
 
 	OpenZitiIdentityController         = "controller"
 	OpenZitiRoleAgent                  = "agent-role"
@@ -28,18 +31,59 @@ const (
 	ControllerEnvAPICertFile           = "API_CERT_FILE"
 	ControllerEnvAPIKeyFile            = "API_KEY_FILE"
 	ControllerEnvEnrollmentToken       = "ENROLLMENT_TOKEN"
+	ControllerEnvDatabaseFile          = "DATABASE_FILE"
+	ControllerEnvImageDir              = "IMAGE_DIR"
+	ControllerEnvImageSigningKeyFile   = "IMAGE_SIGNING_KEY_FILE"
+	ControllerEnvSecretsKeyFile        = "SECRETS_KEY_FILE"
+	ControllerEnvWebhookCertFile       = "WEBHOOK_CERT_FILE"
+	ControllerEnvWebhookKeyFile        = "WEBHOOK_KEY_FILE"
+	ControllerEnvWebhookCAFile         = "WEBHOOK_CA_FILE"
+	ControllerEnvAPIExecUsers          = "API_EXEC_USERS"
 	ControllerAPIAddress               = "0.0.0.0:6969"
 	ControllerMetricsAPIAddress        = "0.0.0.0:9090"
 	ControllerAgentMaxDiagnosticsDelay = 15 * time.Second
+	ControllerRegistryPullTimeout      = 1 * time.Hour
+	ControllerRegistryDefaultPlatform  = "linux/amd64"
+	ControllerRolloutCheckInterval     = 5 * time.Second
+	ControllerRolloutProgressDeadline  = 5 * time.Minute
+	ControllerMessageRetention         = 24 * time.Hour // delivery outcomes of messages stay queryable
+	ControllerExecAuditLineMax         = 4096           // longer input lines of exec sessions are audited in parts
 
 	// Agent
 	AgentDockerHostAddress               = "127.0.0.1"
-	AgentModuleServerIP                  = "0.0.0.0"
+	AgentModuleHostName                  = "host.docker.internal" // the agent's address on isolated module networks
+	AgentModuleServerIP                  = "127.0.0.1"            // module networks are bound on their gateway
 	AgentModuleServerDefaultPort         = 4499
 	AgentModuleServerCertificateValidity = time.Hour * 24 * 365
 	AgentPhonehomeInterval               = 10 * time.Second
 	AgentPingInterval                    = 60 * time.Second
-	AgentImageStreamChunkSize            = 1024
+	AgentImageStreamChunkSize            = 256 * 1024
+	AgentImageDownloadRetries            = 5
+	AgentImageDownloadRetryDelay         = 2 * time.Second
+	AgentModuleLivenessTimeout           = 30 * time.Second
+	AgentModuleSupervisionInterval       = 5 * time.Second
+	AgentModuleRestartBackoffMin         = 1 * time.Second
+	AgentModuleRestartBackoffMax         = 5 * time.Minute
+	AgentModuleStableRunTime             = 60 * time.Second
+	AgentModuleCrashLoopThreshold        = 5
+	AgentVolumeUsageInterval             = 60 * time.Second
+	AgentEndpointCallTimeout             = 30 * time.Second
+	AgentEndpointCallMaxTimeout          = 5 * time.Minute
+	AgentEndpointCallMaxReplySize        = 3 * 1024 * 1024 // fits into a single gRPC message
+	AgentDataStreamChunkSize             = 256 * 1024
+	AgentWebhookHeaderSourceEndpoint     = "X-Source-Endpoint-ID"
+	AgentHeaderMessageID                 = "X-Message-ID" // message ID of streams and calls, which have no JSON body to carry it
+	AgentOutboxDefaultTTL                = 24 * time.Hour
+	AgentOutboxMaxTTL                    = 7 * 24 * time.Hour
+	AgentOutboxRetention                 = 24 * time.Hour // delivered and expired messages stay queryable
+	AgentOutboxMaxPendingMessages        = 10000
+	AgentOutboxDispatchInterval          = 1 * time.Second
+	AgentOutboxDeliveryTimeout           = 10 * time.Second
+	AgentOutboxRetryBackoffMin           = 1 * time.Second
+	AgentOutboxRetryBackoffMax           = 5 * time.Minute
+	AgentVolumeLabelModule               = "dmap.module"
+	AgentVolumeLabelName                 = "dmap.volume"
+	AgentVolumeLabelRetention            = "dmap.retention"
 
 	// Module
 	ModuleEnvAPIBaseUrl  = "MODULE_API_BASE_URL"
@@ -49,4 +93,28 @@ const (
 	ModuleEnvGivenPort   = "MODULE_GIVEN_PORT"
 	ModulePortRangeMin   = 33000
 	ModulePortRangeMax   = 33999
+
+	// Module restart policies
+	ModuleRestartPolicyNever     = "never"
+	ModuleRestartPolicyOnFailure = "on-failure"
+	ModuleRestartPolicyAlways    = "always"
+
+	// Image sources
+	ImageSourceUpload   = "upload"
+	ImageSourceRegistry = "registry"
+
+	// Image statuses
+	ImageStatusReady   = "ready"
+	ImageStatusPulling = "pulling"
+	ImageStatusFailed  = "failed"
+
+	// Module volume retention policies
+	ModuleVolumeRetentionUntilStop   = "until-stop"   // removed when the module stops on the agent
+	ModuleVolumeRetentionUntilDelete = "until-delete" // removed when the module is deleted
+	ModuleVolumeRetentionForever     = "forever"      // never removed by the agent
+
+	// Module rollout states
+	RolloutStateInProgress = "in-progress"
+	RolloutStateSucceeded  = "succeeded"
+	RolloutStateRolledBack = "rolled-back"
 )
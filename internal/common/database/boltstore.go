@@ -0,0 +1,96 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	boltBucketName  = "dmapz"
+	boltOpenTimeout = 5 * time.Second
+)
+
+// BoltStore is a Database persisted in a single bbolt file on disk.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	log.Debug().Msgf("Opening database file: %s", path)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %v", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(boltBucketName))
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create bucket: %v", err)
+	}
+
+	return &BoltStore{
+		db: db,
+	}, nil
+}
+
+func (s *BoltStore) Set(key string, value []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(boltBucketName)).Put([]byte(key), value)
+	})
+}
+
+func (s *BoltStore) Get(key string) ([]byte, bool, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(boltBucketName)).Get([]byte(key))
+		if v != nil {
+			// values are only valid during the transaction
+			value = bytes.Clone(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return value, value != nil, nil
+}
+
+func (s *BoltStore) Delete(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(boltBucketName)).Delete([]byte(key))
+	})
+}
+
+func (s *BoltStore) Keys(prefix string) ([]string, error) {
+	keys := []string{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(boltBucketName)).Cursor()
+		p := []byte(prefix)
+		for k, _ := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *BoltStore) Close() error {
+	log.Debug().Msg("Closing database")
+	return s.db.Close()
+}
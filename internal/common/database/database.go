@@ -0,0 +1,42 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Database is a key-value storage backend used by managers to persist their state.
+type Database interface {
+	Set(key string, value []byte) error
+	Get(key string) ([]byte, bool, error)
+	Delete(key string) error
+	Keys(prefix string) ([]string, error)
+	Close() error
+}
+
+// SetJSON marshals the value into JSON and stores it under the given key.
+func SetJSON(db Database, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value: key=%s: %v", key, err)
+	}
+	if err := db.Set(key, data); err != nil {
+		return fmt.Errorf("failed to store value: key=%s: %v", key, err)
+	}
+	return nil
+}
+
+// GetJSON loads the value stored under the given key and unmarshals it from JSON.
+func GetJSON(db Database, key string, value interface{}) (bool, error) {
+	data, ok, err := db.Get(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to load value: key=%s: %v", key, err)
+	}
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return false, fmt.Errorf("failed to unmarshal value: key=%s: %v", key, err)
+	}
+	return true, nil
+}
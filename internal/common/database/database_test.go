@@ -0,0 +1,87 @@
+package database
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testDatabase(t *testing.T, db Database) {
+	if err := db.Set("agent/1", []byte("a1")); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if err := db.Set("agent/2", []byte("a2")); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if err := db.Set("module/1", []byte("m1")); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+
+	value, ok, err := db.Get("agent/1")
+	if err != nil || !ok || string(value) != "a1" {
+		t.Errorf("Get(%q) = %q, %v, %v; expected %q, true, nil", "agent/1", value, ok, err, "a1")
+	}
+
+	if _, ok, err := db.Get("agent/3"); err != nil || ok {
+		t.Errorf("Get(%q) = %v, %v; expected false, nil", "agent/3", ok, err)
+	}
+
+	keys, err := db.Keys("agent/")
+	if err != nil {
+		t.Fatalf("Keys() failed: %v", err)
+	}
+	if expected := []string{"agent/1", "agent/2"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Keys(%q) = %v; expected %v", "agent/", keys, expected)
+	}
+
+	if err := db.Delete("agent/1"); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if _, ok, _ := db.Get("agent/1"); ok {
+		t.Errorf("Get(%q) returned deleted value", "agent/1")
+	}
+}
+
+func TestKVStore(t *testing.T) {
+	testDatabase(t, NewKVStore())
+}
+
+func TestBoltStore(t *testing.T) {
+	db, err := NewBoltStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewBoltStore() failed: %v", err)
+	}
+	defer db.Close()
+
+	testDatabase(t, db)
+}
+
+func TestBoltStore_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("NewBoltStore() failed: %v", err)
+	}
+	if err := SetJSON(db, "agent/1", map[string]string{"name": "agent"}); err != nil {
+		t.Fatalf("SetJSON() failed: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	db, err = NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("NewBoltStore() failed: %v", err)
+	}
+	defer db.Close()
+
+	value := map[string]string{}
+	ok, err := GetJSON(db, "agent/1", &value)
+	if err != nil || !ok {
+		t.Fatalf("GetJSON() = %v, %v; expected true, nil", ok, err)
+	}
+	if value["name"] != "agent" {
+		t.Errorf("GetJSON() returned %v; expected name=agent", value)
+	}
+}
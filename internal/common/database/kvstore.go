@@ -1,47 +1,55 @@
 package database
 
 import (
+	"sort"
+	"strings"
 	"sync"
 )
 
+// KVStore is an in-memory Database, its content is lost when the process exits.
 type KVStore struct {
 	mu    sync.RWMutex
-	store map[string]interface{}
+	store map[string][]byte
 }
 
 func NewKVStore() *KVStore {
 	return &KVStore{
-		store: map[string]interface{}{},
+		store: map[string][]byte{},
 	}
 }
 
-func (kv *KVStore) Set(key string, value interface{}) {
+func (kv *KVStore) Set(key string, value []byte) error {
 	kv.mu.Lock()
 	defer kv.mu.Unlock()
 	kv.store[key] = value
+	return nil
 }
 
-func (kv *KVStore) Get(key string) (interface{}, bool) {
+func (kv *KVStore) Get(key string) ([]byte, bool, error) {
 	kv.mu.RLock()
 	defer kv.mu.RUnlock()
 	value, ok := kv.store[key]
-	return value, ok
+	return value, ok, nil
 }
 
-func (kv *KVStore) Delete(key string) {
+func (kv *KVStore) Delete(key string) error {
 	kv.mu.Lock()
 	defer kv.mu.Unlock()
 	delete(kv.store, key)
+	return nil
 }
 
-func (kv *KVStore) Keys() []string {
+func (kv *KVStore) Keys(prefix string) ([]string, error) {
 	kv.mu.RLock()
 	defer kv.mu.RUnlock()
 	keys := make([]string, 0, len(kv.store))
 	for k := range kv.store {
-		keys = append(keys, k)
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
 	}
-	return keys
+	sort.Strings(keys)
+	return keys, nil
 }
 
 func (kv *KVStore) Count() int {
@@ -53,5 +61,9 @@ func (kv *KVStore) Count() int {
 func (kv *KVStore) Clear() {
 	kv.mu.Lock()
 	defer kv.mu.Unlock()
-	kv.store = map[string]interface{}{}
+	kv.store = map[string][]byte{}
+}
+
+func (kv *KVStore) Close() error {
+	return nil
 }
@@ -0,0 +1,98 @@
+package delivery
+
+import (
+	"errors"
+
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	pb "github.com/pajtaand/dmap-zero/internal/proto"
+)
+
+type Outcome string
+
+const (
+	OutcomePending       Outcome = "PENDING"
+	OutcomeDelivered     Outcome = "DELIVERED"
+	OutcomeWebhookFailed Outcome = "WEBHOOK_FAILED"
+	OutcomeNoSubscriber  Outcome = "NO_SUBSCRIBER"
+	OutcomeUnconfirmed   Outcome = "UNCONFIRMED" // the receiver took the message without reporting what became of it
+	OutcomeExpired       Outcome = "EXPIRED"     // the message wasn't delivered before its TTL ran out
+	OutcomeUnreachable   Outcome = "UNREACHABLE" // the agent couldn't be reached
+)
+
+// Result is the outcome of a message for one receiver module.
+type Result struct {
+	ModuleID string
+	Outcome  Outcome
+	Error    string
+}
+
+// ResultOf returns the outcome of the delivery to the module which ended with the error. An error
+// wrapping ErrNotFound means the module isn't running or registered no webhook for the data.
+func ResultOf(moduleID string, err error) Result {
+	result := Result{
+		ModuleID: moduleID,
+		Outcome:  OutcomeDelivered,
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, errs.ErrNotFound):
+		result.Outcome = OutcomeNoSubscriber
+		result.Error = err.Error()
+	default:
+		result.Outcome = OutcomeWebhookFailed
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Proto returns the result reported back to the sender. Outcomes the receiving side can't report
+// are sent as unknown.
+func (r Result) Proto() *pb.DeliveryResult {
+	result := &pb.DeliveryResult{
+		Module: r.ModuleID,
+		Error:  r.Error,
+	}
+	switch r.Outcome {
+	case OutcomeDelivered:
+		result.Outcome = pb.DeliveryOutcome_DELIVERY_DELIVERED
+	case OutcomeNoSubscriber:
+		result.Outcome = pb.DeliveryOutcome_DELIVERY_NO_SUBSCRIBER
+	case OutcomeWebhookFailed:
+		result.Outcome = pb.DeliveryOutcome_DELIVERY_WEBHOOK_FAILED
+	default:
+		result.Outcome = pb.DeliveryOutcome_DELIVERY_UNKNOWN
+	}
+	return result
+}
+
+// Results converts the results reported by the receiving side. Agents and controllers which don't
+// report results took the message without confirming its delivery, the module it was sent to gets
+// an unconfirmed result then.
+func Results(moduleID string, report *pb.DeliveryReport) []Result {
+	if len(report.GetResults()) == 0 {
+		return []Result{{
+			ModuleID: moduleID,
+			Outcome:  OutcomeUnconfirmed,
+		}}
+	}
+
+	results := []Result{}
+	for _, reported := range report.Results {
+		result := Result{
+			ModuleID: reported.Module,
+			Error:    reported.Error,
+		}
+		switch reported.Outcome {
+		case pb.DeliveryOutcome_DELIVERY_DELIVERED:
+			result.Outcome = OutcomeDelivered
+		case pb.DeliveryOutcome_DELIVERY_NO_SUBSCRIBER:
+			result.Outcome = OutcomeNoSubscriber
+		case pb.DeliveryOutcome_DELIVERY_UNKNOWN:
+			result.Outcome = OutcomeUnconfirmed
+		default:
+			result.Outcome = OutcomeWebhookFailed
+		}
+		results = append(results, result)
+	}
+	return results
+}
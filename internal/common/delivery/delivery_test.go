@@ -0,0 +1,63 @@
+package delivery
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	pb "github.com/pajtaand/dmap-zero/internal/proto"
+)
+
+func TestResultOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected Outcome
+	}{
+		{name: "delivered", err: nil, expected: OutcomeDelivered},
+		{name: "no subscriber", err: fmt.Errorf("no webhook: %w", errs.ErrNotFound), expected: OutcomeNoSubscriber},
+		{name: "webhook failed", err: errors.New("webhook returned 500"), expected: OutcomeWebhookFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ResultOf("module", tt.err)
+			if result.Outcome != tt.expected || result.ModuleID != "module" {
+				t.Errorf("ResultOf() = %+v; expected outcome %s", result, tt.expected)
+			}
+			if (tt.err != nil) != (result.Error != "") {
+				t.Errorf("ResultOf() error = %q; expected the error to be kept", result.Error)
+			}
+
+			// the result survives the round trip to the sender
+			if back := Results("", &pb.DeliveryReport{Results: []*pb.DeliveryResult{result.Proto()}}); !slices.Equal(back, []Result{result}) {
+				t.Errorf("Results(Proto()) = %+v; expected %+v", back, result)
+			}
+		})
+	}
+}
+
+func TestResults(t *testing.T) {
+	// receivers which don't report results haven't confirmed the delivery
+	for _, report := range []*pb.DeliveryReport{nil, {}} {
+		expected := []Result{{ModuleID: "module", Outcome: OutcomeUnconfirmed}}
+		if results := Results("module", report); !slices.Equal(results, expected) {
+			t.Errorf("Results(%v) = %+v; expected %+v", report, results, expected)
+		}
+	}
+
+	report := &pb.DeliveryReport{Results: []*pb.DeliveryResult{
+		{Module: "a", Outcome: pb.DeliveryOutcome_DELIVERY_DELIVERED},
+		{Module: "b", Outcome: pb.DeliveryOutcome_DELIVERY_UNKNOWN},
+		{Module: "c", Outcome: pb.DeliveryOutcome(42), Error: "failed"},
+	}}
+	expected := []Result{
+		{ModuleID: "a", Outcome: OutcomeDelivered},
+		{ModuleID: "b", Outcome: OutcomeUnconfirmed},
+		{ModuleID: "c", Outcome: OutcomeWebhookFailed, Error: "failed"},
+	}
+	if results := Results("module", report); !slices.Equal(results, expected) {
+		t.Errorf("Results() = %+v; expected %+v", results, expected)
+	}
+}
@@ -6,4 +6,10 @@ var (
 	ErrConflict   = errors.New("conflicting resource already exist")
 	ErrNotFound   = errors.New("resource doesn't exist")
 	ErrNotAllowed = errors.New("this operation is not allowed")
+	ErrInvalid    = errors.New("invalid request")
+
+	ErrDigestMismatch   = errors.New("content doesn't match its digest")
+	ErrSignatureInvalid = errors.New("signature verification failed")
+
+	ErrLimitExceeded = errors.New("limit exceeded")
 )
@@ -11,6 +11,7 @@ import (
 type AuthStore struct {
 	mu          sync.RWMutex
 	credentials map[string]string
+	permissions map[string]map[string]bool
 }
 
 // NewAuthStore creates a new instance of AuthStore.
@@ -18,6 +19,7 @@ func NewAuthStore() *AuthStore {
 	log.Debug().Msg("Creating new AuthStore")
 	return &AuthStore{
 		credentials: map[string]string{},
+		permissions: map[string]map[string]bool{},
 	}
 }
 
@@ -42,6 +44,7 @@ func (store *AuthStore) Remove(username string) {
 	store.mu.Lock()
 	defer store.mu.Unlock()
 	delete(store.credentials, username)
+	delete(store.permissions, username)
 }
 
 // Validate checks if a username-password combination is present in the store.
@@ -55,3 +58,21 @@ func (store *AuthStore) Validate(username, password string) bool {
 	}
 	return hashedPassword == hashPassword(password)
 }
+
+// Grant gives the user a permission, permissions guard operations not every user may run.
+func (store *AuthStore) Grant(username, permission string) {
+	log.Info().Msgf("Granting permission %s to user: %s", permission, username)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.permissions[username] == nil {
+		store.permissions[username] = map[string]bool{}
+	}
+	store.permissions[username][permission] = true
+}
+
+// HasPermission checks if the user was granted the permission.
+func (store *AuthStore) HasPermission(username, permission string) bool {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return store.permissions[username][permission]
+}
@@ -93,3 +93,36 @@ func TestAuthStore_HashPassword(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthStore_Permissions(t *testing.T) {
+	authStore := NewAuthStore()
+
+	authStore.Add("user1", "password1")
+	authStore.Add("user2", "password2")
+	authStore.Grant("user1", "module-exec")
+
+	tests := []struct {
+		username   string
+		permission string
+		expected   bool
+	}{
+		{"user1", "module-exec", true},
+		{"user1", "other", false},
+		{"user2", "module-exec", false},
+		{"user3", "module-exec", false},
+	}
+
+	for ind, test := range tests {
+		t.Run(fmt.Sprintf("Test_%d", ind), func(t *testing.T) {
+			result := authStore.HasPermission(test.username, test.permission)
+			if result != test.expected {
+				t.Errorf("HasPermission(%q, %q) = %v; expected %v", test.username, test.permission, result, test.expected)
+			}
+		})
+	}
+
+	authStore.Remove("user1")
+	if authStore.HasPermission("user1", "module-exec") {
+		t.Errorf("HasPermission(%q, %q) = true; expected false after removal", "user1", "module-exec")
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pajtaand/dmap-zero/internal/common/utils"
+	"github.com/rs/zerolog"
+)
+
+type Authorizer interface {
+	HasPermission(username, permission string) bool
+}
+
+// RequirePermission allows only users granted the permission, it must run after BasicAuth.
+func RequirePermission(permission string, authorizer Authorizer) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := utils.GetUser(r.Context())
+			if !ok || !authorizer.HasPermission(user, permission) {
+				zerolog.Ctx(r.Context()).Warn().Msgf("User is missing permission: %s", permission)
+				utils.WriteErrorResponse(w, http.StatusForbidden, fmt.Errorf("permission '%s' is required", permission))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
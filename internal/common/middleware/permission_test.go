@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pajtaand/dmap-zero/internal/common/utils"
+)
+
+type mockAuthorizer struct {
+	permissions map[string]string
+}
+
+func (m *mockAuthorizer) HasPermission(username, permission string) bool {
+	p, ok := m.permissions[username]
+	return ok && p == permission
+}
+
+func TestRequirePermission(t *testing.T) {
+	authorizer := &mockAuthorizer{
+		permissions: map[string]string{"admin": "module-exec"},
+	}
+
+	// Create a test handler that will only be called when the user has the permission
+	finalHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := RequirePermission("module-exec", authorizer)(finalHandler)
+
+	tests := []struct {
+		name     string
+		user     string
+		expected int
+	}{
+		{name: "Granted", user: "admin", expected: http.StatusOK},
+		{name: "Not granted", user: "user", expected: http.StatusForbidden},
+		{name: "No user", user: "", expected: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.user != "" {
+				req = req.WithContext(utils.SetUser(req.Context(), tt.user))
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
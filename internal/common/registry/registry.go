@@ -0,0 +1,370 @@
+package registry
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/rs/zerolog"
+)
+
+const (
+	dockerHubDomain   = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	maxManifestSize = 4 << 20
+)
+
+var manifestMediaTypes = []string{
+	ocispec.MediaTypeImageIndex,
+	ocispec.MediaTypeImageManifest,
+	mediaTypeDockerManifestList,
+	mediaTypeDockerManifest,
+}
+
+// Credentials authenticate the client to the registry.
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Client pulls images from a registry implementing the OCI distribution API. Only pulling is
+// supported, images are converted to the `docker save` format so they can be distributed to
+// agents the same way as uploaded images.
+type Client struct {
+	httpClient  *http.Client
+	credentials *Credentials
+	insecure    bool
+	basicAuth   bool
+	token       string
+}
+
+// NewClient creates a client, anonymous access is used when credentials are nil. Insecure
+// clients talk plain HTTP, e.g. to a local registry.
+func NewClient(credentials *Credentials, insecure bool) *Client {
+	return &Client{
+		httpClient:  &http.Client{},
+		credentials: credentials,
+		insecure:    insecure,
+	}
+}
+
+// ParseReference normalizes the image reference, the latest tag is used when none is given.
+func ParseReference(ref string) (reference.Named, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image reference '%s': %v", ref, err)
+	}
+	return reference.TagNameOnly(named), nil
+}
+
+// ParsePlatform parses a platform in the form os/architecture[/variant].
+func ParsePlatform(platform string) (*ocispec.Platform, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid platform '%s', expected os/architecture[/variant]", platform)
+	}
+	p := &ocispec.Platform{
+		OS:           parts[0],
+		Architecture: parts[1],
+	}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+// Save pulls the image for the given platform and writes it to w as a `docker save` tarball.
+func (c *Client) Save(ctx context.Context, ref, platform string, w io.Writer) error {
+	log := zerolog.Ctx(ctx)
+
+	named, err := ParseReference(ref)
+	if err != nil {
+		return err
+	}
+	p, err := ParsePlatform(platform)
+	if err != nil {
+		return err
+	}
+
+	repo := reference.Path(named)
+	base := c.baseURL(reference.Domain(named), repo)
+
+	var tag string
+	manifestRef := ""
+	if tagged, ok := named.(reference.Tagged); ok {
+		tag = tagged.Tag()
+		manifestRef = tag
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		manifestRef = digested.Digest().String()
+	}
+
+	log.Info().Msgf("Pulling image manifest: reference=%s, platform=%s", named.String(), platform)
+	manifest, err := c.getManifest(ctx, base, repo, manifestRef, p)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+
+	configName := manifest.Config.Digest.Encoded() + ".json"
+	if err := c.copyBlob(ctx, tw, base, repo, configName, manifest.Config); err != nil {
+		return err
+	}
+
+	layers := []string{}
+	for _, layer := range manifest.Layers {
+		if len(layer.URLs) > 0 {
+			return fmt.Errorf("foreign layers are not supported: digest=%s", layer.Digest)
+		}
+		dir := layer.Digest.Encoded()
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     dir + "/",
+			Typeflag: tar.TypeDir,
+			Mode:     0o755,
+		}); err != nil {
+			return fmt.Errorf("failed to write tarball: %v", err)
+		}
+		name := dir + "/layer.tar"
+		if err := c.copyBlob(ctx, tw, base, repo, name, layer); err != nil {
+			return err
+		}
+		layers = append(layers, name)
+	}
+
+	// docker load decompresses layers, so they are stored as received from the registry
+	saveManifest := []map[string]interface{}{{
+		"Config":   configName,
+		"RepoTags": []string{},
+		"Layers":   layers,
+	}}
+	if tag != "" {
+		saveManifest[0]["RepoTags"] = []string{reference.FamiliarString(named)}
+	}
+	data, err := json.Marshal(saveManifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     "manifest.json",
+		Typeflag: tar.TypeReg,
+		Mode:     0o644,
+		Size:     int64(len(data)),
+	}); err != nil {
+		return fmt.Errorf("failed to write tarball: %v", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write tarball: %v", err)
+	}
+	return tw.Close()
+}
+
+func (c *Client) baseURL(domain, repo string) string {
+	if domain == dockerHubDomain {
+		domain = dockerHubRegistry
+	}
+	scheme := "https"
+	if c.insecure {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s", scheme, domain, repo)
+}
+
+// getManifest fetches the image manifest, an index is resolved to the manifest of the platform.
+func (c *Client) getManifest(ctx context.Context, base, repo, ref string, platform *ocispec.Platform) (*ocispec.Manifest, error) {
+	for range 2 {
+		resp, err := c.get(ctx, base+"/manifests/"+ref, repo, strings.Join(manifestMediaTypes, ", "))
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest: %v", err)
+		}
+		if d, err := digest.Parse(ref); err == nil && d.Algorithm().FromBytes(data) != d {
+			return nil, fmt.Errorf("manifest doesn't match its digest: %s", ref)
+		}
+
+		mediaType := strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+		switch mediaType {
+		case ocispec.MediaTypeImageIndex, mediaTypeDockerManifestList:
+			index := &ocispec.Index{}
+			if err := json.Unmarshal(data, index); err != nil {
+				return nil, fmt.Errorf("failed to parse image index: %v", err)
+			}
+			ref = ""
+			for _, m := range index.Manifests {
+				if m.Platform != nil && m.Platform.OS == platform.OS && m.Platform.Architecture == platform.Architecture &&
+					(platform.Variant == "" || m.Platform.Variant == platform.Variant) {
+					ref = m.Digest.String()
+					break
+				}
+			}
+			if ref == "" {
+				return nil, fmt.Errorf("image has no manifest for platform %s/%s", platform.OS, platform.Architecture)
+			}
+		case ocispec.MediaTypeImageManifest, mediaTypeDockerManifest:
+			manifest := &ocispec.Manifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return nil, fmt.Errorf("failed to parse image manifest: %v", err)
+			}
+			return manifest, nil
+		default:
+			return nil, fmt.Errorf("unsupported manifest media type: %s", mediaType)
+		}
+	}
+	return nil, errors.New("nested image indexes are not supported")
+}
+
+// copyBlob streams the blob into the tarball and verifies its digest.
+func (c *Client) copyBlob(ctx context.Context, tw *tar.Writer, base, repo, name string, desc ocispec.Descriptor) error {
+	if err := desc.Digest.Validate(); err != nil {
+		return fmt.Errorf("invalid blob digest: %v", err)
+	}
+
+	resp, err := c.get(ctx, base+"/blobs/"+desc.Digest.String(), repo, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     0o644,
+		Size:     desc.Size,
+	}); err != nil {
+		return fmt.Errorf("failed to write tarball: %v", err)
+	}
+
+	verifier := desc.Digest.Verifier()
+	n, err := io.Copy(tw, io.TeeReader(io.LimitReader(resp.Body, desc.Size), verifier))
+	if err != nil {
+		return fmt.Errorf("failed to download blob: digest=%s: %v", desc.Digest, err)
+	}
+	if n != desc.Size || !verifier.Verified() {
+		return fmt.Errorf("blob doesn't match its digest: digest=%s", desc.Digest)
+	}
+	return nil
+}
+
+// get sends the request, authenticating when the registry asks for it.
+func (c *Client) get(ctx context.Context, url, repo, accept string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		} else if c.basicAuth {
+			req.SetBasicAuth(c.credentials.Username, c.credentials.Password)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reach registry: %v", err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return nil, fmt.Errorf("registry request failed: url=%s, status=%s", url, resp.Status)
+		}
+		if err := c.authenticate(ctx, resp.Header.Get("WWW-Authenticate"), repo); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// authenticate handles the registry challenge, a bearer token is requested from the token
+// service, basic auth uses the credentials directly.
+func (c *Client) authenticate(ctx context.Context, challenge, repo string) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.credentials == nil {
+			return errors.New("registry requires credentials")
+		}
+		c.basicAuth = true
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("unsupported registry authentication: %s", challenge)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("invalid authentication realm: %s", params["realm"])
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", repo))
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create token request: %v", err)
+	}
+	if c.credentials != nil {
+		req.SetBasicAuth(c.credentials.Username, c.credentials.Password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach token service: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token request failed: status=%s", resp.Status)
+	}
+
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("failed to parse token response: %v", err)
+	}
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+	if c.token == "" {
+		return errors.New("token service returned no token")
+	}
+	return nil
+}
+
+// parseChallenge parses the WWW-Authenticate header, e.g. Bearer realm="...",service="...".
+func parseChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := map[string]string{}
+	for _, part := range strings.Split(rest, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			params[strings.ToLower(key)] = strings.Trim(value, `"`)
+		}
+	}
+	return scheme, params
+}
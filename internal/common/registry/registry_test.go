@@ -0,0 +1,191 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type fakeRegistry struct {
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	types     map[string]string
+}
+
+func newFakeRegistry(t *testing.T, layer []byte, corrupt bool) (*httptest.Server, *fakeRegistry) {
+	reg := &fakeRegistry{
+		blobs:     map[string][]byte{},
+		manifests: map[string][]byte{},
+		types:     map[string]string{},
+	}
+
+	config := []byte(`{"rootfs":{"type":"layers","diff_ids":["` + digest.FromBytes(layer).String() + `"]}}`)
+	reg.blobs[digest.FromBytes(config).String()] = config
+	reg.blobs[digest.FromBytes(layer).String()] = layer
+	if corrupt {
+		reg.blobs[digest.FromBytes(layer).String()] = []byte("corrupted")
+	}
+
+	manifest, _ := json.Marshal(ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    ocispec.Descriptor{MediaType: ocispec.MediaTypeImageConfig, Digest: digest.FromBytes(config), Size: int64(len(config))},
+		Layers:    []ocispec.Descriptor{{MediaType: ocispec.MediaTypeImageLayer, Digest: digest.FromBytes(layer), Size: int64(len(layer))}},
+	})
+	manifestDigest := digest.FromBytes(manifest).String()
+	reg.manifests[manifestDigest] = manifest
+	reg.types[manifestDigest] = ocispec.MediaTypeImageManifest
+
+	index, _ := json.Marshal(ocispec.Index{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: []ocispec.Descriptor{{
+			MediaType: ocispec.MediaTypeImageManifest,
+			Digest:    digest.FromBytes(manifest),
+			Size:      int64(len(manifest)),
+			Platform:  &ocispec.Platform{OS: "linux", Architecture: "amd64"},
+		}},
+	})
+	reg.manifests["1.0"] = index
+	reg.types["1.0"] = ocispec.MediaTypeImageIndex
+
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"token":"secret"}`))
+	})
+	mux.HandleFunc("/v2/team/app/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if ref, ok := strings.CutPrefix(r.URL.Path, "/v2/team/app/manifests/"); ok {
+			data, ok := reg.manifests[ref]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", reg.types[ref])
+			w.Write(data)
+			return
+		}
+		if ref, ok := strings.CutPrefix(r.URL.Path, "/v2/team/app/blobs/"); ok {
+			data, ok := reg.blobs[ref]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	srv = httptest.NewServer(mux)
+	return srv, reg
+}
+
+func TestClient_Save(t *testing.T) {
+	layer := []byte("layer-content")
+	srv, _ := newFakeRegistry(t, layer, false)
+	defer srv.Close()
+
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/team/app:1.0"
+	client := NewClient(&Credentials{Username: "user", Password: "pass"}, true)
+
+	var buf bytes.Buffer
+	if err := client.Save(context.Background(), ref, "linux/amd64", &buf); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	files := map[string][]byte{}
+	tr := tar.NewReader(&buf)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read tarball: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		files[header.Name] = data
+	}
+
+	manifest := []struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}{}
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil || len(manifest) != 1 {
+		t.Fatalf("invalid manifest.json: %s", files["manifest.json"])
+	}
+	if len(manifest[0].RepoTags) != 1 || manifest[0].RepoTags[0] != ref {
+		t.Errorf("RepoTags = %v; expected [%s]", manifest[0].RepoTags, ref)
+	}
+	if _, ok := files[manifest[0].Config]; !ok {
+		t.Errorf("config %s missing in tarball", manifest[0].Config)
+	}
+	if len(manifest[0].Layers) != 1 || !bytes.Equal(files[manifest[0].Layers[0]], layer) {
+		t.Errorf("layer missing in tarball: %v", manifest[0].Layers)
+	}
+}
+
+func TestClient_SaveErrors(t *testing.T) {
+	srv, _ := newFakeRegistry(t, []byte("layer-content"), true)
+	defer srv.Close()
+
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/team/app:1.0"
+	tests := []struct {
+		name        string
+		credentials *Credentials
+		platform    string
+	}{
+		{
+			name:        "Corrupted layer",
+			credentials: &Credentials{Username: "user", Password: "pass"},
+			platform:    "linux/amd64",
+		},
+		{
+			name:        "Wrong credentials",
+			credentials: &Credentials{Username: "user", Password: "wrong"},
+			platform:    "linux/amd64",
+		},
+		{
+			name:        "Missing platform",
+			credentials: &Credentials{Username: "user", Password: "pass"},
+			platform:    "linux/arm64",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(tt.credentials, true)
+			if err := client.Save(context.Background(), ref, tt.platform, io.Discard); err == nil {
+				t.Errorf("Save() returned nil; expected error")
+			}
+		})
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	if p, err := ParsePlatform("linux/arm/v7"); err != nil || p.OS != "linux" || p.Architecture != "arm" || p.Variant != "v7" {
+		t.Errorf("ParsePlatform(%q) = %v, %v", "linux/arm/v7", p, err)
+	}
+	for _, platform := range []string{"", "linux", "linux/", "linux/arm/v7/x"} {
+		if _, err := ParsePlatform(platform); err == nil {
+			t.Errorf("ParsePlatform(%q) returned nil; expected error", platform)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+)
+
+// KeySize is the size of the master key, secrets are sealed with AES-256-GCM.
+const KeySize = 32
+
+var (
+	nameRegex      = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	referenceRegex = regexp.MustCompile(`^\$\{secret:([a-zA-Z0-9][a-zA-Z0-9_.-]*)\}$`)
+)
+
+// ValidName reports whether the name can be used for a secret.
+func ValidName(name string) bool {
+	return nameRegex.MatchString(name)
+}
+
+// Reference returns the name of the secret a configuration value refers to, values of the form
+// ${secret:NAME} are replaced with the secret when the module starts.
+func Reference(value string) (string, bool) {
+	match := referenceRegex.FindStringSubmatch(value)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// References returns the sorted names of the secrets the configuration refers to.
+func References(configuration map[string]string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, value := range configuration {
+		if name, ok := Reference(value); ok && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveEnv returns the configuration with the secret references replaced by the secrets, it
+// returns an error wrapping ErrNotFound when a secret is missing.
+func ResolveEnv(configuration map[string]string, values map[string][]byte) (map[string]string, error) {
+	resolved := make(map[string]string, len(configuration))
+	for key, value := range configuration {
+		if name, ok := Reference(value); ok {
+			secret, ok := values[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: secret '%s'", errs.ErrNotFound, name)
+			}
+			value = string(secret)
+		}
+		resolved[key] = value
+	}
+	return resolved, nil
+}
+
+// Digest returns a digest of the secrets, it changes whenever a secret is added, removed or
+// rotated.
+func Digest(values map[string][]byte) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%d:%s%d:", len(name), name, len(values[name]))
+		h.Write(values[name])
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Box seals and opens secrets with the master key.
+type Box struct {
+	aead cipher.AEAD
+}
+
+func NewBox(key []byte) (*Box, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("master key must be %d bytes long", KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{
+		aead: aead,
+	}, nil
+}
+
+// Seal encrypts the secret, the random nonce is prepended to the ciphertext. The name is
+// authenticated, so ciphertexts can't be swapped between secrets.
+func (b *Box) Seal(name string, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return b.aead.Seal(nonce, nonce, plaintext, []byte(name)), nil
+}
+
+func (b *Box) Open(name string, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < b.aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, sealed := ciphertext[:b.aead.NonceSize()], ciphertext[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, sealed, []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret '%s': %v", name, err)
+	}
+	return plaintext, nil
+}
+
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ParseKey parses a hex encoded master key.
+func ParseKey(data []byte) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("master key must be hex encoded: %v", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("master key must be %d bytes long", KeySize)
+	}
+	return key, nil
+}
+
+func LoadKey(fileName string) ([]byte, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKey(data)
+}
+
+// SaveKey writes the hex encoded master key to a new file only its owner can read, an existing
+// file is never overwritten.
+func SaveKey(fileName string, key []byte) error {
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,178 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+)
+
+func newBox(t *testing.T) *Box {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	box, err := NewBox(key)
+	if err != nil {
+		t.Fatalf("NewBox() failed: %v", err)
+	}
+	return box
+}
+
+func TestBox_SealOpen(t *testing.T) {
+	box := newBox(t)
+	plaintext := []byte("s3cr3t")
+
+	sealed, err := box.Seal("db-password", plaintext)
+	if err != nil {
+		t.Fatalf("Seal() failed: %v", err)
+	}
+	if bytes.Contains(sealed, plaintext) {
+		t.Errorf("Seal() = %x; contains the plaintext", sealed)
+	}
+	opened, err := box.Open("db-password", sealed)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("Open() = %q; expected %q", opened, plaintext)
+	}
+
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 0xff
+	tests := []struct {
+		name       string
+		secretName string
+		ciphertext []byte
+		box        *Box
+	}{
+		{name: "Other name", secretName: "api-token", ciphertext: sealed, box: box},
+		{name: "Tampered", secretName: "db-password", ciphertext: tampered, box: box},
+		{name: "Too short", secretName: "db-password", ciphertext: sealed[:4], box: box},
+		{name: "Other key", secretName: "db-password", ciphertext: sealed, box: newBox(t)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.box.Open(tt.secretName, tt.ciphertext); err == nil {
+				t.Errorf("Open() returned nil; expected error")
+			}
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	key, _ := GenerateKey()
+	parsed, err := ParseKey([]byte(hex.EncodeToString(key) + "\n"))
+	if err != nil {
+		t.Fatalf("ParseKey() failed: %v", err)
+	}
+	if !bytes.Equal(parsed, key) {
+		t.Errorf("ParseKey() = %x; expected %x", parsed, key)
+	}
+
+	for _, data := range []string{"", "not hex", hex.EncodeToString(key[:16])} {
+		if _, err := ParseKey([]byte(data)); err == nil {
+			t.Errorf("ParseKey(%q) returned nil; expected error", data)
+		}
+	}
+}
+
+func TestSaveKey(t *testing.T) {
+	key, _ := GenerateKey()
+	fileName := filepath.Join(t.TempDir(), "master.key")
+	if err := SaveKey(fileName, key); err != nil {
+		t.Fatalf("SaveKey() failed: %v", err)
+	}
+
+	info, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatalf("Stat() failed: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("SaveKey() created the file with mode %o; expected 600", mode)
+	}
+	loaded, err := LoadKey(fileName)
+	if err != nil {
+		t.Fatalf("LoadKey() failed: %v", err)
+	}
+	if !bytes.Equal(loaded, key) {
+		t.Errorf("LoadKey() = %x; expected %x", loaded, key)
+	}
+
+	other, _ := GenerateKey()
+	if err := SaveKey(fileName, other); err == nil {
+		t.Errorf("SaveKey() overwrote the existing key; expected error")
+	}
+}
+
+func TestReference(t *testing.T) {
+	tests := []struct {
+		value string
+		name  string
+		ok    bool
+	}{
+		{value: "${secret:db-password}", name: "db-password", ok: true},
+		{value: "${secret:}", ok: false},
+		{value: "prefix-${secret:db-password}", ok: false},
+		{value: "${secret:db password}", ok: false},
+		{value: "plain", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			name, ok := Reference(tt.value)
+			if name != tt.name || ok != tt.ok {
+				t.Errorf("Reference() = %q, %v; expected %q, %v", name, ok, tt.name, tt.ok)
+			}
+		})
+	}
+}
+
+func TestResolveEnv(t *testing.T) {
+	configuration := map[string]string{
+		"DB_HOST":     "db",
+		"DB_PASSWORD": "${secret:db-password}",
+	}
+	if refs := References(configuration); len(refs) != 1 || refs[0] != "db-password" {
+		t.Errorf("References() = %v; expected [db-password]", refs)
+	}
+
+	resolved, err := ResolveEnv(configuration, map[string][]byte{"db-password": []byte("s3cr3t")})
+	if err != nil {
+		t.Fatalf("ResolveEnv() failed: %v", err)
+	}
+	expected := map[string]string{
+		"DB_HOST":     "db",
+		"DB_PASSWORD": "s3cr3t",
+	}
+	if !maps.Equal(resolved, expected) {
+		t.Errorf("ResolveEnv() = %v; expected %v", resolved, expected)
+	}
+	if configuration["DB_PASSWORD"] != "${secret:db-password}" {
+		t.Errorf("ResolveEnv() modified the configuration")
+	}
+
+	if _, err := ResolveEnv(configuration, nil); !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("ResolveEnv() error = %v; expected %v", err, errs.ErrNotFound)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	values := map[string][]byte{"a": []byte("1"), "b": []byte("2")}
+	if Digest(values) != Digest(maps.Clone(values)) {
+		t.Errorf("Digest() isn't stable")
+	}
+	for _, other := range []map[string][]byte{
+		{"a": []byte("1")},
+		{"a": []byte("1"), "b": []byte("3")},
+		{"a": []byte("12"), "b": []byte("")},
+	} {
+		if Digest(values) == Digest(other) {
+			t.Errorf("Digest(%v) equals Digest(%v)", other, values)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package signing
+
+import (
+	"archive/tar"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+)
+
+const (
+	imagePayloadHeader = "dmap-zero image signature v1\n"
+	imageManifestFile  = "manifest.json"
+	maxMetadataSize    = 64 << 20 // manifests and configurations are small JSON files
+
+	pemTypePrivateKey = "PRIVATE KEY"
+	pemTypePublicKey  = "PUBLIC KEY"
+)
+
+// imagePayload returns the signed message of an image. Docker verifies the layers against the
+// configuration when loading an image, so the configuration digests cover the whole image.
+func imagePayload(configDigests []string) []byte {
+	sorted := append([]string{}, configDigests...)
+	sort.Strings(sorted)
+	return []byte(imagePayloadHeader + strings.Join(sorted, "\n"))
+}
+
+// Signer signs images with an Ed25519 private key.
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+func NewSigner(key ed25519.PrivateKey) (*Signer, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid Ed25519 private key")
+	}
+	return &Signer{
+		key: key,
+	}, nil
+}
+
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// SignImage signs the image with the given configuration digests, nil is returned for images
+// without configurations.
+func (s *Signer) SignImage(configDigests []string) []byte {
+	if len(configDigests) == 0 {
+		return nil
+	}
+	return ed25519.Sign(s.key, imagePayload(configDigests))
+}
+
+// Verifier verifies image signatures against a set of trusted public keys.
+type Verifier struct {
+	keys []ed25519.PublicKey
+}
+
+func NewVerifier(keys []ed25519.PublicKey) (*Verifier, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one trusted public key is required")
+	}
+	for _, key := range keys {
+		if len(key) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+	}
+	return &Verifier{
+		keys: keys,
+	}, nil
+}
+
+// VerifyImage returns errs.ErrSignatureInvalid unless the signature was made by one of the
+// trusted keys for exactly the given configuration digests.
+func (v *Verifier) VerifyImage(configDigests []string, signature []byte) error {
+	if len(configDigests) == 0 {
+		return fmt.Errorf("%w: image has no configuration", errs.ErrSignatureInvalid)
+	}
+	if len(signature) == 0 {
+		return fmt.Errorf("%w: image is not signed", errs.ErrSignatureInvalid)
+	}
+	payload := imagePayload(configDigests)
+	for _, key := range v.keys {
+		if ed25519.Verify(key, payload, signature) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: signature doesn't match any trusted key", errs.ErrSignatureInvalid)
+}
+
+// ConfigDigests returns the digests of the image configurations listed in the manifest of a
+// `docker save` tarball, readFile returns the content of a file of the tarball.
+func ConfigDigests(readFile func(name string) ([]byte, error)) ([]string, error) {
+	data, err := readFile(imageManifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image manifest: %v", err)
+	}
+	manifests := []struct {
+		Config string
+	}{}
+	if err := json.Unmarshal(data, &manifests); err != nil {
+		return nil, fmt.Errorf("failed to parse image manifest: %v", err)
+	}
+	if len(manifests) == 0 {
+		return nil, errors.New("image manifest is empty")
+	}
+
+	digests := []string{}
+	for _, manifest := range manifests {
+		config, err := readFile(path.Clean(manifest.Config))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image config: %v", err)
+		}
+		sum := sha256.Sum256(config)
+		digests = append(digests, "sha256:"+hex.EncodeToString(sum[:]))
+	}
+	sort.Strings(digests)
+	return digests, nil
+}
+
+// CheckEntryNames returns an error wrapping ErrSignatureInvalid when a name appears more than once.
+// `docker load` extracts the whole archive, so the last of duplicated entries wins while the
+// signature would be checked against the first one.
+func CheckEntryNames(names []string) error {
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = path.Clean(name)
+		if seen[name] {
+			return fmt.Errorf("%w: duplicate archive entry: %s", errs.ErrSignatureInvalid, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// TarballConfigDigests returns the configuration digests of a `docker save` tarball, tarballs
+// with duplicate entries are rejected.
+func TarballConfigDigests(r io.ReadSeeker) ([]string, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	names := []string{}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tarball: %v", err)
+		}
+		names = append(names, header.Name)
+	}
+	if err := CheckEntryNames(names); err != nil {
+		return nil, err
+	}
+
+	return ConfigDigests(func(name string) ([]byte, error) {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		tr := tar.NewReader(r)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				return nil, fmt.Errorf("file not found in tarball: %s", name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read tarball: %v", err)
+			}
+			if path.Clean(header.Name) != name || header.Typeflag != tar.TypeReg {
+				continue
+			}
+			if header.Size > maxMetadataSize {
+				return nil, fmt.Errorf("file too large: %s", name)
+			}
+			return io.ReadAll(tr)
+		}
+	})
+}
+
+func GenerateKey() (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	return key, err
+}
+
+func MarshalPrivateKey(key ed25519.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypePrivateKey, Bytes: der}), nil
+}
+
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != pemTypePrivateKey {
+		return nil, errors.New("no PEM encoded private key found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an Ed25519 key")
+	}
+	return edKey, nil
+}
+
+func MarshalPublicKey(key ed25519.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypePublicKey, Bytes: der}), nil
+}
+
+// ParsePublicKeys parses all PEM encoded Ed25519 public keys of the trust root.
+func ParsePublicKeys(data []byte) ([]ed25519.PublicKey, error) {
+	keys := []ed25519.PublicKey{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != pemTypePublicKey {
+			continue
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %v", err)
+		}
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("public key is not an Ed25519 key")
+		}
+		keys = append(keys, edKey)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no PEM encoded public key found")
+	}
+	return keys, nil
+}
+
+func LoadPrivateKey(fileName string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKey(data)
+}
+
+func LoadPublicKeys(fileName string) ([]ed25519.PublicKey, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKeys(data)
+}
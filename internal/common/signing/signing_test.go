@@ -0,0 +1,154 @@
+package signing
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+)
+
+func newSigner(t *testing.T) *Signer {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	signer, err := NewSigner(key)
+	if err != nil {
+		t.Fatalf("NewSigner() failed: %v", err)
+	}
+	return signer
+}
+
+func TestVerifier_VerifyImage(t *testing.T) {
+	signer := newSigner(t)
+	other := newSigner(t)
+	digests := []string{"sha256:bbb", "sha256:aaa"}
+	signature := signer.SignImage(digests)
+
+	if _, err := NewVerifier(nil); err == nil {
+		t.Errorf("NewVerifier() without keys returned nil; expected error")
+	}
+	verifier, err := NewVerifier([]ed25519.PublicKey{other.PublicKey(), signer.PublicKey()})
+	if err != nil {
+		t.Fatalf("NewVerifier() failed: %v", err)
+	}
+
+	if err := verifier.VerifyImage([]string{"sha256:aaa", "sha256:bbb"}, signature); err != nil {
+		t.Errorf("VerifyImage() = %v; expected nil", err)
+	}
+
+	tests := []struct {
+		name      string
+		digests   []string
+		signature []byte
+	}{
+		{name: "Unsigned", digests: digests, signature: nil},
+		{name: "Other digests", digests: []string{"sha256:aaa", "sha256:ccc"}, signature: signature},
+		{name: "Subset of digests", digests: []string{"sha256:aaa"}, signature: signature},
+		{name: "No configurations", digests: nil, signature: signature},
+		{name: "Untrusted key", digests: digests, signature: newSigner(t).SignImage(digests)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifier.VerifyImage(tt.digests, tt.signature); !errors.Is(err, errs.ErrSignatureInvalid) {
+				t.Errorf("VerifyImage() error = %v; expected %v", err, errs.ErrSignatureInvalid)
+			}
+		})
+	}
+}
+
+func TestKeys_PEM(t *testing.T) {
+	signer := newSigner(t)
+	other := newSigner(t)
+
+	data, err := MarshalPrivateKey(signer.key)
+	if err != nil {
+		t.Fatalf("MarshalPrivateKey() failed: %v", err)
+	}
+	key, err := ParsePrivateKey(data)
+	if err != nil {
+		t.Fatalf("ParsePrivateKey() failed: %v", err)
+	}
+	if !key.Equal(signer.key) {
+		t.Errorf("ParsePrivateKey() returned a different key")
+	}
+
+	trustRoot := []byte{}
+	for _, s := range []*Signer{signer, other} {
+		data, err := MarshalPublicKey(s.PublicKey())
+		if err != nil {
+			t.Fatalf("MarshalPublicKey() failed: %v", err)
+		}
+		trustRoot = append(trustRoot, data...)
+	}
+	keys, err := ParsePublicKeys(trustRoot)
+	if err != nil {
+		t.Fatalf("ParsePublicKeys() failed: %v", err)
+	}
+	if len(keys) != 2 || !keys[0].Equal(signer.PublicKey()) || !keys[1].Equal(other.PublicKey()) {
+		t.Errorf("ParsePublicKeys() returned unexpected keys")
+	}
+
+	if _, err := ParsePublicKeys([]byte("not a key")); err == nil {
+		t.Errorf("ParsePublicKeys() of invalid data returned nil; expected error")
+	}
+}
+
+func TestTarballConfigDigests(t *testing.T) {
+	config := []byte(`{"rootfs":{"type":"layers","diff_ids":[]}}`)
+	sum := sha256.Sum256(config)
+
+	files := []tarFile{
+		{name: "abc.json", content: config},
+		{name: "layer/layer.tar", content: []byte("layer")},
+		{name: "manifest.json", content: []byte(`[{"Config":"./abc.json","Layers":["layer/layer.tar"]}]`)},
+	}
+
+	digests, err := TarballConfigDigests(bytes.NewReader(writeTarball(files)))
+	if err != nil {
+		t.Fatalf("TarballConfigDigests() failed: %v", err)
+	}
+	if expected := "sha256:" + hex.EncodeToString(sum[:]); len(digests) != 1 || digests[0] != expected {
+		t.Errorf("TarballConfigDigests() = %v; expected [%s]", digests, expected)
+	}
+
+	if _, err := TarballConfigDigests(bytes.NewReader([]byte{})); err == nil {
+		t.Errorf("TarballConfigDigests() of empty tarball returned nil; expected error")
+	}
+
+	// a second manifest appended to a signed tarball would be the one docker loads
+	appended := writeTarball(append(files, tarFile{name: "./manifest.json", content: []byte(`[{"Config":"other.json","Layers":[]}]`)}))
+	if _, err := TarballConfigDigests(bytes.NewReader(appended)); !errors.Is(err, errs.ErrSignatureInvalid) {
+		t.Errorf("TarballConfigDigests() of tarball with duplicate entries error = %v; expected %v", err, errs.ErrSignatureInvalid)
+	}
+}
+
+func TestCheckEntryNames(t *testing.T) {
+	if err := CheckEntryNames([]string{"manifest.json", "abc.json", "layer/", "layer/layer.tar"}); err != nil {
+		t.Errorf("CheckEntryNames() failed: %v", err)
+	}
+	if err := CheckEntryNames([]string{"abc.json", "manifest.json", "./abc.json"}); !errors.Is(err, errs.ErrSignatureInvalid) {
+		t.Errorf("CheckEntryNames() error = %v; expected %v", err, errs.ErrSignatureInvalid)
+	}
+}
+
+type tarFile struct {
+	name    string
+	content []byte
+}
+
+func writeTarball(files []tarFile) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, file := range files {
+		tw.WriteHeader(&tar.Header{Name: file.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(file.content))})
+		tw.Write(file.content)
+	}
+	tw.Close()
+	return buf.Bytes()
+}
@@ -9,10 +9,13 @@ import (
 	"encoding/pem"
 	"fmt"
 	"math/big"
+	"net"
 	"time"
 )
 
-func GenerateCertificate(commonName string, expiration time.Time) (*tls.Certificate, []byte, error) {
+// GenerateCertificate generates a self-signed certificate valid for the common name and the
+// additional host names or IP addresses.
+func GenerateCertificate(commonName string, expiration time.Time, hosts ...string) (*tls.Certificate, []byte, error) {
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to generate private key: %v", err)
@@ -34,6 +37,13 @@ func GenerateCertificate(commonName string, expiration time.Time) (*tls.Certific
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
 	}
+	for _, host := range append([]string{commonName}, hosts...) {
+		if ip := net.ParseIP(host); ip != nil {
+			certTemplate.IPAddresses = append(certTemplate.IPAddresses, ip)
+		} else {
+			certTemplate.DNSNames = append(certTemplate.DNSNames, host)
+		}
+	}
 
 	certDER, err := x509.CreateCertificate(rand.Reader, &certTemplate, &certTemplate, &privateKey.PublicKey, privateKey)
 	if err != nil {
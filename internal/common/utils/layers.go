@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// LayerChainIDs computes the chain ID of every layer from the ordered layer diff IDs. Docker
+// identifies a layer together with all its parents, so a layer can only be reused when the
+// chain ID matches.
+func LayerChainIDs(diffIDs []string) []string {
+	chainIDs := make([]string, 0, len(diffIDs))
+	for i, diffID := range diffIDs {
+		if i == 0 {
+			chainIDs = append(chainIDs, diffID)
+			continue
+		}
+		sum := sha256.Sum256([]byte(chainIDs[i-1] + " " + diffID))
+		chainIDs = append(chainIDs, "sha256:"+hex.EncodeToString(sum[:]))
+	}
+	return chainIDs
+}
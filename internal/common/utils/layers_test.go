@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLayerChainIDs(t *testing.T) {
+	diffIDs := []string{
+		"sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4",
+		"sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+	}
+	expected := []string{
+		"sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4",
+		"sha256:d587417f0a217771bf1e9d926ffed3a84610f861c354fc04ce90ba6c3f849355",
+	}
+
+	chainIDs := LayerChainIDs(diffIDs)
+	if len(chainIDs) != 2 || chainIDs[0] != expected[0] {
+		t.Fatalf("LayerChainIDs() = %v; expected first chain ID to equal the diff ID", chainIDs)
+	}
+	if !reflect.DeepEqual(chainIDs, expected) {
+		t.Errorf("LayerChainIDs() = %v; expected %v", chainIDs, expected)
+	}
+	if chainIDs := LayerChainIDs(nil); len(chainIDs) != 0 {
+		t.Errorf("LayerChainIDs(nil) = %v; expected empty", chainIDs)
+	}
+}
@@ -2,17 +2,81 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 )
 
 func SendPOSTRequest(URL string, payload []byte) error {
+	return SendPOSTRequestWithHeader(&http.Client{}, URL, nil, payload)
+}
+
+// SendPOSTRequestWithHeader sends the payload with the client, the headers are added to the request.
+func SendPOSTRequestWithHeader(client *http.Client, URL string, header http.Header, payload []byte) error {
 	req, err := http.NewRequest("POST", URL, bytes.NewBuffer(payload))
 	if err != nil {
 		return fmt.Errorf("failed to create POST request: %v", err)
 	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send POST request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", code)
+	}
+
+	return nil
+}
+
+// SendPOSTRequestWithReply sends the payload and returns the response body, bodies larger than
+// maxReplySize are rejected.
+func SendPOSTRequestWithReply(ctx context.Context, URL string, payload []byte, maxReplySize int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", URL, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create POST request: %v", err)
+	}
 	req.Header.Set("Content-Type", "application/json")
 
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send POST request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", code)
+	}
+
+	reply, err := io.ReadAll(io.LimitReader(resp.Body, maxReplySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	if int64(len(reply)) > maxReplySize {
+		return nil, fmt.Errorf("response is larger than %d bytes", maxReplySize)
+	}
+	return reply, nil
+}
+
+// SendPOSTStream sends the body as a stream of raw bytes, the headers are added to the request.
+func SendPOSTStream(ctx context.Context, URL string, header http.Header, body io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", URL, body)
+	if err != nil {
+		return fmt.Errorf("failed to create POST request: %v", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
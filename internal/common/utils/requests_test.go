@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendPOSTStream(t *testing.T) {
+	payload := bytes.Repeat([]byte("data"), 100000)
+
+	var received []byte
+	var source, contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		source = r.Header.Get("X-Source")
+		contentType = r.Header.Get("Content-Type")
+		received, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	header := http.Header{}
+	header.Set("X-Source", "endpoint")
+	if err := SendPOSTStream(context.Background(), srv.URL, header, bytes.NewReader(payload)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(received, payload) {
+		t.Errorf("received %d bytes, expected %d", len(received), len(payload))
+	}
+	if source != "endpoint" {
+		t.Errorf("unexpected header: %q", source)
+	}
+	if contentType != "application/octet-stream" {
+		t.Errorf("unexpected content type: %q", contentType)
+	}
+}
+
+func TestSendPOSTStreamStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	if err := SendPOSTStream(context.Background(), srv.URL, nil, bytes.NewReader(nil)); err == nil {
+		t.Error("expected error for unexpected status code")
+	}
+}
+
+func TestSendPOSTStreamBrokenBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	body, bodyWriter := io.Pipe()
+	go func() {
+		bodyWriter.Write([]byte("partial"))
+		bodyWriter.CloseWithError(io.ErrUnexpectedEOF)
+	}()
+	if err := SendPOSTStream(context.Background(), srv.URL, nil, body); err == nil {
+		t.Error("expected error for broken body")
+	}
+}
+
+func TestSendPOSTRequestWithHeader(t *testing.T) {
+	var received []byte
+	var signature, contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get("X-Signature")
+		contentType = r.Header.Get("Content-Type")
+		received, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	header := http.Header{}
+	header.Set("X-Signature", "sig")
+	if err := SendPOSTRequestWithHeader(srv.Client(), srv.URL, header, []byte(`{}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(received) != `{}` {
+		t.Errorf("unexpected body: %q", received)
+	}
+	if signature != "sig" {
+		t.Errorf("unexpected header: %q", signature)
+	}
+	if contentType != "application/json" {
+		t.Errorf("unexpected content type: %q", contentType)
+	}
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var labelKeyRegex = regexp.MustCompile(`^[A-Za-z0-9]([\w.\-/]*[A-Za-z0-9])?$`)
+
+type selectorOperator string
+
+const (
+	selectorOpEquals    selectorOperator = "="
+	selectorOpNotEquals selectorOperator = "!="
+	selectorOpExists    selectorOperator = "exists"
+	selectorOpNotExists selectorOperator = "!exists"
+)
+
+type selectorRequirement struct {
+	key   string
+	op    selectorOperator
+	value string
+}
+
+// LabelSelector is a parsed label selector, all of its requirements must be met for labels to match.
+type LabelSelector struct {
+	requirements []selectorRequirement
+}
+
+// ParseLabelSelector parses a comma separated list of label requirements.
+//
+// Supported requirements are "key=value", "key==value", "key!=value", "key" (label is present)
+// and "!key" (label is not present). An empty selector matches everything.
+//
+// Example:
+//
+//	selector, err := ParseLabelSelector("region=eu,tier!=edge")
+//	if err != nil {
+//	    // handle error
+//	}
+//	selector.Matches(map[string]string{"region": "eu"}) // true
+func ParseLabelSelector(selector string) (*LabelSelector, error) {
+	ls := &LabelSelector{
+		requirements: []selectorRequirement{},
+	}
+	if strings.TrimSpace(selector) == "" {
+		return ls, nil
+	}
+
+	for _, part := range strings.Split(selector, ",") {
+		part = strings.TrimSpace(part)
+
+		var req selectorRequirement
+		switch {
+		case strings.Contains(part, "!="):
+			kv := strings.SplitN(part, "!=", 2)
+			req = selectorRequirement{key: kv[0], op: selectorOpNotEquals, value: kv[1]}
+		case strings.Contains(part, "=="):
+			kv := strings.SplitN(part, "==", 2)
+			req = selectorRequirement{key: kv[0], op: selectorOpEquals, value: kv[1]}
+		case strings.Contains(part, "="):
+			kv := strings.SplitN(part, "=", 2)
+			req = selectorRequirement{key: kv[0], op: selectorOpEquals, value: kv[1]}
+		case strings.HasPrefix(part, "!"):
+			req = selectorRequirement{key: part[1:], op: selectorOpNotExists}
+		default:
+			req = selectorRequirement{key: part, op: selectorOpExists}
+		}
+
+		req.key = strings.TrimSpace(req.key)
+		req.value = strings.TrimSpace(req.value)
+		if !labelKeyRegex.MatchString(req.key) {
+			return nil, fmt.Errorf("invalid label key in selector: '%s'", part)
+		}
+		ls.requirements = append(ls.requirements, req)
+	}
+	return ls, nil
+}
+
+// Matches reports whether the labels satisfy all requirements of the selector.
+func (ls *LabelSelector) Matches(labels map[string]string) bool {
+	for _, req := range ls.requirements {
+		value, ok := labels[req.key]
+		switch req.op {
+		case selectorOpEquals:
+			if !ok || value != req.value {
+				return false
+			}
+		case selectorOpNotEquals:
+			if ok && value == req.value {
+				return false
+			}
+		case selectorOpExists:
+			if !ok {
+				return false
+			}
+		case selectorOpNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// IsEmpty reports whether the selector has no requirements.
+func (ls *LabelSelector) IsEmpty() bool {
+	return len(ls.requirements) == 0
+}
+
+// ValidateLabels checks that all label keys are well-formed.
+func ValidateLabels(labels map[string]string) error {
+	for key := range labels {
+		if !labelKeyRegex.MatchString(key) {
+			return fmt.Errorf("invalid label key: '%s'", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	labels := map[string]string{
+		"region": "eu",
+		"tier":   "core",
+		"gpu":    "",
+	}
+
+	tests := []struct {
+		name        string
+		selector    string
+		expectMatch bool
+		expectErr   bool
+	}{
+		{
+			name:        "Empty selector",
+			selector:    "",
+			expectMatch: true,
+		},
+		{
+			name:        "Equality",
+			selector:    "region=eu",
+			expectMatch: true,
+		},
+		{
+			name:        "Double equality",
+			selector:    "region==eu",
+			expectMatch: true,
+		},
+		{
+			name:        "Equality with different value",
+			selector:    "region=us",
+			expectMatch: false,
+		},
+		{
+			name:        "Inequality",
+			selector:    "region=eu,tier!=edge",
+			expectMatch: true,
+		},
+		{
+			name:        "Inequality with same value",
+			selector:    "tier!=core",
+			expectMatch: false,
+		},
+		{
+			name:        "Inequality with missing label",
+			selector:    "zone!=a",
+			expectMatch: true,
+		},
+		{
+			name:        "Exists",
+			selector:    "gpu",
+			expectMatch: true,
+		},
+		{
+			name:        "Not exists",
+			selector:    "!gpu",
+			expectMatch: false,
+		},
+		{
+			name:        "Spaces around requirements",
+			selector:    " region = eu , !zone ",
+			expectMatch: true,
+		},
+		{
+			name:      "Invalid key",
+			selector:  "=eu",
+			expectErr: true,
+		},
+		{
+			name:      "Empty requirement",
+			selector:  "region=eu,",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := ParseLabelSelector(tt.selector)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if match := selector.Matches(labels); match != tt.expectMatch {
+				t.Errorf("expected match: %v, got: %v", tt.expectMatch, match)
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package wrapper
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -10,6 +9,7 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/volume"
@@ -104,14 +104,14 @@ func (w *DockerClientWrapper) ImportImage(ctx context.Context, input io.Reader,
 	return nil
 }
 
-func (w *DockerClientWrapper) LoadImage(ctx context.Context, data []byte) (string, error) {
+func (w *DockerClientWrapper) LoadImage(ctx context.Context, src io.Reader) (string, error) {
 	log := zerolog.Ctx(ctx)
-	log.Debug().Msgf("Loading docker image of %d bytes", len(data))
-	reader := bytes.NewReader(data)
-	resp, err := w.client.ImageLoad(ctx, reader, true)
+	log.Debug().Msg("Loading docker image")
+	resp, err := w.client.ImageLoad(ctx, src, true)
 	if err != nil {
 		return "", fmt.Errorf("failed to load docker image: %v", err)
 	}
+	defer resp.Body.Close()
 	b, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return "", fmt.Errorf("failed to read load result: %v", err)
@@ -142,12 +142,13 @@ func (w *DockerClientWrapper) RemoveImage(ctx context.Context, imageReference st
 	return nil
 }
 
-func (w *DockerClientWrapper) CreateVolume(ctx context.Context, volumeName, driver string) error {
+func (w *DockerClientWrapper) CreateVolume(ctx context.Context, volumeName, driver string, labels map[string]string) error {
 	log := zerolog.Ctx(ctx)
 	log.Debug().Msgf("Creating new docker volume: %s", volumeName)
 	_, err := w.client.VolumeCreate(ctx, volume.CreateOptions{
 		Name:   volumeName,
 		Driver: driver,
+		Labels: labels,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create docker volume: %v", err)
@@ -155,6 +156,34 @@ func (w *DockerClientWrapper) CreateVolume(ctx context.Context, volumeName, driv
 	return nil
 }
 
+// ListVolumes lists the docker volumes having all the labels.
+func (w *DockerClientWrapper) ListVolumes(ctx context.Context, labels map[string]string) ([]*volume.Volume, error) {
+	log := zerolog.Ctx(ctx)
+	log.Debug().Msgf("Listing docker volumes: labels=%v", labels)
+	args := filters.NewArgs()
+	for k, v := range labels {
+		args.Add("label", fmt.Sprintf("%s=%s", k, v))
+	}
+	vols, err := w.client.VolumeList(ctx, volume.ListOptions{Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list docker volumes: %v", err)
+	}
+	return vols.Volumes, nil
+}
+
+// VolumesDiskUsage lists the docker volumes with their usage data, computing it can be slow.
+func (w *DockerClientWrapper) VolumesDiskUsage(ctx context.Context) ([]*volume.Volume, error) {
+	log := zerolog.Ctx(ctx)
+	log.Debug().Msg("Getting docker volumes disk usage")
+	usage, err := w.client.DiskUsage(ctx, types.DiskUsageOptions{
+		Types: []types.DiskUsageObject{types.VolumeObject},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get docker disk usage: %v", err)
+	}
+	return usage.Volumes, nil
+}
+
 func (w *DockerClientWrapper) RemoveVolume(ctx context.Context, volumeName string) error {
 	log := zerolog.Ctx(ctx)
 	log.Debug().Msgf("Removing docker volume: %s", volumeName)
@@ -197,6 +226,16 @@ func (w *DockerClientWrapper) RunContainer(ctx context.Context, contCfg *contain
 	return resp.ID, nil
 }
 
+func (w *DockerClientWrapper) StartContainer(ctx context.Context, containerName string) error {
+	log := zerolog.Ctx(ctx)
+	log.Debug().Msgf("Starting docker container: %s", containerName)
+	err := w.client.ContainerStart(ctx, containerName, container.StartOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to start docker container: %v", err)
+	}
+	return nil
+}
+
 func (w *DockerClientWrapper) StopContainer(ctx context.Context, containerName string) error {
 	log := zerolog.Ctx(ctx)
 	log.Debug().Msgf("Stopping docker container: %s", containerName)
@@ -263,6 +302,65 @@ func (w *DockerClientWrapper) RemoveAllContainers(ctx context.Context) error {
 	return nil
 }
 
+func (w *DockerClientWrapper) InspectContainer(ctx context.Context, containerRef string) (*types.ContainerJSON, error) {
+	log := zerolog.Ctx(ctx)
+	log.Debug().Msgf("Inspecting docker container: %s", containerRef)
+	cont, err := w.client.ContainerInspect(ctx, containerRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect docker container: %v", err)
+	}
+	return &cont, nil
+}
+
+// ContainerLogs returns the multiplexed stdout and stderr of the container, the caller must
+// close the reader.
+func (w *DockerClientWrapper) ContainerLogs(ctx context.Context, containerRef string, options container.LogsOptions) (io.ReadCloser, error) {
+	log := zerolog.Ctx(ctx)
+	log.Debug().Msgf("Reading docker container logs: %s", containerRef)
+	logs, err := w.client.ContainerLogs(ctx, containerRef, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read docker container logs: %v", err)
+	}
+	return logs, nil
+}
+
+func (w *DockerClientWrapper) CreateExec(ctx context.Context, containerRef string, options container.ExecOptions) (string, error) {
+	log := zerolog.Ctx(ctx)
+	log.Debug().Msgf("Creating docker exec in container: %s, cmd=%v", containerRef, options.Cmd)
+	resp, err := w.client.ContainerExecCreate(ctx, containerRef, options)
+	if err != nil {
+		return "", fmt.Errorf("failed to create docker exec: %v", err)
+	}
+	return resp.ID, nil
+}
+
+// AttachExec starts the exec and returns the connection to its streams, the caller must close
+// the connection.
+func (w *DockerClientWrapper) AttachExec(ctx context.Context, execID string, options container.ExecAttachOptions) (*types.HijackedResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Debug().Msgf("Attaching to docker exec: %s", execID)
+	resp, err := w.client.ContainerExecAttach(ctx, execID, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to docker exec: %v", err)
+	}
+	return &resp, nil
+}
+
+func (w *DockerClientWrapper) ResizeExec(ctx context.Context, execID string, options container.ResizeOptions) error {
+	if err := w.client.ContainerExecResize(ctx, execID, options); err != nil {
+		return fmt.Errorf("failed to resize docker exec: %v", err)
+	}
+	return nil
+}
+
+func (w *DockerClientWrapper) InspectExec(ctx context.Context, execID string) (*container.ExecInspect, error) {
+	resp, err := w.client.ContainerExecInspect(ctx, execID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect docker exec: %v", err)
+	}
+	return &resp, nil
+}
+
 func (w *DockerClientWrapper) WaitForContainer(ctx context.Context, containerRef string) error {
 	log := zerolog.Ctx(ctx)
 	for {
@@ -290,6 +388,16 @@ func (w *DockerClientWrapper) CreateNetwork(ctx context.Context, networkName str
 	return resp.ID, nil
 }
 
+func (w *DockerClientWrapper) InspectNetwork(ctx context.Context, networkID string) (*network.Inspect, error) {
+	log := zerolog.Ctx(ctx)
+	log.Debug().Msgf("Inspecting docker network: %s", networkID)
+	info, err := w.client.NetworkInspect(ctx, networkID, network.InspectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect docker network: %v", err)
+	}
+	return &info, nil
+}
+
 func (w *DockerClientWrapper) ListNetworks(ctx context.Context) ([]network.Inspect, error) {
 	log := zerolog.Ctx(ctx)
 	log.Debug().Msg("Listing docker networks")
@@ -2,14 +2,22 @@ package app
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
+	"os"
 	"sync"
 
+	"github.com/pajtaand/dmap-zero/internal/common/blobstore"
 	"github.com/pajtaand/dmap-zero/internal/common/constants"
 	"github.com/pajtaand/dmap-zero/internal/common/database"
 	mm "github.com/pajtaand/dmap-zero/internal/common/manager"
+	"github.com/pajtaand/dmap-zero/internal/common/secrets"
+	"github.com/pajtaand/dmap-zero/internal/common/signing"
 	"github.com/pajtaand/dmap-zero/internal/common/wrapper"
 	ctrl_grpc "github.com/pajtaand/dmap-zero/internal/controller/grpc"
 	"github.com/pajtaand/dmap-zero/internal/controller/manager"
@@ -21,6 +29,11 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	signingKeyDatabaseKey = "signing/image-key"
+	secretsKeyDatabaseKey = "secrets/master-key"
+)
+
 type ControllerAppConfig struct {
 	ApiCredentials map[string]string
 	RESTapi        struct {
@@ -37,6 +50,33 @@ type ControllerAppConfig struct {
 		KeyAlg          ziti.KeyAlgVar
 		EnrollmentToken string
 	}
+	Database struct {
+		// File is the path of the on-disk database, in-memory storage is used when empty
+		File string
+	}
+	Images struct {
+		// Dir is the directory image tarballs are stored in, a temporary directory is used when empty
+		Dir string
+		// SigningKeyFile is the PEM encoded Ed25519 key images are signed with, a key is
+		// generated and kept in the database when empty
+		SigningKeyFile string
+	}
+	Secrets struct {
+		// KeyFile holds the hex encoded 32 byte master key secrets are encrypted with, a key is
+		// generated into it on the first start. It must be kept apart from the database
+		KeyFile string
+	}
+	Webhooks struct {
+		// CertFile and KeyFile are the client certificate presented to webhooks, deliveries
+		// don't use mTLS when empty
+		CertFile string
+		KeyFile  string
+		// CAFile is the PEM bundle webhook servers are verified with, the system pool is used
+		// when empty
+		CAFile string
+	}
+	// ExecUsers are the API users allowed to open exec sessions in module containers
+	ExecUsers []string
 }
 
 type ControllerApp struct {
@@ -45,11 +85,15 @@ type ControllerApp struct {
 	clientServer  *rest.RESTServer
 	metricsServer *metrics.MetricsServer
 
+	rolloutService *service.RolloutService
+
 	agentManager   *manager.AgentManager
 	moduleManager  *manager.ModuleManager
 	imageManager   *manager.ImageManager
 	webhookManager *manager.WebhookManager
+	secretManager  *manager.SecretManager
 	userAuthStore  *mm.AuthStore
+	database       database.Database
 }
 
 func NewControllerApp(cfg *ControllerAppConfig) (*ControllerApp, error) {
@@ -76,6 +120,9 @@ func NewControllerApp(cfg *ControllerAppConfig) (*ControllerApp, error) {
 	if cfg.MetricsApi.KeyFile == "" {
 		return nil, errors.New("value KeyFile for MetricsApi not set")
 	}
+	if cfg.Secrets.KeyFile == "" {
+		return nil, errors.New("value KeyFile for Secrets not set")
+	}
 	if cfg.OpenZiti.KeyAlg == "" {
 		return nil, errors.New("value KeyAlg for OpenZiti not set")
 	}
@@ -92,10 +139,6 @@ func NewControllerApp(cfg *ControllerAppConfig) (*ControllerApp, error) {
 func (app *ControllerApp) Setup(ctx context.Context) error {
 	log.Info().Msg("Setting up controller")
 
-	if err := app.Clean(ctx); err != nil {
-		return err
-	}
-
 	// OpenZiti Identity
 	openZitiClient, err := wrapper.NewOpenZitiClientWrapperFromToken(
 		&wrapper.OpenZitiClientWrapperConfig{
@@ -114,43 +157,106 @@ func (app *ControllerApp) Setup(ctx context.Context) error {
 	}
 
 	log.Debug().Msg("Connecting to database")
-	imageDatabase := database.NewKVStore()
+	if app.cfg.Database.File == "" {
+		log.Warn().Msg("No database file configured, state will not survive a restart")
+		app.database = database.NewKVStore()
+	} else {
+		db, err := database.NewBoltStore(app.cfg.Database.File)
+		if err != nil {
+			return fmt.Errorf("failed to open database: %v", err)
+		}
+		app.database = db
+	}
+
+	log.Debug().Msg("Opening image store")
+	var blobStore *blobstore.BlobStore
+	if app.cfg.Images.Dir == "" {
+		log.Warn().Msg("No image directory configured, images will not survive a restart")
+		blobStore, err = blobstore.NewTempBlobStore()
+	} else {
+		blobStore, err = blobstore.NewBlobStore(app.cfg.Images.Dir)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open image store: %v", err)
+	}
+
+	log.Debug().Msg("Loading image signing key")
+	signingKey, err := app.loadSigningKey()
+	if err != nil {
+		return fmt.Errorf("failed to load image signing key: %v", err)
+	}
+	signer, err := signing.NewSigner(signingKey)
+	if err != nil {
+		return fmt.Errorf("failed to create image signer: %v", err)
+	}
+	if publicKey, err := signing.MarshalPublicKey(signer.PublicKey()); err == nil {
+		log.Info().Msgf("Agents must trust the image signing key:\n%s", publicKey)
+	}
+
+	log.Debug().Msg("Loading secrets master key")
+	secretsKey, err := app.loadSecretsKey()
+	if err != nil {
+		return fmt.Errorf("failed to load secrets master key: %v", err)
+	}
+	secretsBox, err := secrets.NewBox(secretsKey)
+	if err != nil {
+		return fmt.Errorf("failed to create secrets box: %v", err)
+	}
 
 	log.Debug().Msg("Creating managers")
 	agentManager, err := manager.NewAgentManager(&manager.AgentManagerConfig{
 		AgentServiceName: constants.OpenZitiServiceAgent,
-	}, openZitiClient)
+	}, openZitiClient, app.database)
 	if err != nil {
 		return fmt.Errorf("failed to create AgentManager: %v", err)
 	}
-	moduleManager, err := manager.NewModuleManager()
+	moduleManager, err := manager.NewModuleManager(app.database)
 	if err != nil {
 		return fmt.Errorf("failed to create ModuleManager: %v", err)
 	}
-	imageManager, err := manager.NewImageManager(imageDatabase)
+	imageManager, err := manager.NewImageManager(blobStore, signer, app.database)
 	if err != nil {
 		return fmt.Errorf("failed to create ImageManager: %v", err)
 	}
-	webhookManager, err := manager.NewWebhookManager()
+	webhookClient, err := app.newWebhookClient()
+	if err != nil {
+		return fmt.Errorf("failed to create webhook client: %v", err)
+	}
+	webhookManager, err := manager.NewWebhookManager(secretsBox, app.database, webhookClient)
 	if err != nil {
 		return fmt.Errorf("failed to create WebhookManager: %v", err)
 	}
+	secretManager, err := manager.NewSecretManager(secretsBox, app.database)
+	if err != nil {
+		return fmt.Errorf("failed to create SecretManager: %v", err)
+	}
+	deliveryManager, err := manager.NewDeliveryManager(app.database)
+	if err != nil {
+		return fmt.Errorf("failed to create DeliveryManager: %v", err)
+	}
 	userAuthStore := mm.NewAuthStore()
 	for username, password := range app.cfg.ApiCredentials {
 		userAuthStore.Add(username, password)
 	}
+	for _, username := range app.cfg.ExecUsers {
+		if _, ok := app.cfg.ApiCredentials[username]; !ok {
+			return fmt.Errorf("exec user '%s' has no API credentials", username)
+		}
+		userAuthStore.Grant(username, constants.PermissionModuleExec)
+	}
 	app.agentManager = agentManager
 	app.moduleManager = moduleManager
 	app.imageManager = imageManager
 	app.webhookManager = webhookManager
+	app.secretManager = secretManager
 	app.userAuthStore = userAuthStore
 
 	log.Debug().Msg("Creating services")
-	agentService, err := service.NewAgentService(agentManager, openZitiWrapper)
+	agentService, err := service.NewAgentService(agentManager, imageManager, moduleManager, secretManager, openZitiWrapper)
 	if err != nil {
 		return fmt.Errorf("failed to create AgentService: %v", err)
 	}
-	moduleService, err := service.NewModuleService(moduleManager, imageManager, agentManager)
+	moduleService, err := service.NewModuleService(moduleManager, imageManager, agentManager, secretManager, deliveryManager)
 	if err != nil {
 		return fmt.Errorf("failed to create ModuleService: %v", err)
 	}
@@ -162,30 +268,45 @@ func (app *ControllerApp) Setup(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to create WebhookService: %v", err)
 	}
+	messageService, err := service.NewMessageService(deliveryManager)
+	if err != nil {
+		return fmt.Errorf("failed to create MessageService: %v", err)
+	}
+	secretService, err := service.NewSecretService(secretManager, moduleManager, agentManager)
+	if err != nil {
+		return fmt.Errorf("failed to create SecretService: %v", err)
+	}
 	enrollmentService, err := service.NewEnrollmentService(agentManager, openZitiWrapper)
 	if err != nil {
 		return fmt.Errorf("failed to create EnrollmentService: %v", err)
 	}
-	phonehomeService, err := service.NewPhonehomeService(agentManager)
+	phonehomeService, err := service.NewPhonehomeService(agentManager, imageManager, moduleManager, secretManager)
 	if err != nil {
 		return fmt.Errorf("failed to create HealthService: %v", err)
 	}
-	setupService, err := service.NewSetupService(agentManager, imageManager, moduleManager)
+	setupService, err := service.NewSetupService(agentManager, imageManager, moduleManager, secretManager)
 	if err != nil {
 		return fmt.Errorf("failed to create SetupService: %v", err)
 	}
-	receiveService, err := service.NewReceiveService(webhookManager)
+	receiveService, err := service.NewReceiveService(webhookManager, deliveryManager)
 	if err != nil {
 		return fmt.Errorf("failed to create ReceiveService: %v", err)
 	}
+	app.rolloutService, err = service.NewRolloutService(moduleManager, agentManager)
+	if err != nil {
+		return fmt.Errorf("failed to create RolloutService: %v", err)
+	}
 
 	log.Debug().Msg("Preparing servers")
 	app.clientServer = rest.NewRESTServer(
+		app.userAuthStore,
 		app.userAuthStore,
 		agentService,
 		moduleService,
 		imageService,
 		webhookService,
+		messageService,
+		secretService,
 		enrollmentService,
 	)
 
@@ -248,6 +369,8 @@ func (app *ControllerApp) Run(ctx context.Context) error {
 		}
 	}()
 
+	go app.rolloutService.Run(ctx)
+
 	log.Info().Msg("Controller successfully started")
 	wg.Wait()
 
@@ -269,19 +392,116 @@ func (app *ControllerApp) Stop(ctx context.Context) error {
 func (app *ControllerApp) Clean(ctx context.Context) error {
 	log.Debug().Msg("Cleaning up")
 
+	// state is kept in the database, only runtime resources are released
 	if app.agentManager != nil {
 		for _, agent := range app.agentManager.ListAgents() {
-			if err := app.agentManager.RemoveAgent(agent.GetID()); err != nil {
-				return err
-			}
+			agent.Cleanup()
 		}
 	}
-	if app.imageManager != nil {
-		for _, image := range app.imageManager.ListImages() {
-			if err := app.imageManager.RemoveImage(image.GetID()); err != nil {
-				return err
-			}
+	if app.database != nil {
+		if err := app.database.Close(); err != nil {
+			return fmt.Errorf("failed to close database: %v", err)
 		}
 	}
 	return nil
 }
+
+// loadSigningKey loads the configured image signing key. Without one, the key generated on the
+// first start is kept in the database, so agents keep trusting the controller across restarts.
+func (app *ControllerApp) loadSigningKey() (ed25519.PrivateKey, error) {
+	if app.cfg.Images.SigningKeyFile != "" {
+		return signing.LoadPrivateKey(app.cfg.Images.SigningKeyFile)
+	}
+
+	data, ok, err := app.database.Get(signingKeyDatabaseKey)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return signing.ParsePrivateKey(data)
+	}
+
+	log.Warn().Msg("No image signing key configured, generating a new one")
+	key, err := signing.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	data, err = signing.MarshalPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.database.Set(signingKeyDatabaseKey, data); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// loadSecretsKey loads the secrets master key from its key file, so the key isn't stored next to
+// the secrets it encrypts. The key is generated into the file on the first start, a key kept in
+// the database by earlier versions is moved to it.
+func (app *ControllerApp) loadSecretsKey() ([]byte, error) {
+	fileName := app.cfg.Secrets.KeyFile
+	key, err := secrets.LoadKey(fileName)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return key, err
+	}
+
+	key, ok, err := app.database.Get(secretsKeyDatabaseKey)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		log.Warn().Msgf("Moving secrets master key out of the database to %s", fileName)
+	} else {
+		log.Info().Msgf("Generating secrets master key to %s", fileName)
+		if key, err = secrets.GenerateKey(); err != nil {
+			return nil, err
+		}
+	}
+	if err := secrets.SaveKey(fileName, key); err != nil {
+		return nil, err
+	}
+	if ok {
+		if err := app.database.Delete(secretsKeyDatabaseKey); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// newWebhookClient creates the client webhook deliveries are sent with. It presents the configured
+// client certificate so webhook servers can require mTLS.
+func (app *ControllerApp) newWebhookClient() (*http.Client, error) {
+	cfg := app.cfg.Webhooks
+	if cfg.CertFile == "" && cfg.KeyFile == "" && cfg.CAFile == "" {
+		return &http.Client{}, nil
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, errors.New("both CertFile and KeyFile for Webhooks must be set")
+	}
+
+	tlsConfig := &tls.Config{}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		log.Info().Msg("Webhook deliveries present a client certificate")
+	}
+	if cfg.CAFile != "" {
+		data, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in CA file '%s'", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
@@ -3,6 +3,7 @@ package dto
 type CreateAgentRequest struct {
 	Name          string
 	Configuration map[string]string
+	Labels        map[string]string
 }
 
 type CreateAgentResponse struct {
@@ -13,26 +14,50 @@ type GetAgentRequest struct {
 	ID string
 }
 
+type AgentDrift struct {
+	InSync            bool
+	MissingImages     []string
+	UnexpectedImages  []string
+	MissingModules    []string
+	UnexpectedModules []string
+}
+
 type GetAgentResponse struct {
-	Name           string
-	Configuration  map[string]string
-	IsEnrolled     bool
-	IsOnline       bool
-	PresentImages  []string
-	PresentModules []string
+	Name            string
+	Configuration   map[string]string
+	Labels          map[string]string
+	IsEnrolled      bool
+	IsOnline        bool
+	PresentImages   []string
+	RejectedImages  map[string]string
+	RejectedModules map[string]string
+	VolumeUsage     map[string]map[string]int64
+	PresentModules  []string
+	ModuleStatuses  map[string]string
+	ModuleRestarts  map[string]int
+	Subscriptions   map[string][]string
+	Drift           *AgentDrift
 }
 
 type ListAgentsRequest struct {
+	Selector string
 }
 
 type ListAgentsResponseAgent struct {
-	ID             string
-	Name           string
-	Configuration  map[string]string
-	IsEnrolled     bool
-	IsOnline       bool
-	PresentImages  []string
-	PresentModules []string
+	ID              string
+	Name            string
+	Configuration   map[string]string
+	Labels          map[string]string
+	IsEnrolled      bool
+	IsOnline        bool
+	PresentImages   []string
+	RejectedImages  map[string]string
+	RejectedModules map[string]string
+	VolumeUsage     map[string]map[string]int64
+	PresentModules  []string
+	ModuleStatuses  map[string]string
+	ModuleRestarts  map[string]int
+	Subscriptions   map[string][]string
 }
 
 type ListAgentsResponse struct {
@@ -43,6 +68,7 @@ type UpdateAgentRequest struct {
 	ID            string
 	Name          string
 	Configuration map[string]string
+	Labels        map[string]string
 }
 
 type UpdateAgentResponse struct {
@@ -54,3 +80,48 @@ type DeleteAgentRequest struct {
 
 type DeleteAgentResponse struct {
 }
+
+type StreamModuleLogsRequest struct {
+	AgentID    string
+	ModuleID   string
+	Since      string
+	Tail       string
+	Follow     bool
+	Timestamps bool
+}
+
+type ModuleLogChunk struct {
+	Stream string
+	Data   []byte
+}
+
+type StreamModuleLogsResponse struct {
+	// Recv returns the next chunk of the logs, io.EOF is returned once the logs end.
+	Recv func() (*ModuleLogChunk, error)
+}
+
+type ExecModuleRequest struct {
+	AgentID  string
+	ModuleID string
+	Command  []string
+	Tty      bool
+	Rows     uint32
+	Cols     uint32
+}
+
+type ExecOutput struct {
+	Stream string
+	Data   []byte
+}
+
+type ExecModuleResponse struct {
+	// Recv returns the next output of the command, once the command exits it returns io.EOF
+	// and ExitCode returns its exit code.
+	Recv       func() (*ExecOutput, error)
+	ExitCode   func() int
+	Stdin      func(data []byte) error
+	Resize     func(rows, cols uint32) error
+	CloseStdin func() error
+	// Close ends the session, the command is detached if it is still running.
+	Close func()
+}
@@ -11,28 +11,60 @@ type UploadImageResponse struct {
 	ID string
 }
 
+type RegisterImageRequest struct {
+	Name      string
+	Reference string
+	Platform  string
+	Insecure  bool
+	Username  string
+	Password  string
+}
+
+type RegisterImageResponse struct {
+	ID string
+}
+
 type GetImageRequest struct {
 	ID string
 }
 
 type GetImageResponse struct {
-	Name string
-	Size int
+	Name          string
+	Size          int
+	Digest        string
+	Source        string
+	Reference     string
+	Platform      string
+	Status        string
+	StatusMessage string
 }
 
 type ListImagesRequest struct {
 }
 
 type ListImagesResponseImage struct {
-	ID   string
-	Name string
-	Size int
+	ID            string
+	Name          string
+	Size          int
+	Digest        string
+	Source        string
+	Reference     string
+	Platform      string
+	Status        string
+	StatusMessage string
 }
 
 type ListImagesResponse struct {
 	Images []*ListImagesResponseImage
 }
 
+type GetImageSigningKeyRequest struct {
+}
+
+type GetImageSigningKeyResponse struct {
+	PublicKey string
+}
+
 type DeleteImageRequest struct {
 	ID string
 }
@@ -0,0 +1,24 @@
+package dto
+
+import "time"
+
+type DeliveryRecipient struct {
+	AgentID  string
+	ModuleID string
+	Outcome  string
+	Error    string
+}
+
+type GetMessageRequest struct {
+	ID string
+}
+
+type GetMessageResponse struct {
+	ID            string
+	Direction     string
+	ModuleID      string
+	Receiver      string
+	SourceAgentID string
+	CreatedAt     time.Time
+	Recipients    []DeliveryRecipient
+}
@@ -1,9 +1,75 @@
 package dto
 
+import "time"
+
+type ModulePlacement struct {
+	All      bool
+	AgentIDs []string
+	Selector string
+}
+
+type ModuleRestartPolicy struct {
+	Policy     string
+	MaxRetries int
+}
+
+type ModuleResources struct {
+	CPUs        float64
+	MemoryBytes int64
+	PidsLimit   int64
+}
+
+type ModuleSecurity struct {
+	ReadOnlyRootfs  bool
+	User            string
+	CapAdd          []string
+	CapDrop         []string
+	SeccompProfile  string
+	NoNewPrivileges bool
+	Privileged      bool
+	HostNetwork     bool
+	Tmpfs           map[string]string
+}
+
+type ModuleVolume struct {
+	Name      string
+	Path      string
+	ReadOnly  bool
+	Retention string
+}
+
+type ModuleBindMount struct {
+	HostPath string
+	Path     string
+	ReadOnly bool
+}
+
+type ModuleSecretMount struct {
+	Secret string
+	Path   string
+}
+
+type ModuleStorage struct {
+	Volumes    []*ModuleVolume
+	BindMounts []*ModuleBindMount
+	Secrets    []*ModuleSecretMount
+}
+
+type ModuleRolloutStrategy struct {
+	MaxUnavailable   int
+	CanaryPercentage int
+	ProgressDeadline int
+}
+
 type CreateModuleRequest struct {
 	Name          string
 	Image         string
 	Configuration map[string]string
+	Resources     *ModuleResources
+	Security      *ModuleSecurity
+	Storage       *ModuleStorage
+	Placement     *ModulePlacement
+	RestartPolicy *ModuleRestartPolicy
 }
 
 type CreateModuleResponse struct {
@@ -18,7 +84,14 @@ type GetModuleResponse struct {
 	Name          string
 	Image         string
 	Configuration map[string]string
+	Resources     *ModuleResources
+	Security      *ModuleSecurity
+	Storage       *ModuleStorage
+	Placement     *ModulePlacement
+	RestartPolicy *ModuleRestartPolicy
 	IsRunning     bool
+	Revision      int
+	AgentStatuses map[string]string
 }
 
 type ListModulesRequest struct {
@@ -29,6 +102,11 @@ type ListModulesResponseModule struct {
 	Name          string
 	Image         string
 	Configuration map[string]string
+	Resources     *ModuleResources
+	Security      *ModuleSecurity
+	Storage       *ModuleStorage
+	Placement     *ModulePlacement
+	RestartPolicy *ModuleRestartPolicy
 	IsRunning     bool
 }
 
@@ -41,11 +119,68 @@ type UpdateModuleRequest struct {
 	Name          string
 	Image         string
 	Configuration map[string]string
+	Resources     *ModuleResources
+	Security      *ModuleSecurity
+	Storage       *ModuleStorage
+	Placement     *ModulePlacement
+	RestartPolicy *ModuleRestartPolicy
+	Rollout       *ModuleRolloutStrategy
 }
 
 type UpdateModuleResponse struct {
 }
 
+type ModuleRevision struct {
+	Revision      int
+	Image         string
+	Configuration map[string]string
+	Resources     *ModuleResources
+	Security      *ModuleSecurity
+	Storage       *ModuleStorage
+	Placement     *ModulePlacement
+	ChangedBy     string
+	Message       string
+	CreatedAt     time.Time
+	Removed       bool
+}
+
+type ListModuleRevisionsRequest struct {
+	ID string
+}
+
+type ListModuleRevisionsResponse struct {
+	Revision  int
+	Revisions []*ModuleRevision
+}
+
+type RollbackModuleRequest struct {
+	ID       string
+	Revision int
+}
+
+type RollbackModuleResponse struct {
+	Revision int
+}
+
+type GetModuleRolloutRequest struct {
+	ID string
+}
+
+type GetModuleRolloutResponse struct {
+	ID             string
+	FromRevision   int
+	ToRevision     int
+	Strategy       *ModuleRolloutStrategy
+	Batches        [][]string
+	CurrentBatch   int
+	State          string
+	Message        string
+	AgentStatuses  map[string]string
+	StartedAt      time.Time
+	BatchStartedAt time.Time
+	FinishedAt     time.Time
+}
+
 type DeleteModuleRequest struct {
 	ID string
 }
@@ -70,7 +205,16 @@ type StopModuleResponse struct {
 type SendDataRequest struct {
 	ModuleID string
 	Data     []byte
+	Target   *SendDataTarget
+}
+
+type SendDataTarget struct {
+	AgentID  string
+	Selector string
+	Any      bool
 }
 
 type SendDataResponse struct {
+	MessageID  string
+	Recipients []DeliveryRecipient
 }
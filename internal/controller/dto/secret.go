@@ -0,0 +1,39 @@
+package dto
+
+import "time"
+
+type CreateSecretRequest struct {
+	Name  string
+	Value []byte
+}
+
+type CreateSecretResponse struct {
+}
+
+type ListSecretsRequest struct {
+}
+
+type ListSecretsResponse struct {
+	Secrets []*ListSecretsResponseSecret
+}
+
+type ListSecretsResponseSecret struct {
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type UpdateSecretRequest struct {
+	Name  string
+	Value []byte
+}
+
+type UpdateSecretResponse struct {
+}
+
+type DeleteSecretRequest struct {
+	Name string
+}
+
+type DeleteSecretResponse struct {
+}
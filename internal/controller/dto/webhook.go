@@ -6,7 +6,8 @@ type RegisterWebhookRequest struct {
 }
 
 type RegisterWebhookResponse struct {
-	ID string
+	ID     string
+	Secret string
 }
 
 type ListWebhooksRequest struct {
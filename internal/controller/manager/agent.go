@@ -11,6 +11,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/openziti/sdk-golang/ziti"
 	"github.com/pajtaand/dmap-zero/internal/common/constants"
+	"github.com/pajtaand/dmap-zero/internal/common/database"
 	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
 	"github.com/pajtaand/dmap-zero/internal/common/wrapper"
 	pb "github.com/pajtaand/dmap-zero/internal/proto"
@@ -18,15 +19,46 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 )
 
+// ModuleRejection is a module revision the agent refused to run, e.g. because it violates the
+// agent's module policy.
+type ModuleRejection struct {
+	Revision int
+	Reason   string
+}
+
 type Diagnostics struct {
-	PresentImages  map[string]string
-	PresentModules map[string]string
+	PresentImages   map[string]string
+	PresentModules  map[string]string
+	ModuleStatuses  map[string]string
+	ModuleRestarts  map[string]int
+	ModuleRevisions map[string]int
+	RejectedImages  map[string]string
+	RejectedModules map[string]*ModuleRejection
+	VolumeUsage     map[string]map[string]int64 // volume sizes by module ID and volume name
+	Subscriptions   map[string][]string         // subscribed module IDs by topic
 }
 
 type diagnostics struct {
-	time           time.Time
-	presentImages  map[string]string
-	presentModules map[string]string
+	time            time.Time
+	presentImages   map[string]string
+	presentModules  map[string]string
+	moduleStatuses  map[string]string
+	moduleRestarts  map[string]int
+	moduleRevisions map[string]int
+	rejectedImages  map[string]string
+	rejectedModules map[string]*ModuleRejection
+	volumeUsage     map[string]map[string]int64
+	subscriptions   map[string][]string
+}
+
+const agentKeyPrefix = "agent/"
+
+type agentRecord struct {
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	IdentityID    string            `json:"identityID"`
+	Configuration map[string]string `json:"configuration"`
+	Labels        map[string]string `json:"labels"`
 }
 
 type Agent struct {
@@ -34,24 +66,42 @@ type Agent struct {
 	name          string
 	identityID    string
 	configuration map[string]string
+	labels        map[string]string
 	diag          *diagnostics
 	conn          *grpc.ClientConn
 
-	mu sync.RWMutex
+	mu       sync.RWMutex
+	database database.Database
 }
 
-func NewAgent(id, name string, configuration map[string]string) *Agent {
+func NewAgent(id, name string, configuration, labels map[string]string, database database.Database) *Agent {
 	if configuration == nil {
 		configuration = map[string]string{}
 	}
+	if labels == nil {
+		labels = map[string]string{}
+	}
 
 	return &Agent{
 		id:            id,
 		name:          name,
 		configuration: configuration,
+		labels:        labels,
+		database:      database,
 	}
 }
 
+// save persists the agent, the caller must hold the lock.
+func (a *Agent) save() error {
+	return database.SetJSON(a.database, agentKeyPrefix+a.id, &agentRecord{
+		ID:            a.id,
+		Name:          a.name,
+		IdentityID:    a.identityID,
+		Configuration: a.configuration,
+		Labels:        a.labels,
+	})
+}
+
 func (a *Agent) Connect(conn *grpc.ClientConn) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -134,7 +184,13 @@ func (a *Agent) GetConfiguration() map[string]string {
 	return a.configuration
 }
 
-func (a *Agent) SetIdentityID(identityID string) {
+func (a *Agent) GetLabels() map[string]string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.labels
+}
+
+func (a *Agent) SetIdentityID(identityID string) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	a.identityID = identityID
@@ -143,15 +199,17 @@ func (a *Agent) SetIdentityID(identityID string) {
 		a.conn.Close()
 		a.conn = nil
 	}
+	return a.save()
 }
 
-func (a *Agent) SetName(name string) {
+func (a *Agent) SetName(name string) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	a.name = name
+	return a.save()
 }
 
-func (a *Agent) SetConfiguration(configuration map[string]string) {
+func (a *Agent) SetConfiguration(configuration map[string]string) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
@@ -159,6 +217,18 @@ func (a *Agent) SetConfiguration(configuration map[string]string) {
 		configuration = map[string]string{}
 	}
 	a.configuration = configuration
+	return a.save()
+}
+
+func (a *Agent) SetLabels(labels map[string]string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	a.labels = labels
+	return a.save()
 }
 
 func (a *Agent) GetDiagnostics() *Diagnostics {
@@ -166,8 +236,15 @@ func (a *Agent) GetDiagnostics() *Diagnostics {
 	defer a.mu.RUnlock()
 	if a.diag != nil && time.Since(a.diag.time) < constants.ControllerAgentMaxDiagnosticsDelay {
 		return &Diagnostics{
-			PresentImages:  a.diag.presentImages,
-			PresentModules: a.diag.presentModules,
+			PresentImages:   a.diag.presentImages,
+			PresentModules:  a.diag.presentModules,
+			ModuleStatuses:  a.diag.moduleStatuses,
+			ModuleRestarts:  a.diag.moduleRestarts,
+			ModuleRevisions: a.diag.moduleRevisions,
+			RejectedImages:  a.diag.rejectedImages,
+			RejectedModules: a.diag.rejectedModules,
+			VolumeUsage:     a.diag.volumeUsage,
+			Subscriptions:   a.diag.subscriptions,
 		}
 	}
 	return nil
@@ -177,9 +254,16 @@ func (a *Agent) setDiagnostics(diag *Diagnostics) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	a.diag = &diagnostics{
-		time:           time.Now(),
-		presentImages:  diag.PresentImages,
-		presentModules: diag.PresentModules,
+		time:            time.Now(),
+		presentImages:   diag.PresentImages,
+		presentModules:  diag.PresentModules,
+		moduleStatuses:  diag.ModuleStatuses,
+		moduleRestarts:  diag.ModuleRestarts,
+		moduleRevisions: diag.ModuleRevisions,
+		rejectedImages:  diag.RejectedImages,
+		rejectedModules: diag.RejectedModules,
+		volumeUsage:     diag.VolumeUsage,
+		subscriptions:   diag.Subscriptions,
 	}
 }
 
@@ -192,30 +276,61 @@ type AgentManager struct {
 	mu             sync.RWMutex
 	agents         map[string]*Agent
 	openZitiClient *wrapper.OpenZitiClientWrapper
+	database       database.Database
 }
 
-func NewAgentManager(config *AgentManagerConfig, openZitiClient *wrapper.OpenZitiClientWrapper) (*AgentManager, error) {
+func NewAgentManager(config *AgentManagerConfig, openZitiClient *wrapper.OpenZitiClientWrapper, database database.Database) (*AgentManager, error) {
 	log.Debug().Msg("Creating new AgentManager")
 
 	if config == nil {
 		return nil, errors.New("config must not be nil")
 	}
+	if database == nil {
+		return nil, errors.New("database must not be nil")
+	}
 
-	return &AgentManager{
+	mgr := &AgentManager{
 		config:         config,
 		agents:         map[string]*Agent{},
 		openZitiClient: openZitiClient,
-	}, nil
+		database:       database,
+	}
+	if err := mgr.load(); err != nil {
+		return nil, fmt.Errorf("failed to load agents: %v", err)
+	}
+	return mgr, nil
+}
+
+func (mgr *AgentManager) load() error {
+	keys, err := mgr.database.Keys(agentKeyPrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		record := &agentRecord{}
+		if _, err := database.GetJSON(mgr.database, key, record); err != nil {
+			return err
+		}
+		agent := NewAgent(record.ID, record.Name, record.Configuration, record.Labels, mgr.database)
+		agent.identityID = record.IdentityID
+		mgr.agents[record.ID] = agent
+	}
+	log.Info().Msgf("Loaded %d agents from database", len(mgr.agents))
+	return nil
 }
 
-func (mgr *AgentManager) AddAgent(name string, configuration map[string]string) string {
+func (mgr *AgentManager) AddAgent(name string, configuration, labels map[string]string) (string, error) {
 	log.Info().Msgf("Adding new agent: %s", name)
 
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
 	agentID := uuid.New().String()
-	mgr.agents[agentID] = NewAgent(agentID, name, configuration)
-	return agentID
+	agent := NewAgent(agentID, name, configuration, labels, mgr.database)
+	if err := agent.save(); err != nil {
+		return "", fmt.Errorf("failed to save agent: %v", err)
+	}
+	mgr.agents[agentID] = agent
+	return agentID, nil
 }
 
 func (mgr *AgentManager) GetAgent(agentID string) (*Agent, error) {
@@ -269,6 +384,10 @@ func (mgr *AgentManager) RemoveAgent(agentID string) error {
 		return errs.ErrNotFound
 	}
 
+	if err := mgr.database.Delete(agentKeyPrefix + agentID); err != nil {
+		return fmt.Errorf("failed to delete agent: %v", err)
+	}
+
 	agent.Cleanup()
 
 	delete(mgr.agents, agentID)
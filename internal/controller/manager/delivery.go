@@ -0,0 +1,157 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+	"github.com/pajtaand/dmap-zero/internal/common/database"
+	"github.com/pajtaand/dmap-zero/internal/common/delivery"
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	pb "github.com/pajtaand/dmap-zero/internal/proto"
+	"github.com/rs/zerolog/log"
+)
+
+const deliveryKeyPrefix = "delivery/"
+
+type DeliveryDirection string
+
+const (
+	DeliveryDirectionToModule   DeliveryDirection = "TO_MODULE"   // sent to a module through the API
+	DeliveryDirectionFromModule DeliveryDirection = "FROM_MODULE" // sent by a module to the webhooks
+)
+
+type DeliveryOutcome = delivery.Outcome
+
+const (
+	DeliveryOutcomeDelivered     = delivery.OutcomeDelivered
+	DeliveryOutcomeWebhookFailed = delivery.OutcomeWebhookFailed
+	DeliveryOutcomeNoSubscriber  = delivery.OutcomeNoSubscriber
+	DeliveryOutcomeUnconfirmed   = delivery.OutcomeUnconfirmed
+	DeliveryOutcomeUnreachable   = delivery.OutcomeUnreachable
+)
+
+// DeliveryRecipient is the outcome of a message for one receiver. Messages sent by modules are
+// received by the webhooks registered on the controller, so their recipient has no agent.
+type DeliveryRecipient struct {
+	AgentID  string          `json:"agentID"`
+	ModuleID string          `json:"moduleID"`
+	Outcome  DeliveryOutcome `json:"outcome"`
+	Error    string          `json:"error"`
+}
+
+// DeliveryRecipients converts the results reported by the agent, see delivery.Results.
+func DeliveryRecipients(agentID, moduleID string, report *pb.DeliveryReport) []DeliveryRecipient {
+	recipients := []DeliveryRecipient{}
+	for _, result := range delivery.Results(moduleID, report) {
+		recipients = append(recipients, DeliveryRecipient{
+			AgentID:  agentID,
+			ModuleID: result.ModuleID,
+			Outcome:  result.Outcome,
+			Error:    result.Error,
+		})
+	}
+	return recipients
+}
+
+// Delivery records where a message passing through the controller ended up.
+type Delivery struct {
+	ID            string              `json:"id"`
+	Direction     DeliveryDirection   `json:"direction"`
+	ModuleID      string              `json:"moduleID"` // receiver module, or the sender for messages from modules
+	Receiver      string              `json:"receiver"` // receiver given by the sending module
+	SourceAgentID string              `json:"sourceAgentID"`
+	CreatedAt     time.Time           `json:"createdAt"`
+	Recipients    []DeliveryRecipient `json:"recipients"`
+}
+
+// DeliveryManager keeps the delivery outcomes of messages for a while, so the senders can find
+// out what happened to them.
+type DeliveryManager struct {
+	mu         sync.RWMutex
+	deliveries map[string]*Delivery
+	database   database.Database
+}
+
+func NewDeliveryManager(database database.Database) (*DeliveryManager, error) {
+	log.Debug().Msg("Creating new DeliveryManager")
+
+	if database == nil {
+		return nil, errors.New("database must not be nil")
+	}
+
+	mgr := &DeliveryManager{
+		deliveries: map[string]*Delivery{},
+		database:   database,
+	}
+	if err := mgr.load(); err != nil {
+		return nil, fmt.Errorf("failed to load deliveries: %v", err)
+	}
+	return mgr, nil
+}
+
+func (mgr *DeliveryManager) load() error {
+	keys, err := mgr.database.Keys(deliveryKeyPrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		record := &Delivery{}
+		if _, err := database.GetJSON(mgr.database, key, record); err != nil {
+			return err
+		}
+		mgr.deliveries[record.ID] = record
+	}
+	log.Info().Msgf("Loaded %d deliveries from database", len(mgr.deliveries))
+	return mgr.prune(time.Now())
+}
+
+// prune forgets the deliveries past their retention, the caller must hold the lock.
+func (mgr *DeliveryManager) prune(now time.Time) error {
+	for id, delivery := range mgr.deliveries {
+		if now.Sub(delivery.CreatedAt) < constants.ControllerMessageRetention {
+			continue
+		}
+		if err := mgr.database.Delete(deliveryKeyPrefix + id); err != nil {
+			return err
+		}
+		delete(mgr.deliveries, id)
+	}
+	return nil
+}
+
+// RecordDelivery stores the outcome of the message, a message delivered again replaces its
+// previous outcome.
+func (mgr *DeliveryManager) RecordDelivery(delivery *Delivery) error {
+	log.Info().Msgf("Recording delivery: messageID=%s, direction=%s, moduleID=%s", delivery.ID, delivery.Direction, delivery.ModuleID)
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	if err := mgr.prune(time.Now()); err != nil {
+		log.Error().Err(err).Msg("Failed to prune deliveries")
+	}
+	if err := database.SetJSON(mgr.database, deliveryKeyPrefix+delivery.ID, delivery); err != nil {
+		return err
+	}
+	mgr.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+// GetDelivery returns the outcome of the message, deliveries past their retention are gone even
+// when no message was recorded since.
+func (mgr *DeliveryManager) GetDelivery(messageID string) (*Delivery, error) {
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	delivery, ok := mgr.deliveries[messageID]
+	if !ok || time.Since(delivery.CreatedAt) >= constants.ControllerMessageRetention {
+		return nil, errs.ErrNotFound
+	}
+	copied := *delivery
+	copied.Recipients = slices.Clone(delivery.Recipients)
+	return &copied, nil
+}
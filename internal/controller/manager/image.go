@@ -1,41 +1,165 @@
 package manager
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"sync"
 
 	"github.com/google/uuid"
+	"github.com/pajtaand/dmap-zero/internal/common/blobstore"
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
 	"github.com/pajtaand/dmap-zero/internal/common/database"
 	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	"github.com/pajtaand/dmap-zero/internal/common/registry"
+	"github.com/pajtaand/dmap-zero/internal/common/signing"
 	"github.com/rs/zerolog/log"
 )
 
+const imageKeyPrefix = "image/"
+
+type imageRecord struct {
+	ID            string          `json:"id"`
+	Name          string          `json:"name"`
+	Digest        string          `json:"digest"`
+	Size          int             `json:"size"`
+	Entries       []ArchiveEntry  `json:"entries,omitempty"`
+	ConfigDigests []string        `json:"configDigests,omitempty"`
+	Registry      *RegistrySource `json:"registry,omitempty"`
+	Status        string          `json:"status,omitempty"` // empty for images stored by older versions, which are ready
+	StatusMessage string          `json:"statusMessage,omitempty"`
+	Filename      string          `json:"filename,omitempty"` // image data stored in the database by older versions
+}
+
 type Image struct {
-	id       string
-	name     string
-	filename string
-	size     int
+	id            string
+	name          string
+	digest        string
+	size          int
+	entries       []ArchiveEntry
+	configDigests []string
+	registry      *RegistrySource // nil for uploaded images
+	status        string
+	statusMessage string
+
+	mu        sync.RWMutex
+	blobStore *blobstore.BlobStore
+	database  database.Database
+}
+
+func NewImage(id, name, digest string, size int, blobStore *blobstore.BlobStore, database database.Database) (*Image, error) {
+	if blobStore == nil {
+		return nil, errors.New("BlobStore must not be nil")
+	}
+	if database == nil {
+		return nil, errors.New("database must not be nil")
+	}
+	if err := blobstore.ValidateDigest(digest); err != nil {
+		return nil, err
+	}
 
-	mu       sync.RWMutex
-	database *database.KVStore // TODO use interface and accept whatever
+	image := &Image{
+		id:        id,
+		name:      name,
+		digest:    digest,
+		size:      size,
+		status:    constants.ImageStatusReady,
+		blobStore: blobStore,
+		database:  database,
+	}
+	image.index()
+	if err := image.save(); err != nil {
+		return nil, err
+	}
+	return image, nil
 }
 
-func NewImage(id, name string, data []byte, database *database.KVStore) (*Image, error) {
+// NewRegistryImage creates an image whose data is yet to be pulled from the registry.
+func NewRegistryImage(id, name string, source *RegistrySource, blobStore *blobstore.BlobStore, database database.Database) (*Image, error) {
+	if blobStore == nil {
+		return nil, errors.New("BlobStore must not be nil")
+	}
 	if database == nil {
 		return nil, errors.New("database must not be nil")
 	}
+	if source == nil {
+		return nil, errors.New("RegistrySource must not be nil")
+	}
+	if err := source.Validate(); err != nil {
+		return nil, err
+	}
+
+	image := &Image{
+		id:        id,
+		name:      name,
+		registry:  source,
+		status:    constants.ImageStatusPulling,
+		blobStore: blobStore,
+		database:  database,
+	}
+	if err := image.save(); err != nil {
+		return nil, err
+	}
+	return image, nil
+}
 
-	fileName := fmt.Sprintf("img_%s", uuid.New().String())
-	database.Set(fileName, data)
+// index records the entries of the image tarball, so agents can download only the layers they
+// are missing, and the digests of its configurations, which are signed. Images that can't be
+// indexed are transferred whole and unsigned.
+func (i *Image) index() {
+	f, err := i.blobStore.Open(i.digest)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Failed to open image data for indexing: imageID=%s", i.id)
+		return
+	}
+	defer f.Close()
+
+	entries, configDigests, err := indexArchive(f)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Failed to index image, it can't be signed and layers won't be deduplicated: imageID=%s", i.id)
+		return
+	}
+	i.entries = entries
+	i.configDigests = configDigests
+}
 
-	return &Image{
-		id:       id,
-		name:     name,
-		filename: fileName,
-		size:     len(data),
-		database: database,
-	}, nil
+// save persists the image metadata, the caller must hold the lock.
+func (i *Image) save() error {
+	return database.SetJSON(i.database, imageKeyPrefix+i.id, &imageRecord{
+		ID:            i.id,
+		Name:          i.name,
+		Digest:        i.digest,
+		Size:          i.size,
+		Entries:       i.entries,
+		ConfigDigests: i.configDigests,
+		Registry:      i.registry,
+		Status:        i.status,
+		StatusMessage: i.statusMessage,
+	})
+}
+
+// setPulled records the data pulled from the registry and marks the image ready.
+func (i *Image) setPulled(digest string, size int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.digest = digest
+	i.size = size
+	i.status = constants.ImageStatusReady
+	i.statusMessage = ""
+	i.index()
+	return i.save()
+}
+
+func (i *Image) setStatus(status, message string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.status = status
+	i.statusMessage = message
+	return i.save()
 }
 
 func (i *Image) GetID() string {
@@ -50,21 +174,79 @@ func (i *Image) GetName() string {
 	return i.name
 }
 
-func (i *Image) GetData() ([]byte, error) {
+func (i *Image) GetDigest() string {
 	i.mu.RLock()
-	fileName := i.filename
-	i.mu.RUnlock()
+	defer i.mu.RUnlock()
+	return i.digest
+}
 
-	val, ok := i.database.Get(fileName)
-	if !ok {
-		return nil, fmt.Errorf("no file in database: fileName=%s", fileName)
+// GetSource returns whether the image was uploaded or pulled from a registry.
+func (i *Image) GetSource() string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.registry != nil {
+		return constants.ImageSourceRegistry
 	}
+	return constants.ImageSourceUpload
+}
 
-	data, ok := val.([]byte)
-	if !ok {
-		return nil, fmt.Errorf("failed to parse image to bytes: fileName=%s", fileName)
+// GetRegistrySource returns the registry the image is pulled from, nil for uploaded images.
+func (i *Image) GetRegistrySource() *RegistrySource {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.registry
+}
+
+func (i *Image) GetStatus() string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.status
+}
+
+func (i *Image) GetStatusMessage() string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.statusMessage
+}
+
+// IsReady returns whether the image data is available for agents.
+func (i *Image) IsReady() bool {
+	return i.GetStatus() == constants.ImageStatusReady
+}
+
+// GetArchiveEntries returns the entries of the image tarball, nil if it wasn't indexed.
+func (i *Image) GetArchiveEntries() []ArchiveEntry {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.entries
+}
+
+// GetConfigDigests returns the digests of the image configurations, nil if it wasn't indexed.
+func (i *Image) GetConfigDigests() []string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.configDigests
+}
+
+// GetLayer returns the layer entry with the given content digest.
+func (i *Image) GetLayer(digest string) (ArchiveEntry, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	for _, entry := range i.entries {
+		if entry.IsLayer() && entry.Digest == digest {
+			return entry, true
+		}
+	}
+	return ArchiveEntry{}, false
+}
+
+// Open opens the image tarball for reading, the caller must close it.
+func (i *Image) Open() (*os.File, error) {
+	f, err := i.blobStore.Open(i.GetDigest())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image data: imageID=%s: %v", i.GetID(), err)
 	}
-	return data, nil
+	return f, nil
 }
 
 func (i *Image) GetSize() int {
@@ -73,38 +255,130 @@ func (i *Image) GetSize() int {
 	return i.size
 }
 
-func (i *Image) Cleanup() {
-	i.mu.RLock()
-	fileName := i.filename
-	i.mu.RUnlock()
-
-	i.database.Delete(fileName)
+// Cleanup removes the image metadata, the data is shared by digest and removed by the ImageManager.
+func (i *Image) Cleanup() error {
+	if err := i.database.Delete(imageKeyPrefix + i.GetID()); err != nil {
+		return fmt.Errorf("failed to delete image metadata: %v", err)
+	}
+	return nil
 }
 
 type ImageManager struct {
-	mu       sync.RWMutex
-	images   map[string]*Image
-	database *database.KVStore // TODO use interface and accept whatever
+	mu        sync.RWMutex
+	images    map[string]*Image
+	blobStore *blobstore.BlobStore
+	signer    *signing.Signer
+	database  database.Database
 }
 
-func NewImageManager(database *database.KVStore) (*ImageManager, error) {
+func NewImageManager(blobStore *blobstore.BlobStore, signer *signing.Signer, database database.Database) (*ImageManager, error) {
 	log.Debug().Msg("Creating new ImageManager")
 
+	if blobStore == nil {
+		return nil, errors.New("BlobStore must not be nil")
+	}
+	if signer == nil {
+		return nil, errors.New("Signer must not be nil")
+	}
 	if database == nil {
 		return nil, errors.New("database must not be nil")
 	}
 
-	return &ImageManager{
-		images:   map[string]*Image{},
-		database: database,
-	}, nil
+	mgr := &ImageManager{
+		images:    map[string]*Image{},
+		blobStore: blobStore,
+		signer:    signer,
+		database:  database,
+	}
+	if err := mgr.load(); err != nil {
+		return nil, fmt.Errorf("failed to load images: %v", err)
+	}
+	for _, image := range mgr.images {
+		if image.status == constants.ImageStatusPulling {
+			go mgr.pull(image) // interrupted by a restart
+		}
+	}
+	return mgr, nil
+}
+
+func (mgr *ImageManager) load() error {
+	keys, err := mgr.database.Keys(imageKeyPrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		record := &imageRecord{}
+		if _, err := database.GetJSON(mgr.database, key, record); err != nil {
+			return err
+		}
+		image := &Image{
+			id:            record.ID,
+			name:          record.Name,
+			digest:        record.Digest,
+			size:          record.Size,
+			entries:       record.Entries,
+			configDigests: record.ConfigDigests,
+			registry:      record.Registry,
+			status:        record.Status,
+			statusMessage: record.StatusMessage,
+			blobStore:     mgr.blobStore,
+			database:      mgr.database,
+		}
+		if image.status == "" {
+			image.status = constants.ImageStatusReady
+		}
+		if record.Filename != "" {
+			if err := mgr.migrate(image, record.Filename); err != nil {
+				return fmt.Errorf("failed to migrate image: imageID=%s: %v", record.ID, err)
+			}
+		}
+		if (image.entries == nil || image.configDigests == nil) && image.status == constants.ImageStatusReady {
+			image.index()
+			if err := image.save(); err != nil {
+				return err
+			}
+		}
+		mgr.images[record.ID] = image
+	}
+	log.Info().Msgf("Loaded %d images from database", len(mgr.images))
+	return nil
+}
+
+// migrate moves image data stored in the database into the blob store.
+func (mgr *ImageManager) migrate(image *Image, fileName string) error {
+	log.Info().Msgf("Moving image data to blob store: imageID=%s", image.id)
+
+	data, ok, err := mgr.database.Get(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to load image data: fileName=%s: %v", fileName, err)
+	}
+	if !ok {
+		return fmt.Errorf("no file in database: fileName=%s", fileName)
+	}
+	digest, size, err := mgr.blobStore.Put(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	image.digest = digest
+	image.size = int(size)
+	if err := image.save(); err != nil {
+		return err
+	}
+	return mgr.database.Delete(fileName)
 }
 
-func (mgr *ImageManager) AddImage(name string, data []byte) (*Image, error) {
+// AddImage streams the image tarball from src into the blob store.
+func (mgr *ImageManager) AddImage(name string, src io.Reader) (*Image, error) {
 	log.Info().Msgf("Adding new image: %s", name)
 
+	digest, size, err := mgr.blobStore.Put(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store image data: %v", err)
+	}
+	log.Info().Msgf("Image data stored: name=%s, digest=%s, size=%d", name, digest, size)
+
 	imageID := uuid.New().String()
-	image, err := NewImage(imageID, name, data, mgr.database)
+	image, err := NewImage(imageID, name, digest, int(size), mgr.blobStore, mgr.database)
 	if err != nil {
 		return nil, fmt.Errorf("failed to add new image: %v", err)
 	}
@@ -115,14 +389,19 @@ func (mgr *ImageManager) AddImage(name string, data []byte) (*Image, error) {
 	return image, err
 }
 
-func (mgr *ImageManager) AddImageWithID(id, name string, data []byte) (*Image, error) {
+func (mgr *ImageManager) AddImageWithID(id, name string, src io.Reader) (*Image, error) {
 	log.Info().Msgf("Adding new image with id: %s (%s)", name, id)
 
 	if mgr.ImageExists(id) {
 		return nil, errs.ErrConflict
 	}
 
-	image, err := NewImage(id, name, data, mgr.database)
+	digest, size, err := mgr.blobStore.Put(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store image data: %v", err)
+	}
+
+	image, err := NewImage(id, name, digest, int(size), mgr.blobStore, mgr.database)
 	if err != nil {
 		return nil, fmt.Errorf("failed to add new image: %v", err)
 	}
@@ -133,6 +412,78 @@ func (mgr *ImageManager) AddImageWithID(id, name string, data []byte) (*Image, e
 	return image, nil
 }
 
+// AddRegistryImage registers an image pulled from an OCI registry. The pull runs in the
+// background and the image is distributed to agents once it's ready.
+func (mgr *ImageManager) AddRegistryImage(name string, source *RegistrySource) (*Image, error) {
+	log.Info().Msgf("Adding new registry image: %s (%s)", name, source.Reference)
+
+	imageID := uuid.New().String()
+	image, err := NewRegistryImage(imageID, name, source, mgr.blobStore, mgr.database)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add new image: %v", err)
+	}
+
+	mgr.mu.Lock()
+	mgr.images[imageID] = image
+	mgr.mu.Unlock()
+
+	go mgr.pull(image)
+	return image, nil
+}
+
+// pull downloads the image from its registry into the blob store.
+func (mgr *ImageManager) pull(image *Image) {
+	source := image.GetRegistrySource()
+	log.Info().Msgf("Pulling image from registry: imageID=%s, reference=%s", image.GetID(), source.Reference)
+
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ControllerRegistryPullTimeout)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	go func() {
+		client := registry.NewClient(source.Credentials, source.Insecure)
+		pw.CloseWithError(client.Save(ctx, source.Reference, source.Platform, pw))
+	}()
+	digest, size, err := mgr.blobStore.Put(pr)
+	pr.CloseWithError(err)
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	if _, ok := mgr.images[image.GetID()]; !ok {
+		log.Info().Msgf("Image removed while pulling: imageID=%s", image.GetID())
+		if err == nil && !mgr.isDigestUsed(digest) {
+			if err := mgr.blobStore.Delete(digest); err != nil {
+				log.Error().Err(err).Msgf("Failed to remove image data: imageID=%s", image.GetID())
+			}
+		}
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to pull image: imageID=%s", image.GetID())
+		if err := image.setStatus(constants.ImageStatusFailed, err.Error()); err != nil {
+			log.Error().Err(err).Msgf("Failed to save image status: imageID=%s", image.GetID())
+		}
+		return
+	}
+	if err := image.setPulled(digest, int(size)); err != nil {
+		log.Error().Err(err).Msgf("Failed to save pulled image: imageID=%s", image.GetID())
+		return
+	}
+	log.Info().Msgf("Image pulled: imageID=%s, digest=%s, size=%d", image.GetID(), digest, size)
+}
+
+// SignImage returns the signature agents verify before loading the image, nil for images that
+// couldn't be indexed.
+func (mgr *ImageManager) SignImage(image *Image) []byte {
+	return mgr.signer.SignImage(image.GetConfigDigests())
+}
+
+// GetSigningKey returns the public key agents must trust to load images.
+func (mgr *ImageManager) GetSigningKey() ed25519.PublicKey {
+	return mgr.signer.PublicKey()
+}
+
 func (mgr *ImageManager) GetImage(imageID string) (*Image, error) {
 	log.Info().Msgf("Getting image: %s", imageID)
 
@@ -170,12 +521,31 @@ func (mgr *ImageManager) RemoveImage(imageID string) error {
 		return errs.ErrNotFound
 	}
 
-	image.Cleanup()
-
+	if err := image.Cleanup(); err != nil {
+		return fmt.Errorf("failed to remove image: %v", err)
+	}
 	delete(mgr.images, imageID)
+
+	digest := image.GetDigest()
+	if digest == "" || mgr.isDigestUsed(digest) {
+		return nil // not pulled yet or data still used by another image
+	}
+	if err := mgr.blobStore.Delete(digest); err != nil {
+		return fmt.Errorf("failed to remove image data: %v", err)
+	}
 	return nil
 }
 
+// isDigestUsed returns whether any image references the data, the caller must hold the lock.
+func (mgr *ImageManager) isDigestUsed(digest string) bool {
+	for _, image := range mgr.images {
+		if image.GetDigest() == digest {
+			return true
+		}
+	}
+	return false
+}
+
 func (mgr *ImageManager) ImageExists(imageID string) bool {
 	log.Info().Msgf("Checking if image exists: %s", imageID)
 	mgr.mu.RLock()
@@ -0,0 +1,138 @@
+package manager
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"sort"
+
+	"github.com/pajtaand/dmap-zero/internal/common/utils"
+)
+
+const archiveManifestFile = "manifest.json"
+
+// ArchiveEntry describes a file of the image tarball created by `docker save`.
+type ArchiveEntry struct {
+	Name     string `json:"name"`
+	Type     byte   `json:"type"`
+	Mode     int64  `json:"mode"`
+	Size     int64  `json:"size"`
+	Linkname string `json:"linkname,omitempty"`
+	Offset   int64  `json:"offset"`            // position of the content within the tarball
+	Digest   string `json:"digest,omitempty"`  // SHA-256 digest of the content, regular files only
+	ChainID  string `json:"chainId,omitempty"` // chain ID of the layer, layers only
+}
+
+func (e *ArchiveEntry) IsLayer() bool {
+	return e.ChainID != ""
+}
+
+type archiveManifest struct {
+	Config string
+	Layers []string
+}
+
+type archiveConfig struct {
+	RootFS struct {
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// indexArchive lists the entries of an image tarball and identifies its layers from the
+// manifest and the image configurations, whose digests are returned as well.
+func indexArchive(r io.ReaderAt) ([]ArchiveEntry, []string, error) {
+	cr := &countingReader{r: io.NewSectionReader(r, 0, math.MaxInt64)}
+	tr := tar.NewReader(cr)
+
+	entries := []ArchiveEntry{}
+	byName := map[string]int{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read tarball: %v", err)
+		}
+
+		entry := ArchiveEntry{
+			Name:     path.Clean(header.Name),
+			Type:     header.Typeflag,
+			Mode:     header.Mode,
+			Size:     header.Size,
+			Linkname: header.Linkname,
+			Offset:   cr.n,
+		}
+		if header.Typeflag == tar.TypeReg {
+			h := sha256.New()
+			if _, err := io.Copy(h, tr); err != nil {
+				return nil, nil, fmt.Errorf("failed to read tarball entry: name=%s: %v", header.Name, err)
+			}
+			entry.Digest = "sha256:" + hex.EncodeToString(h.Sum(nil))
+		}
+		byName[entry.Name] = len(entries)
+		entries = append(entries, entry)
+	}
+
+	readJSON := func(name string, value interface{}) error {
+		i, ok := byName[name]
+		if !ok || entries[i].Type != tar.TypeReg {
+			return fmt.Errorf("file not found in tarball: %s", name)
+		}
+		return json.NewDecoder(io.NewSectionReader(r, entries[i].Offset, entries[i].Size)).Decode(value)
+	}
+
+	manifests := []archiveManifest{}
+	if err := readJSON(archiveManifestFile, &manifests); err != nil {
+		return nil, nil, fmt.Errorf("failed to read image manifest: %v", err)
+	}
+	if len(manifests) == 0 {
+		return nil, nil, errors.New("image manifest is empty")
+	}
+
+	configDigests := []string{}
+	for _, manifest := range manifests {
+		config := &archiveConfig{}
+		if err := readJSON(path.Clean(manifest.Config), config); err != nil {
+			return nil, nil, fmt.Errorf("failed to read image config: %v", err)
+		}
+		if len(config.RootFS.DiffIDs) != len(manifest.Layers) {
+			return nil, nil, fmt.Errorf("image config doesn't match manifest: config=%s", manifest.Config)
+		}
+		configDigests = append(configDigests, entries[byName[path.Clean(manifest.Config)]].Digest)
+
+		for i, chainID := range utils.LayerChainIDs(config.RootFS.DiffIDs) {
+			name := path.Clean(manifest.Layers[i])
+			j, ok := byName[name]
+			if ok && entries[j].Type == tar.TypeSymlink {
+				name = path.Join(path.Dir(name), entries[j].Linkname)
+				j, ok = byName[name]
+			}
+			if !ok || entries[j].Type != tar.TypeReg {
+				return nil, nil, fmt.Errorf("layer not found in tarball: %s", manifest.Layers[i])
+			}
+			if entries[j].ChainID == "" {
+				entries[j].ChainID = chainID
+			}
+		}
+	}
+	sort.Strings(configDigests)
+	return entries, configDigests, nil
+}
@@ -1,37 +1,188 @@
 package manager
 
 import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+	"github.com/pajtaand/dmap-zero/internal/common/database"
 	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	"github.com/pajtaand/dmap-zero/internal/common/secrets"
 	"github.com/rs/zerolog/log"
 )
 
+const moduleKeyPrefix = "module/"
+
+// ModuleSpec is the part of a module agents run, changing it restarts the module's containers.
+type ModuleSpec struct {
+	Revision      int               `json:"revision"`
+	Image         string            `json:"image"`
+	Configuration map[string]string `json:"configuration"`
+	Resources     *ModuleResources  `json:"resources"`
+	Security      *ModuleSecurity   `json:"security"`
+	Storage       *ModuleStorage    `json:"storage"`
+}
+
+// normalize fills the unset parts of the spec with their defaults.
+func (s *ModuleSpec) normalize() *ModuleSpec {
+	spec := *s
+	if spec.Configuration == nil {
+		spec.Configuration = map[string]string{}
+	}
+	if spec.Resources == nil {
+		spec.Resources = &ModuleResources{}
+	}
+	if spec.Security == nil {
+		spec.Security = NewModuleSecurityDefault()
+	}
+	if spec.Storage == nil {
+		spec.Storage = NewModuleStorageDefault()
+	}
+	return &spec
+}
+
+func (s *ModuleSpec) Validate() error {
+	if err := s.Resources.Validate(); err != nil {
+		return err
+	}
+	if err := s.Security.Validate(); err != nil {
+		return err
+	}
+	return s.Storage.Validate()
+}
+
+// SecretReferences returns the names of the secrets the module's containers get, sorted and
+// without duplicates.
+func (s *ModuleSpec) SecretReferences() []string {
+	spec := s.normalize()
+	names := secrets.References(spec.Configuration)
+	for _, secret := range spec.Storage.Secrets {
+		if !slices.Contains(names, secret.Secret) {
+			names = append(names, secret.Secret)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Equal reports whether both specs run the same containers, revisions aren't compared.
+func (s *ModuleSpec) Equal(other *ModuleSpec) bool {
+	return s.Image == other.Image &&
+		maps.Equal(s.Configuration, other.Configuration) &&
+		s.Resources.Equal(other.Resources) &&
+		s.Security.Equal(other.Security) &&
+		s.Storage.Equal(other.Storage)
+}
+
+type moduleRecord struct {
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	Image         string            `json:"image"`
+	Configuration map[string]string `json:"configuration"`
+	Resources     *ModuleResources  `json:"resources"`
+	Security      *ModuleSecurity   `json:"security"`
+	Storage       *ModuleStorage    `json:"storage"`
+	Placement     *Placement        `json:"placement"`
+	RestartPolicy *RestartPolicy    `json:"restartPolicy"`
+	IsRunning     bool              `json:"isRunning"`
+	Revision      int               `json:"revision"`
+	Rollout       *Rollout          `json:"rollout"`
+}
+
 type Module struct {
 	id            string
 	name          string
 	image         string
 	configuration map[string]string
+	resources     *ModuleResources
+	security      *ModuleSecurity
+	storage       *ModuleStorage
+	placement     *Placement
+	restartPolicy *RestartPolicy
 	isRunning     bool
+	revision      int // latest revision, see ModuleRevision
+	rollout       *Rollout
 
-	mu sync.RWMutex
+	mu       sync.RWMutex
+	database database.Database
 }
 
-func NewModule(id, name, image string, configuration map[string]string) *Module {
-	if configuration == nil {
-		configuration = map[string]string{}
+func NewModule(id, name string, spec *ModuleSpec, placement *Placement, restartPolicy *RestartPolicy, database database.Database) *Module {
+	spec = spec.normalize()
+	if placement == nil {
+		placement = NewPlacementAll()
+	}
+	if restartPolicy == nil {
+		restartPolicy = NewRestartPolicyNever()
 	}
 
 	return &Module{
 		id:            id,
 		name:          name,
-		image:         image,
-		configuration: configuration,
+		image:         spec.Image,
+		configuration: spec.Configuration,
+		resources:     spec.Resources,
+		security:      spec.Security,
+		storage:       spec.Storage,
+		placement:     placement,
+		restartPolicy: restartPolicy,
 		isRunning:     false,
+		revision:      1,
+		database:      database,
+	}
+}
+
+// currentRevision returns the record of the module's current revision.
+func (m *Module) currentRevision(changedBy, message string) *ModuleRevision {
+	return &ModuleRevision{
+		Revision:      m.revision,
+		Image:         m.image,
+		Configuration: m.configuration,
+		Resources:     m.resources,
+		Security:      m.security,
+		Storage:       m.storage,
+		Placement:     m.placement,
+		ChangedBy:     changedBy,
+		Message:       message,
+		CreatedAt:     time.Now(),
 	}
 }
 
+// tombstone returns the revision recorded when the module is removed.
+func (m *Module) tombstone(removedBy string) *ModuleRevision {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	revision := m.currentRevision(removedBy, "module removed")
+	revision.Revision++
+	revision.Removed = true
+	return revision
+}
+
+// save persists the module, the caller must hold the lock.
+func (m *Module) save() error {
+	return database.SetJSON(m.database, moduleKeyPrefix+m.id, &moduleRecord{
+		ID:            m.id,
+		Name:          m.name,
+		Image:         m.image,
+		Configuration: m.configuration,
+		Resources:     m.resources,
+		Security:      m.security,
+		Storage:       m.storage,
+		Placement:     m.placement,
+		RestartPolicy: m.restartPolicy,
+		IsRunning:     m.isRunning,
+		Revision:      m.revision,
+		Rollout:       m.rollout,
+	})
+}
+
 func (m *Module) GetID() string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -44,10 +195,11 @@ func (m *Module) GetName() string {
 	return m.name
 }
 
-func (m *Module) SetName(name string) {
+func (m *Module) SetName(name string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.name = name
+	return m.save()
 }
 
 func (m *Module) GetImage() string {
@@ -56,26 +208,245 @@ func (m *Module) GetImage() string {
 	return m.image
 }
 
-func (m *Module) SetImage(image string) {
+func (m *Module) GetConfiguration() map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.configuration
+}
+
+func (m *Module) GetResources() *ModuleResources {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.resources
+}
+
+func (m *Module) GetSecurity() *ModuleSecurity {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.security
+}
+
+func (m *Module) GetStorage() *ModuleStorage {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.storage
+}
+
+func (m *Module) GetRevision() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.revision
+}
+
+// GetSpec returns the current image, configuration and container options of the module.
+func (m *Module) GetSpec() *ModuleSpec {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.spec()
+}
+
+func (m *Module) spec() *ModuleSpec {
+	return &ModuleSpec{
+		Revision:      m.revision,
+		Image:         m.image,
+		Configuration: m.configuration,
+		Resources:     m.resources,
+		Security:      m.security,
+		Storage:       m.storage,
+	}
+}
+
+// SpecFor returns the image and configuration the agent should run. Agents of an active rollout
+// whose batch wasn't reached yet keep running the previous spec.
+func (m *Module) SpecFor(agentID string) *ModuleSpec {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.rollout != nil && m.rollout.IsActive() && !m.rollout.IsUpdated(agentID) {
+		return m.rollout.From.normalize() // rollouts started before container options were introduced
+	}
+	return m.spec()
+}
+
+// UsesSecret reports whether the module's containers get the secret, including the containers an
+// active rollout didn't update yet.
+func (m *Module) UsesSecret(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	specs := []*ModuleSpec{m.spec()}
+	if m.rollout != nil && m.rollout.IsActive() {
+		specs = append(specs, m.rollout.From)
+	}
+	for _, spec := range specs {
+		if slices.Contains(spec.SecretReferences(), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// newRevision applies the spec and placement and records them as the next revision of the
+// module, the caller must hold the lock.
+func (m *Module) newRevision(spec *ModuleSpec, placement *Placement, changedBy, message string) error {
+	revision := &ModuleRevision{
+		Revision:      m.revision + 1,
+		Image:         spec.Image,
+		Configuration: spec.Configuration,
+		Resources:     spec.Resources,
+		Security:      spec.Security,
+		Storage:       spec.Storage,
+		Placement:     placement,
+		ChangedBy:     changedBy,
+		Message:       message,
+		CreatedAt:     time.Now(),
+	}
+	if err := saveModuleRevision(m.database, m.id, revision); err != nil {
+		return fmt.Errorf("failed to save module revision: %v", err)
+	}
+	m.revision = revision.Revision
+	m.image = spec.Image
+	m.configuration = spec.Configuration
+	m.resources = spec.Resources
+	m.security = spec.Security
+	m.storage = spec.Storage
+	m.placement = placement
+	return nil
+}
+
+// SetSpec changes the spec and placement on every agent at once, a new revision is created when
+// they differ from the current ones.
+func (m *Module) SetSpec(spec *ModuleSpec, placement *Placement, changedBy, message string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.image = image
+
+	spec = spec.normalize()
+	if placement == nil {
+		placement = NewPlacementAll()
+	}
+	if spec.Equal(m.spec()) && placement.Equal(m.placement) {
+		return nil
+	}
+	if m.rollout != nil && m.rollout.IsActive() {
+		return fmt.Errorf("rollout %s in progress: %w", m.rollout.ID, errs.ErrConflict)
+	}
+	if err := m.newRevision(spec, placement, changedBy, message); err != nil {
+		return err
+	}
+	return m.save()
 }
 
-func (m *Module) GetConfiguration() map[string]string {
+// StartRollout creates a new revision of the module and rolls its spec across the given agents
+// batch by batch.
+func (m *Module) StartRollout(spec *ModuleSpec, placement *Placement, strategy *RolloutStrategy, agentIDs []string, changedBy, message string) (*Rollout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.rollout != nil && m.rollout.IsActive() {
+		return nil, fmt.Errorf("rollout %s in progress: %w", m.rollout.ID, errs.ErrConflict)
+	}
+	spec = spec.normalize()
+	if placement == nil {
+		placement = NewPlacementAll()
+	}
+
+	from := m.spec()
+	if err := m.newRevision(spec, placement, changedBy, message); err != nil {
+		return nil, err
+	}
+	m.rollout = newRollout(uuid.New().String(), from, m.spec(), strategy, agentIDs)
+	return m.rollout.copy(), m.save()
+}
+
+// GetRollout returns the last rollout of the module, nil if the module was never rolled out.
+func (m *Module) GetRollout() *Rollout {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.configuration
+	if m.rollout == nil {
+		return nil
+	}
+	return m.rollout.copy()
+}
+
+// AdvanceRollout moves the active rollout to its next batch, the rollout succeeds once every
+// batch was updated.
+func (m *Module) AdvanceRollout() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.rollout == nil || !m.rollout.IsActive() {
+		return errs.ErrNotFound
+	}
+	now := time.Now()
+	m.rollout.CurrentBatch++
+	m.rollout.BatchStartedAt = now
+	if m.rollout.CurrentBatch >= len(m.rollout.Batches) {
+		m.rollout.State = constants.RolloutStateSucceeded
+		m.rollout.FinishedAt = now
+	}
+	return m.save()
 }
 
-func (m *Module) SetConfiguration(configuration map[string]string) {
+// FinishRollout ends the active rollout, the current spec is kept on every agent.
+func (m *Module) FinishRollout(message string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if configuration == nil {
-		configuration = map[string]string{}
+	if m.rollout == nil || !m.rollout.IsActive() {
+		return errs.ErrNotFound
 	}
-	m.configuration = configuration
+	m.rollout.State = constants.RolloutStateSucceeded
+	m.rollout.Message = message
+	m.rollout.FinishedAt = time.Now()
+	return m.save()
+}
+
+// RollBack ends the active rollout and restores the spec the module ran before it as a new
+// revision.
+func (m *Module) RollBack(reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.rollout == nil || !m.rollout.IsActive() {
+		return errs.ErrNotFound
+	}
+	from := m.rollout.From
+	message := fmt.Sprintf("rollout of revision %d rolled back: %s", m.rollout.To.Revision, reason)
+	if err := m.newRevision(from, m.placement, "", message); err != nil {
+		return err
+	}
+	m.rollout.State = constants.RolloutStateRolledBack
+	m.rollout.Message = reason
+	m.rollout.FinishedAt = time.Now()
+	return m.save()
+}
+
+// LoadRevision returns the given revision of the module.
+func (m *Module) LoadRevision(revision int) (*ModuleRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return loadModuleRevision(m.database, m.id, revision)
+}
+
+func (m *Module) GetPlacement() *Placement {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.placement
+}
+
+func (m *Module) GetRestartPolicy() *RestartPolicy {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.restartPolicy
+}
+
+func (m *Module) SetRestartPolicy(restartPolicy *RestartPolicy) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if restartPolicy == nil {
+		restartPolicy = NewRestartPolicyNever()
+	}
+	m.restartPolicy = restartPolicy
+	return m.save()
 }
 
 func (m *Module) IsRunning() bool {
@@ -84,33 +455,90 @@ func (m *Module) IsRunning() bool {
 	return m.isRunning
 }
 
-func (m *Module) SetRunning(isRunning bool) {
+func (m *Module) SetRunning(isRunning bool) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.isRunning = isRunning
+	return m.save()
 }
 
 type ModuleManager struct {
-	mu      sync.RWMutex
-	modules map[string]*Module
+	mu       sync.RWMutex
+	modules  map[string]*Module
+	database database.Database
 }
 
-func NewModuleManager() (*ModuleManager, error) {
+func NewModuleManager(database database.Database) (*ModuleManager, error) {
 	log.Debug().Msg("Creating new ModuleManager")
 
-	return &ModuleManager{
-		modules: map[string]*Module{},
-	}, nil
+	if database == nil {
+		return nil, errors.New("database must not be nil")
+	}
+
+	mgr := &ModuleManager{
+		modules:  map[string]*Module{},
+		database: database,
+	}
+	if err := mgr.load(); err != nil {
+		return nil, fmt.Errorf("failed to load modules: %v", err)
+	}
+	return mgr, nil
 }
 
-func (mgr *ModuleManager) AddModule(name, image string, configuration map[string]string) string {
+func (mgr *ModuleManager) load() error {
+	keys, err := mgr.database.Keys(moduleKeyPrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		record := &moduleRecord{}
+		if _, err := database.GetJSON(mgr.database, key, record); err != nil {
+			return err
+		}
+		// modules stored without placement were broadcast to every agent
+		// modules stored without resources, security and storage run with docker's defaults
+		module := NewModule(record.ID, record.Name, &ModuleSpec{
+			Image:         record.Image,
+			Configuration: record.Configuration,
+			Resources:     record.Resources,
+			Security:      record.Security,
+			Storage:       record.Storage,
+		}, record.Placement, record.RestartPolicy, mgr.database)
+		module.isRunning = record.IsRunning
+		if record.Revision > 0 {
+			module.revision = record.Revision
+		}
+		module.rollout = record.Rollout
+
+		// modules stored before revisions were introduced get their current state recorded
+		if _, err := module.LoadRevision(module.revision); errors.Is(err, errs.ErrNotFound) {
+			if err := saveModuleRevision(mgr.database, module.id, module.currentRevision("", "recorded on controller start")); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+		mgr.modules[record.ID] = module
+	}
+	log.Info().Msgf("Loaded %d modules from database", len(mgr.modules))
+	return nil
+}
+
+func (mgr *ModuleManager) AddModule(name string, spec *ModuleSpec, placement *Placement, restartPolicy *RestartPolicy, createdBy string) (string, error) {
 	log.Info().Msgf("Adding new module: %s", name)
 
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
 	moduleID := uuid.New().String()
-	mgr.modules[moduleID] = NewModule(moduleID, name, image, configuration)
-	return moduleID
+	module := NewModule(moduleID, name, spec, placement, restartPolicy, mgr.database)
+	if err := saveModuleRevision(mgr.database, moduleID, module.currentRevision(createdBy, "module created")); err != nil {
+		return "", fmt.Errorf("failed to save module revision: %v", err)
+	}
+	if err := module.save(); err != nil {
+		return "", fmt.Errorf("failed to save module: %v", err)
+	}
+	mgr.modules[moduleID] = module
+	return moduleID, nil
 }
 
 func (mgr *ModuleManager) GetModule(moduleID string) (*Module, error) {
@@ -128,7 +556,7 @@ func (mgr *ModuleManager) GetModule(moduleID string) (*Module, error) {
 }
 
 func (mgr *ModuleManager) ListModules() []*Module {
-	log.Info().Msg("Listing all modules")
+	log.Debug().Msg("Listing all modules")
 
 	mgr.mu.RLock()
 	defer mgr.mu.RUnlock()
@@ -139,21 +567,45 @@ func (mgr *ModuleManager) ListModules() []*Module {
 	return modules
 }
 
-func (mgr *ModuleManager) RemoveModule(moduleID string) error {
+// RemoveModule removes the module. Its revisions are kept, closed by a tombstone revision, so
+// what the module ran stays queryable.
+func (mgr *ModuleManager) RemoveModule(moduleID, removedBy string) error {
 	log.Info().Msgf("Removing module: %s", moduleID)
 
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
 
-	_, ok := mgr.modules[moduleID]
+	module, ok := mgr.modules[moduleID]
 	if !ok {
 		return errs.ErrNotFound
 	}
 
+	if err := saveModuleRevision(mgr.database, moduleID, module.tombstone(removedBy)); err != nil {
+		return fmt.Errorf("failed to save module tombstone: %v", err)
+	}
+	if err := mgr.database.Delete(moduleKeyPrefix + moduleID); err != nil {
+		return fmt.Errorf("failed to delete module: %v", err)
+	}
+
 	delete(mgr.modules, moduleID)
 	return nil
 }
 
+// ListRevisions returns every revision of the module, oldest first, including the revisions of
+// removed modules.
+func (mgr *ModuleManager) ListRevisions(moduleID string) ([]*ModuleRevision, error) {
+	log.Info().Msgf("Listing revisions of module: %s", moduleID)
+
+	revisions, err := listModuleRevisions(mgr.database, moduleID)
+	if err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		return nil, errs.ErrNotFound
+	}
+	return revisions, nil
+}
+
 func (mgr *ModuleManager) ModuleExists(moduleID string) bool {
 	log.Info().Msgf("Checking if module exists: %s", moduleID)
 	_, ok := mgr.modules[moduleID]
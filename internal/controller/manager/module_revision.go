@@ -0,0 +1,81 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pajtaand/dmap-zero/internal/common/database"
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+)
+
+const moduleRevisionKeyPrefix = "module-revision/"
+
+// ModuleRevision is an immutable record of what a module ran, a new revision is stored whenever
+// the spec or placement of the module changes.
+type ModuleRevision struct {
+	Revision      int               `json:"revision"`
+	Image         string            `json:"image"`
+	Configuration map[string]string `json:"configuration"`
+	Resources     *ModuleResources  `json:"resources"`
+	Security      *ModuleSecurity   `json:"security"`
+	Storage       *ModuleStorage    `json:"storage"`
+	Placement     *Placement        `json:"placement"`
+	ChangedBy     string            `json:"changedBy"`
+	Message       string            `json:"message"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	// Removed marks the tombstone recorded when the module was removed, it's the last revision
+	Removed bool `json:"removed,omitempty"`
+}
+
+// GetSpec returns the spec of the revision, revisions recorded before container options were
+// introduced run with docker's defaults.
+func (r *ModuleRevision) GetSpec() *ModuleSpec {
+	return (&ModuleSpec{
+		Revision:      r.Revision,
+		Image:         r.Image,
+		Configuration: r.Configuration,
+		Resources:     r.Resources,
+		Security:      r.Security,
+		Storage:       r.Storage,
+	}).normalize()
+}
+
+func moduleRevisionKey(moduleID string, revision int) string {
+	// zero padded so the keys sort by revision
+	return fmt.Sprintf("%s%s/%010d", moduleRevisionKeyPrefix, moduleID, revision)
+}
+
+func saveModuleRevision(db database.Database, moduleID string, revision *ModuleRevision) error {
+	return database.SetJSON(db, moduleRevisionKey(moduleID, revision.Revision), revision)
+}
+
+func loadModuleRevision(db database.Database, moduleID string, revision int) (*ModuleRevision, error) {
+	record := &ModuleRevision{}
+	found, err := database.GetJSON(db, moduleRevisionKey(moduleID, revision), record)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errs.ErrNotFound
+	}
+	return record, nil
+}
+
+func listModuleRevisions(db database.Database, moduleID string) ([]*ModuleRevision, error) {
+	keys, err := db.Keys(moduleRevisionKeyPrefix + moduleID + "/")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	revisions := []*ModuleRevision{}
+	for _, key := range keys {
+		record := &ModuleRevision{}
+		if _, err := database.GetJSON(db, key, record); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, record)
+	}
+	return revisions, nil
+}
@@ -0,0 +1,81 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+)
+
+// ModuleResources limits the resources of the module's containers, zero means unlimited.
+type ModuleResources struct {
+	CPUs        float64 `json:"cpus"`
+	MemoryBytes int64   `json:"memoryBytes"`
+	PidsLimit   int64   `json:"pidsLimit"`
+}
+
+func (r *ModuleResources) Validate() error {
+	if r.CPUs < 0 {
+		return errors.New("resources cpus must not be negative")
+	}
+	if r.MemoryBytes < 0 {
+		return errors.New("resources memory must not be negative")
+	}
+	if r.PidsLimit < 0 {
+		return errors.New("resources pids limit must not be negative")
+	}
+	return nil
+}
+
+func (r *ModuleResources) Equal(other *ModuleResources) bool {
+	return *r == *other
+}
+
+// ModuleSecurity hardens the module's containers. Agents refuse to run modules whose security
+// options violate their node policy.
+type ModuleSecurity struct {
+	ReadOnlyRootfs  bool              `json:"readOnlyRootfs"`
+	User            string            `json:"user"`
+	CapAdd          []string          `json:"capAdd"`
+	CapDrop         []string          `json:"capDrop"`
+	SeccompProfile  string            `json:"seccompProfile"` // empty for docker's default, "unconfined" or a JSON profile
+	NoNewPrivileges bool              `json:"noNewPrivileges"`
+	Privileged      bool              `json:"privileged"`
+	HostNetwork     bool              `json:"hostNetwork"` // isolated bridge network otherwise
+	Tmpfs           map[string]string `json:"tmpfs"`       // mount options by absolute path
+}
+
+func NewModuleSecurityDefault() *ModuleSecurity {
+	return &ModuleSecurity{
+		CapAdd:  []string{},
+		CapDrop: []string{},
+		Tmpfs:   map[string]string{},
+	}
+}
+
+func (s *ModuleSecurity) Validate() error {
+	for _, capability := range slices.Concat(s.CapAdd, s.CapDrop) {
+		if capability == "" {
+			return errors.New("security capabilities must not be empty")
+		}
+	}
+	for mountPath := range s.Tmpfs {
+		if !path.IsAbs(mountPath) {
+			return fmt.Errorf("security tmpfs mount path must be absolute: '%s'", mountPath)
+		}
+	}
+	return nil
+}
+
+func (s *ModuleSecurity) Equal(other *ModuleSecurity) bool {
+	return s.ReadOnlyRootfs == other.ReadOnlyRootfs &&
+		s.User == other.User &&
+		slices.Equal(s.CapAdd, other.CapAdd) &&
+		slices.Equal(s.CapDrop, other.CapDrop) &&
+		s.SeccompProfile == other.SeccompProfile &&
+		s.NoNewPrivileges == other.NoNewPrivileges &&
+		s.Privileged == other.Privileged &&
+		s.HostNetwork == other.HostNetwork &&
+		maps.Equal(s.Tmpfs, other.Tmpfs)
+}
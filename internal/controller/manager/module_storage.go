@@ -0,0 +1,110 @@
+package manager
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+	"github.com/pajtaand/dmap-zero/internal/common/secrets"
+)
+
+var moduleVolumeName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// ModuleVolume is a named volume agents create for the module, its data outlives the module's
+// containers according to its retention.
+type ModuleVolume struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	ReadOnly  bool   `json:"readOnly"`
+	Retention string `json:"retention"`
+}
+
+// ModuleBindMount mounts a host path into the module's containers, agents only mount the paths
+// their module policy allows.
+type ModuleBindMount struct {
+	HostPath string `json:"hostPath"`
+	Path     string `json:"path"`
+	ReadOnly bool   `json:"readOnly"`
+}
+
+// ModuleSecretMount mounts a secret into the module's containers as a read-only file.
+type ModuleSecretMount struct {
+	Secret string `json:"secret"`
+	Path   string `json:"path"`
+}
+
+type ModuleStorage struct {
+	Volumes    []*ModuleVolume      `json:"volumes"`
+	BindMounts []*ModuleBindMount   `json:"bindMounts"`
+	Secrets    []*ModuleSecretMount `json:"secrets"`
+}
+
+func NewModuleStorageDefault() *ModuleStorage {
+	return &ModuleStorage{
+		Volumes:    []*ModuleVolume{},
+		BindMounts: []*ModuleBindMount{},
+		Secrets:    []*ModuleSecretMount{},
+	}
+}
+
+func (s *ModuleStorage) Validate() error {
+	names := map[string]bool{}
+	paths := map[string]bool{}
+	checkPath := func(mountPath string) error {
+		if !path.IsAbs(mountPath) {
+			return fmt.Errorf("storage mount path must be absolute: '%s'", mountPath)
+		}
+		if paths[path.Clean(mountPath)] {
+			return fmt.Errorf("storage mount path is used more than once: '%s'", mountPath)
+		}
+		paths[path.Clean(mountPath)] = true
+		return nil
+	}
+
+	for _, volume := range s.Volumes {
+		if !moduleVolumeName.MatchString(volume.Name) {
+			return fmt.Errorf("storage volume name is invalid: '%s'", volume.Name)
+		}
+		if names[volume.Name] {
+			return fmt.Errorf("storage volume name is used more than once: '%s'", volume.Name)
+		}
+		names[volume.Name] = true
+		if err := checkPath(volume.Path); err != nil {
+			return err
+		}
+		switch volume.Retention {
+		case constants.ModuleVolumeRetentionUntilStop, constants.ModuleVolumeRetentionUntilDelete, constants.ModuleVolumeRetentionForever:
+		default:
+			return fmt.Errorf("storage volume retention is unknown: '%s'", volume.Retention)
+		}
+	}
+	for _, bind := range s.BindMounts {
+		if !path.IsAbs(bind.HostPath) {
+			return fmt.Errorf("storage bind mount host path must be absolute: '%s'", bind.HostPath)
+		}
+		if err := checkPath(bind.Path); err != nil {
+			return err
+		}
+	}
+	for _, secret := range s.Secrets {
+		if !secrets.ValidName(secret.Secret) {
+			return fmt.Errorf("storage secret name is invalid: '%s'", secret.Secret)
+		}
+		if err := checkPath(secret.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ModuleStorage) Equal(other *ModuleStorage) bool {
+	return slices.EqualFunc(s.Volumes, other.Volumes, func(a, b *ModuleVolume) bool {
+		return *a == *b
+	}) && slices.EqualFunc(s.BindMounts, other.BindMounts, func(a, b *ModuleBindMount) bool {
+		return *a == *b
+	}) && slices.EqualFunc(s.Secrets, other.Secrets, func(a, b *ModuleSecretMount) bool {
+		return *a == *b
+	})
+}
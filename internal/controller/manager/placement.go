@@ -0,0 +1,56 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/pajtaand/dmap-zero/internal/common/utils"
+)
+
+// Placement describes which agents should run a module. An agent is targeted when
+// All is set, its ID is listed in AgentIDs, or its labels match the Selector.
+type Placement struct {
+	All      bool     `json:"all"`
+	AgentIDs []string `json:"agentIDs"`
+	Selector string   `json:"selector"`
+}
+
+func NewPlacementAll() *Placement {
+	return &Placement{
+		All:      true,
+		AgentIDs: []string{},
+	}
+}
+
+func (p *Placement) Validate() error {
+	if !p.All && len(p.AgentIDs) == 0 && p.Selector == "" {
+		return errors.New("placement must target all agents, a list of agents or a label selector")
+	}
+	if _, err := utils.ParseLabelSelector(p.Selector); err != nil {
+		return fmt.Errorf("invalid placement selector: %v", err)
+	}
+	return nil
+}
+
+// Matches reports whether the agent is targeted by the placement.
+func (p *Placement) Matches(agent *Agent) bool {
+	if p.All {
+		return true
+	}
+	if slices.Contains(p.AgentIDs, agent.GetID()) {
+		return true
+	}
+	if p.Selector != "" {
+		selector, err := utils.ParseLabelSelector(p.Selector)
+		if err != nil {
+			return false
+		}
+		return selector.Matches(agent.GetLabels())
+	}
+	return false
+}
+
+func (p *Placement) Equal(other *Placement) bool {
+	return p.All == other.All && p.Selector == other.Selector && slices.Equal(p.AgentIDs, other.AgentIDs)
+}
@@ -0,0 +1,28 @@
+package manager
+
+import (
+	"errors"
+
+	"github.com/pajtaand/dmap-zero/internal/common/registry"
+)
+
+// RegistrySource describes an image pulled from an OCI registry instead of being uploaded.
+type RegistrySource struct {
+	Reference   string                `json:"reference"`
+	Platform    string                `json:"platform"`
+	Insecure    bool                  `json:"insecure"`
+	Credentials *registry.Credentials `json:"credentials,omitempty"`
+}
+
+func (s *RegistrySource) Validate() error {
+	if _, err := registry.ParseReference(s.Reference); err != nil {
+		return err
+	}
+	if _, err := registry.ParsePlatform(s.Platform); err != nil {
+		return err
+	}
+	if s.Credentials != nil && s.Credentials.Username == "" {
+		return errors.New("registry username must not be empty")
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+)
+
+// RestartPolicy describes how agents restart a module whose container exited.
+type RestartPolicy struct {
+	Policy     string `json:"policy"`
+	MaxRetries int    `json:"maxRetries"`
+}
+
+func NewRestartPolicyNever() *RestartPolicy {
+	return &RestartPolicy{
+		Policy: constants.ModuleRestartPolicyNever,
+	}
+}
+
+func (p *RestartPolicy) Validate() error {
+	switch p.Policy {
+	case constants.ModuleRestartPolicyNever, constants.ModuleRestartPolicyOnFailure, constants.ModuleRestartPolicyAlways:
+	default:
+		return fmt.Errorf("unknown restart policy: '%s'", p.Policy)
+	}
+	if p.MaxRetries < 0 {
+		return errors.New("restart policy max retries must not be negative")
+	}
+	return nil
+}
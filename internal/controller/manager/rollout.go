@@ -0,0 +1,119 @@
+package manager
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+)
+
+// RolloutStrategy describes how a module update is rolled across its agents.
+type RolloutStrategy struct {
+	MaxUnavailable   int `json:"maxUnavailable"`   // agents updated at once
+	CanaryPercentage int `json:"canaryPercentage"` // agents updated in the first batch, 0 disables the canary
+	ProgressDeadline int `json:"progressDeadline"` // seconds a batch has to become healthy before rolling back
+}
+
+func NewRolloutStrategyDefault() *RolloutStrategy {
+	return &RolloutStrategy{
+		MaxUnavailable:   1,
+		ProgressDeadline: int(constants.ControllerRolloutProgressDeadline.Seconds()),
+	}
+}
+
+func (s *RolloutStrategy) Validate() error {
+	if s.MaxUnavailable < 1 {
+		return errors.New("rollout max unavailable must be at least 1")
+	}
+	if s.CanaryPercentage < 0 || s.CanaryPercentage > 100 {
+		return errors.New("rollout canary percentage must be between 0 and 100")
+	}
+	if s.ProgressDeadline < 1 {
+		return errors.New("rollout progress deadline must be at least 1 second")
+	}
+	return nil
+}
+
+// Rollout tracks an update of a running module. Agents of the batches up to CurrentBatch run
+// the new spec, the other agents of the rollout keep running the previous one.
+type Rollout struct {
+	ID             string           `json:"id"`
+	From           *ModuleSpec      `json:"from"`
+	To             *ModuleSpec      `json:"to"`
+	Strategy       *RolloutStrategy `json:"strategy"`
+	Batches        [][]string       `json:"batches"`
+	CurrentBatch   int              `json:"currentBatch"`
+	State          string           `json:"state"`
+	Message        string           `json:"message,omitempty"`
+	StartedAt      time.Time        `json:"startedAt"`
+	BatchStartedAt time.Time        `json:"batchStartedAt"`
+	FinishedAt     time.Time        `json:"finishedAt"`
+}
+
+// newRollout splits the agents into the canary batch and batches of MaxUnavailable agents.
+func newRollout(id string, from, to *ModuleSpec, strategy *RolloutStrategy, agentIDs []string) *Rollout {
+	agentIDs = slices.Clone(agentIDs)
+	sort.Strings(agentIDs)
+
+	batches := [][]string{}
+	if canary := (len(agentIDs)*strategy.CanaryPercentage + 99) / 100; canary > 0 {
+		batches = append(batches, agentIDs[:canary])
+		agentIDs = agentIDs[canary:]
+	}
+	for len(agentIDs) > 0 {
+		n := min(strategy.MaxUnavailable, len(agentIDs))
+		batches = append(batches, agentIDs[:n])
+		agentIDs = agentIDs[n:]
+	}
+
+	now := time.Now()
+	rollout := &Rollout{
+		ID:             id,
+		From:           from,
+		To:             to,
+		Strategy:       strategy,
+		Batches:        batches,
+		State:          constants.RolloutStateInProgress,
+		StartedAt:      now,
+		BatchStartedAt: now,
+	}
+	if len(batches) == 0 {
+		rollout.State = constants.RolloutStateSucceeded
+		rollout.FinishedAt = now
+	}
+	return rollout
+}
+
+func (r *Rollout) IsActive() bool {
+	return r.State == constants.RolloutStateInProgress
+}
+
+// IsUpdated reports whether the agent runs the new spec while the rollout is active.
+func (r *Rollout) IsUpdated(agentID string) bool {
+	for i, batch := range r.Batches {
+		if slices.Contains(batch, agentID) {
+			return i <= r.CurrentBatch
+		}
+	}
+	return true // agents placed after the rollout started run the new spec right away
+}
+
+// GetCurrentBatch returns the agents of the batch being rolled out.
+func (r *Rollout) GetCurrentBatch() []string {
+	if !r.IsActive() || r.CurrentBatch >= len(r.Batches) {
+		return []string{}
+	}
+	return r.Batches[r.CurrentBatch]
+}
+
+func (r *Rollout) GetProgressDeadline() time.Duration {
+	return time.Duration(r.Strategy.ProgressDeadline) * time.Second
+}
+
+func (r *Rollout) copy() *Rollout {
+	c := *r
+	c.Batches = slices.Clone(r.Batches)
+	return &c
+}
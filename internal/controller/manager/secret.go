@@ -0,0 +1,264 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pajtaand/dmap-zero/internal/common/database"
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	"github.com/pajtaand/dmap-zero/internal/common/secrets"
+	"github.com/rs/zerolog/log"
+)
+
+const secretKeyPrefix = "secret/"
+
+// secretRecord is the persisted secret, only the ciphertext is stored.
+type secretRecord struct {
+	Name       string    `json:"name"`
+	Ciphertext []byte    `json:"ciphertext"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// Secret is a named value modules and agents refer to from their configuration. The value is
+// only decrypted when it is delivered to an agent.
+type Secret struct {
+	name       string
+	ciphertext []byte
+	createdAt  time.Time
+	updatedAt  time.Time
+
+	mu sync.RWMutex
+}
+
+func (s *Secret) GetName() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.name
+}
+
+func (s *Secret) GetCreatedAt() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.createdAt
+}
+
+func (s *Secret) GetUpdatedAt() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.updatedAt
+}
+
+func (s *Secret) record() *secretRecord {
+	return &secretRecord{
+		Name:       s.name,
+		Ciphertext: s.ciphertext,
+		CreatedAt:  s.createdAt,
+		UpdatedAt:  s.updatedAt,
+	}
+}
+
+type SecretManager struct {
+	mu       sync.RWMutex
+	secrets  map[string]*Secret
+	box      *secrets.Box
+	database database.Database
+}
+
+func NewSecretManager(box *secrets.Box, database database.Database) (*SecretManager, error) {
+	log.Debug().Msg("Creating new SecretManager")
+
+	if box == nil {
+		return nil, errors.New("box must not be nil")
+	}
+	if database == nil {
+		return nil, errors.New("database must not be nil")
+	}
+
+	mgr := &SecretManager{
+		secrets:  map[string]*Secret{},
+		box:      box,
+		database: database,
+	}
+	if err := mgr.load(); err != nil {
+		return nil, fmt.Errorf("failed to load secrets: %v", err)
+	}
+	return mgr, nil
+}
+
+func (mgr *SecretManager) load() error {
+	keys, err := mgr.database.Keys(secretKeyPrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		record := &secretRecord{}
+		if _, err := database.GetJSON(mgr.database, key, record); err != nil {
+			return err
+		}
+		// fail early when the master key changed
+		if _, err := mgr.box.Open(record.Name, record.Ciphertext); err != nil {
+			return err
+		}
+		mgr.secrets[record.Name] = &Secret{
+			name:       record.Name,
+			ciphertext: record.Ciphertext,
+			createdAt:  record.CreatedAt,
+			updatedAt:  record.UpdatedAt,
+		}
+	}
+	log.Info().Msgf("Loaded %d secrets from database", len(mgr.secrets))
+	return nil
+}
+
+// AddSecret stores a new secret, it returns ErrConflict when the name is taken.
+func (mgr *SecretManager) AddSecret(name string, value []byte) error {
+	log.Info().Msgf("Adding new secret: name=%s", name)
+
+	if !secrets.ValidName(name) {
+		return fmt.Errorf("secret name is invalid: '%s'", name)
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	if _, ok := mgr.secrets[name]; ok {
+		return errs.ErrConflict
+	}
+	ciphertext, err := mgr.box.Seal(name, value)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt secret: %v", err)
+	}
+	now := time.Now()
+	secret := &Secret{
+		name:       name,
+		ciphertext: ciphertext,
+		createdAt:  now,
+		updatedAt:  now,
+	}
+	if err := database.SetJSON(mgr.database, secretKeyPrefix+name, secret.record()); err != nil {
+		return fmt.Errorf("failed to save secret: %v", err)
+	}
+	mgr.secrets[name] = secret
+	return nil
+}
+
+// UpdateSecret replaces the value of the secret, agents pick up the new value with the next
+// desired state and restart the modules using it.
+func (mgr *SecretManager) UpdateSecret(name string, value []byte) error {
+	log.Info().Msgf("Updating secret: name=%s", name)
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	secret, ok := mgr.secrets[name]
+	if !ok {
+		return errs.ErrNotFound
+	}
+	ciphertext, err := mgr.box.Seal(name, value)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt secret: %v", err)
+	}
+
+	secret.mu.Lock()
+	defer secret.mu.Unlock()
+	record := secret.record()
+	record.Ciphertext = ciphertext
+	record.UpdatedAt = time.Now()
+	if err := database.SetJSON(mgr.database, secretKeyPrefix+name, record); err != nil {
+		return fmt.Errorf("failed to save secret: %v", err)
+	}
+	secret.ciphertext = record.Ciphertext
+	secret.updatedAt = record.UpdatedAt
+	return nil
+}
+
+func (mgr *SecretManager) GetSecret(name string) (*Secret, error) {
+	log.Info().Msgf("Getting secret: name=%s", name)
+
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	secret, ok := mgr.secrets[name]
+	if !ok {
+		return nil, errs.ErrNotFound
+	}
+	return secret, nil
+}
+
+// ListSecrets returns the secrets sorted by name.
+func (mgr *SecretManager) ListSecrets() []*Secret {
+	log.Info().Msg("Listing all secrets")
+
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	list := make([]*Secret, 0, len(mgr.secrets))
+	for _, secret := range mgr.secrets {
+		list = append(list, secret)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+	return list
+}
+
+func (mgr *SecretManager) RemoveSecret(name string) error {
+	log.Info().Msgf("Removing secret: name=%s", name)
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	if _, ok := mgr.secrets[name]; !ok {
+		return errs.ErrNotFound
+	}
+	if err := mgr.database.Delete(secretKeyPrefix + name); err != nil {
+		return fmt.Errorf("failed to delete secret: %v", err)
+	}
+	delete(mgr.secrets, name)
+	return nil
+}
+
+func (mgr *SecretManager) SecretExists(name string) bool {
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	_, ok := mgr.secrets[name]
+	return ok
+}
+
+// CheckSecretsExist returns an error wrapping ErrNotAllowed when one of the referenced secrets
+// doesn't exist.
+func (mgr *SecretManager) CheckSecretsExist(names []string) error {
+	for _, name := range names {
+		if !mgr.SecretExists(name) {
+			return fmt.Errorf("%w: secret '%s' doesn't exist", errs.ErrNotAllowed, name)
+		}
+	}
+	return nil
+}
+
+// RevealSecrets decrypts the secrets with the given names, missing secrets are left out.
+func (mgr *SecretManager) RevealSecrets(names []string) (map[string][]byte, error) {
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	values := map[string][]byte{}
+	for _, name := range names {
+		secret, ok := mgr.secrets[name]
+		if !ok {
+			continue
+		}
+		secret.mu.RLock()
+		value, err := mgr.box.Open(name, secret.ciphertext)
+		secret.mu.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+	return values, nil
+}
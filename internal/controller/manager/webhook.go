@@ -3,30 +3,49 @@ package manager
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/google/uuid"
+	"github.com/pajtaand/dmap-zero/internal/common/database"
 	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	"github.com/pajtaand/dmap-zero/internal/common/secrets"
 	"github.com/pajtaand/dmap-zero/internal/common/utils"
 	"github.com/pajtaand/dmap-zero/internal/controller/rest/models"
+	"github.com/pajtaand/dmap-zero/pkg/webhooksig"
 )
 
+const webhookKeyPrefix = "webhook/"
+
+type webhookRecord struct {
+	ID       string `json:"id"`
+	ModuleID string `json:"moduleID"`
+	URL      string `json:"url"`
+	// Secret is the signing secret sealed by the secrets box, webhooks registered before
+	// deliveries were signed have none
+	Secret []byte `json:"secret,omitempty"`
+}
+
 type Webhook struct {
 	id       string
 	moduleID string
 	URL      string
+	secret   string
 
 	mu sync.RWMutex
 }
 
-func NewWebhook(id, moduleID, URL string) *Webhook {
+func NewWebhook(id, moduleID, URL, secret string) *Webhook {
 	return &Webhook{
 		id:       id,
 		moduleID: moduleID,
 		URL:      URL,
+		secret:   secret,
 	}
 }
 
@@ -48,28 +67,100 @@ func (a *Webhook) GetURL() string {
 	return a.URL
 }
 
+func (a *Webhook) getSecret() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.secret
+}
+
 type WebhookManager struct {
 	mu       sync.RWMutex
 	webhooks map[string]*Webhook
+	database database.Database
+	box      *secrets.Box
+	client   *http.Client
 }
 
-func NewWebhookManager() (*WebhookManager, error) {
+// NewWebhookManager creates the manager, the signing secrets of webhooks are sealed by the box and
+// data is delivered with the client.
+func NewWebhookManager(box *secrets.Box, database database.Database, client *http.Client) (*WebhookManager, error) {
 	log.Debug().Msg("Creating new WebhookManager")
 
-	return &WebhookManager{
+	if box == nil {
+		return nil, errors.New("box must not be nil")
+	}
+	if database == nil {
+		return nil, errors.New("database must not be nil")
+	}
+	if client == nil {
+		return nil, errors.New("client must not be nil")
+	}
+
+	mgr := &WebhookManager{
 		webhooks: map[string]*Webhook{},
-	}, nil
+		database: database,
+		box:      box,
+		client:   client,
+	}
+	if err := mgr.load(); err != nil {
+		return nil, fmt.Errorf("failed to load webhooks: %v", err)
+	}
+	return mgr, nil
+}
+
+func (mgr *WebhookManager) load() error {
+	keys, err := mgr.database.Keys(webhookKeyPrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		record := &webhookRecord{}
+		if _, err := database.GetJSON(mgr.database, key, record); err != nil {
+			return err
+		}
+		secret := ""
+		if record.Secret == nil {
+			log.Warn().Msgf("Webhook %s has no signing secret, its deliveries are not signed", record.ID)
+		} else {
+			plaintext, err := mgr.box.Open(webhookKeyPrefix+record.ID, record.Secret)
+			if err != nil {
+				return fmt.Errorf("failed to open secret of webhook %s: %v", record.ID, err)
+			}
+			secret = string(plaintext)
+		}
+		mgr.webhooks[record.ID] = NewWebhook(record.ID, record.ModuleID, record.URL, secret)
+	}
+	log.Info().Msgf("Loaded %d webhooks from database", len(mgr.webhooks))
+	return nil
 }
 
-func (mgr *WebhookManager) AddWebhook(moduleID, URL string) (string, error) {
+// AddWebhook registers the webhook and returns its ID with the secret its deliveries are signed
+// with. The secret is only kept sealed, it can't be retrieved again.
+func (mgr *WebhookManager) AddWebhook(moduleID, URL string) (string, string, error) {
 	log.Info().Msgf("Adding new webhook: moduleID=%s, URL=%s", moduleID, URL)
 
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
 
 	webhookID := uuid.New().String()
-	mgr.webhooks[webhookID] = NewWebhook(webhookID, moduleID, URL)
-	return webhookID, nil
+	secret, err := webhooksig.GenerateSecret()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate signing secret: %v", err)
+	}
+	sealed, err := mgr.box.Seal(webhookKeyPrefix+webhookID, []byte(secret))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to seal signing secret: %v", err)
+	}
+	if err := database.SetJSON(mgr.database, webhookKeyPrefix+webhookID, &webhookRecord{
+		ID:       webhookID,
+		ModuleID: moduleID,
+		URL:      URL,
+		Secret:   sealed,
+	}); err != nil {
+		return "", "", fmt.Errorf("failed to save webhook: %v", err)
+	}
+	mgr.webhooks[webhookID] = NewWebhook(webhookID, moduleID, URL, secret)
+	return webhookID, secret, nil
 }
 
 func (mgr *WebhookManager) GetWebhook(webhookID string) (*Webhook, error) {
@@ -124,6 +215,10 @@ func (mgr *WebhookManager) RemoveWebhook(webhookID string) error {
 		return errs.ErrNotFound
 	}
 
+	if err := mgr.database.Delete(webhookKeyPrefix + webhookID); err != nil {
+		return fmt.Errorf("failed to delete webhook: %v", err)
+	}
+
 	delete(mgr.webhooks, webhookID)
 	return nil
 }
@@ -138,15 +233,19 @@ func (mgr *WebhookManager) WebhookExists(webhookID string) bool {
 	return ok
 }
 
-func (mgr *WebhookManager) SendData(moduleID, receiver string, data []byte) error {
-	log.Info().Msgf("Sending data to webhook: moduleID=%s", moduleID)
+// SendData delivers the data sent by the module to all webhooks registered for it. The delivery
+// succeeds only when every webhook accepted it, it returns ErrNotFound when no webhook is
+// registered for the module. Every delivery is signed with the secret of its webhook.
+func (mgr *WebhookManager) SendData(moduleID, messageID, receiver string, data []byte) error {
+	log.Info().Msgf("Sending data to webhook: moduleID=%s, messageID=%s", moduleID, messageID)
 
 	// prepare payload
 	base64String := base64.StdEncoding.EncodeToString(data)
 	webhookData := models.WebhookData{
-		ModuleID: moduleID,
-		Blob:     base64String,
-		Receiver: receiver,
+		ModuleID:  moduleID,
+		MessageID: messageID,
+		Blob:      base64String,
+		Receiver:  receiver,
 	}
 
 	payload, err := json.Marshal(webhookData)
@@ -158,18 +257,22 @@ func (mgr *WebhookManager) SendData(moduleID, receiver string, data []byte) erro
 	webhooks := mgr.ListWebhooksForModule(moduleID)
 
 	if len(webhooks) == 0 {
-		log.Debug().Msg("No webhooks registered. Skipping...")
-		return nil
+		return fmt.Errorf("%w: no webhook registered for module", errs.ErrNotFound)
 	}
 
 	var wg sync.WaitGroup
 	results := make(chan bool, len(webhooks))
 
 	for _, webhook := range webhooks {
+		var header http.Header
+		if secret := webhook.getSecret(); secret != "" {
+			header = webhooksig.Header(secret, time.Now(), payload)
+		}
+
 		wg.Add(1)
 		go func(URL string, res chan bool) {
 			log.Debug().Msgf("Sending data to webhook: %s", URL)
-			err := utils.SendPOSTRequest(URL, payload)
+			err := utils.SendPOSTRequestWithHeader(mgr.client, URL, header, payload)
 			if err != nil {
 				log.Warn().Msgf("failed to send data: %v", err)
 			}
@@ -181,12 +284,14 @@ func (mgr *WebhookManager) SendData(moduleID, receiver string, data []byte) erro
 	wg.Wait()
 	close(results)
 
-	// succeed if at least one call was successfully
+	failed := 0
 	for result := range results {
-		if result {
-			return nil
+		if !result {
+			failed++
 		}
 	}
-
-	return fmt.Errorf("none of %d registered webhook urls were reached", len(webhooks))
+	if failed > 0 {
+		return fmt.Errorf("%d of %d registered webhook urls were not reached", failed, len(webhooks))
+	}
+	return nil
 }
@@ -22,6 +22,13 @@ var (
 		},
 		[]string{"agent"},
 	)
+	AgentRejectedImagesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "agent_rejected_images_total",
+			Help: "Number of images the agent refused to load because their signature didn't verify",
+		},
+		[]string{"agent"},
+	)
 	AgentRunningModulesGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "agent_running_modules_total",
@@ -29,10 +36,43 @@ var (
 		},
 		[]string{"agent"},
 	)
+	AgentUnhealthyModulesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "agent_unhealthy_modules_total",
+			Help: "Number of currently unhealthy modules on agent",
+		},
+		[]string{"agent"},
+	)
+	AgentCrashLoopingModulesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "agent_crash_looping_modules_total",
+			Help: "Number of modules in a crash loop on agent",
+		},
+		[]string{"agent"},
+	)
+	AgentModuleRestartsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "agent_module_restarts_total",
+			Help: "Number of module restarts performed by agent",
+		},
+		[]string{"agent", "module"},
+	)
+	AgentModuleVolumeBytesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "agent_module_volume_bytes",
+			Help: "Size of module volumes on agent",
+		},
+		[]string{"agent", "module", "volume"},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(RESTHTTPRequestsTotal)
 	prometheus.MustRegister(AgentPresentImagesGauge)
+	prometheus.MustRegister(AgentRejectedImagesGauge)
 	prometheus.MustRegister(AgentRunningModulesGauge)
+	prometheus.MustRegister(AgentUnhealthyModulesGauge)
+	prometheus.MustRegister(AgentCrashLoopingModulesGauge)
+	prometheus.MustRegister(AgentModuleRestartsGauge)
+	prometheus.MustRegister(AgentModuleVolumeBytesGauge)
 }
@@ -1,11 +1,15 @@
 package handler
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
 	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
 	"github.com/pajtaand/dmap-zero/internal/common/utils"
 	"github.com/pajtaand/dmap-zero/internal/controller/dto"
@@ -36,8 +40,14 @@ func (h *agentHandler) CreateAgent(w http.ResponseWriter, r *http.Request) {
 	agent, err := h.service.CreateAgent(r.Context(), &dto.CreateAgentRequest{
 		Name:          req.Name,
 		Configuration: req.Configuration,
+		Labels:        req.Labels,
 	})
 	if err != nil {
+		if errors.Is(err, errs.ErrNotAllowed) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusUnprocessableEntity, errors.New("configuration refers to a secret that doesn't exist"))
+			return
+		}
 		panic(err)
 	}
 
@@ -68,18 +78,48 @@ func (h *agentHandler) GetAgent(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
+	var drift *models.AgentDrift
+	if agent.Drift != nil {
+		drift = &models.AgentDrift{
+			InSync:            agent.Drift.InSync,
+			MissingImages:     agent.Drift.MissingImages,
+			UnexpectedImages:  agent.Drift.UnexpectedImages,
+			MissingModules:    agent.Drift.MissingModules,
+			UnexpectedModules: agent.Drift.UnexpectedModules,
+		}
+	}
+
 	utils.WriteResponse(w, http.StatusOK, models.GetAgentResponse{
-		Name:           agent.Name,
-		Configuration:  agent.Configuration,
-		IsEnrolled:     agent.IsEnrolled,
-		IsOnline:       agent.IsOnline,
-		PresentImages:  agent.PresentImages,
-		PresentModules: agent.PresentModules,
+		Name:            agent.Name,
+		Configuration:   agent.Configuration,
+		Labels:          agent.Labels,
+		IsEnrolled:      agent.IsEnrolled,
+		IsOnline:        agent.IsOnline,
+		PresentImages:   agent.PresentImages,
+		RejectedImages:  agent.RejectedImages,
+		RejectedModules: agent.RejectedModules,
+		VolumeUsage:     agent.VolumeUsage,
+		PresentModules:  agent.PresentModules,
+		ModuleStatuses:  agent.ModuleStatuses,
+		ModuleRestarts:  agent.ModuleRestarts,
+		Subscriptions:   agent.Subscriptions,
+		Drift:           drift,
 	})
 }
 
 func (h *agentHandler) ListAgents(w http.ResponseWriter, r *http.Request) {
-	agents, err := h.service.ListAgents(r.Context(), &dto.ListAgentsRequest{})
+	log := zerolog.Ctx(r.Context())
+
+	selector := r.URL.Query().Get("selector")
+	if _, err := utils.ParseLabelSelector(selector); err != nil {
+		log.Error().Err(err).Msg("")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+
+	agents, err := h.service.ListAgents(r.Context(), &dto.ListAgentsRequest{
+		Selector: selector,
+	})
 	if err != nil {
 		panic(err)
 	}
@@ -87,13 +127,20 @@ func (h *agentHandler) ListAgents(w http.ResponseWriter, r *http.Request) {
 	agentList := []models.ListAgentsResponseAgent{}
 	for _, agent := range agents.Agents {
 		agentList = append(agentList, models.ListAgentsResponseAgent{
-			ID:             agent.ID,
-			Name:           agent.Name,
-			Configuration:  agent.Configuration,
-			IsEnrolled:     agent.IsEnrolled,
-			IsOnline:       agent.IsOnline,
-			PresentImages:  agent.PresentImages,
-			PresentModules: agent.PresentModules,
+			ID:              agent.ID,
+			Name:            agent.Name,
+			Configuration:   agent.Configuration,
+			Labels:          agent.Labels,
+			IsEnrolled:      agent.IsEnrolled,
+			IsOnline:        agent.IsOnline,
+			PresentImages:   agent.PresentImages,
+			RejectedImages:  agent.RejectedImages,
+			RejectedModules: agent.RejectedModules,
+			VolumeUsage:     agent.VolumeUsage,
+			PresentModules:  agent.PresentModules,
+			ModuleStatuses:  agent.ModuleStatuses,
+			ModuleRestarts:  agent.ModuleRestarts,
+			Subscriptions:   agent.Subscriptions,
 		})
 	}
 	utils.WriteResponse(w, http.StatusOK, models.ListAgentsResponse{
@@ -122,12 +169,18 @@ func (h *agentHandler) UpdateAgent(w http.ResponseWriter, r *http.Request) {
 		ID:            agentID,
 		Name:          req.Name,
 		Configuration: req.Configuration,
+		Labels:        req.Labels,
 	}); err != nil {
 		if errors.Is(err, errs.ErrNotFound) {
 			log.Error().Err(err).Msg("")
 			utils.WriteErrorResponse(w, http.StatusNotFound, fmt.Errorf("agent with id '%s' doesn't exists", agentID))
 			return
 		}
+		if errors.Is(err, errs.ErrNotAllowed) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusUnprocessableEntity, errors.New("configuration refers to a secret that doesn't exist"))
+			return
+		}
 		panic(err)
 	}
 
@@ -157,3 +210,222 @@ func (h *agentHandler) DeleteAgent(w http.ResponseWriter, r *http.Request) {
 
 	utils.WriteResponse(w, http.StatusOK, nil)
 }
+
+func (h *agentHandler) StreamModuleLogs(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	agentID := chi.URLParam(r, "agentID")
+	if agentID == "" {
+		log.Info().Msg("agentID is empty")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+	moduleID := chi.URLParam(r, "moduleID")
+	if moduleID == "" {
+		log.Info().Msg("moduleID is empty")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	req := &models.StreamModuleLogsRequest{}
+	if err := req.FromHttpRequest(r); err != nil {
+		log.Error().Err(err).Msg("")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logs, err := h.service.StreamModuleLogs(r.Context(), &dto.StreamModuleLogsRequest{
+		AgentID:    agentID,
+		ModuleID:   moduleID,
+		Since:      req.Since,
+		Tail:       req.Tail,
+		Follow:     req.Follow,
+		Timestamps: req.Timestamps,
+	})
+	if err != nil {
+		if errors.Is(err, errs.ErrNotFound) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusNotFound, fmt.Errorf("module '%s' isn't present on agent '%s'", moduleID, agentID))
+			return
+		}
+		if errors.Is(err, errs.ErrConflict) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusConflict, fmt.Errorf("agent '%s' is offline", agentID))
+			return
+		}
+		panic(err)
+	}
+
+	// browsers can't set the authorization header on EventSource, so plain chunked text is
+	// served unless server-sent events are asked for
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		log.Error().Err(err).Msg("Streaming isn't supported")
+		return
+	}
+	for {
+		chunk, err := logs.Recv()
+		if err != nil {
+			if err != io.EOF && r.Context().Err() == nil {
+				log.Error().Err(err).Msg("Module logs stream failed")
+			}
+			return
+		}
+		if sse {
+			err = writeLogEvent(w, chunk)
+		} else {
+			_, err = w.Write(chunk.Data)
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			log.Debug().Err(err).Msg("Client went away")
+			return
+		}
+	}
+}
+
+// writeLogEvent writes the chunk as server-sent event named after the stream, every line of
+// the chunk becomes one data field.
+func writeLogEvent(w io.Writer, chunk *dto.ModuleLogChunk) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "event: %s\n", chunk.Stream)
+	for _, line := range strings.Split(strings.TrimSuffix(string(chunk.Data), "\n"), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", strings.TrimSuffix(line, "\r"))
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// execUpgrader rejects cross-origin upgrades, browsers would send the stored credentials.
+var execUpgrader = websocket.Upgrader{}
+
+func (h *agentHandler) ExecModule(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	agentID := chi.URLParam(r, "agentID")
+	if agentID == "" {
+		log.Info().Msg("agentID is empty")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+	moduleID := chi.URLParam(r, "moduleID")
+	if moduleID == "" {
+		log.Info().Msg("moduleID is empty")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		log.Info().Msg("Not a websocket upgrade")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, errors.New("exec session requires a websocket connection"))
+		return
+	}
+
+	req := &models.ExecModuleRequest{}
+	if err := req.FromHttpRequest(r); err != nil {
+		log.Error().Err(err).Msg("")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+
+	session, err := h.service.ExecModule(r.Context(), &dto.ExecModuleRequest{
+		AgentID:  agentID,
+		ModuleID: moduleID,
+		Command:  req.Command,
+		Tty:      req.Tty,
+		Rows:     req.Rows,
+		Cols:     req.Cols,
+	})
+	if err != nil {
+		if errors.Is(err, errs.ErrNotFound) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusNotFound, fmt.Errorf("module '%s' isn't present on agent '%s'", moduleID, agentID))
+			return
+		}
+		if errors.Is(err, errs.ErrConflict) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusConflict, fmt.Errorf("agent '%s' is offline", agentID))
+			return
+		}
+		panic(err)
+	}
+	defer session.Close()
+
+	conn, err := execUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to upgrade exec session")
+		return
+	}
+	defer conn.Close()
+
+	go func() {
+		// closing the session ends the output loop below
+		defer session.Close()
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if messageType == websocket.BinaryMessage {
+				err = session.Stdin(data)
+			} else {
+				err = handleExecMessage(session, data)
+			}
+			if err != nil {
+				log.Error().Err(err).Msg("Exec session input failed")
+				return
+			}
+		}
+	}()
+
+	for {
+		output, err := session.Recv()
+		if err == io.EOF {
+			if err := conn.WriteJSON(models.ExecMessage{
+				Type:     models.ExecMessageExit,
+				ExitCode: session.ExitCode(),
+			}); err != nil {
+				return
+			}
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		}
+		if err != nil {
+			if r.Context().Err() == nil {
+				log.Error().Err(err).Msg("Exec session failed")
+			}
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "exec session failed"))
+			return
+		}
+		if err := conn.WriteMessage(websocket.BinaryMessage, output.Data); err != nil {
+			return
+		}
+	}
+}
+
+func handleExecMessage(session *dto.ExecModuleResponse, data []byte) error {
+	msg := models.ExecMessage{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return fmt.Errorf("invalid exec message: %v", err)
+	}
+	switch msg.Type {
+	case models.ExecMessageResize:
+		return session.Resize(msg.Rows, msg.Cols)
+	case models.ExecMessageCloseStdin:
+		return session.CloseStdin()
+	default:
+		return fmt.Errorf("unknown exec message type: '%s'", msg.Type)
+	}
+}
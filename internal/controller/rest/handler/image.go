@@ -14,7 +14,8 @@ import (
 )
 
 const (
-	maxImageSize = 5 << 30 // 5*2^30 = 5GiB
+	maxImageSize   = 5 << 30  // 5*2^30 = 5GiB
+	maxImageMemory = 32 << 20 // larger uploads are spooled to a temporary file
 )
 
 type imageHandler struct {
@@ -28,7 +29,8 @@ func NewImageHandler(service ImageService) *imageHandler {
 }
 
 func (h *imageHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseMultipartForm(maxImageSize)
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageSize)
+	err := r.ParseMultipartForm(maxImageMemory)
 	if err != nil {
 		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
 		return
@@ -40,6 +42,7 @@ func (h *imageHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer file.Close()
+	defer r.MultipartForm.RemoveAll()
 
 	image, err := h.service.UploadImage(r.Context(), &dto.UploadImageRequest{
 		Name: r.FormValue("name"),
@@ -54,6 +57,33 @@ func (h *imageHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (h *imageHandler) RegisterImage(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	req := &models.RegisterImageRequest{}
+	if err := req.FromHttpRequest(r); err != nil {
+		log.Error().Err(err).Msg("")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	image, err := h.service.RegisterImage(r.Context(), &dto.RegisterImageRequest{
+		Name:      req.Name,
+		Reference: req.Reference,
+		Platform:  req.Platform,
+		Insecure:  req.Insecure,
+		Username:  req.Username,
+		Password:  req.Password,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	utils.WriteResponse(w, http.StatusOK, models.RegisterImageResponse{
+		ID: image.ID,
+	})
+}
+
 func (h *imageHandler) GetImage(w http.ResponseWriter, r *http.Request) {
 	log := zerolog.Ctx(r.Context())
 
@@ -77,8 +107,14 @@ func (h *imageHandler) GetImage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	utils.WriteResponse(w, http.StatusOK, models.GetImageResponse{
-		Name: image.Name,
-		Size: image.Size,
+		Name:          image.Name,
+		Size:          image.Size,
+		Digest:        image.Digest,
+		Source:        image.Source,
+		Reference:     image.Reference,
+		Platform:      image.Platform,
+		Status:        image.Status,
+		StatusMessage: image.StatusMessage,
 	})
 }
 
@@ -91,9 +127,15 @@ func (h *imageHandler) ListImages(w http.ResponseWriter, r *http.Request) {
 	imageList := []models.ListImagesResponseImage{}
 	for _, image := range images.Images {
 		imageList = append(imageList, models.ListImagesResponseImage{
-			ID:   image.ID,
-			Name: image.Name,
-			Size: image.Size,
+			ID:            image.ID,
+			Name:          image.Name,
+			Size:          image.Size,
+			Digest:        image.Digest,
+			Source:        image.Source,
+			Reference:     image.Reference,
+			Platform:      image.Platform,
+			Status:        image.Status,
+			StatusMessage: image.StatusMessage,
 		})
 	}
 	utils.WriteResponse(w, http.StatusOK, models.ListImagesResponse{
@@ -101,6 +143,17 @@ func (h *imageHandler) ListImages(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (h *imageHandler) GetSigningKey(w http.ResponseWriter, r *http.Request) {
+	key, err := h.service.GetSigningKey(r.Context(), &dto.GetImageSigningKeyRequest{})
+	if err != nil {
+		panic(err)
+	}
+
+	utils.WriteResponse(w, http.StatusOK, models.GetImageSigningKeyResponse{
+		PublicKey: key.PublicKey,
+	})
+}
+
 func (h *imageHandler) DeleteImage(w http.ResponseWriter, r *http.Request) {
 	log := zerolog.Ctx(r.Context())
 
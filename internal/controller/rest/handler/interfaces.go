@@ -12,6 +12,8 @@ type AgentService interface {
 	ListAgents(ctx context.Context, req *dto.ListAgentsRequest) (*dto.ListAgentsResponse, error)
 	UpdateAgent(ctx context.Context, req *dto.UpdateAgentRequest) (*dto.UpdateAgentResponse, error)
 	DeleteAgent(ctx context.Context, req *dto.DeleteAgentRequest) (*dto.DeleteAgentResponse, error)
+	StreamModuleLogs(ctx context.Context, req *dto.StreamModuleLogsRequest) (*dto.StreamModuleLogsResponse, error)
+	ExecModule(ctx context.Context, req *dto.ExecModuleRequest) (*dto.ExecModuleResponse, error)
 }
 
 type WebhookService interface {
@@ -20,6 +22,17 @@ type WebhookService interface {
 	DeleteWebhook(ctx context.Context, req *dto.DeleteWebhookRequest) (*dto.DeleteWebhookResponse, error)
 }
 
+type MessageService interface {
+	GetMessage(ctx context.Context, req *dto.GetMessageRequest) (*dto.GetMessageResponse, error)
+}
+
+type SecretService interface {
+	CreateSecret(ctx context.Context, req *dto.CreateSecretRequest) (*dto.CreateSecretResponse, error)
+	ListSecrets(ctx context.Context, req *dto.ListSecretsRequest) (*dto.ListSecretsResponse, error)
+	UpdateSecret(ctx context.Context, req *dto.UpdateSecretRequest) (*dto.UpdateSecretResponse, error)
+	DeleteSecret(ctx context.Context, req *dto.DeleteSecretRequest) (*dto.DeleteSecretResponse, error)
+}
+
 type EnrollmentService interface {
 	CreateEnrollment(ctx context.Context, req *dto.CreateEnrollmentRequest) (*dto.CreateEnrollmentResponse, error)
 	GetEnrollment(ctx context.Context, req *dto.GetEnrollmentRequest) (*dto.GetEnrollmentResponse, error)
@@ -28,6 +41,8 @@ type EnrollmentService interface {
 
 type ImageService interface {
 	UploadImage(ctx context.Context, req *dto.UploadImageRequest) (*dto.UploadImageResponse, error)
+	RegisterImage(ctx context.Context, req *dto.RegisterImageRequest) (*dto.RegisterImageResponse, error)
+	GetSigningKey(ctx context.Context, req *dto.GetImageSigningKeyRequest) (*dto.GetImageSigningKeyResponse, error)
 	GetImage(ctx context.Context, req *dto.GetImageRequest) (*dto.GetImageResponse, error)
 	ListImages(ctx context.Context, req *dto.ListImagesRequest) (*dto.ListImagesResponse, error)
 	DeleteImage(ctx context.Context, req *dto.DeleteImageRequest) (*dto.DeleteImageResponse, error)
@@ -41,5 +56,8 @@ type ModuleService interface {
 	DeleteModule(ctx context.Context, req *dto.DeleteModuleRequest) (*dto.DeleteModuleResponse, error)
 	StartModule(ctx context.Context, req *dto.StartModuleRequest) (*dto.StartModuleResponse, error)
 	StopModule(ctx context.Context, req *dto.StopModuleRequest) (*dto.StopModuleResponse, error)
+	GetRollout(ctx context.Context, req *dto.GetModuleRolloutRequest) (*dto.GetModuleRolloutResponse, error)
+	ListRevisions(ctx context.Context, req *dto.ListModuleRevisionsRequest) (*dto.ListModuleRevisionsResponse, error)
+	RollbackModule(ctx context.Context, req *dto.RollbackModuleRequest) (*dto.RollbackModuleResponse, error)
 	SendData(ctx context.Context, req *dto.SendDataRequest) (*dto.SendDataResponse, error)
 }
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	"github.com/pajtaand/dmap-zero/internal/common/utils"
+	"github.com/pajtaand/dmap-zero/internal/controller/dto"
+	"github.com/pajtaand/dmap-zero/internal/controller/rest/models"
+	"github.com/rs/zerolog"
+)
+
+type messageHandler struct {
+	service MessageService
+}
+
+func NewMessageHandler(service MessageService) *messageHandler {
+	return &messageHandler{
+		service: service,
+	}
+}
+
+func (h *messageHandler) GetMessage(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	messageID := chi.URLParam(r, "messageID")
+	if messageID == "" {
+		log.Info().Msg("messageID is empty")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	message, err := h.service.GetMessage(r.Context(), &dto.GetMessageRequest{
+		ID: messageID,
+	})
+	if err != nil {
+		if errors.Is(err, errs.ErrNotFound) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusNotFound, fmt.Errorf("message with id '%s' doesn't exists", messageID))
+			return
+		}
+		panic(err)
+	}
+
+	utils.WriteResponse(w, http.StatusOK, &models.GetMessageResponse{
+		ID:            message.ID,
+		Direction:     message.Direction,
+		ModuleID:      message.ModuleID,
+		Receiver:      message.Receiver,
+		SourceAgentID: message.SourceAgentID,
+		CreatedAt:     message.CreatedAt,
+		Recipients:    deliveryRecipientsFromDTO(message.Recipients),
+	})
+}
+
+func deliveryRecipientsFromDTO(recipients []dto.DeliveryRecipient) []models.DeliveryRecipient {
+	res := []models.DeliveryRecipient{}
+	for _, recipient := range recipients {
+		res = append(res, models.DeliveryRecipient{
+			AgentID:  recipient.AgentID,
+			ModuleID: recipient.ModuleID,
+			Outcome:  recipient.Outcome,
+			Error:    recipient.Error,
+		})
+	}
+	return res
+}
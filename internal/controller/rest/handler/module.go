@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
@@ -37,8 +38,23 @@ func (h *moduleHandler) CreateModule(w http.ResponseWriter, r *http.Request) {
 		Name:          req.Name,
 		Image:         req.Image,
 		Configuration: req.Configuration,
+		Resources:     resourcesFromModel(req.Resources),
+		Security:      securityFromModel(req.Security),
+		Storage:       storageFromModel(req.Storage),
+		Placement:     placementFromModel(req.Placement),
+		RestartPolicy: restartPolicyFromModel(req.RestartPolicy),
 	})
 	if err != nil {
+		if errors.Is(err, errs.ErrInvalid) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, errs.ErrNotAllowed) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusUnprocessableEntity, errors.New("module refers to a secret that doesn't exist"))
+			return
+		}
 		panic(err)
 	}
 
@@ -73,7 +89,14 @@ func (h *moduleHandler) GetModule(w http.ResponseWriter, r *http.Request) {
 		Name:          module.Name,
 		Image:         module.Image,
 		Configuration: module.Configuration,
+		Resources:     resourcesToModel(module.Resources),
+		Security:      securityToModel(module.Security),
+		Storage:       storageToModel(module.Storage),
+		Placement:     placementToModel(module.Placement),
+		RestartPolicy: restartPolicyToModel(module.RestartPolicy),
 		IsRunning:     module.IsRunning,
+		Revision:      module.Revision,
+		AgentStatuses: module.AgentStatuses,
 	})
 }
 
@@ -90,6 +113,11 @@ func (h *moduleHandler) ListModules(w http.ResponseWriter, r *http.Request) {
 			Name:          module.Name,
 			Image:         module.Image,
 			Configuration: module.Configuration,
+			Resources:     resourcesToModel(module.Resources),
+			Security:      securityToModel(module.Security),
+			Storage:       storageToModel(module.Storage),
+			Placement:     placementToModel(module.Placement),
+			RestartPolicy: restartPolicyToModel(module.RestartPolicy),
 			IsRunning:     module.IsRunning,
 		})
 	}
@@ -120,12 +148,33 @@ func (h *moduleHandler) UpdateModule(w http.ResponseWriter, r *http.Request) {
 		Name:          req.Name,
 		Image:         req.Image,
 		Configuration: req.Configuration,
+		Resources:     resourcesFromModel(req.Resources),
+		Security:      securityFromModel(req.Security),
+		Storage:       storageFromModel(req.Storage),
+		Placement:     placementFromModel(req.Placement),
+		RestartPolicy: restartPolicyFromModel(req.RestartPolicy),
+		Rollout:       rolloutStrategyFromModel(req.Rollout),
 	}); err != nil {
+		if errors.Is(err, errs.ErrInvalid) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err)
+			return
+		}
 		if errors.Is(err, errs.ErrNotFound) {
 			log.Error().Err(err).Msg("")
 			utils.WriteErrorResponse(w, http.StatusNotFound, fmt.Errorf("module with id '%s' doesn't exists", moduleID))
 			return
 		}
+		if errors.Is(err, errs.ErrConflict) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusConflict, fmt.Errorf("module with id '%s' is being rolled out", moduleID))
+			return
+		}
+		if errors.Is(err, errs.ErrNotAllowed) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusUnprocessableEntity, errors.New("module refers to a secret that doesn't exist"))
+			return
+		}
 		panic(err)
 	}
 
@@ -204,6 +253,133 @@ func (h *moduleHandler) StopModule(w http.ResponseWriter, r *http.Request) {
 	utils.WriteResponse(w, http.StatusOK, nil)
 }
 
+func (h *moduleHandler) GetRollout(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	moduleID := chi.URLParam(r, "moduleID")
+	if moduleID == "" {
+		log.Info().Msg("moduleID is empty")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	rollout, err := h.service.GetRollout(r.Context(), &dto.GetModuleRolloutRequest{
+		ID: moduleID,
+	})
+	if err != nil {
+		if errors.Is(err, errs.ErrNotFound) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusNotFound, fmt.Errorf("module with id '%s' doesn't exists or was never rolled out", moduleID))
+			return
+		}
+		panic(err)
+	}
+
+	utils.WriteResponse(w, http.StatusOK, models.GetModuleRolloutResponse{
+		ID:             rollout.ID,
+		FromRevision:   rollout.FromRevision,
+		ToRevision:     rollout.ToRevision,
+		Strategy:       rolloutStrategyToModel(rollout.Strategy),
+		Batches:        rollout.Batches,
+		CurrentBatch:   rollout.CurrentBatch,
+		State:          rollout.State,
+		Message:        rollout.Message,
+		AgentStatuses:  rollout.AgentStatuses,
+		StartedAt:      rollout.StartedAt,
+		BatchStartedAt: rollout.BatchStartedAt,
+		FinishedAt:     rollout.FinishedAt,
+	})
+}
+
+func (h *moduleHandler) ListRevisions(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	moduleID := chi.URLParam(r, "moduleID")
+	if moduleID == "" {
+		log.Info().Msg("moduleID is empty")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	revisions, err := h.service.ListRevisions(r.Context(), &dto.ListModuleRevisionsRequest{
+		ID: moduleID,
+	})
+	if err != nil {
+		if errors.Is(err, errs.ErrNotFound) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusNotFound, fmt.Errorf("module with id '%s' doesn't exists", moduleID))
+			return
+		}
+		panic(err)
+	}
+
+	revisionList := []models.ModuleRevision{}
+	for _, revision := range revisions.Revisions {
+		revisionList = append(revisionList, models.ModuleRevision{
+			Revision:      revision.Revision,
+			Image:         revision.Image,
+			Configuration: revision.Configuration,
+			Resources:     resourcesToModel(revision.Resources),
+			Security:      securityToModel(revision.Security),
+			Storage:       storageToModel(revision.Storage),
+			Placement:     placementToModel(revision.Placement),
+			ChangedBy:     revision.ChangedBy,
+			Message:       revision.Message,
+			CreatedAt:     revision.CreatedAt,
+			Removed:       revision.Removed,
+		})
+	}
+	utils.WriteResponse(w, http.StatusOK, models.ListModuleRevisionsResponse{
+		Revision:  revisions.Revision,
+		Revisions: revisionList,
+	})
+}
+
+func (h *moduleHandler) RollbackModule(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	moduleID := chi.URLParam(r, "moduleID")
+	if moduleID == "" {
+		log.Info().Msg("moduleID is empty")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	revision, err := strconv.Atoi(r.URL.Query().Get("revision"))
+	if err != nil || revision < 1 {
+		log.Info().Msg("Missing or invalid query parameter: revision")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	rollback, err := h.service.RollbackModule(r.Context(), &dto.RollbackModuleRequest{
+		ID:       moduleID,
+		Revision: revision,
+	})
+	if err != nil {
+		if errors.Is(err, errs.ErrNotFound) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusNotFound, fmt.Errorf("module with id '%s' or its revision %d doesn't exists", moduleID, revision))
+			return
+		}
+		if errors.Is(err, errs.ErrConflict) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusConflict, fmt.Errorf("module with id '%s' is being rolled out", moduleID))
+			return
+		}
+		if errors.Is(err, errs.ErrNotAllowed) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusUnprocessableEntity, fmt.Errorf("image or secrets of revision %d no longer exist", revision))
+			return
+		}
+		panic(err)
+	}
+
+	utils.WriteResponse(w, http.StatusOK, models.RollbackModuleResponse{
+		Revision: rollback.Revision,
+	})
+}
+
 func (h *moduleHandler) SendData(w http.ResponseWriter, r *http.Request) {
 	log := zerolog.Ctx(r.Context())
 
@@ -221,17 +397,228 @@ func (h *moduleHandler) SendData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := h.service.SendData(r.Context(), &dto.SendDataRequest{
+	request := &dto.SendDataRequest{
 		ModuleID: moduleID,
 		Data:     req.Data,
-	}); err != nil {
+	}
+	if req.Target != nil {
+		request.Target = &dto.SendDataTarget{
+			AgentID:  req.Target.AgentID,
+			Selector: req.Target.Selector,
+			Any:      req.Target.Any,
+		}
+	}
+	resp, err := h.service.SendData(r.Context(), request)
+	if err != nil {
 		if errors.Is(err, errs.ErrNotFound) {
 			log.Error().Err(err).Msg("")
+			if request.Target != nil && request.Target.AgentID != "" {
+				utils.WriteErrorResponse(w, http.StatusNotFound, fmt.Errorf("module with id '%s' or agent with id '%s' doesn't exists", moduleID, request.Target.AgentID))
+				return
+			}
 			utils.WriteErrorResponse(w, http.StatusNotFound, fmt.Errorf("module with id '%s' doesn't exists", moduleID))
 			return
 		}
+		if errors.Is(err, errs.ErrConflict) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusConflict, fmt.Errorf("no connected agent runs module with id '%s'", moduleID))
+			return
+		}
 		panic(err)
 	}
 
-	utils.WriteResponse(w, http.StatusOK, nil)
+	utils.WriteResponse(w, http.StatusOK, &models.SendDataResponse{
+		MessageID:  resp.MessageID,
+		Recipients: deliveryRecipientsFromDTO(resp.Recipients),
+	})
+}
+
+func placementFromModel(placement *models.ModulePlacement) *dto.ModulePlacement {
+	if placement == nil {
+		return nil
+	}
+	return &dto.ModulePlacement{
+		All:      placement.All,
+		AgentIDs: placement.AgentIDs,
+		Selector: placement.Selector,
+	}
+}
+
+func placementToModel(placement *dto.ModulePlacement) *models.ModulePlacement {
+	if placement == nil {
+		return nil
+	}
+	return &models.ModulePlacement{
+		All:      placement.All,
+		AgentIDs: placement.AgentIDs,
+		Selector: placement.Selector,
+	}
+}
+
+func restartPolicyFromModel(restartPolicy *models.ModuleRestartPolicy) *dto.ModuleRestartPolicy {
+	if restartPolicy == nil {
+		return nil
+	}
+	return &dto.ModuleRestartPolicy{
+		Policy:     restartPolicy.Policy,
+		MaxRetries: restartPolicy.MaxRetries,
+	}
+}
+
+func restartPolicyToModel(restartPolicy *dto.ModuleRestartPolicy) *models.ModuleRestartPolicy {
+	if restartPolicy == nil {
+		return nil
+	}
+	return &models.ModuleRestartPolicy{
+		Policy:     restartPolicy.Policy,
+		MaxRetries: restartPolicy.MaxRetries,
+	}
+}
+
+func rolloutStrategyFromModel(strategy *models.ModuleRolloutStrategy) *dto.ModuleRolloutStrategy {
+	if strategy == nil {
+		return nil
+	}
+	return &dto.ModuleRolloutStrategy{
+		MaxUnavailable:   strategy.MaxUnavailable,
+		CanaryPercentage: strategy.CanaryPercentage,
+		ProgressDeadline: strategy.ProgressDeadline,
+	}
+}
+
+func rolloutStrategyToModel(strategy *dto.ModuleRolloutStrategy) *models.ModuleRolloutStrategy {
+	if strategy == nil {
+		return nil
+	}
+	return &models.ModuleRolloutStrategy{
+		MaxUnavailable:   strategy.MaxUnavailable,
+		CanaryPercentage: strategy.CanaryPercentage,
+		ProgressDeadline: strategy.ProgressDeadline,
+	}
+}
+
+func resourcesFromModel(resources *models.ModuleResources) *dto.ModuleResources {
+	if resources == nil {
+		return nil
+	}
+	return &dto.ModuleResources{
+		CPUs:        resources.CPUs,
+		MemoryBytes: resources.MemoryBytes,
+		PidsLimit:   resources.PidsLimit,
+	}
+}
+
+func resourcesToModel(resources *dto.ModuleResources) *models.ModuleResources {
+	if resources == nil {
+		return nil
+	}
+	return &models.ModuleResources{
+		CPUs:        resources.CPUs,
+		MemoryBytes: resources.MemoryBytes,
+		PidsLimit:   resources.PidsLimit,
+	}
+}
+
+func securityFromModel(security *models.ModuleSecurity) *dto.ModuleSecurity {
+	if security == nil {
+		return nil
+	}
+	return &dto.ModuleSecurity{
+		ReadOnlyRootfs:  security.ReadOnlyRootfs,
+		User:            security.User,
+		CapAdd:          security.CapAdd,
+		CapDrop:         security.CapDrop,
+		SeccompProfile:  security.SeccompProfile,
+		NoNewPrivileges: security.NoNewPrivileges,
+		Privileged:      security.Privileged,
+		HostNetwork:     security.HostNetwork,
+		Tmpfs:           security.Tmpfs,
+	}
+}
+
+func securityToModel(security *dto.ModuleSecurity) *models.ModuleSecurity {
+	if security == nil {
+		return nil
+	}
+	return &models.ModuleSecurity{
+		ReadOnlyRootfs:  security.ReadOnlyRootfs,
+		User:            security.User,
+		CapAdd:          security.CapAdd,
+		CapDrop:         security.CapDrop,
+		SeccompProfile:  security.SeccompProfile,
+		NoNewPrivileges: security.NoNewPrivileges,
+		Privileged:      security.Privileged,
+		HostNetwork:     security.HostNetwork,
+		Tmpfs:           security.Tmpfs,
+	}
+}
+
+func storageFromModel(storage *models.ModuleStorage) *dto.ModuleStorage {
+	if storage == nil {
+		return nil
+	}
+	volumes := make([]*dto.ModuleVolume, 0, len(storage.Volumes))
+	for _, volume := range storage.Volumes {
+		volumes = append(volumes, &dto.ModuleVolume{
+			Name:      volume.Name,
+			Path:      volume.Path,
+			ReadOnly:  volume.ReadOnly,
+			Retention: volume.Retention,
+		})
+	}
+	bindMounts := make([]*dto.ModuleBindMount, 0, len(storage.BindMounts))
+	for _, bind := range storage.BindMounts {
+		bindMounts = append(bindMounts, &dto.ModuleBindMount{
+			HostPath: bind.HostPath,
+			Path:     bind.Path,
+			ReadOnly: bind.ReadOnly,
+		})
+	}
+	secrets := make([]*dto.ModuleSecretMount, 0, len(storage.Secrets))
+	for _, secret := range storage.Secrets {
+		secrets = append(secrets, &dto.ModuleSecretMount{
+			Secret: secret.Secret,
+			Path:   secret.Path,
+		})
+	}
+	return &dto.ModuleStorage{
+		Volumes:    volumes,
+		BindMounts: bindMounts,
+		Secrets:    secrets,
+	}
+}
+
+func storageToModel(storage *dto.ModuleStorage) *models.ModuleStorage {
+	if storage == nil {
+		return nil
+	}
+	volumes := make([]*models.ModuleVolume, 0, len(storage.Volumes))
+	for _, volume := range storage.Volumes {
+		volumes = append(volumes, &models.ModuleVolume{
+			Name:      volume.Name,
+			Path:      volume.Path,
+			ReadOnly:  volume.ReadOnly,
+			Retention: volume.Retention,
+		})
+	}
+	bindMounts := make([]*models.ModuleBindMount, 0, len(storage.BindMounts))
+	for _, bind := range storage.BindMounts {
+		bindMounts = append(bindMounts, &models.ModuleBindMount{
+			HostPath: bind.HostPath,
+			Path:     bind.Path,
+			ReadOnly: bind.ReadOnly,
+		})
+	}
+	secrets := make([]*models.ModuleSecretMount, 0, len(storage.Secrets))
+	for _, secret := range storage.Secrets {
+		secrets = append(secrets, &models.ModuleSecretMount{
+			Secret: secret.Secret,
+			Path:   secret.Path,
+		})
+	}
+	return &models.ModuleStorage{
+		Volumes:    volumes,
+		BindMounts: bindMounts,
+		Secrets:    secrets,
+	}
 }
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	"github.com/pajtaand/dmap-zero/internal/common/utils"
+	"github.com/pajtaand/dmap-zero/internal/controller/dto"
+	"github.com/pajtaand/dmap-zero/internal/controller/rest/models"
+	"github.com/rs/zerolog"
+)
+
+type secretHandler struct {
+	service SecretService
+}
+
+func NewSecretHandler(service SecretService) *secretHandler {
+	return &secretHandler{
+		service: service,
+	}
+}
+
+func (h *secretHandler) CreateSecret(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	req := &models.CreateSecretRequest{}
+	if err := req.FromHttpRequest(r); err != nil {
+		log.Error().Err(err).Msg("")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	if _, err := h.service.CreateSecret(r.Context(), &dto.CreateSecretRequest{
+		Name:  req.Name,
+		Value: []byte(req.Value),
+	}); err != nil {
+		if errors.Is(err, errs.ErrConflict) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusConflict, fmt.Errorf("secret with name '%s' already exists", req.Name))
+			return
+		}
+		if errors.Is(err, errs.ErrNotAllowed) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusBadRequest, fmt.Errorf("secret name '%s' is invalid", req.Name))
+			return
+		}
+		panic(err)
+	}
+
+	utils.WriteResponse(w, http.StatusCreated, nil)
+}
+
+func (h *secretHandler) ListSecrets(w http.ResponseWriter, r *http.Request) {
+	secrets, err := h.service.ListSecrets(r.Context(), &dto.ListSecretsRequest{})
+	if err != nil {
+		panic(err)
+	}
+
+	secretList := []models.Secret{}
+	for _, secret := range secrets.Secrets {
+		secretList = append(secretList, models.Secret{
+			Name:      secret.Name,
+			CreatedAt: secret.CreatedAt,
+			UpdatedAt: secret.UpdatedAt,
+		})
+	}
+	utils.WriteResponse(w, http.StatusOK, models.ListSecretsResponse{
+		Secrets: secretList,
+	})
+}
+
+func (h *secretHandler) UpdateSecret(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		log.Info().Msg("name is empty")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	req := &models.UpdateSecretRequest{}
+	if err := req.FromHttpRequest(r); err != nil {
+		log.Error().Err(err).Msg("")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	if _, err := h.service.UpdateSecret(r.Context(), &dto.UpdateSecretRequest{
+		Name:  name,
+		Value: []byte(req.Value),
+	}); err != nil {
+		if errors.Is(err, errs.ErrNotFound) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusNotFound, fmt.Errorf("secret with name '%s' doesn't exists", name))
+			return
+		}
+		panic(err)
+	}
+
+	utils.WriteResponse(w, http.StatusNoContent, nil)
+}
+
+func (h *secretHandler) DeleteSecret(w http.ResponseWriter, r *http.Request) {
+	log := zerolog.Ctx(r.Context())
+
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		log.Info().Msg("name is empty")
+		utils.WriteErrorResponse(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	if _, err := h.service.DeleteSecret(r.Context(), &dto.DeleteSecretRequest{
+		Name: name,
+	}); err != nil {
+		if errors.Is(err, errs.ErrNotFound) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusNotFound, fmt.Errorf("secret with name '%s' doesn't exists", name))
+			return
+		}
+		if errors.Is(err, errs.ErrConflict) {
+			log.Error().Err(err).Msg("")
+			utils.WriteErrorResponse(w, http.StatusConflict, fmt.Errorf("secret with name '%s' is still in use", name))
+			return
+		}
+		panic(err)
+	}
+
+	utils.WriteResponse(w, http.StatusNoContent, nil)
+}
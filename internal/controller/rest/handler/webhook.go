@@ -61,7 +61,8 @@ func (h *webhookHandler) RegisterWebhook(w http.ResponseWriter, r *http.Request)
 	}
 
 	utils.WriteResponse(w, http.StatusCreated, &models.WebhookRegistrationResponse{
-		ID: resp.ID,
+		ID:     resp.ID,
+		Secret: resp.Secret,
 	})
 }
 
@@ -18,6 +18,8 @@ type AgentHandler interface {
 	GetAgent(w http.ResponseWriter, r *http.Request)
 	UpdateAgent(w http.ResponseWriter, r *http.Request)
 	DeleteAgent(w http.ResponseWriter, r *http.Request)
+	StreamModuleLogs(w http.ResponseWriter, r *http.Request)
+	ExecModule(w http.ResponseWriter, r *http.Request)
 }
 
 type ModuleHandler interface {
@@ -28,11 +30,16 @@ type ModuleHandler interface {
 	DeleteModule(w http.ResponseWriter, r *http.Request)
 	StartModule(w http.ResponseWriter, r *http.Request)
 	StopModule(w http.ResponseWriter, r *http.Request)
+	GetRollout(w http.ResponseWriter, r *http.Request)
+	ListRevisions(w http.ResponseWriter, r *http.Request)
+	RollbackModule(w http.ResponseWriter, r *http.Request)
 	SendData(w http.ResponseWriter, r *http.Request)
 }
 
 type ImageHandler interface {
 	UploadImage(w http.ResponseWriter, r *http.Request)
+	RegisterImage(w http.ResponseWriter, r *http.Request)
+	GetSigningKey(w http.ResponseWriter, r *http.Request)
 	ListImages(w http.ResponseWriter, r *http.Request)
 	GetImage(w http.ResponseWriter, r *http.Request)
 	DeleteImage(w http.ResponseWriter, r *http.Request)
@@ -44,6 +51,17 @@ type WebhookHandler interface {
 	DeleteWebhook(w http.ResponseWriter, r *http.Request)
 }
 
+type MessageHandler interface {
+	GetMessage(w http.ResponseWriter, r *http.Request)
+}
+
+type SecretHandler interface {
+	CreateSecret(w http.ResponseWriter, r *http.Request)
+	ListSecrets(w http.ResponseWriter, r *http.Request)
+	UpdateSecret(w http.ResponseWriter, r *http.Request)
+	DeleteSecret(w http.ResponseWriter, r *http.Request)
+}
+
 type EnrollmentHandler interface {
 	GetEnrollment(w http.ResponseWriter, r *http.Request)
 	CreateEnrollment(w http.ResponseWriter, r *http.Request)
@@ -10,6 +10,7 @@ import (
 type CreateAgentRequest struct {
 	Name          string
 	Configuration map[string]string
+	Labels        map[string]string
 }
 
 func (req *CreateAgentRequest) FromHttpRequest(r *http.Request) error {
@@ -22,6 +23,9 @@ func (req *CreateAgentRequest) FromHttpRequest(r *http.Request) error {
 	if err := utils.CheckNotNil(req, "Configuration"); err != nil {
 		return err
 	}
+	if err := utils.ValidateLabels(req.Labels); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -1,10 +1,26 @@
 package models
 
+type AgentDrift struct {
+	InSync            bool
+	MissingImages     []string
+	UnexpectedImages  []string
+	MissingModules    []string
+	UnexpectedModules []string
+}
+
 type GetAgentResponse struct {
-	Name           string
-	Configuration  map[string]string
-	IsEnrolled     bool
-	IsOnline       bool
-	PresentImages  []string
-	PresentModules []string
+	Name            string
+	Configuration   map[string]string
+	Labels          map[string]string
+	IsEnrolled      bool
+	IsOnline        bool
+	PresentImages   []string
+	RejectedImages  map[string]string
+	RejectedModules map[string]string
+	VolumeUsage     map[string]map[string]int64
+	PresentModules  []string
+	ModuleStatuses  map[string]string
+	ModuleRestarts  map[string]int
+	Subscriptions   map[string][]string // subscribed module IDs by topic
+	Drift           *AgentDrift
 }
@@ -1,13 +1,20 @@
 package models
 
 type ListAgentsResponseAgent struct {
-	ID             string
-	Name           string
-	Configuration  map[string]string
-	IsEnrolled     bool
-	IsOnline       bool
-	PresentImages  []string
-	PresentModules []string
+	ID              string
+	Name            string
+	Configuration   map[string]string
+	Labels          map[string]string
+	IsEnrolled      bool
+	IsOnline        bool
+	PresentImages   []string
+	RejectedImages  map[string]string
+	RejectedModules map[string]string
+	VolumeUsage     map[string]map[string]int64
+	PresentModules  []string
+	ModuleStatuses  map[string]string
+	ModuleRestarts  map[string]int
+	Subscriptions   map[string][]string
 }
 
 type ListAgentsResponse struct {
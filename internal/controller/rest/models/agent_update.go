@@ -10,6 +10,7 @@ import (
 type UpdateAgentRequest struct {
 	Name          string
 	Configuration map[string]string
+	Labels        map[string]string
 }
 
 func (req *UpdateAgentRequest) FromHttpRequest(r *http.Request) error {
@@ -22,5 +23,8 @@ func (req *UpdateAgentRequest) FromHttpRequest(r *http.Request) error {
 	if err := utils.CheckNotNil(req, "Configuration"); err != nil {
 		return err
 	}
+	if err := utils.ValidateLabels(req.Labels); err != nil {
+		return err
+	}
 	return nil
 }
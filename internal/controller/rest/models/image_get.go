@@ -1,6 +1,12 @@
 package models
 
 type GetImageResponse struct {
-	Name string
-	Size int
+	Name          string
+	Size          int
+	Digest        string
+	Source        string
+	Reference     string
+	Platform      string
+	Status        string
+	StatusMessage string
 }
@@ -1,9 +1,15 @@
 package models
 
 type ListImagesResponseImage struct {
-	ID   string
-	Name string
-	Size int
+	ID            string
+	Name          string
+	Size          int
+	Digest        string
+	Source        string
+	Reference     string
+	Platform      string
+	Status        string
+	StatusMessage string
 }
 
 type ListImagesResponse struct {
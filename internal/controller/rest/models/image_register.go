@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/pajtaand/dmap-zero/internal/common/registry"
+	"github.com/pajtaand/dmap-zero/internal/common/utils"
+)
+
+type RegisterImageRequest struct {
+	Name      string
+	Reference string
+	Platform  string
+	Insecure  bool
+	Username  string
+	Password  string
+}
+
+func (req *RegisterImageRequest) FromHttpRequest(r *http.Request) error {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return err
+	}
+	if err := utils.CheckStringNotEmpty(req, "Name"); err != nil {
+		return err
+	}
+	if err := utils.CheckStringNotEmpty(req, "Reference"); err != nil {
+		return err
+	}
+	if _, err := registry.ParseReference(req.Reference); err != nil {
+		return fmt.Errorf("field 'Reference' is invalid: %v", err)
+	}
+	if req.Platform != "" {
+		if _, err := registry.ParsePlatform(req.Platform); err != nil {
+			return fmt.Errorf("field 'Platform' is invalid: %v", err)
+		}
+	}
+	if req.Username == "" && req.Password != "" {
+		return errors.New("field 'Username' must not be empty when 'Password' is set")
+	}
+	return nil
+}
+
+type RegisterImageResponse struct {
+	ID string
+}
@@ -0,0 +1,5 @@
+package models
+
+type GetImageSigningKeyResponse struct {
+	PublicKey string
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type DeliveryRecipient struct {
+	AgentID  string
+	ModuleID string
+	Outcome  string
+	Error    string
+}
+
+type GetMessageResponse struct {
+	ID            string
+	Direction     string
+	ModuleID      string
+	Receiver      string
+	SourceAgentID string
+	CreatedAt     time.Time
+	Recipients    []DeliveryRecipient
+}
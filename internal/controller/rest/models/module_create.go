@@ -11,6 +11,11 @@ type CreateModuleRequest struct {
 	Name          string
 	Image         string
 	Configuration map[string]string
+	Resources     *ModuleResources
+	Security      *ModuleSecurity
+	Storage       *ModuleStorage
+	Placement     *ModulePlacement
+	RestartPolicy *ModuleRestartPolicy
 }
 
 func (req *CreateModuleRequest) FromHttpRequest(r *http.Request) error {
@@ -26,6 +31,26 @@ func (req *CreateModuleRequest) FromHttpRequest(r *http.Request) error {
 	if err := utils.CheckNotNil(req, "Configuration"); err != nil {
 		return err
 	}
+	if req.Resources != nil {
+		if err := req.Resources.Validate(); err != nil {
+			return err
+		}
+	}
+	if req.Security != nil {
+		if err := req.Security.Validate(); err != nil {
+			return err
+		}
+	}
+	if req.Storage != nil {
+		if err := req.Storage.Validate(); err != nil {
+			return err
+		}
+	}
+	if req.RestartPolicy != nil {
+		if err := req.RestartPolicy.Validate(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
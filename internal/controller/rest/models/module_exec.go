@@ -0,0 +1,60 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	ExecMessageResize     = "resize"
+	ExecMessageCloseStdin = "close-stdin"
+	ExecMessageExit       = "exit"
+)
+
+var defaultExecCommand = []string{"/bin/sh"}
+
+type ExecModuleRequest struct {
+	Command []string
+	Tty     bool
+	Rows    uint32
+	Cols    uint32
+}
+
+func (req *ExecModuleRequest) FromHttpRequest(r *http.Request) error {
+	query := r.URL.Query()
+
+	req.Command = query["command"]
+	if len(req.Command) == 0 {
+		req.Command = defaultExecCommand
+	}
+
+	req.Tty = true
+	if s := query.Get("tty"); s != "" {
+		tty, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("tty must be boolean: '%s'", s)
+		}
+		req.Tty = tty
+	}
+
+	for field, value := range map[string]*uint32{"rows": &req.Rows, "cols": &req.Cols} {
+		if s := query.Get(field); s != "" {
+			n, err := strconv.ParseUint(s, 10, 16)
+			if err != nil {
+				return fmt.Errorf("%s must be number of characters: '%s'", field, s)
+			}
+			*value = uint32(n)
+		}
+	}
+	return nil
+}
+
+// ExecMessage is the control message of an exec session sent as websocket text message, the
+// input and output of the command are sent as binary messages.
+type ExecMessage struct {
+	Type     string
+	Rows     uint32
+	Cols     uint32
+	ExitCode int
+}
@@ -4,5 +4,12 @@ type GetModuleResponse struct {
 	Name          string
 	Image         string
 	Configuration map[string]string
+	Resources     *ModuleResources
+	Security      *ModuleSecurity
+	Storage       *ModuleStorage
+	Placement     *ModulePlacement
+	RestartPolicy *ModuleRestartPolicy
 	IsRunning     bool
+	Revision      int
+	AgentStatuses map[string]string
 }
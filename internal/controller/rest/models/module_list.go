@@ -5,6 +5,11 @@ type ListModulesResponseModule struct {
 	Name          string
 	Image         string
 	Configuration map[string]string
+	Resources     *ModuleResources
+	Security      *ModuleSecurity
+	Storage       *ModuleStorage
+	Placement     *ModulePlacement
+	RestartPolicy *ModuleRestartPolicy
 	IsRunning     bool
 }
 
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type StreamModuleLogsRequest struct {
+	Since      string
+	Tail       string
+	Follow     bool
+	Timestamps bool
+}
+
+func (req *StreamModuleLogsRequest) FromHttpRequest(r *http.Request) error {
+	query := r.URL.Query()
+
+	req.Since = query.Get("since")
+	if req.Since != "" {
+		if _, err := time.Parse(time.RFC3339, req.Since); err != nil {
+			if _, err := time.ParseDuration(req.Since); err != nil {
+				return fmt.Errorf("since must be RFC 3339 timestamp or duration: '%s'", req.Since)
+			}
+		}
+	}
+
+	req.Tail = query.Get("tail")
+	if req.Tail != "" && req.Tail != "all" {
+		if n, err := strconv.Atoi(req.Tail); err != nil || n < 0 {
+			return fmt.Errorf("tail must be non-negative number or 'all': '%s'", req.Tail)
+		}
+	}
+
+	for field, value := range map[string]*bool{"follow": &req.Follow, "timestamps": &req.Timestamps} {
+		if s := query.Get(field); s != "" {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return fmt.Errorf("%s must be boolean: '%s'", field, s)
+			}
+			*value = b
+		}
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+package models
+
+type ModulePlacement struct {
+	All      bool
+	AgentIDs []string
+	Selector string
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+)
+
+type ModuleRestartPolicy struct {
+	Policy     string
+	MaxRetries int
+}
+
+func (p *ModuleRestartPolicy) Validate() error {
+	switch p.Policy {
+	case constants.ModuleRestartPolicyNever, constants.ModuleRestartPolicyOnFailure, constants.ModuleRestartPolicyAlways:
+	default:
+		return fmt.Errorf("field 'RestartPolicy' has unknown policy: '%s'", p.Policy)
+	}
+	if p.MaxRetries < 0 {
+		return errors.New("field 'RestartPolicy' must not have negative MaxRetries")
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+type ModuleRevision struct {
+	Revision      int
+	Image         string
+	Configuration map[string]string
+	Resources     *ModuleResources
+	Security      *ModuleSecurity
+	Storage       *ModuleStorage
+	Placement     *ModulePlacement
+	ChangedBy     string
+	Message       string
+	CreatedAt     time.Time
+	Removed       bool
+}
+
+type ListModuleRevisionsResponse struct {
+	Revision  int
+	Revisions []ModuleRevision
+}
+
+type RollbackModuleResponse struct {
+	Revision int
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+type ModuleRolloutStrategy struct {
+	MaxUnavailable   int
+	CanaryPercentage int
+	ProgressDeadline int
+}
+
+func (s *ModuleRolloutStrategy) Validate() error {
+	if s.MaxUnavailable < 0 {
+		return errors.New("field 'Rollout' must not have negative MaxUnavailable")
+	}
+	if s.CanaryPercentage < 0 || s.CanaryPercentage > 100 {
+		return errors.New("field 'Rollout' must have CanaryPercentage between 0 and 100")
+	}
+	if s.ProgressDeadline < 0 {
+		return errors.New("field 'Rollout' must not have negative ProgressDeadline")
+	}
+	return nil
+}
+
+type GetModuleRolloutResponse struct {
+	ID             string
+	FromRevision   int
+	ToRevision     int
+	Strategy       *ModuleRolloutStrategy
+	Batches        [][]string
+	CurrentBatch   int
+	State          string
+	Message        string
+	AgentStatuses  map[string]string
+	StartedAt      time.Time
+	BatchStartedAt time.Time
+	FinishedAt     time.Time
+}
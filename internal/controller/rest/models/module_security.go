@@ -0,0 +1,41 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"path"
+)
+
+type ModuleResources struct {
+	CPUs        float64
+	MemoryBytes int64
+	PidsLimit   int64
+}
+
+func (r *ModuleResources) Validate() error {
+	if r.CPUs < 0 || r.MemoryBytes < 0 || r.PidsLimit < 0 {
+		return errors.New("field 'Resources' must not have negative limits")
+	}
+	return nil
+}
+
+type ModuleSecurity struct {
+	ReadOnlyRootfs  bool
+	User            string
+	CapAdd          []string
+	CapDrop         []string
+	SeccompProfile  string
+	NoNewPrivileges bool
+	Privileged      bool
+	HostNetwork     bool
+	Tmpfs           map[string]string
+}
+
+func (s *ModuleSecurity) Validate() error {
+	for mountPath := range s.Tmpfs {
+		if !path.IsAbs(mountPath) {
+			return fmt.Errorf("field 'Security' has relative Tmpfs path: '%s'", mountPath)
+		}
+	}
+	return nil
+}
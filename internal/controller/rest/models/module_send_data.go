@@ -2,13 +2,43 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/pajtaand/dmap-zero/internal/common/utils"
 )
 
 type SendDataRequest struct {
-	Data []byte
+	Data   []byte
+	Target *SendDataTarget
+}
+
+// SendDataTarget selects the agents the data is sent to, at most one of the fields may be set.
+// Without a target the data is sent to every agent running the module.
+type SendDataTarget struct {
+	AgentID  string
+	Selector string
+	Any      bool // any one agent running the module
+}
+
+func (t *SendDataTarget) Validate() error {
+	set := 0
+	if t.AgentID != "" {
+		set++
+	}
+	if t.Selector != "" {
+		set++
+	}
+	if t.Any {
+		set++
+	}
+	if set > 1 {
+		return errors.New("field 'Target' must set at most one of AgentID, Selector or Any")
+	}
+	if _, err := utils.ParseLabelSelector(t.Selector); err != nil {
+		return err
+	}
+	return nil
 }
 
 func (req *SendDataRequest) FromHttpRequest(r *http.Request) error {
@@ -18,5 +48,15 @@ func (req *SendDataRequest) FromHttpRequest(r *http.Request) error {
 	if err := utils.CheckNotNil(req, "Data"); err != nil {
 		return err
 	}
+	if req.Target != nil {
+		if err := req.Target.Validate(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+type SendDataResponse struct {
+	MessageID  string
+	Recipients []DeliveryRecipient
+}
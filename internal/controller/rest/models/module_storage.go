@@ -0,0 +1,60 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+)
+
+type ModuleVolume struct {
+	Name      string
+	Path      string
+	ReadOnly  bool
+	Retention string
+}
+
+type ModuleBindMount struct {
+	HostPath string
+	Path     string
+	ReadOnly bool
+}
+
+type ModuleSecretMount struct {
+	Secret string
+	Path   string
+}
+
+type ModuleStorage struct {
+	Volumes    []*ModuleVolume
+	BindMounts []*ModuleBindMount
+	Secrets    []*ModuleSecretMount
+}
+
+func (s *ModuleStorage) Validate() error {
+	for _, volume := range s.Volumes {
+		if volume == nil || volume.Name == "" {
+			return errors.New("field 'Storage' has volume without Name")
+		}
+		if !path.IsAbs(volume.Path) {
+			return fmt.Errorf("field 'Storage' has relative volume Path: '%s'", volume.Path)
+		}
+		switch volume.Retention {
+		case "", constants.ModuleVolumeRetentionUntilStop, constants.ModuleVolumeRetentionUntilDelete, constants.ModuleVolumeRetentionForever:
+		default:
+			return fmt.Errorf("field 'Storage' has volume with unknown Retention: '%s'", volume.Retention)
+		}
+	}
+	for _, bind := range s.BindMounts {
+		if bind == nil || !path.IsAbs(bind.HostPath) || !path.IsAbs(bind.Path) {
+			return errors.New("field 'Storage' has bind mount without absolute HostPath and Path")
+		}
+	}
+	for _, secret := range s.Secrets {
+		if secret == nil || secret.Secret == "" || !path.IsAbs(secret.Path) {
+			return errors.New("field 'Storage' has secret without Secret and absolute Path")
+		}
+	}
+	return nil
+}
@@ -11,6 +11,12 @@ type UpdateModuleRequest struct {
 	Name          string
 	Image         string
 	Configuration map[string]string
+	Resources     *ModuleResources
+	Security      *ModuleSecurity
+	Storage       *ModuleStorage
+	Placement     *ModulePlacement
+	RestartPolicy *ModuleRestartPolicy
+	Rollout       *ModuleRolloutStrategy
 }
 
 func (req *UpdateModuleRequest) FromHttpRequest(r *http.Request) error {
@@ -26,5 +32,30 @@ func (req *UpdateModuleRequest) FromHttpRequest(r *http.Request) error {
 	if err := utils.CheckNotNil(req, "Configuration"); err != nil {
 		return err
 	}
+	if req.Resources != nil {
+		if err := req.Resources.Validate(); err != nil {
+			return err
+		}
+	}
+	if req.Security != nil {
+		if err := req.Security.Validate(); err != nil {
+			return err
+		}
+	}
+	if req.Storage != nil {
+		if err := req.Storage.Validate(); err != nil {
+			return err
+		}
+	}
+	if req.RestartPolicy != nil {
+		if err := req.RestartPolicy.Validate(); err != nil {
+			return err
+		}
+	}
+	if req.Rollout != nil {
+		if err := req.Rollout.Validate(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
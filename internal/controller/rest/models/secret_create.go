@@ -0,0 +1,26 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pajtaand/dmap-zero/internal/common/utils"
+)
+
+type CreateSecretRequest struct {
+	Name  string
+	Value string
+}
+
+func (req *CreateSecretRequest) FromHttpRequest(r *http.Request) error {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return err
+	}
+	if err := utils.CheckStringNotEmpty(req, "Name"); err != nil {
+		return err
+	}
+	if err := utils.CheckStringNotEmpty(req, "Value"); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Secret describes a stored secret, its value is never returned.
+type Secret struct {
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type ListSecretsResponse struct {
+	Secrets []Secret
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pajtaand/dmap-zero/internal/common/utils"
+)
+
+type UpdateSecretRequest struct {
+	Value string
+}
+
+func (req *UpdateSecretRequest) FromHttpRequest(r *http.Request) error {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return err
+	}
+	if err := utils.CheckStringNotEmpty(req, "Value"); err != nil {
+		return err
+	}
+	return nil
+}
@@ -26,5 +26,6 @@ func (req *WebhookRegistrationRequest) FromHttpRequest(r *http.Request) error {
 }
 
 type WebhookRegistrationResponse struct {
-	ID string `json:"ID"`
+	ID     string `json:"ID"`
+	Secret string `json:"secret"`
 }
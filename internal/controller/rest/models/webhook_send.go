@@ -1,7 +1,8 @@
 package models
 
 type WebhookData struct {
-	ModuleID string `json:"moduleID"`
-	Blob     string `json:"blob"`
-	Receiver string `json:"Receiver"`
+	ModuleID  string `json:"moduleID"`
+	MessageID string `json:"messageID,omitempty"`
+	Blob      string `json:"blob"`
+	Receiver  string `json:"Receiver"`
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/docgen"
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
 	m "github.com/pajtaand/dmap-zero/internal/common/middleware"
 	"github.com/pajtaand/dmap-zero/internal/controller/rest/handler"
 	"github.com/rs/zerolog/log"
@@ -20,18 +21,24 @@ type RESTServer struct {
 
 func NewRESTServer(
 	authenticator m.Authenticator,
+	authorizer m.Authorizer,
 	agentService handler.AgentService,
 	moduleService handler.ModuleService,
 	imageService handler.ImageService,
 	webhookService handler.WebhookService,
+	messageService handler.MessageService,
+	secretService handler.SecretService,
 	enrollmentService handler.EnrollmentService,
 ) *RESTServer {
 	baseAuthMiddleware := m.BasicAuth("api", authenticator)
+	execMiddleware := m.RequirePermission(constants.PermissionModuleExec, authorizer)
 	webAppHandler := handler.NewWebAppHandler()
 	agentHandler := handler.NewAgentHandler(agentService)
 	moduleHandler := handler.NewModuleHandler(moduleService)
 	imageHandler := handler.NewImageHandler(imageService)
 	webhookHandler := handler.NewWebhookHandler(webhookService)
+	messageHandler := handler.NewMessageHandler(messageService)
+	secretHandler := handler.NewSecretHandler(secretService)
 	enrollmentHandler := handler.NewEnrollmentHandler(enrollmentService)
 
 	r := chi.NewRouter()
@@ -44,8 +51,11 @@ func NewRESTServer(
 		moduleHandler,
 		imageHandler,
 		webhookHandler,
+		messageHandler,
+		secretHandler,
 		enrollmentHandler,
 		baseAuthMiddleware,
+		execMiddleware,
 	)
 	return srv
 }
@@ -80,8 +90,11 @@ func (srv *RESTServer) addHandlers(
 	moduleHandler ModuleHandler,
 	imageHandler ImageHandler,
 	webhookHandler WebhookHandler,
+	messageHandler MessageHandler,
+	secretHandler SecretHandler,
 	enrollmentHandler EnrollmentHandler,
 	authMiddleware func(next http.Handler) http.Handler,
+	execMiddleware func(next http.Handler) http.Handler,
 ) {
 	srv.r.Use(middleware.RequestID)
 	srv.r.Use(m.Logger)
@@ -110,6 +123,8 @@ func (srv *RESTServer) addHandlers(
 					r.Post("/", enrollmentHandler.CreateEnrollment)
 					r.Delete("/", enrollmentHandler.DeleteEnrollment)
 				})
+				r.Get("/module/{moduleID}/logs", agentHandler.StreamModuleLogs)
+				r.With(execMiddleware).Get("/module/{moduleID}/exec", agentHandler.ExecModule)
 			})
 		})
 		r.Route("/module", func(r chi.Router) {
@@ -121,11 +136,16 @@ func (srv *RESTServer) addHandlers(
 				r.Delete("/", moduleHandler.DeleteModule)
 				r.Post("/start", moduleHandler.StartModule)
 				r.Post("/stop", moduleHandler.StopModule)
+				r.Get("/rollout", moduleHandler.GetRollout)
+				r.Get("/revisions", moduleHandler.ListRevisions)
+				r.Post("/rollback", moduleHandler.RollbackModule)
 				r.Post("/send", moduleHandler.SendData)
 			})
 		})
 		r.Route("/image", func(r chi.Router) {
 			r.Post("/", imageHandler.UploadImage)
+			r.Post("/registry", imageHandler.RegisterImage)
+			r.Get("/signing-key", imageHandler.GetSigningKey)
 			r.Get("/", imageHandler.ListImages)
 			r.Route("/{imageID}", func(r chi.Router) {
 				r.Get("/", imageHandler.GetImage)
@@ -137,5 +157,14 @@ func (srv *RESTServer) addHandlers(
 			r.Post("/", webhookHandler.RegisterWebhook)
 			r.Delete("/", webhookHandler.DeleteWebhook)
 		})
+		r.Get("/message/{messageID}", messageHandler.GetMessage)
+		r.Route("/secret", func(r chi.Router) {
+			r.Post("/", secretHandler.CreateSecret)
+			r.Get("/", secretHandler.ListSecrets)
+			r.Route("/{name}", func(r chi.Router) {
+				r.Put("/", secretHandler.UpdateSecret)
+				r.Delete("/", secretHandler.DeleteSecret)
+			})
+		})
 	})
 }
@@ -4,10 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/rs/zerolog"
 
 	"github.com/openziti/edge-api/rest_model"
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	"github.com/pajtaand/dmap-zero/internal/common/secrets"
+	"github.com/pajtaand/dmap-zero/internal/common/utils"
 	"github.com/pajtaand/dmap-zero/internal/common/wrapper"
 	"github.com/pajtaand/dmap-zero/internal/controller/dto"
 	"github.com/pajtaand/dmap-zero/internal/controller/manager"
@@ -16,13 +24,25 @@ import (
 
 type agentService struct {
 	agentManager    *manager.AgentManager
+	imageManager    *manager.ImageManager
+	moduleManager   *manager.ModuleManager
+	secretManager   *manager.SecretManager
 	openZitiWrapper *wrapper.OpenZitiManagementWrapper
 }
 
-func NewAgentService(agentManager *manager.AgentManager, openZitiWrapper *wrapper.OpenZitiManagementWrapper) (*agentService, error) {
+func NewAgentService(agentManager *manager.AgentManager, imageManager *manager.ImageManager, moduleManager *manager.ModuleManager, secretManager *manager.SecretManager, openZitiWrapper *wrapper.OpenZitiManagementWrapper) (*agentService, error) {
 	if agentManager == nil {
 		return nil, errors.New("AgentManager must not be nil")
 	}
+	if imageManager == nil {
+		return nil, errors.New("ImageManager must not be nil")
+	}
+	if moduleManager == nil {
+		return nil, errors.New("ModuleManager must not be nil")
+	}
+	if secretManager == nil {
+		return nil, errors.New("SecretManager must not be nil")
+	}
 
 	if openZitiWrapper == nil {
 		return nil, errors.New("OpenZitiManagementWrapper wrapper must not be nil")
@@ -30,6 +50,9 @@ func NewAgentService(agentManager *manager.AgentManager, openZitiWrapper *wrappe
 
 	return &agentService{
 		agentManager:    agentManager,
+		imageManager:    imageManager,
+		moduleManager:   moduleManager,
+		secretManager:   secretManager,
 		openZitiWrapper: openZitiWrapper,
 	}, nil
 }
@@ -41,7 +64,13 @@ func (svc *agentService) CreateAgent(ctx context.Context, request *dto.CreateAge
 	if request == nil {
 		return nil, errors.New("request must not be nil")
 	}
-	agentID := svc.agentManager.AddAgent(request.Name, request.Configuration)
+	if err := svc.secretManager.CheckSecretsExist(secrets.References(request.Configuration)); err != nil {
+		return nil, err
+	}
+	agentID, err := svc.agentManager.AddAgent(request.Name, request.Configuration, request.Labels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add agent: %v", err)
+	}
 
 	return &dto.CreateAgentResponse{
 		ID: agentID,
@@ -72,25 +101,47 @@ func (svc *agentService) GetAgent(ctx context.Context, request *dto.GetAgentRequ
 
 	isOnline := false
 	presentImages := []string{}
+	rejectedImages := map[string]string{}
+	rejectedModules := map[string]string{}
+	volumeUsage := map[string]map[string]int64{}
 	presentModules := []string{}
+	moduleStatuses := map[string]string{}
+	moduleRestarts := map[string]int{}
+	subscriptions := map[string][]string{}
+	var drift *dto.AgentDrift
 
 	if diag := agent.GetDiagnostics(); diag != nil {
 		isOnline = true
+		moduleStatuses = diag.ModuleStatuses
+		moduleRestarts = diag.ModuleRestarts
+		rejectedImages = diag.RejectedImages
+		rejectedModules = moduleRejectionReasons(diag.RejectedModules)
+		volumeUsage = diag.VolumeUsage
+		subscriptions = diag.Subscriptions
 		for img := range diag.PresentImages {
 			presentImages = append(presentImages, img)
 		}
 		for mod := range diag.PresentModules {
 			presentModules = append(presentModules, mod)
 		}
+		drift = agentDrift(desiredAgentState(agent, svc.imageManager, svc.moduleManager), diag)
 	}
 
 	return &dto.GetAgentResponse{
-		Name:           agent.GetName(),
-		Configuration:  agent.GetConfiguration(),
-		IsEnrolled:     isEnrolled,
-		IsOnline:       isOnline,
-		PresentImages:  presentImages,
-		PresentModules: presentModules,
+		Name:            agent.GetName(),
+		Configuration:   agent.GetConfiguration(),
+		Labels:          agent.GetLabels(),
+		IsEnrolled:      isEnrolled,
+		IsOnline:        isOnline,
+		PresentImages:   presentImages,
+		RejectedImages:  rejectedImages,
+		RejectedModules: rejectedModules,
+		VolumeUsage:     volumeUsage,
+		PresentModules:  presentModules,
+		ModuleStatuses:  moduleStatuses,
+		ModuleRestarts:  moduleRestarts,
+		Subscriptions:   subscriptions,
+		Drift:           drift,
 	}, nil
 }
 
@@ -102,6 +153,11 @@ func (svc *agentService) ListAgents(ctx context.Context, request *dto.ListAgents
 		return nil, errors.New("request must not be nil")
 	}
 
+	selector, err := utils.ParseLabelSelector(request.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse label selector: %v", err)
+	}
+
 	details, err := svc.openZitiWrapper.ListIdentityDetails()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get identity details: %v", err)
@@ -120,6 +176,10 @@ func (svc *agentService) ListAgents(ctx context.Context, request *dto.ListAgents
 
 	agents := make([]*dto.ListAgentsResponseAgent, 0)
 	for _, agent := range svc.agentManager.ListAgents() {
+		if !selector.Matches(agent.GetLabels()) {
+			continue
+		}
+
 		isEnrolled := false
 		if identityID := agent.GetIdentityID(); identityID != "" {
 			if identity, ok := tmpIdentityMap[identityID]; ok {
@@ -131,10 +191,22 @@ func (svc *agentService) ListAgents(ctx context.Context, request *dto.ListAgents
 
 		isOnline := false
 		presentImages := []string{}
+		rejectedImages := map[string]string{}
+		rejectedModules := map[string]string{}
+		volumeUsage := map[string]map[string]int64{}
 		presentModules := []string{}
+		moduleStatuses := map[string]string{}
+		moduleRestarts := map[string]int{}
+		subscriptions := map[string][]string{}
 
 		if diag := agent.GetDiagnostics(); diag != nil {
 			isOnline = true
+			moduleStatuses = diag.ModuleStatuses
+			moduleRestarts = diag.ModuleRestarts
+			rejectedImages = diag.RejectedImages
+			rejectedModules = moduleRejectionReasons(diag.RejectedModules)
+			volumeUsage = diag.VolumeUsage
+			subscriptions = diag.Subscriptions
 			for img := range diag.PresentImages {
 				presentImages = append(presentImages, img)
 			}
@@ -144,13 +216,20 @@ func (svc *agentService) ListAgents(ctx context.Context, request *dto.ListAgents
 		}
 
 		agents = append(agents, &dto.ListAgentsResponseAgent{
-			ID:             agent.GetID(),
-			Name:           agent.GetName(),
-			Configuration:  agent.GetConfiguration(),
-			IsEnrolled:     isEnrolled,
-			IsOnline:       isOnline,
-			PresentImages:  presentImages,
-			PresentModules: presentModules,
+			ID:              agent.GetID(),
+			Name:            agent.GetName(),
+			Configuration:   agent.GetConfiguration(),
+			Labels:          agent.GetLabels(),
+			IsEnrolled:      isEnrolled,
+			IsOnline:        isOnline,
+			PresentImages:   presentImages,
+			RejectedImages:  rejectedImages,
+			RejectedModules: rejectedModules,
+			VolumeUsage:     volumeUsage,
+			PresentModules:  presentModules,
+			ModuleStatuses:  moduleStatuses,
+			ModuleRestarts:  moduleRestarts,
+			Subscriptions:   subscriptions,
 		})
 	}
 	return &dto.ListAgentsResponse{
@@ -170,6 +249,9 @@ func (svc *agentService) UpdateAgent(ctx context.Context, request *dto.UpdateAge
 	if err != nil {
 		return nil, fmt.Errorf("failed to get agent: %v", err)
 	}
+	if err := svc.secretManager.CheckSecretsExist(secrets.References(request.Configuration)); err != nil {
+		return nil, err
+	}
 
 	if c := agent.GetConfigurationServiceClient(); c != nil {
 		log.Info().Msgf("Sending update configuration request: agentID=%s", agent.GetID())
@@ -181,8 +263,17 @@ func (svc *agentService) UpdateAgent(ctx context.Context, request *dto.UpdateAge
 		}
 	}
 
-	agent.SetName(request.Name)
-	agent.SetConfiguration(request.Configuration)
+	if err := agent.SetName(request.Name); err != nil {
+		return nil, fmt.Errorf("failed to update agent name: %v", err)
+	}
+	if err := agent.SetConfiguration(request.Configuration); err != nil {
+		return nil, fmt.Errorf("failed to update agent configuration: %v", err)
+	}
+	if request.Labels != nil {
+		if err := agent.SetLabels(request.Labels); err != nil {
+			return nil, fmt.Errorf("failed to update agent labels: %v", err)
+		}
+	}
 	return &dto.UpdateAgentResponse{}, nil
 }
 
@@ -210,3 +301,265 @@ func (svc *agentService) DeleteAgent(ctx context.Context, request *dto.DeleteAge
 	}
 	return &dto.DeleteAgentResponse{}, nil
 }
+
+// StreamModuleLogs opens the log stream of the module's container on the agent. It returns
+// ErrNotFound when the agent or the module doesn't exist, or the module isn't present on the
+// agent, and ErrConflict when the agent is offline.
+func (svc *agentService) StreamModuleLogs(ctx context.Context, request *dto.StreamModuleLogsRequest) (*dto.StreamModuleLogsResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Stream module logs request")
+
+	if request == nil {
+		return nil, errors.New("request must not be nil")
+	}
+
+	agent, err := svc.agentManager.GetAgent(request.AgentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agent: %w", err)
+	}
+	if !svc.moduleManager.ModuleExists(request.ModuleID) {
+		return nil, fmt.Errorf("failed to get module: %w", errs.ErrNotFound)
+	}
+
+	c := agent.GetModuleServiceClient()
+	if c == nil {
+		return nil, fmt.Errorf("%w: agent is offline", errs.ErrConflict)
+	}
+	if !agentRunsModule(agent, request.ModuleID) {
+		return nil, fmt.Errorf("%w: module isn't present on the agent", errs.ErrNotFound)
+	}
+
+	log.Info().Msgf("Streaming module logs: agentID=%s, moduleID=%s, since=%s, tail=%s, follow=%v", request.AgentID, request.ModuleID, request.Since, request.Tail, request.Follow)
+	stream, err := c.StreamLogs(ctx, &pb.ModuleLogsRequest{
+		Module: &pb.ModuleIdentifier{
+			Id: request.ModuleID,
+		},
+		Since:      request.Since,
+		Tail:       request.Tail,
+		Follow:     request.Follow,
+		Timestamps: request.Timestamps,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to stream module logs: %v", err)
+	}
+	// the agent sends the header once the logs are open, without it the call already failed
+	if md, err := stream.Header(); err != nil || md == nil {
+		if _, err := stream.Recv(); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to stream module logs: %v", err)
+		}
+		return nil, errors.New("failed to stream module logs: agent closed the stream")
+	}
+
+	return &dto.StreamModuleLogsResponse{
+		Recv: func() (*dto.ModuleLogChunk, error) {
+			chunk, err := stream.Recv()
+			if err != nil {
+				return nil, err
+			}
+			return &dto.ModuleLogChunk{
+				Stream: chunk.Stream,
+				Data:   chunk.Data,
+			}, nil
+		},
+	}, nil
+}
+
+// ExecModule opens an exec session in the module's container on the agent, every session and
+// the lines of its input are recorded in the audit log. It returns the same errors as
+// StreamModuleLogs.
+func (svc *agentService) ExecModule(ctx context.Context, request *dto.ExecModuleRequest) (*dto.ExecModuleResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Exec module request")
+
+	if request == nil {
+		return nil, errors.New("request must not be nil")
+	}
+
+	agent, err := svc.agentManager.GetAgent(request.AgentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agent: %w", err)
+	}
+	if !svc.moduleManager.ModuleExists(request.ModuleID) {
+		return nil, fmt.Errorf("failed to get module: %w", errs.ErrNotFound)
+	}
+
+	c := agent.GetModuleServiceClient()
+	if c == nil {
+		return nil, fmt.Errorf("%w: agent is offline", errs.ErrConflict)
+	}
+	if !agentRunsModule(agent, request.ModuleID) {
+		return nil, fmt.Errorf("%w: module isn't present on the agent", errs.ErrNotFound)
+	}
+
+	user, _ := utils.GetUser(ctx)
+	audit := log.With().
+		Bool(constants.LoggerKeyAudit, true).
+		Str("agent_id", request.AgentID).
+		Str("module_id", request.ModuleID).
+		Logger()
+
+	// the session outlives the request which opened it
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stream, err := c.Exec(ctx)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to open exec session: %v", err)
+	}
+	if err := stream.Send(&pb.ExecRequest{
+		Request: &pb.ExecRequest_Start{
+			Start: &pb.ExecStart{
+				Module: &pb.ModuleIdentifier{
+					Id: request.ModuleID,
+				},
+				Command: request.Command,
+				Tty:     request.Tty,
+				Rows:    request.Rows,
+				Cols:    request.Cols,
+				User:    user,
+			},
+		},
+	}); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start exec session: %v", err)
+	}
+	// the agent sends the header once the command runs, without it the command failed to start
+	if md, err := stream.Header(); err != nil || md == nil {
+		defer cancel()
+		if _, err := stream.Recv(); err != nil && err != io.EOF {
+			audit.Warn().Err(err).Msgf("Exec session failed to start: command=%q", request.Command)
+			return nil, fmt.Errorf("failed to start exec session: %v", err)
+		}
+		return nil, errors.New("failed to start exec session: agent closed the stream")
+	}
+	audit.Info().Msgf("Exec session started: command=%q, tty=%v", request.Command, request.Tty)
+
+	started := time.Now()
+	var exitCode atomic.Int32
+	input := newExecInput(func(line string) {
+		audit.Info().Msgf("Exec session input: %q", line)
+	})
+	var exited atomic.Bool
+	var closeOnce sync.Once
+	return &dto.ExecModuleResponse{
+		Recv: func() (*dto.ExecOutput, error) {
+			for {
+				resp, err := stream.Recv()
+				if err != nil {
+					return nil, err
+				}
+				switch r := resp.Response.(type) {
+				case *pb.ExecResponse_Output:
+					return &dto.ExecOutput{
+						Stream: r.Output.Stream,
+						Data:   r.Output.Data,
+					}, nil
+				case *pb.ExecResponse_ExitCode:
+					exitCode.Store(r.ExitCode)
+					exited.Store(true)
+					input.flush()
+					audit.Info().Msgf("Exec session finished: exitCode=%d, duration=%v", r.ExitCode, time.Since(started))
+					return nil, io.EOF
+				}
+			}
+		},
+		ExitCode: func() int {
+			return int(exitCode.Load())
+		},
+		Stdin: func(data []byte) error {
+			input.write(data)
+			return stream.Send(&pb.ExecRequest{
+				Request: &pb.ExecRequest_Stdin{
+					Stdin: data,
+				},
+			})
+		},
+		Resize: func(rows, cols uint32) error {
+			return stream.Send(&pb.ExecRequest{
+				Request: &pb.ExecRequest_Resize{
+					Resize: &pb.ExecResize{
+						Rows: rows,
+						Cols: cols,
+					},
+				},
+			})
+		},
+		CloseStdin: func() error {
+			input.flush()
+			audit.Info().Msg("Exec session input closed")
+			return stream.Send(&pb.ExecRequest{
+				Request: &pb.ExecRequest_CloseStdin{
+					CloseStdin: true,
+				},
+			})
+		},
+		Close: func() {
+			closeOnce.Do(func() {
+				cancel()
+				if !exited.Load() {
+					input.flush()
+					audit.Info().Msgf("Exec session closed before the command exited: duration=%v", time.Since(started))
+				}
+			})
+		},
+	}, nil
+}
+
+// execInput splits the input of an exec session into the lines submitted to the command. Erased
+// characters are dropped from the line, so it reads as typed into a terminal.
+type execInput struct {
+	mu     sync.Mutex
+	line   []byte
+	record func(line string)
+}
+
+func newExecInput(record func(line string)) *execInput {
+	return &execInput{
+		record: record,
+	}
+}
+
+func (in *execInput) write(data []byte) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	for _, b := range data {
+		switch b {
+		case '\r', '\n':
+			in.submit()
+		case '\b', 0x7f:
+			if len(in.line) > 0 {
+				in.line = in.line[:len(in.line)-1]
+			}
+		default:
+			in.line = append(in.line, b)
+			if len(in.line) >= constants.ControllerExecAuditLineMax {
+				in.submit()
+			}
+		}
+	}
+}
+
+// flush records the input which wasn't submitted by the end of a line.
+func (in *execInput) flush() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.submit()
+}
+
+// submit records the current line, the caller must hold the lock.
+func (in *execInput) submit() {
+	if len(in.line) == 0 {
+		return
+	}
+	in.record(string(in.line))
+	in.line = in.line[:0]
+}
+
+// moduleRejectionReasons returns the reasons of the rejected module revisions by module ID.
+func moduleRejectionReasons(rejections map[string]*manager.ModuleRejection) map[string]string {
+	reasons := map[string]string{}
+	for moduleID, rejection := range rejections {
+		reasons[moduleID] = fmt.Sprintf("revision %d: %s", rejection.Revision, rejection.Reason)
+	}
+	return reasons
+}
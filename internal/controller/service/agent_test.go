@@ -0,0 +1,34 @@
+package service
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+)
+
+func TestExecInput(t *testing.T) {
+	lines := []string{}
+	input := newExecInput(func(line string) {
+		lines = append(lines, line)
+	})
+
+	input.write([]byte("ls -l"))
+	input.write([]byte("a\x7f\r\n"))
+	input.write([]byte("cat\bt /etc/hostname\n\nexit"))
+	input.flush()
+	input.flush()
+
+	expected := []string{"ls -l", "cat /etc/hostname", "exit"}
+	if !slices.Equal(lines, expected) {
+		t.Errorf("lines = %q; expected %q", lines, expected)
+	}
+
+	// long lines are recorded in parts
+	lines = nil
+	input.write([]byte(strings.Repeat("x", constants.ControllerExecAuditLineMax+1) + "\n"))
+	if len(lines) != 2 || len(lines[0]) != constants.ControllerExecAuditLineMax || lines[1] != "x" {
+		t.Errorf("got %d lines; expected the line split after %d bytes", len(lines), constants.ControllerExecAuditLineMax)
+	}
+}
@@ -56,7 +56,9 @@ func (svc *enrollmentService) CreateEnrollment(ctx context.Context, request *dto
 	if err != nil {
 		return nil, fmt.Errorf("failed to create identity for agent: %v", err)
 	}
-	agent.SetIdentityID(identityID)
+	if err := agent.SetIdentityID(identityID); err != nil {
+		return nil, fmt.Errorf("failed to set identity for agent: %v", err)
+	}
 
 	ExpiresAt := time.Now().Add(constants.OpenZitiEnrollmentTokenValidity)
 	enrollmentID, err := svc.openZitiWrapper.CreateEnrollment(agent.GetIdentityID(), strfmt.DateTime(ExpiresAt))
@@ -121,7 +123,9 @@ func (svc *enrollmentService) DeleteEnrollment(ctx context.Context, request *dto
 		if err := svc.openZitiWrapper.DeleteIdentity(identityID); err != nil {
 			return nil, fmt.Errorf("failed to remove identity for agent: %v", err)
 		}
-		agent.SetIdentityID("")
+		if err := agent.SetIdentityID(""); err != nil {
+			return nil, fmt.Errorf("failed to clear identity for agent: %v", err)
+		}
 	}
 
 	return &dto.DeleteEnrollmentResponse{}, nil
@@ -4,10 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
 
 	"github.com/pajtaand/dmap-zero/internal/common/constants"
 	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	"github.com/pajtaand/dmap-zero/internal/common/registry"
+	"github.com/pajtaand/dmap-zero/internal/common/signing"
 	"github.com/pajtaand/dmap-zero/internal/controller/dto"
 	"github.com/pajtaand/dmap-zero/internal/controller/manager"
 	pb "github.com/pajtaand/dmap-zero/internal/proto"
@@ -50,60 +51,49 @@ func (svc *imageService) UploadImage(ctx context.Context, request *dto.UploadIma
 		return nil, errors.New("src must not be nil")
 	}
 
-	data, err := io.ReadAll(request.Src)
+	image, err := svc.imageManager.AddImage(request.Name, request.Src)
 	if err != nil {
 		return nil, err
 	}
+	log.Info().Msgf("Image uploaded, agents will pull it on their next phonehome: imageID=%s, digest=%s", image.GetID(), image.GetDigest())
 
-	image, err := svc.imageManager.AddImage(request.Name, data)
-	if err != nil {
-		return nil, err
+	return &dto.UploadImageResponse{
+		ID: image.GetID(),
+	}, nil
+}
+
+func (svc *imageService) RegisterImage(ctx context.Context, request *dto.RegisterImageRequest) (*dto.RegisterImageResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Register image request")
+
+	if request == nil {
+		return nil, errors.New("request must not be nil")
 	}
-	imageID := image.GetID()
 
-	for _, agent := range svc.agentManager.ListAgents() {
-		go func(ctx context.Context, agent *manager.Agent) {
-			agentID := agent.GetID()
-
-			c := agent.GetImageServiceClient()
-			if c == nil {
-				return
-			}
-			log.Info().Msgf("Pushing image to agent: agentID=%s, imageID=%s", agentID, imageID)
-
-			stream, err := c.PushImage(ctx)
-			if err != nil {
-				log.Info().Msgf("Failed to create stream to agentID=%s: %v", agentID, err)
-				return
-			}
-
-			for start := 0; start < len(data); start += constants.AgentImageStreamChunkSize {
-				end := start + constants.AgentImageStreamChunkSize
-				if end > len(data) {
-					end = len(data)
-				}
-				if err := stream.Send(&pb.ImageStreamData{
-					Id:      imageID,
-					Name:    request.Name,
-					Content: data[start:end],
-				}); err != nil {
-					log.Info().Msgf("Failed to stream image to agentID=%s: %v", agentID, err)
-					return
-				}
-			}
-
-			if _, err := stream.CloseAndRecv(); err != nil {
-				log.Info().Msgf("Failed to receive response from agentID=%s: %v", agentID, err)
-				return
-			}
-			log.Info().Msgf("Image push finished: agentID=%s, imageID=%s", agentID, imageID)
-		}(context.Background(), agent)
+	source := &manager.RegistrySource{
+		Reference: request.Reference,
+		Platform:  request.Platform,
+		Insecure:  request.Insecure,
+	}
+	if source.Platform == "" {
+		source.Platform = constants.ControllerRegistryDefaultPlatform
+	}
+	if request.Username != "" {
+		source.Credentials = &registry.Credentials{
+			Username: request.Username,
+			Password: request.Password,
+		}
 	}
 
-	return &dto.UploadImageResponse{
-		ID: imageID,
-	}, nil
+	image, err := svc.imageManager.AddRegistryImage(request.Name, source)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msgf("Image registered, agents will pull it once the controller has pulled it: imageID=%s, reference=%s", image.GetID(), source.Reference)
 
+	return &dto.RegisterImageResponse{
+		ID: image.GetID(),
+	}, nil
 }
 
 func (svc *imageService) GetImage(ctx context.Context, request *dto.GetImageRequest) (*dto.GetImageResponse, error) {
@@ -119,10 +109,19 @@ func (svc *imageService) GetImage(ctx context.Context, request *dto.GetImageRequ
 		return nil, fmt.Errorf("failed to get image: %v", err)
 	}
 
-	return &dto.GetImageResponse{
-		Name: image.GetName(),
-		Size: image.GetSize(),
-	}, nil
+	response := &dto.GetImageResponse{
+		Name:          image.GetName(),
+		Size:          image.GetSize(),
+		Digest:        image.GetDigest(),
+		Source:        image.GetSource(),
+		Status:        image.GetStatus(),
+		StatusMessage: image.GetStatusMessage(),
+	}
+	if source := image.GetRegistrySource(); source != nil {
+		response.Reference = source.Reference
+		response.Platform = source.Platform
+	}
+	return response, nil
 }
 
 func (svc *imageService) ListImages(ctx context.Context, request *dto.ListImagesRequest) (*dto.ListImagesResponse, error) {
@@ -135,17 +134,44 @@ func (svc *imageService) ListImages(ctx context.Context, request *dto.ListImages
 
 	images := make([]*dto.ListImagesResponseImage, 0)
 	for _, image := range svc.imageManager.ListImages() {
-		images = append(images, &dto.ListImagesResponseImage{
-			ID:   image.GetID(),
-			Name: image.GetName(),
-			Size: image.GetSize(),
-		})
+		item := &dto.ListImagesResponseImage{
+			ID:            image.GetID(),
+			Name:          image.GetName(),
+			Size:          image.GetSize(),
+			Digest:        image.GetDigest(),
+			Source:        image.GetSource(),
+			Status:        image.GetStatus(),
+			StatusMessage: image.GetStatusMessage(),
+		}
+		if source := image.GetRegistrySource(); source != nil {
+			item.Reference = source.Reference
+			item.Platform = source.Platform
+		}
+		images = append(images, item)
 	}
 	return &dto.ListImagesResponse{
 		Images: images,
 	}, nil
 }
 
+// GetSigningKey returns the PEM encoded public key agents verify image signatures with.
+func (svc *imageService) GetSigningKey(ctx context.Context, request *dto.GetImageSigningKeyRequest) (*dto.GetImageSigningKeyResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Get image signing key request")
+
+	if request == nil {
+		return nil, errors.New("request must not be nil")
+	}
+
+	publicKey, err := signing.MarshalPublicKey(svc.imageManager.GetSigningKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode signing key: %v", err)
+	}
+	return &dto.GetImageSigningKeyResponse{
+		PublicKey: string(publicKey),
+	}, nil
+}
+
 func (svc *imageService) DeleteImage(ctx context.Context, request *dto.DeleteImageRequest) (*dto.DeleteImageResponse, error) {
 	log := zerolog.Ctx(ctx)
 	log.Info().Msg("Delete image request")
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pajtaand/dmap-zero/internal/controller/dto"
+	"github.com/pajtaand/dmap-zero/internal/controller/manager"
+	"github.com/rs/zerolog"
+)
+
+type messageService struct {
+	deliveryManager *manager.DeliveryManager
+}
+
+func NewMessageService(deliveryManager *manager.DeliveryManager) (*messageService, error) {
+	if deliveryManager == nil {
+		return nil, errors.New("DeliveryManager must not be nil")
+	}
+
+	return &messageService{
+		deliveryManager: deliveryManager,
+	}, nil
+}
+
+func (svc *messageService) GetMessage(ctx context.Context, request *dto.GetMessageRequest) (*dto.GetMessageResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Get message request")
+
+	if request == nil {
+		return nil, errors.New("request must not be nil")
+	}
+
+	delivery, err := svc.deliveryManager.GetDelivery(request.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.GetMessageResponse{
+		ID:            delivery.ID,
+		Direction:     string(delivery.Direction),
+		ModuleID:      delivery.ModuleID,
+		Receiver:      delivery.Receiver,
+		SourceAgentID: delivery.SourceAgentID,
+		CreatedAt:     delivery.CreatedAt,
+		Recipients:    deliveryRecipientsToDTO(delivery.Recipients),
+	}, nil
+}
+
+func deliveryRecipientsToDTO(recipients []manager.DeliveryRecipient) []dto.DeliveryRecipient {
+	res := []dto.DeliveryRecipient{}
+	for _, recipient := range recipients {
+		res = append(res, dto.DeliveryRecipient{
+			AgentID:  recipient.AgentID,
+			ModuleID: recipient.ModuleID,
+			Outcome:  string(recipient.Outcome),
+			Error:    recipient.Error,
+		})
+	}
+	return res
+}
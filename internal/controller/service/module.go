@@ -4,8 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"slices"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
 	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	"github.com/pajtaand/dmap-zero/internal/common/utils"
 	"github.com/pajtaand/dmap-zero/internal/controller/dto"
 	"github.com/pajtaand/dmap-zero/internal/controller/manager"
 	pb "github.com/pajtaand/dmap-zero/internal/proto"
@@ -13,12 +19,14 @@ import (
 )
 
 type moduleService struct {
-	moduleManager *manager.ModuleManager
-	imageManager  *manager.ImageManager
-	agentManager  *manager.AgentManager
+	moduleManager   *manager.ModuleManager
+	imageManager    *manager.ImageManager
+	agentManager    *manager.AgentManager
+	secretManager   *manager.SecretManager
+	deliveryManager *manager.DeliveryManager
 }
 
-func NewModuleService(moduleManager *manager.ModuleManager, imageManager *manager.ImageManager, agentManager *manager.AgentManager) (*moduleService, error) {
+func NewModuleService(moduleManager *manager.ModuleManager, imageManager *manager.ImageManager, agentManager *manager.AgentManager, secretManager *manager.SecretManager, deliveryManager *manager.DeliveryManager) (*moduleService, error) {
 	if moduleManager == nil {
 		return nil, errors.New("ModuleManager must not be nil")
 	}
@@ -28,11 +36,19 @@ func NewModuleService(moduleManager *manager.ModuleManager, imageManager *manage
 	if agentManager == nil {
 		return nil, errors.New("AgentManager must not be nil")
 	}
+	if secretManager == nil {
+		return nil, errors.New("SecretManager must not be nil")
+	}
+	if deliveryManager == nil {
+		return nil, errors.New("DeliveryManager must not be nil")
+	}
 
 	return &moduleService{
-		moduleManager: moduleManager,
-		imageManager:  imageManager,
-		agentManager:  agentManager,
+		moduleManager:   moduleManager,
+		imageManager:    imageManager,
+		agentManager:    agentManager,
+		secretManager:   secretManager,
+		deliveryManager: deliveryManager,
 	}, nil
 }
 
@@ -48,7 +64,33 @@ func (svc *moduleService) CreateModule(ctx context.Context, request *dto.CreateM
 		return nil, fmt.Errorf("failed to find image: %s", request.Image)
 	}
 
-	moduleID := svc.moduleManager.AddModule(request.Name, request.Image, request.Configuration)
+	placement := placementFromDto(request.Placement)
+	if err := placement.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", errs.ErrInvalid, err)
+	}
+	restartPolicy := restartPolicyFromDto(request.RestartPolicy)
+	if err := restartPolicy.Validate(); err != nil {
+		return nil, err
+	}
+	spec := &manager.ModuleSpec{
+		Image:         request.Image,
+		Configuration: request.Configuration,
+		Resources:     resourcesFromDto(request.Resources),
+		Security:      securityFromDto(request.Security),
+		Storage:       storageFromDto(request.Storage),
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	if err := svc.secretManager.CheckSecretsExist(spec.SecretReferences()); err != nil {
+		return nil, err
+	}
+
+	createdBy, _ := utils.GetUser(ctx)
+	moduleID, err := svc.moduleManager.AddModule(request.Name, spec, placement, restartPolicy, createdBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add module: %v", err)
+	}
 	return &dto.CreateModuleResponse{
 		ID: moduleID,
 	}, nil
@@ -67,11 +109,30 @@ func (svc *moduleService) GetModule(ctx context.Context, request *dto.GetModuleR
 		return nil, fmt.Errorf("failed to get module: %v", err)
 	}
 
+	// status of the module on every online agent that reports it
+	agentStatuses := map[string]string{}
+	for _, agent := range svc.agentManager.ListAgents() {
+		diag := agent.GetDiagnostics()
+		if diag == nil {
+			continue
+		}
+		if status, ok := diag.ModuleStatuses[module.GetID()]; ok {
+			agentStatuses[agent.GetID()] = status
+		}
+	}
+
 	return &dto.GetModuleResponse{
 		Name:          module.GetName(),
 		Image:         module.GetImage(),
 		Configuration: module.GetConfiguration(),
+		Resources:     resourcesToDto(module.GetResources()),
+		Security:      securityToDto(module.GetSecurity()),
+		Storage:       storageToDto(module.GetStorage()),
+		Placement:     placementToDto(module.GetPlacement()),
+		RestartPolicy: restartPolicyToDto(module.GetRestartPolicy()),
 		IsRunning:     module.IsRunning(),
+		Revision:      module.GetRevision(),
+		AgentStatuses: agentStatuses,
 	}, nil
 }
 
@@ -90,6 +151,11 @@ func (svc *moduleService) ListModules(ctx context.Context, request *dto.ListModu
 			Name:          module.GetName(),
 			Image:         module.GetImage(),
 			Configuration: module.GetConfiguration(),
+			Resources:     resourcesToDto(module.GetResources()),
+			Security:      securityToDto(module.GetSecurity()),
+			Storage:       storageToDto(module.GetStorage()),
+			Placement:     placementToDto(module.GetPlacement()),
+			RestartPolicy: restartPolicyToDto(module.GetRestartPolicy()),
 			IsRunning:     module.IsRunning(),
 		})
 	}
@@ -114,12 +180,171 @@ func (svc *moduleService) UpdateModule(ctx context.Context, request *dto.UpdateM
 	if err != nil {
 		return nil, fmt.Errorf("failed to get module: %v", err)
 	}
-	module.SetName(request.Name)
-	module.SetImage(request.Image)
-	module.SetConfiguration(request.Configuration)
+
+	placement := module.GetPlacement()
+	if request.Placement != nil {
+		placement = placementFromDto(request.Placement)
+		if err := placement.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %v", errs.ErrInvalid, err)
+		}
+	}
+	spec := &manager.ModuleSpec{
+		Image:         request.Image,
+		Configuration: request.Configuration,
+		Resources:     module.GetResources(),
+		Security:      module.GetSecurity(),
+		Storage:       module.GetStorage(),
+	}
+	if request.Resources != nil {
+		spec.Resources = resourcesFromDto(request.Resources)
+	}
+	if request.Security != nil {
+		spec.Security = securityFromDto(request.Security)
+	}
+	if request.Storage != nil {
+		spec.Storage = storageFromDto(request.Storage)
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	strategy := rolloutStrategyFromDto(request.Rollout)
+	if err := strategy.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := svc.applyRevision(ctx, module, spec, placement, strategy, "module updated"); err != nil {
+		return nil, err
+	}
+
+	if err := module.SetName(request.Name); err != nil {
+		return nil, fmt.Errorf("failed to update module name: %v", err)
+	}
+
+	if request.RestartPolicy != nil {
+		restartPolicy := restartPolicyFromDto(request.RestartPolicy)
+		if err := restartPolicy.Validate(); err != nil {
+			return nil, err
+		}
+		if err := module.SetRestartPolicy(restartPolicy); err != nil {
+			return nil, fmt.Errorf("failed to update module restart policy: %v", err)
+		}
+	}
 	return &dto.UpdateModuleResponse{}, nil
 }
 
+func (svc *moduleService) ListRevisions(ctx context.Context, request *dto.ListModuleRevisionsRequest) (*dto.ListModuleRevisionsResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("List module revisions request")
+
+	if request == nil {
+		return nil, errors.New("request must not be nil")
+	}
+
+	records, err := svc.moduleManager.ListRevisions(request.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list module revisions: %w", err)
+	}
+
+	revisions := make([]*dto.ModuleRevision, 0)
+	for _, record := range records {
+		revisions = append(revisions, &dto.ModuleRevision{
+			Revision:      record.Revision,
+			Image:         record.Image,
+			Configuration: record.Configuration,
+			Resources:     resourcesToDto(record.GetSpec().Resources),
+			Security:      securityToDto(record.GetSpec().Security),
+			Storage:       storageToDto(record.GetSpec().Storage),
+			Placement:     placementToDto(record.Placement),
+			ChangedBy:     record.ChangedBy,
+			Message:       record.Message,
+			CreatedAt:     record.CreatedAt,
+			Removed:       record.Removed,
+		})
+	}
+	// removed modules report their tombstone as the current revision
+	return &dto.ListModuleRevisionsResponse{
+		Revision:  records[len(records)-1].Revision,
+		Revisions: revisions,
+	}, nil
+}
+
+// RollbackModule restores the image, configuration and placement of an earlier revision as a
+// new revision, a running module gets them rolled across its agents like an update.
+func (svc *moduleService) RollbackModule(ctx context.Context, request *dto.RollbackModuleRequest) (*dto.RollbackModuleResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Rollback module request")
+
+	if request == nil {
+		return nil, errors.New("request must not be nil")
+	}
+
+	module, err := svc.moduleManager.GetModule(request.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get module: %w", err)
+	}
+	revision, err := module.LoadRevision(request.Revision)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load module revision %d: %w", request.Revision, err)
+	}
+	if !svc.imageManager.ImageExists(revision.Image) {
+		return nil, fmt.Errorf("image of revision %d no longer exists: %s: %w", revision.Revision, revision.Image, errs.ErrNotAllowed)
+	}
+
+	message := fmt.Sprintf("rolled back to revision %d", revision.Revision)
+	if err := svc.applyRevision(ctx, module, revision.GetSpec(), revision.Placement, manager.NewRolloutStrategyDefault(), message); err != nil {
+		return nil, err
+	}
+	log.Info().Msgf("Module rolled back: moduleID=%s, toRevision=%d, revision=%d", module.GetID(), revision.Revision, module.GetRevision())
+
+	return &dto.RollbackModuleResponse{
+		Revision: module.GetRevision(),
+	}, nil
+}
+
+// applyRevision makes the spec and placement the next revision of the module. A new spec of a
+// running module is rolled across its agents in batches, and the module is moved to the agents a
+// new placement targets.
+func (svc *moduleService) applyRevision(ctx context.Context, module *manager.Module, spec *manager.ModuleSpec, placement *manager.Placement, strategy *manager.RolloutStrategy, message string) error {
+	log := zerolog.Ctx(ctx)
+
+	// secrets referenced by a restored revision might have been deleted since
+	if err := svc.secretManager.CheckSecretsExist(spec.SecretReferences()); err != nil {
+		return err
+	}
+
+	changedBy, _ := utils.GetUser(ctx)
+	oldPlacement := module.GetPlacement()
+
+	if module.IsRunning() && !spec.Equal(module.GetSpec()) {
+		agentIDs := []string{}
+		for _, agent := range svc.agentManager.ListAgents() {
+			if oldPlacement.Matches(agent) && placement.Matches(agent) && agentRunsModule(agent, module.GetID()) {
+				agentIDs = append(agentIDs, agent.GetID())
+			}
+		}
+		rollout, err := module.StartRollout(spec, placement, strategy, agentIDs, changedBy, message)
+		if err != nil {
+			return fmt.Errorf("failed to start module rollout: %w", err)
+		}
+		log.Info().Msgf("Module rollout started: moduleID=%s, rolloutID=%s, revision=%d, batches=%d", module.GetID(), rollout.ID, rollout.To.Revision, len(rollout.Batches))
+	} else if err := module.SetSpec(spec, placement, changedBy, message); err != nil {
+		return fmt.Errorf("failed to update module: %w", err)
+	}
+
+	// move running module to the newly targeted agents
+	if module.IsRunning() && !oldPlacement.Equal(placement) {
+		for _, agent := range svc.agentManager.ListAgents() {
+			wasPlaced, isPlaced := oldPlacement.Matches(agent), placement.Matches(agent)
+			if wasPlaced && !isPlaced {
+				svc.stopModuleOnAgent(ctx, agent, module)
+			} else if !wasPlaced && isPlaced {
+				svc.startModuleOnAgent(ctx, agent, module)
+			}
+		}
+	}
+	return nil
+}
+
 func (svc *moduleService) DeleteModule(ctx context.Context, request *dto.DeleteModuleRequest) (*dto.DeleteModuleResponse, error) {
 	log := zerolog.Ctx(ctx)
 	log.Info().Msg("Delete module request")
@@ -136,12 +361,64 @@ func (svc *moduleService) DeleteModule(ctx context.Context, request *dto.DeleteM
 		return nil, errs.ErrNotAllowed
 	}
 
-	if err := svc.moduleManager.RemoveModule(request.ID); err != nil {
+	removedBy, _ := utils.GetUser(ctx)
+	if err := svc.moduleManager.RemoveModule(request.ID, removedBy); err != nil {
 		return nil, fmt.Errorf("failed to remove module: %v", err)
 	}
 	return &dto.DeleteModuleResponse{}, nil
 }
 
+func (svc *moduleService) GetRollout(ctx context.Context, request *dto.GetModuleRolloutRequest) (*dto.GetModuleRolloutResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Get module rollout request")
+
+	if request == nil {
+		return nil, errors.New("request must not be nil")
+	}
+
+	module, err := svc.moduleManager.GetModule(request.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get module: %v", err)
+	}
+	rollout := module.GetRollout()
+	if rollout == nil {
+		return nil, errs.ErrNotFound
+	}
+
+	// status of the module on the agents of the rollout, as last reported by them
+	agentStatuses := map[string]string{}
+	for _, batch := range rollout.Batches {
+		for _, agentID := range batch {
+			agent, err := svc.agentManager.GetAgent(agentID)
+			if err != nil {
+				continue
+			}
+			diag := agent.GetDiagnostics()
+			if diag == nil {
+				continue
+			}
+			if status, ok := diag.ModuleStatuses[module.GetID()]; ok {
+				agentStatuses[agentID] = fmt.Sprintf("%s (revision %d)", status, diag.ModuleRevisions[module.GetID()])
+			}
+		}
+	}
+
+	return &dto.GetModuleRolloutResponse{
+		ID:             rollout.ID,
+		FromRevision:   rollout.From.Revision,
+		ToRevision:     rollout.To.Revision,
+		Strategy:       rolloutStrategyToDto(rollout.Strategy),
+		Batches:        rollout.Batches,
+		CurrentBatch:   rollout.CurrentBatch,
+		State:          rollout.State,
+		Message:        rollout.Message,
+		AgentStatuses:  agentStatuses,
+		StartedAt:      rollout.StartedAt,
+		BatchStartedAt: rollout.BatchStartedAt,
+		FinishedAt:     rollout.FinishedAt,
+	}, nil
+}
+
 func (svc *moduleService) StartModule(ctx context.Context, request *dto.StartModuleRequest) (*dto.StartModuleResponse, error) {
 	log := zerolog.Ctx(ctx)
 	log.Info().Msg("Start modules request")
@@ -155,33 +432,16 @@ func (svc *moduleService) StartModule(ctx context.Context, request *dto.StartMod
 		return nil, fmt.Errorf("failed to get module: %v", err)
 	}
 
+	placement := module.GetPlacement()
 	for _, agent := range svc.agentManager.ListAgents() {
-		agentID := agent.GetID()
-		moduleID := module.GetID()
-		moduleCfg := module.GetConfiguration()
-		imageID := module.GetImage()
-
-		c := agent.GetModuleServiceClient()
-		if c == nil {
-			continue
-		}
-		log.Info().Msgf("Starting module: agentID=%s, moduleID=%s, moduleCfg=%v, imageID=%s", agentID, moduleID, moduleCfg, imageID)
-
-		if _, err := c.StartModule(ctx, &pb.ModuleConfiguration{
-			Module: &pb.ModuleIdentifier{
-				Id: moduleID,
-			},
-			Image: &pb.ImageIdentifier{
-				Id: imageID,
-			},
-			Env: moduleCfg,
-		}); err != nil {
-			log.Info().Msgf("could not get response: %v", err)
+		if !placement.Matches(agent) {
 			continue
 		}
-		log.Info().Msgf("Module start response: agentID=%s, moduleID=%s, moduleCfg=%v, imageID=%s", agentID, moduleID, moduleCfg, imageID)
+		svc.startModuleOnAgent(ctx, agent, module)
+	}
+	if err := module.SetRunning(true); err != nil {
+		return nil, fmt.Errorf("failed to update module state: %v", err)
 	}
-	module.SetRunning(true)
 
 	return &dto.StartModuleResponse{}, nil
 }
@@ -199,30 +459,24 @@ func (svc *moduleService) StopModule(ctx context.Context, request *dto.StopModul
 		return nil, fmt.Errorf("failed to get module: %v", err)
 	}
 
+	placement := module.GetPlacement()
 	for _, agent := range svc.agentManager.ListAgents() {
-		agentID := agent.GetID()
-		moduleID := module.GetID()
-
-		c := agent.GetModuleServiceClient()
-		if c == nil {
-			continue
-		}
-		log.Info().Msgf("Stopping module: agentID=%s, moduleID=%s", agentID, moduleID)
-
-		if _, err := c.StopModule(ctx, &pb.ModuleIdentifier{
-			Id: moduleID,
-		}); err != nil {
-			log.Info().Msgf("could not get response: %v", err)
+		// stop also instances left behind on agents that are no longer targeted
+		if !placement.Matches(agent) && !agentRunsModule(agent, module.GetID()) {
 			continue
 		}
-
-		log.Info().Msgf("Module stop response: agentID=%s, moduleID=%s", agentID, moduleID)
+		svc.stopModuleOnAgent(ctx, agent, module)
+	}
+	if err := module.SetRunning(false); err != nil {
+		return nil, fmt.Errorf("failed to update module state: %v", err)
 	}
-	module.SetRunning(false)
 
 	return &dto.StopModuleResponse{}, nil
 }
 
+// SendData delivers the data to the module on the targeted agents. The outcome for each agent
+// is returned and recorded under the message ID. When any one agent is targeted, the agents
+// running the module are tried in random order until one of them delivers the data.
 func (svc *moduleService) SendData(ctx context.Context, request *dto.SendDataRequest) (*dto.SendDataResponse, error) {
 	log := zerolog.Ctx(ctx)
 	log.Info().Msg("Send data request")
@@ -235,27 +489,365 @@ func (svc *moduleService) SendData(ctx context.Context, request *dto.SendDataReq
 		return nil, errs.ErrNotFound
 	}
 
-	for _, agent := range svc.agentManager.ListAgents() {
-		agentID := agent.GetID()
+	agents, err := svc.sendDataTargets(request.ModuleID, request.Target)
+	if err != nil {
+		return nil, err
+	}
+	anyAgent := request.Target != nil && request.Target.Any
+
+	messageID := uuid.New().String()
+	recipients := []manager.DeliveryRecipient{}
+	for _, agent := range agents {
+		agentRecipients := svc.sendDataToAgent(ctx, agent, request.ModuleID, messageID, request.Data)
+		recipients = append(recipients, agentRecipients...)
+		// agents which don't confirm deliveries took the data, trying another one would duplicate it
+		delivered := !slices.ContainsFunc(agentRecipients, func(recipient manager.DeliveryRecipient) bool {
+			return recipient.Outcome != manager.DeliveryOutcomeDelivered && recipient.Outcome != manager.DeliveryOutcomeUnconfirmed
+		})
+		if anyAgent && delivered {
+			break
+		}
+	}
 
-		c := agent.GetShareServiceClient()
-		if c == nil {
-			continue
+	if err := svc.deliveryManager.RecordDelivery(&manager.Delivery{
+		ID:         messageID,
+		Direction:  manager.DeliveryDirectionToModule,
+		ModuleID:   request.ModuleID,
+		CreatedAt:  time.Now(),
+		Recipients: recipients,
+	}); err != nil {
+		log.Error().Err(err).Msgf("Failed to record delivery: messageID=%s", messageID)
+	}
+
+	return &dto.SendDataResponse{
+		MessageID:  messageID,
+		Recipients: deliveryRecipientsToDTO(recipients),
+	}, nil
+}
+
+// sendDataTargets returns the agents the data is sent to. Without a target these are the agents
+// running the module, any one of them is picked from a shuffled list.
+func (svc *moduleService) sendDataTargets(moduleID string, target *dto.SendDataTarget) ([]*manager.Agent, error) {
+	switch {
+	case target != nil && target.AgentID != "":
+		agent, err := svc.agentManager.GetAgent(target.AgentID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get agent: %w", err)
 		}
-		log.Info().Msgf("Sending data: agentID=%s, moduleID=%s", agentID, request.ModuleID)
-
-		if _, err := c.PushData(ctx, &pb.ShareData{
-			Receiver: &pb.ModuleIdentifier{
-				Id: request.ModuleID,
-			},
-			Data: request.Data,
-		}); err != nil {
-			log.Info().Msgf("could not get response: %v", err)
-			continue
+		return []*manager.Agent{agent}, nil
+	case target != nil && target.Selector != "":
+		selector, err := utils.ParseLabelSelector(target.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse label selector: %v", err)
+		}
+		agents := []*manager.Agent{}
+		for _, agent := range svc.agentManager.ListAgents() {
+			if selector.Matches(agent.GetLabels()) {
+				agents = append(agents, agent)
+			}
+		}
+		return agents, nil
+	default:
+		agents := []*manager.Agent{}
+		for _, agent := range svc.agentManager.ListAgents() {
+			if agentRunsModule(agent, moduleID) {
+				agents = append(agents, agent)
+			}
+		}
+		if target != nil && target.Any {
+			if len(agents) == 0 {
+				return nil, fmt.Errorf("%w: no connected agent runs the module", errs.ErrConflict)
+			}
+			rand.Shuffle(len(agents), func(i, j int) { agents[i], agents[j] = agents[j], agents[i] })
 		}
+		return agents, nil
+	}
+}
+
+// sendDataToAgent delivers the data to the module on the agent and returns the outcome.
+func (svc *moduleService) sendDataToAgent(ctx context.Context, agent *manager.Agent, moduleID, messageID string, data []byte) []manager.DeliveryRecipient {
+	log := zerolog.Ctx(ctx)
+
+	agentID := agent.GetID()
+	c := agent.GetShareServiceClient()
+	if c == nil {
+		return []manager.DeliveryRecipient{{
+			AgentID:  agentID,
+			ModuleID: moduleID,
+			Outcome:  manager.DeliveryOutcomeUnreachable,
+			Error:    "agent is offline",
+		}}
+	}
+	log.Info().Msgf("Sending data: agentID=%s, moduleID=%s, messageID=%s", agentID, moduleID, messageID)
+
+	report, err := c.PushData(ctx, &pb.ShareData{
+		Receiver: &pb.ModuleIdentifier{
+			Id: moduleID,
+		},
+		Data:      data,
+		MessageId: messageID,
+	})
+	if err != nil {
+		log.Info().Msgf("could not get response: %v", err)
+		return []manager.DeliveryRecipient{{
+			AgentID:  agentID,
+			ModuleID: moduleID,
+			Outcome:  manager.DeliveryOutcomeUnreachable,
+			Error:    err.Error(),
+		}}
+	}
+
+	log.Info().Msgf("Module data response: agentID=%s, moduleID=%s", agentID, moduleID)
+	return manager.DeliveryRecipients(agentID, moduleID, report)
+}
+
+func (svc *moduleService) startModuleOnAgent(ctx context.Context, agent *manager.Agent, module *manager.Module) {
+	log := zerolog.Ctx(ctx)
+
+	agentID := agent.GetID()
+	moduleID := module.GetID()
+	spec := module.SpecFor(agentID)
+	moduleCfg := spec.Configuration
+	imageID := spec.Image
+
+	c := agent.GetModuleServiceClient()
+	if c == nil {
+		return
+	}
+	log.Info().Msgf("Starting module: agentID=%s, moduleID=%s, moduleCfg=%v, imageID=%s", agentID, moduleID, moduleCfg, imageID)
+
+	cfg := moduleConfiguration(module, agentID)
+	if err := revealSecrets(agent, []*pb.ModuleConfiguration{cfg}, svc.secretManager); err != nil {
+		log.Error().Err(err).Msg("")
+		return
+	}
+	if _, err := c.StartModule(ctx, cfg); err != nil {
+		log.Info().Msgf("could not get response: %v", err)
+		return
+	}
+	log.Info().Msgf("Module start response: agentID=%s, moduleID=%s, moduleCfg=%v, imageID=%s", agentID, moduleID, moduleCfg, imageID)
+}
+
+func (svc *moduleService) stopModuleOnAgent(ctx context.Context, agent *manager.Agent, module *manager.Module) {
+	log := zerolog.Ctx(ctx)
+
+	agentID := agent.GetID()
+	moduleID := module.GetID()
+
+	c := agent.GetModuleServiceClient()
+	if c == nil {
+		return
+	}
+	log.Info().Msgf("Stopping module: agentID=%s, moduleID=%s", agentID, moduleID)
+
+	if _, err := c.StopModule(ctx, &pb.ModuleIdentifier{
+		Id: moduleID,
+	}); err != nil {
+		log.Info().Msgf("could not get response: %v", err)
+		return
+	}
+
+	log.Info().Msgf("Module stop response: agentID=%s, moduleID=%s", agentID, moduleID)
+}
+
+func agentRunsModule(agent *manager.Agent, moduleID string) bool {
+	diag := agent.GetDiagnostics()
+	if diag == nil {
+		return false
+	}
+	_, ok := diag.PresentModules[moduleID]
+	return ok
+}
+
+func placementFromDto(placement *dto.ModulePlacement) *manager.Placement {
+	if placement == nil {
+		return manager.NewPlacementAll()
+	}
+	agentIDs := placement.AgentIDs
+	if agentIDs == nil {
+		agentIDs = []string{}
+	}
+	return &manager.Placement{
+		All:      placement.All,
+		AgentIDs: agentIDs,
+		Selector: placement.Selector,
+	}
+}
+
+func placementToDto(placement *manager.Placement) *dto.ModulePlacement {
+	return &dto.ModulePlacement{
+		All:      placement.All,
+		AgentIDs: placement.AgentIDs,
+		Selector: placement.Selector,
+	}
+}
+
+func restartPolicyFromDto(restartPolicy *dto.ModuleRestartPolicy) *manager.RestartPolicy {
+	if restartPolicy == nil {
+		return manager.NewRestartPolicyNever()
+	}
+	return &manager.RestartPolicy{
+		Policy:     restartPolicy.Policy,
+		MaxRetries: restartPolicy.MaxRetries,
+	}
+}
 
-		log.Info().Msgf("Module data response: agentID=%s, moduleID=%s", agentID, request.ModuleID)
+func restartPolicyToDto(restartPolicy *manager.RestartPolicy) *dto.ModuleRestartPolicy {
+	return &dto.ModuleRestartPolicy{
+		Policy:     restartPolicy.Policy,
+		MaxRetries: restartPolicy.MaxRetries,
 	}
+}
 
-	return &dto.SendDataResponse{}, nil
+// rolloutStrategyFromDto returns the rollout strategy, unset fields fall back to the defaults.
+func rolloutStrategyFromDto(strategy *dto.ModuleRolloutStrategy) *manager.RolloutStrategy {
+	rolloutStrategy := manager.NewRolloutStrategyDefault()
+	if strategy == nil {
+		return rolloutStrategy
+	}
+	if strategy.MaxUnavailable > 0 {
+		rolloutStrategy.MaxUnavailable = strategy.MaxUnavailable
+	}
+	if strategy.ProgressDeadline > 0 {
+		rolloutStrategy.ProgressDeadline = strategy.ProgressDeadline
+	}
+	rolloutStrategy.CanaryPercentage = strategy.CanaryPercentage
+	return rolloutStrategy
+}
+
+func rolloutStrategyToDto(strategy *manager.RolloutStrategy) *dto.ModuleRolloutStrategy {
+	return &dto.ModuleRolloutStrategy{
+		MaxUnavailable:   strategy.MaxUnavailable,
+		CanaryPercentage: strategy.CanaryPercentage,
+		ProgressDeadline: strategy.ProgressDeadline,
+	}
+}
+
+func resourcesFromDto(resources *dto.ModuleResources) *manager.ModuleResources {
+	if resources == nil {
+		return &manager.ModuleResources{}
+	}
+	return &manager.ModuleResources{
+		CPUs:        resources.CPUs,
+		MemoryBytes: resources.MemoryBytes,
+		PidsLimit:   resources.PidsLimit,
+	}
+}
+
+func resourcesToDto(resources *manager.ModuleResources) *dto.ModuleResources {
+	return &dto.ModuleResources{
+		CPUs:        resources.CPUs,
+		MemoryBytes: resources.MemoryBytes,
+		PidsLimit:   resources.PidsLimit,
+	}
+}
+
+func securityFromDto(security *dto.ModuleSecurity) *manager.ModuleSecurity {
+	if security == nil {
+		return manager.NewModuleSecurityDefault()
+	}
+	capAdd := security.CapAdd
+	if capAdd == nil {
+		capAdd = []string{}
+	}
+	capDrop := security.CapDrop
+	if capDrop == nil {
+		capDrop = []string{}
+	}
+	tmpfs := security.Tmpfs
+	if tmpfs == nil {
+		tmpfs = map[string]string{}
+	}
+	return &manager.ModuleSecurity{
+		ReadOnlyRootfs:  security.ReadOnlyRootfs,
+		User:            security.User,
+		CapAdd:          capAdd,
+		CapDrop:         capDrop,
+		SeccompProfile:  security.SeccompProfile,
+		NoNewPrivileges: security.NoNewPrivileges,
+		Privileged:      security.Privileged,
+		HostNetwork:     security.HostNetwork,
+		Tmpfs:           tmpfs,
+	}
+}
+
+func securityToDto(security *manager.ModuleSecurity) *dto.ModuleSecurity {
+	return &dto.ModuleSecurity{
+		ReadOnlyRootfs:  security.ReadOnlyRootfs,
+		User:            security.User,
+		CapAdd:          security.CapAdd,
+		CapDrop:         security.CapDrop,
+		SeccompProfile:  security.SeccompProfile,
+		NoNewPrivileges: security.NoNewPrivileges,
+		Privileged:      security.Privileged,
+		HostNetwork:     security.HostNetwork,
+		Tmpfs:           security.Tmpfs,
+	}
+}
+
+// storageFromDto converts the storage, volumes without retention are kept until the module is
+// deleted.
+func storageFromDto(storage *dto.ModuleStorage) *manager.ModuleStorage {
+	result := manager.NewModuleStorageDefault()
+	if storage == nil {
+		return result
+	}
+	for _, volume := range storage.Volumes {
+		retention := volume.Retention
+		if retention == "" {
+			retention = constants.ModuleVolumeRetentionUntilDelete
+		}
+		result.Volumes = append(result.Volumes, &manager.ModuleVolume{
+			Name:      volume.Name,
+			Path:      volume.Path,
+			ReadOnly:  volume.ReadOnly,
+			Retention: retention,
+		})
+	}
+	for _, bind := range storage.BindMounts {
+		result.BindMounts = append(result.BindMounts, &manager.ModuleBindMount{
+			HostPath: bind.HostPath,
+			Path:     bind.Path,
+			ReadOnly: bind.ReadOnly,
+		})
+	}
+	for _, secret := range storage.Secrets {
+		result.Secrets = append(result.Secrets, &manager.ModuleSecretMount{
+			Secret: secret.Secret,
+			Path:   secret.Path,
+		})
+	}
+	return result
+}
+
+func storageToDto(storage *manager.ModuleStorage) *dto.ModuleStorage {
+	volumes := make([]*dto.ModuleVolume, 0, len(storage.Volumes))
+	for _, volume := range storage.Volumes {
+		volumes = append(volumes, &dto.ModuleVolume{
+			Name:      volume.Name,
+			Path:      volume.Path,
+			ReadOnly:  volume.ReadOnly,
+			Retention: volume.Retention,
+		})
+	}
+	bindMounts := make([]*dto.ModuleBindMount, 0, len(storage.BindMounts))
+	for _, bind := range storage.BindMounts {
+		bindMounts = append(bindMounts, &dto.ModuleBindMount{
+			HostPath: bind.HostPath,
+			Path:     bind.Path,
+			ReadOnly: bind.ReadOnly,
+		})
+	}
+	secrets := make([]*dto.ModuleSecretMount, 0, len(storage.Secrets))
+	for _, secret := range storage.Secrets {
+		secrets = append(secrets, &dto.ModuleSecretMount{
+			Secret: secret.Secret,
+			Path:   secret.Path,
+		})
+	}
+	return &dto.ModuleStorage{
+		Volumes:    volumes,
+		BindMounts: bindMounts,
+		Secrets:    secrets,
+	}
 }
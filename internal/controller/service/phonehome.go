@@ -11,26 +11,40 @@ import (
 	pb "github.com/pajtaand/dmap-zero/internal/proto"
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc/peer"
-	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 type phonehomeService struct {
 	pb.UnimplementedPhonehomeServiceServer
 
-	agentManager *manager.AgentManager
+	agentManager  *manager.AgentManager
+	imageManager  *manager.ImageManager
+	moduleManager *manager.ModuleManager
+	secretManager *manager.SecretManager
 }
 
-func NewPhonehomeService(agentManager *manager.AgentManager) (pb.PhonehomeServiceServer, error) {
+func NewPhonehomeService(agentManager *manager.AgentManager, imageManager *manager.ImageManager, moduleManager *manager.ModuleManager, secretManager *manager.SecretManager) (pb.PhonehomeServiceServer, error) {
 	if agentManager == nil {
 		return nil, errors.New("AgentManager must not be nil")
 	}
+	if imageManager == nil {
+		return nil, errors.New("ImageManager must not be nil")
+	}
+	if moduleManager == nil {
+		return nil, errors.New("ModuleManager must not be nil")
+	}
+	if secretManager == nil {
+		return nil, errors.New("SecretManager must not be nil")
+	}
 
 	return &phonehomeService{
-		agentManager: agentManager,
+		agentManager:  agentManager,
+		imageManager:  imageManager,
+		moduleManager: moduleManager,
+		secretManager: secretManager,
 	}, nil
 }
 
-func (svc *phonehomeService) Phonehome(ctx context.Context, data *pb.PhonehomeData) (*emptypb.Empty, error) {
+func (svc *phonehomeService) Phonehome(ctx context.Context, data *pb.PhonehomeData) (*pb.DesiredState, error) {
 	log := zerolog.Ctx(ctx)
 	log.Info().Msg("Phonehome request")
 
@@ -67,20 +81,80 @@ func (svc *phonehomeService) Phonehome(ctx context.Context, data *pb.PhonehomeDa
 	}
 	metrics.AgentPresentImagesGauge.WithLabelValues(agent.GetID()).Set(float64(len(data.Images)))
 
+	rejectedImages := map[string]string{}
+	for key, reason := range data.RejectedImages {
+		log.Warn().Msgf("Agent refused to load image: agentID=%s, imageID=%s, reason=%s", agent.GetID(), key, reason)
+		rejectedImages[key] = reason
+	}
+	metrics.AgentRejectedImagesGauge.WithLabelValues(agent.GetID()).Set(float64(len(rejectedImages)))
+
+	rejectedModules := map[string]*manager.ModuleRejection{}
+	for key, rejection := range data.RejectedModules {
+		log.Warn().Msgf("Agent refused to run module: agentID=%s, moduleID=%s, revision=%d, reason=%s", agent.GetID(), key, rejection.Revision, rejection.Reason)
+		rejectedModules[key] = &manager.ModuleRejection{
+			Revision: int(rejection.Revision),
+			Reason:   rejection.Reason,
+		}
+	}
+
+	volumeUsage := map[string]map[string]int64{}
+	for moduleID, usage := range data.VolumeUsage {
+		volumeUsage[moduleID] = usage.SizeBytes
+		for volume, size := range usage.SizeBytes {
+			metrics.AgentModuleVolumeBytesGauge.WithLabelValues(agent.GetID(), moduleID, volume).Set(float64(size))
+		}
+	}
+
+	subscriptions := map[string][]string{}
+	for topic, subscribers := range data.Subscriptions {
+		subscriptions[topic] = subscribers.Modules
+	}
+
 	presentModules := map[string]string{}
+	moduleStatuses := map[string]string{}
+	moduleRestarts := map[string]int{}
+	moduleRevisions := map[string]int{}
+	unhealthyModules := 0
+	crashLoopingModules := 0
 	for key, value := range data.Modules {
 		presentModules[key] = value.Id
+		moduleStatuses[key] = value.Status.String()
+		moduleRestarts[key] = int(value.RestartCount)
+		moduleRevisions[key] = int(value.Revision)
+		switch value.Status {
+		case pb.ModuleStatus_UNHEALTHY:
+			unhealthyModules++
+		case pb.ModuleStatus_CRASH_LOOP:
+			crashLoopingModules++
+		}
+		metrics.AgentModuleRestartsGauge.WithLabelValues(agent.GetID(), key).Set(float64(value.RestartCount))
 	}
 	metrics.AgentRunningModulesGauge.WithLabelValues(agent.GetID()).Set(float64(len(data.Modules)))
+	metrics.AgentUnhealthyModulesGauge.WithLabelValues(agent.GetID()).Set(float64(unhealthyModules))
+	metrics.AgentCrashLoopingModulesGauge.WithLabelValues(agent.GetID()).Set(float64(crashLoopingModules))
 
 	if err := svc.agentManager.ReceiveAgentDiagnostics(sourceIdentity, &manager.Diagnostics{
-		PresentImages:  presentImage,
-		PresentModules: presentModules,
+		PresentImages:   presentImage,
+		PresentModules:  presentModules,
+		ModuleStatuses:  moduleStatuses,
+		ModuleRestarts:  moduleRestarts,
+		ModuleRevisions: moduleRevisions,
+		RejectedImages:  rejectedImages,
+		RejectedModules: rejectedModules,
+		VolumeUsage:     volumeUsage,
+		Subscriptions:   subscriptions,
 	}); err != nil {
 		err := fmt.Errorf("failed to push agent diagnostics: %v", err)
 		log.Error().Err(err).Msg("")
 		return nil, err
 	}
 
-	return &emptypb.Empty{}, nil
+	// reply with the desired state, the agent converges to it
+	state := desiredAgentState(agent, svc.imageManager, svc.moduleManager)
+	state.Subscriptions = topicSubscriptions(agent, svc.agentManager)
+	if err := revealSecrets(agent, state.Modules, svc.secretManager); err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+	return state, nil
 }
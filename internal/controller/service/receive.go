@@ -5,31 +5,41 @@ import (
 	"errors"
 	"fmt"
 
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pajtaand/dmap-zero/internal/common/delivery"
 	"github.com/pajtaand/dmap-zero/internal/common/utils"
 	"github.com/pajtaand/dmap-zero/internal/controller/manager"
 	pb "github.com/pajtaand/dmap-zero/internal/proto"
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc/peer"
-	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 type receiveService struct {
 	pb.UnimplementedReceiveServiceServer
 
-	webhookManager *manager.WebhookManager
+	webhookManager  *manager.WebhookManager
+	deliveryManager *manager.DeliveryManager
 }
 
-func NewReceiveService(webhookManager *manager.WebhookManager) (pb.ReceiveServiceServer, error) {
+func NewReceiveService(webhookManager *manager.WebhookManager, deliveryManager *manager.DeliveryManager) (pb.ReceiveServiceServer, error) {
 	if webhookManager == nil {
 		return nil, errors.New("WebhookManager must not be nil")
 	}
+	if deliveryManager == nil {
+		return nil, errors.New("DeliveryManager must not be nil")
+	}
 
 	return &receiveService{
-		webhookManager: webhookManager,
+		webhookManager:  webhookManager,
+		deliveryManager: deliveryManager,
 	}, nil
 }
 
-func (svc *receiveService) PushData(ctx context.Context, data *pb.ModuleControllerData) (*emptypb.Empty, error) {
+// PushData delivers the data sent by the module to its webhooks, records the outcome and reports
+// it back to the agent. A failed delivery is reported rather than returned as an error.
+func (svc *receiveService) PushData(ctx context.Context, data *pb.ModuleControllerData) (*pb.DeliveryReport, error) {
 	log := zerolog.Ctx(ctx)
 	log.Info().Msg("Push data request")
 
@@ -51,13 +61,39 @@ func (svc *receiveService) PushData(ctx context.Context, data *pb.ModuleControll
 		return nil, err
 	}
 
-	log.Info().Msgf("Received module message: agentID=%s, moduleID=%s, Receiver=%s", sourceIdentity, data.Sender, data.Receiver)
+	log.Info().Msgf("Received module message: agentID=%s, moduleID=%s, Receiver=%s, messageID=%s", sourceIdentity, data.Sender, data.Receiver, data.MessageId)
 
-	if err := svc.webhookManager.SendData(data.Sender.Id, data.Receiver, data.Data); err != nil {
-		err := fmt.Errorf("failed to push data to module: %v", err)
-		log.Error().Err(err).Msg("")
-		return nil, err
+	messageID := data.MessageId
+	if messageID == "" {
+		// sent by an agent which doesn't assign message IDs
+		messageID = uuid.New().String()
 	}
 
-	return &emptypb.Empty{}, nil
+	err = svc.webhookManager.SendData(data.Sender.Id, messageID, data.Receiver, data.Data)
+	if err != nil {
+		err = fmt.Errorf("failed to push data to webhooks: %w", err)
+		log.Warn().Err(err).Msgf("Message not delivered: messageID=%s", messageID)
+	}
+	result := delivery.ResultOf(data.Receiver, err)
+	recipient := manager.DeliveryRecipient{
+		ModuleID: result.ModuleID,
+		Outcome:  result.Outcome,
+		Error:    result.Error,
+	}
+
+	if err := svc.deliveryManager.RecordDelivery(&manager.Delivery{
+		ID:            messageID,
+		Direction:     manager.DeliveryDirectionFromModule,
+		ModuleID:      data.Sender.Id,
+		Receiver:      data.Receiver,
+		SourceAgentID: sourceIdentity,
+		CreatedAt:     time.Now(),
+		Recipients:    []manager.DeliveryRecipient{recipient},
+	}); err != nil {
+		log.Error().Err(err).Msgf("Failed to record delivery: messageID=%s", messageID)
+	}
+
+	return &pb.DeliveryReport{
+		Results: []*pb.DeliveryResult{result.Proto()},
+	}, nil
 }
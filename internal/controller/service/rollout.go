@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+	"github.com/pajtaand/dmap-zero/internal/controller/manager"
+	pb "github.com/pajtaand/dmap-zero/internal/proto"
+	"github.com/rs/zerolog/log"
+)
+
+// RolloutService drives module rollouts. Agents pick up the revision of their batch on their next
+// phonehome, a batch is done once all its agents report the new revision as healthy.
+type RolloutService struct {
+	moduleManager *manager.ModuleManager
+	agentManager  *manager.AgentManager
+}
+
+func NewRolloutService(moduleManager *manager.ModuleManager, agentManager *manager.AgentManager) (*RolloutService, error) {
+	if moduleManager == nil {
+		return nil, errors.New("ModuleManager must not be nil")
+	}
+	if agentManager == nil {
+		return nil, errors.New("AgentManager must not be nil")
+	}
+
+	return &RolloutService{
+		moduleManager: moduleManager,
+		agentManager:  agentManager,
+	}, nil
+}
+
+func (svc *RolloutService) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			// context cancelled
+			return
+		default:
+			for _, module := range svc.moduleManager.ListModules() {
+				if err := svc.checkRollout(module); err != nil {
+					log.Error().Err(err).Msgf("Failed to check rollout: moduleID=%s", module.GetID())
+				}
+			}
+		}
+		time.Sleep(constants.ControllerRolloutCheckInterval)
+	}
+}
+
+// checkRollout advances the module's active rollout to the next batch once the current batch is
+// healthy, and rolls the module back when the batch crash loops or misses its deadline.
+func (svc *RolloutService) checkRollout(module *manager.Module) error {
+	rollout := module.GetRollout()
+	if rollout == nil || !rollout.IsActive() {
+		return nil
+	}
+	moduleID := module.GetID()
+
+	if !module.IsRunning() {
+		log.Info().Msgf("Module stopped during rollout, finishing it: moduleID=%s, rolloutID=%s", moduleID, rollout.ID)
+		return module.FinishRollout("module was stopped")
+	}
+
+	done := true
+	for _, agentID := range rollout.GetCurrentBatch() {
+		agent, err := svc.agentManager.GetAgent(agentID)
+		if err != nil {
+			continue // agent was removed
+		}
+		diag := agent.GetDiagnostics()
+		if diag == nil {
+			// offline agents aren't known to be healthy, the batch waits for them until its deadline
+			done = false
+			continue
+		}
+
+		if rejection, ok := diag.RejectedModules[moduleID]; ok && rejection.Revision == rollout.To.Revision {
+			reason := fmt.Sprintf("agent %s refused to run revision %d: %s", agentID, rejection.Revision, rejection.Reason)
+			log.Warn().Msgf("Rolling back module: moduleID=%s, rolloutID=%s, reason=%s", moduleID, rollout.ID, reason)
+			return module.RollBack(reason)
+		}
+
+		status := diag.ModuleStatuses[moduleID]
+		revision := diag.ModuleRevisions[moduleID]
+		if revision == rollout.To.Revision && status == pb.ModuleStatus_CRASH_LOOP.String() {
+			reason := fmt.Sprintf("revision %d crash loops on agent %s", revision, agentID)
+			log.Warn().Msgf("Rolling back module: moduleID=%s, rolloutID=%s, reason=%s", moduleID, rollout.ID, reason)
+			return module.RollBack(reason)
+		}
+		if revision != rollout.To.Revision || status != pb.ModuleStatus_HEALTHY.String() {
+			done = false
+		}
+	}
+
+	if !done {
+		if time.Since(rollout.BatchStartedAt) > rollout.GetProgressDeadline() {
+			reason := fmt.Sprintf("batch %d didn't become healthy within %s", rollout.CurrentBatch+1, rollout.GetProgressDeadline())
+			log.Warn().Msgf("Rolling back module: moduleID=%s, rolloutID=%s, reason=%s", moduleID, rollout.ID, reason)
+			return module.RollBack(reason)
+		}
+		return nil
+	}
+
+	log.Info().Msgf("Rollout batch healthy: moduleID=%s, rolloutID=%s, batch=%d/%d", moduleID, rollout.ID, rollout.CurrentBatch+1, len(rollout.Batches))
+	return module.AdvanceRollout()
+}
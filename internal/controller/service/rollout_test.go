@@ -0,0 +1,183 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pajtaand/dmap-zero/internal/common/constants"
+	"github.com/pajtaand/dmap-zero/internal/common/database"
+	"github.com/pajtaand/dmap-zero/internal/controller/manager"
+	pb "github.com/pajtaand/dmap-zero/internal/proto"
+)
+
+type rolloutFixture struct {
+	database      database.Database
+	svc           *RolloutService
+	agentManager  *manager.AgentManager
+	moduleManager *manager.ModuleManager
+	module        *manager.Module
+}
+
+// newRolloutFixture creates a running module and starts a rollout of a new image across the given
+// number of agents.
+func newRolloutFixture(t *testing.T, agents int, strategy *manager.RolloutStrategy) *rolloutFixture {
+	t.Helper()
+
+	db := database.NewKVStore()
+	agentManager, err := manager.NewAgentManager(&manager.AgentManagerConfig{AgentServiceName: "agent"}, nil, db)
+	if err != nil {
+		t.Fatalf("NewAgentManager() failed: %v", err)
+	}
+	moduleManager, err := manager.NewModuleManager(db)
+	if err != nil {
+		t.Fatalf("NewModuleManager() failed: %v", err)
+	}
+	svc, err := NewRolloutService(moduleManager, agentManager)
+	if err != nil {
+		t.Fatalf("NewRolloutService() failed: %v", err)
+	}
+
+	agentIDs := []string{}
+	for range agents {
+		agentID, err := agentManager.AddAgent("agent", nil, nil)
+		if err != nil {
+			t.Fatalf("AddAgent() failed: %v", err)
+		}
+		agentIDs = append(agentIDs, agentID)
+	}
+
+	moduleID, err := moduleManager.AddModule("module", &manager.ModuleSpec{Image: "v1"}, nil, nil, "")
+	if err != nil {
+		t.Fatalf("AddModule() failed: %v", err)
+	}
+	module, _ := moduleManager.GetModule(moduleID)
+	if err := module.SetRunning(true); err != nil {
+		t.Fatalf("SetRunning() failed: %v", err)
+	}
+	if _, err := module.StartRollout(&manager.ModuleSpec{Image: "v2"}, nil, strategy, agentIDs, "", ""); err != nil {
+		t.Fatalf("StartRollout() failed: %v", err)
+	}
+
+	return &rolloutFixture{
+		database:      db,
+		svc:           svc,
+		agentManager:  agentManager,
+		moduleManager: moduleManager,
+		module:        module,
+	}
+}
+
+// report records the status the agents report for the revision the rollout is updating to.
+func (f *rolloutFixture) report(t *testing.T, agentIDs []string, status pb.ModuleStatus) {
+	t.Helper()
+	for _, agentID := range agentIDs {
+		if err := f.agentManager.ReceiveAgentDiagnostics(agentID, &manager.Diagnostics{
+			ModuleStatuses:  map[string]string{f.module.GetID(): status.String()},
+			ModuleRevisions: map[string]int{f.module.GetID(): f.module.GetRollout().To.Revision},
+		}); err != nil {
+			t.Fatalf("ReceiveAgentDiagnostics() failed: %v", err)
+		}
+	}
+}
+
+// startBatchAt moves the start of the current batch of the stored rollout and reloads the module,
+// so deadlines are tested without waiting for them.
+func (f *rolloutFixture) startBatchAt(t *testing.T, startedAt time.Time) {
+	t.Helper()
+	key := "module/" + f.module.GetID()
+	record := map[string]any{}
+	if _, err := database.GetJSON(f.database, key, &record); err != nil {
+		t.Fatalf("GetJSON() failed: %v", err)
+	}
+	record["rollout"].(map[string]any)["batchStartedAt"] = startedAt
+	if err := database.SetJSON(f.database, key, record); err != nil {
+		t.Fatalf("SetJSON() failed: %v", err)
+	}
+
+	moduleManager, err := manager.NewModuleManager(f.database)
+	if err != nil {
+		t.Fatalf("NewModuleManager() failed: %v", err)
+	}
+	f.moduleManager = moduleManager
+	f.module, err = moduleManager.GetModule(f.module.GetID())
+	if err != nil {
+		t.Fatalf("GetModule() failed: %v", err)
+	}
+}
+
+func (f *rolloutFixture) check(t *testing.T) *manager.Rollout {
+	t.Helper()
+	if err := f.svc.checkRollout(f.module); err != nil {
+		t.Fatalf("checkRollout() failed: %v", err)
+	}
+	return f.module.GetRollout()
+}
+
+func TestCheckRollout_Batches(t *testing.T) {
+	f := newRolloutFixture(t, 4, &manager.RolloutStrategy{MaxUnavailable: 2, CanaryPercentage: 25, ProgressDeadline: 60})
+
+	batches := f.module.GetRollout().Batches
+	if len(batches) != 3 || len(batches[0]) != 1 || len(batches[1]) != 2 || len(batches[2]) != 1 {
+		t.Fatalf("rollout batches = %v; expected canary of 1 agent and batches of 2 and 1", batches)
+	}
+
+	if rollout := f.check(t); rollout.CurrentBatch != 0 {
+		t.Errorf("rollout advanced to batch %d before the canary reported", rollout.CurrentBatch)
+	}
+
+	f.report(t, batches[0], pb.ModuleStatus_STARTING)
+	if rollout := f.check(t); rollout.CurrentBatch != 0 {
+		t.Errorf("rollout advanced to batch %d before the canary was healthy", rollout.CurrentBatch)
+	}
+
+	f.report(t, batches[0], pb.ModuleStatus_HEALTHY)
+	if rollout := f.check(t); rollout.CurrentBatch != 1 {
+		t.Errorf("rollout is at batch %d after a healthy canary; expected 1", rollout.CurrentBatch)
+	}
+
+	// the second agent of the batch is offline, so the batch isn't done
+	f.report(t, batches[1][:1], pb.ModuleStatus_HEALTHY)
+	if rollout := f.check(t); rollout.CurrentBatch != 1 {
+		t.Errorf("rollout advanced to batch %d with an offline agent", rollout.CurrentBatch)
+	}
+
+	f.report(t, batches[1], pb.ModuleStatus_HEALTHY)
+	if rollout := f.check(t); rollout.CurrentBatch != 2 {
+		t.Errorf("rollout is at batch %d after a healthy batch; expected 2", rollout.CurrentBatch)
+	}
+
+	f.report(t, batches[2], pb.ModuleStatus_HEALTHY)
+	if rollout := f.check(t); rollout.State != constants.RolloutStateSucceeded {
+		t.Errorf("rollout state = %s; expected %s", rollout.State, constants.RolloutStateSucceeded)
+	}
+}
+
+func TestCheckRollout_CrashLoop(t *testing.T) {
+	f := newRolloutFixture(t, 2, &manager.RolloutStrategy{MaxUnavailable: 1, CanaryPercentage: 50, ProgressDeadline: 60})
+
+	f.report(t, f.module.GetRollout().Batches[0], pb.ModuleStatus_CRASH_LOOP)
+	rollout := f.check(t)
+	if rollout.State != constants.RolloutStateRolledBack {
+		t.Errorf("rollout state = %s; expected %s", rollout.State, constants.RolloutStateRolledBack)
+	}
+	if rollout.CurrentBatch != 0 {
+		t.Errorf("rollout advanced to batch %d past a crash looping canary", rollout.CurrentBatch)
+	}
+}
+
+func TestCheckRollout_OfflineAgentMissesDeadline(t *testing.T) {
+	f := newRolloutFixture(t, 2, &manager.RolloutStrategy{MaxUnavailable: 1, CanaryPercentage: 50, ProgressDeadline: 60})
+
+	if rollout := f.check(t); rollout.State != constants.RolloutStateInProgress {
+		t.Fatalf("rollout state = %s; expected %s", rollout.State, constants.RolloutStateInProgress)
+	}
+
+	f.startBatchAt(t, time.Now().Add(-61*time.Second))
+	rollout := f.check(t)
+	if rollout.State != constants.RolloutStateRolledBack {
+		t.Errorf("rollout state = %s; expected %s", rollout.State, constants.RolloutStateRolledBack)
+	}
+	if rollout.CurrentBatch != 0 {
+		t.Errorf("rollout advanced to batch %d past an offline canary", rollout.CurrentBatch)
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	errs "github.com/pajtaand/dmap-zero/internal/common/errors"
+	"github.com/pajtaand/dmap-zero/internal/common/secrets"
+	"github.com/pajtaand/dmap-zero/internal/controller/dto"
+	"github.com/pajtaand/dmap-zero/internal/controller/manager"
+	"github.com/rs/zerolog"
+)
+
+type secretService struct {
+	secretManager *manager.SecretManager
+	moduleManager *manager.ModuleManager
+	agentManager  *manager.AgentManager
+}
+
+func NewSecretService(secretManager *manager.SecretManager, moduleManager *manager.ModuleManager, agentManager *manager.AgentManager) (*secretService, error) {
+	if secretManager == nil {
+		return nil, errors.New("SecretManager must not be nil")
+	}
+	if moduleManager == nil {
+		return nil, errors.New("ModuleManager must not be nil")
+	}
+	if agentManager == nil {
+		return nil, errors.New("AgentManager must not be nil")
+	}
+
+	return &secretService{
+		secretManager: secretManager,
+		moduleManager: moduleManager,
+		agentManager:  agentManager,
+	}, nil
+}
+
+func (svc *secretService) CreateSecret(ctx context.Context, request *dto.CreateSecretRequest) (*dto.CreateSecretResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Create secret request")
+
+	if request == nil {
+		return nil, errors.New("request must not be nil")
+	}
+	if !secrets.ValidName(request.Name) {
+		return nil, fmt.Errorf("%w: secret name is invalid: '%s'", errs.ErrNotAllowed, request.Name)
+	}
+
+	if err := svc.secretManager.AddSecret(request.Name, request.Value); err != nil {
+		return nil, fmt.Errorf("failed to add secret: %w", err)
+	}
+	return &dto.CreateSecretResponse{}, nil
+}
+
+func (svc *secretService) ListSecrets(ctx context.Context, request *dto.ListSecretsRequest) (*dto.ListSecretsResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("List secrets request")
+
+	if request == nil {
+		return nil, errors.New("request must not be nil")
+	}
+
+	list := make([]*dto.ListSecretsResponseSecret, 0)
+	for _, secret := range svc.secretManager.ListSecrets() {
+		list = append(list, &dto.ListSecretsResponseSecret{
+			Name:      secret.GetName(),
+			CreatedAt: secret.GetCreatedAt(),
+			UpdatedAt: secret.GetUpdatedAt(),
+		})
+	}
+	return &dto.ListSecretsResponse{
+		Secrets: list,
+	}, nil
+}
+
+func (svc *secretService) UpdateSecret(ctx context.Context, request *dto.UpdateSecretRequest) (*dto.UpdateSecretResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Update secret request")
+
+	if request == nil {
+		return nil, errors.New("request must not be nil")
+	}
+
+	if err := svc.secretManager.UpdateSecret(request.Name, request.Value); err != nil {
+		return nil, fmt.Errorf("failed to update secret: %w", err)
+	}
+	return &dto.UpdateSecretResponse{}, nil
+}
+
+// DeleteSecret deletes the secret, it returns ErrConflict while a module or an agent refers to it.
+func (svc *secretService) DeleteSecret(ctx context.Context, request *dto.DeleteSecretRequest) (*dto.DeleteSecretResponse, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Delete secret request")
+
+	if request == nil {
+		return nil, errors.New("request must not be nil")
+	}
+
+	for _, module := range svc.moduleManager.ListModules() {
+		if module.UsesSecret(request.Name) {
+			return nil, fmt.Errorf("%w: secret is used by module %s", errs.ErrConflict, module.GetID())
+		}
+	}
+	for _, agent := range svc.agentManager.ListAgents() {
+		for _, name := range secrets.References(agent.GetConfiguration()) {
+			if name == request.Name {
+				return nil, fmt.Errorf("%w: secret is used by agent %s", errs.ErrConflict, agent.GetID())
+			}
+		}
+	}
+
+	if err := svc.secretManager.RemoveSecret(request.Name); err != nil {
+		return nil, fmt.Errorf("failed to delete secret: %w", err)
+	}
+	return &dto.DeleteSecretResponse{}, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 
 	"github.com/rs/zerolog"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/pajtaand/dmap-zero/internal/common/utils"
 	"github.com/pajtaand/dmap-zero/internal/controller/manager"
 	pb "github.com/pajtaand/dmap-zero/internal/proto"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
@@ -21,9 +23,10 @@ type setupService struct {
 	agentManager  *manager.AgentManager
 	imageManager  *manager.ImageManager
 	moduleManager *manager.ModuleManager
+	secretManager *manager.SecretManager
 }
 
-func NewSetupService(agentManager *manager.AgentManager, imageManager *manager.ImageManager, moduleManager *manager.ModuleManager) (pb.SetupServiceServer, error) {
+func NewSetupService(agentManager *manager.AgentManager, imageManager *manager.ImageManager, moduleManager *manager.ModuleManager, secretManager *manager.SecretManager) (pb.SetupServiceServer, error) {
 	if agentManager == nil {
 		return nil, errors.New("AgentManager must not be nil")
 	}
@@ -33,11 +36,15 @@ func NewSetupService(agentManager *manager.AgentManager, imageManager *manager.I
 	if moduleManager == nil {
 		return nil, errors.New("ModuleManager must not be nil")
 	}
+	if secretManager == nil {
+		return nil, errors.New("SecretManager must not be nil")
+	}
 
 	return &setupService{
 		agentManager:  agentManager,
 		imageManager:  imageManager,
 		moduleManager: moduleManager,
+		secretManager: secretManager,
 	}, nil
 }
 
@@ -93,35 +100,137 @@ func (svc *setupService) ImageRequest(request *emptypb.Empty, stream pb.SetupSer
 
 	log.Info().Msgf("Caller identity: %s", sourceIdentity)
 
-	images := svc.imageManager.ListImages()
-	for _, image := range images {
-		imageID := image.GetID()
+	for _, image := range svc.imageManager.ListImages() {
+		if !image.IsReady() {
+			continue
+		}
+		if err := streamImage(stream, image, svc.imageManager.SignImage(image), sourceIdentity, 0); err != nil {
+			log.Error().Err(err).Msg("")
+			return err
+		}
+	}
+	return nil
+}
+
+func (svc *setupService) ImageDataRequest(request *pb.ImageChunkRequest, stream pb.SetupService_ImageDataRequestServer) error {
+	log := zerolog.Ctx(stream.Context())
+	log.Info().Msg("Image data request request")
 
-		data, err := image.GetData()
-		if err != nil {
-			err := fmt.Errorf("failed to get image data: imageID=%s, agentID=%s: %v", imageID, sourceIdentity, err)
+	if request == nil {
+		return errors.New("request must not be nil")
+	}
+
+	p, ok := peer.FromContext(stream.Context())
+	if !ok {
+		err := errors.New("failed to get peer from request context")
+		log.Error().Err(err).Msg("")
+		return err
+	}
+
+	_, _, sourceIdentity, err := utils.ParseOpenZitiAddress(p.LocalAddr.String())
+	if err != nil {
+		err := fmt.Errorf("failed to parse source address: %v", err)
+		log.Error().Err(err).Msg("")
+		return err
+	}
+
+	log.Info().Msgf("Caller identity: %s", sourceIdentity)
+
+	image, err := svc.imageManager.GetImage(request.Id)
+	if err != nil {
+		err := fmt.Errorf("failed to get image: imageID=%s: %v", request.Id, err)
+		log.Error().Err(err).Msg("")
+		return err
+	}
+
+	// the whole tarball is streamed, unless a single layer is requested
+	digest, start, size := image.GetDigest(), int64(0), int64(image.GetSize())
+	if request.Digest != "" && request.Digest != digest {
+		layer, ok := image.GetLayer(request.Digest)
+		if !ok {
+			err := fmt.Errorf("image digest doesn't match: imageID=%s, requested=%s, actual=%s", request.Id, request.Digest, image.GetDigest())
 			log.Error().Err(err).Msg("")
 			return err
 		}
+		digest, start, size = layer.Digest, layer.Offset, layer.Size
+	}
+	if request.Offset < 0 || request.Offset > size {
+		err := fmt.Errorf("offset out of range: imageID=%s, digest=%s, offset=%d, size=%d", request.Id, digest, request.Offset, size)
+		log.Error().Err(err).Msg("")
+		return err
+	}
+
+	if err := streamImageSection(stream, image, nil, sourceIdentity, digest, start, size, request.Offset); err != nil {
+		log.Error().Err(err).Msg("")
+		return err
+	}
+	return nil
+}
+
+func (svc *setupService) ImageArchiveRequest(ctx context.Context, request *pb.ImageArchiveRequest) (*pb.ImageArchive, error) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("Image archive request")
 
-		log.Info().Msgf("Streaming image to agent: imageID=%s, agentID=%s: %v", imageID, sourceIdentity, err)
-		for start := 0; start < len(data); start += constants.AgentImageStreamChunkSize {
-			end := start + constants.AgentImageStreamChunkSize
-			if end > len(data) {
-				end = len(data)
+	if request == nil {
+		return nil, errors.New("request must not be nil")
+	}
+
+	image, err := svc.imageManager.GetImage(request.Id)
+	if err != nil {
+		err := fmt.Errorf("failed to get image: imageID=%s: %v", request.Id, err)
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+
+	entries := image.GetArchiveEntries()
+	if entries == nil {
+		err := fmt.Errorf("image isn't indexed: imageID=%s", request.Id)
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+
+	f, err := image.Open()
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+	defer f.Close()
+
+	presentLayers := map[string]bool{}
+	for _, chainID := range request.PresentLayers {
+		presentLayers[chainID] = true
+	}
+
+	archive := &pb.ImageArchive{}
+	var missing, missingSize int64
+	for _, entry := range entries {
+		archiveEntry := &pb.ImageArchiveEntry{
+			Name:     entry.Name,
+			Type:     int32(entry.Type),
+			Mode:     entry.Mode,
+			Size:     entry.Size,
+			Linkname: entry.Linkname,
+		}
+		if entry.IsLayer() {
+			archiveEntry.Digest = entry.Digest
+			archiveEntry.Present = presentLayers[entry.ChainID]
+			if !archiveEntry.Present {
+				missing++
+				missingSize += entry.Size
 			}
-			if err := stream.Send(&pb.ImageStreamData{
-				Id:      imageID,
-				Name:    image.GetName(),
-				Content: data[start:end],
-			}); err != nil {
-				err := fmt.Errorf("failed to stream image to agent: imageID=%s, agentID=%s: %v", imageID, sourceIdentity, err)
+		} else if entry.Size > 0 {
+			archiveEntry.Content = make([]byte, entry.Size)
+			if _, err := f.ReadAt(archiveEntry.Content, entry.Offset); err != nil {
+				err := fmt.Errorf("failed to read image data: imageID=%s, name=%s: %v", request.Id, entry.Name, err)
 				log.Error().Err(err).Msg("")
-				return err
+				return nil, err
 			}
 		}
+		archive.Entries = append(archive.Entries, archiveEntry)
 	}
-	return nil
+
+	log.Info().Msgf("Image archive prepared: imageID=%s, missingLayers=%d, missingBytes=%d, imageSize=%d", request.Id, missing, missingSize, image.GetSize())
+	return archive, nil
 }
 
 func (svc *setupService) ModuleRequest(ctx context.Context, request *emptypb.Empty) (*pb.ModuleConfigurations, error) {
@@ -144,28 +253,66 @@ func (svc *setupService) ModuleRequest(ctx context.Context, request *emptypb.Emp
 
 	log.Info().Msgf("Caller identity: %s", sourceIdentity)
 
-	if _, err := svc.agentManager.GetAgent(sourceIdentity); err != nil {
+	agent, err := svc.agentManager.GetAgent(sourceIdentity)
+	if err != nil {
 		err := fmt.Errorf("failed to get agent: %v", err)
 		log.Error().Err(err).Msg("")
 		return nil, err
 	}
 
-	configs := []*pb.ModuleConfiguration{}
-	for _, module := range svc.moduleManager.ListModules() {
-		if module.IsRunning() {
-			configs = append(configs, &pb.ModuleConfiguration{
-				Module: &pb.ModuleIdentifier{
-					Id: module.GetID(),
-				},
-				Image: &pb.ImageIdentifier{
-					Id: module.GetImage(),
-				},
-				Env: module.GetConfiguration(),
-			})
-		}
+	state := desiredAgentState(agent, svc.imageManager, svc.moduleManager)
+	if err := revealSecrets(agent, state.Modules, svc.secretManager); err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
 	}
 
 	return &pb.ModuleConfigurations{
-		Configs: configs,
+		Configs: state.Modules,
 	}, nil
 }
+
+// streamImage streams the whole image tarball with its signature.
+func streamImage(stream grpc.ServerStreamingServer[pb.ImageStreamData], image *manager.Image, signature []byte, agentID string, offset int64) error {
+	return streamImageSection(stream, image, signature, agentID, image.GetDigest(), 0, int64(image.GetSize()), offset)
+}
+
+// streamImageSection streams size bytes of the image tarball starting at start, the data is
+// identified by its digest. Streaming begins at offset within the section, in chunks of
+// AgentImageStreamChunkSize. The signature is sent along for agents loading the streamed data.
+func streamImageSection(stream grpc.ServerStreamingServer[pb.ImageStreamData], image *manager.Image, signature []byte, agentID, digest string, start, size, offset int64) error {
+	log := zerolog.Ctx(stream.Context())
+
+	imageID := image.GetID()
+	f, err := image.Open()
+	if err != nil {
+		return fmt.Errorf("failed to get image data: imageID=%s, agentID=%s: %v", imageID, agentID, err)
+	}
+	defer f.Close()
+	section := io.NewSectionReader(f, start+offset, size-offset)
+
+	log.Info().Msgf("Streaming image to agent: imageID=%s, digest=%s, agentID=%s, offset=%d", imageID, digest, agentID, offset)
+	buf := make([]byte, constants.AgentImageStreamChunkSize)
+	for {
+		n, err := io.ReadFull(section, buf)
+		if n > 0 {
+			if err := stream.Send(&pb.ImageStreamData{
+				Id:        imageID,
+				Name:      image.GetName(),
+				Content:   buf[:n],
+				Digest:    digest,
+				Offset:    offset,
+				Size:      size,
+				Signature: signature,
+			}); err != nil {
+				return fmt.Errorf("failed to stream image to agent: imageID=%s, agentID=%s: %v", imageID, agentID, err)
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read image data: imageID=%s, agentID=%s: %v", imageID, agentID, err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pajtaand/dmap-zero/internal/common/secrets"
+	"github.com/pajtaand/dmap-zero/internal/controller/dto"
+	"github.com/pajtaand/dmap-zero/internal/controller/manager"
+	pb "github.com/pajtaand/dmap-zero/internal/proto"
+)
+
+// desiredAgentState returns the images and modules the agent should have. Every agent keeps all
+// ready images, but runs only the running modules whose placement targets it. All module IDs are
+// listed, so agents can release the volumes of deleted modules.
+func desiredAgentState(agent *manager.Agent, imageManager *manager.ImageManager, moduleManager *manager.ModuleManager) *pb.DesiredState {
+	state := &pb.DesiredState{
+		Images:          []*pb.ImageInfo{},
+		Modules:         []*pb.ModuleConfiguration{},
+		ExistingModules: []string{},
+	}
+
+	for _, image := range imageManager.ListImages() {
+		if !image.IsReady() {
+			continue // still being pulled from the registry
+		}
+		state.Images = append(state.Images, &pb.ImageInfo{
+			Id:        image.GetID(),
+			Name:      image.GetName(),
+			Size:      int64(image.GetSize()),
+			Digest:    image.GetDigest(),
+			Signature: imageManager.SignImage(image),
+		})
+	}
+
+	for _, module := range moduleManager.ListModules() {
+		state.ExistingModules = append(state.ExistingModules, module.GetID())
+		if module.IsRunning() && module.GetPlacement().Matches(agent) {
+			state.Modules = append(state.Modules, moduleConfiguration(module, agent.GetID()))
+		}
+	}
+	return state
+}
+
+// topicSubscriptions returns the topic subscriptions of the other agents, as reported on their
+// last phonehome. Agents which didn't phone home recently are left out.
+func topicSubscriptions(agent *manager.Agent, agentManager *manager.AgentManager) []*pb.TopicSubscription {
+	subscriptions := []*pb.TopicSubscription{}
+	for _, other := range agentManager.ListAgents() {
+		if other.GetID() == agent.GetID() {
+			continue
+		}
+		diag := other.GetDiagnostics()
+		if diag == nil {
+			continue
+		}
+		for topic, modules := range diag.Subscriptions {
+			subscriptions = append(subscriptions, &pb.TopicSubscription{
+				Topic:   topic,
+				Agent:   other.GetID(),
+				Modules: modules,
+			})
+		}
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if subscriptions[i].Topic != subscriptions[j].Topic {
+			return subscriptions[i].Topic < subscriptions[j].Topic
+		}
+		return subscriptions[i].Agent < subscriptions[j].Agent
+	})
+	return subscriptions
+}
+
+// moduleConfiguration returns the configuration of the module for the agent, agents not yet
+// reached by a rollout get the previous revision.
+func moduleConfiguration(module *manager.Module, agentID string) *pb.ModuleConfiguration {
+	spec := module.SpecFor(agentID)
+	restartPolicy := module.GetRestartPolicy()
+	return &pb.ModuleConfiguration{
+		Module: &pb.ModuleIdentifier{
+			Id: module.GetID(),
+		},
+		Image: &pb.ImageIdentifier{
+			Id: spec.Image,
+		},
+		Env: spec.Configuration,
+		RestartPolicy: &pb.RestartPolicy{
+			Policy:     restartPolicy.Policy,
+			MaxRetries: int32(restartPolicy.MaxRetries),
+		},
+		Revision: int32(spec.Revision),
+		Resources: &pb.ModuleResources{
+			Cpus:        spec.Resources.CPUs,
+			MemoryBytes: spec.Resources.MemoryBytes,
+			PidsLimit:   spec.Resources.PidsLimit,
+		},
+		Security: &pb.ModuleSecurity{
+			ReadOnlyRootfs:  spec.Security.ReadOnlyRootfs,
+			User:            spec.Security.User,
+			CapAdd:          spec.Security.CapAdd,
+			CapDrop:         spec.Security.CapDrop,
+			SeccompProfile:  spec.Security.SeccompProfile,
+			NoNewPrivileges: spec.Security.NoNewPrivileges,
+			Privileged:      spec.Security.Privileged,
+			HostNetwork:     spec.Security.HostNetwork,
+			Tmpfs:           spec.Security.Tmpfs,
+		},
+		Storage: storageToProto(spec.Storage),
+	}
+}
+
+// revealSecrets adds the secrets the modules refer to from their configuration, their storage or
+// the agent's configuration. Agents only receive the secrets of the modules they run.
+func revealSecrets(agent *manager.Agent, modules []*pb.ModuleConfiguration, secretManager *manager.SecretManager) error {
+	agentSecrets := secrets.References(agent.GetConfiguration())
+	for _, module := range modules {
+		names := append(secrets.References(module.Env), agentSecrets...)
+		for _, secret := range module.Storage.GetSecrets() {
+			names = append(names, secret.Secret)
+		}
+		values, err := secretManager.RevealSecrets(names)
+		if err != nil {
+			return fmt.Errorf("failed to reveal secrets of module %s: %v", module.Module.Id, err)
+		}
+		module.Secrets = values
+	}
+	return nil
+}
+
+func storageToProto(storage *manager.ModuleStorage) *pb.ModuleStorage {
+	result := &pb.ModuleStorage{
+		Volumes:    []*pb.ModuleVolume{},
+		BindMounts: []*pb.ModuleBindMount{},
+		Secrets:    []*pb.ModuleSecretMount{},
+	}
+	for _, volume := range storage.Volumes {
+		result.Volumes = append(result.Volumes, &pb.ModuleVolume{
+			Name:      volume.Name,
+			Path:      volume.Path,
+			ReadOnly:  volume.ReadOnly,
+			Retention: volume.Retention,
+		})
+	}
+	for _, bind := range storage.BindMounts {
+		result.BindMounts = append(result.BindMounts, &pb.ModuleBindMount{
+			HostPath: bind.HostPath,
+			Path:     bind.Path,
+			ReadOnly: bind.ReadOnly,
+		})
+	}
+	for _, secret := range storage.Secrets {
+		result.Secrets = append(result.Secrets, &pb.ModuleSecretMount{
+			Secret: secret.Secret,
+			Path:   secret.Path,
+		})
+	}
+	return result
+}
+
+// agentDrift compares the desired state with the state last reported by the agent.
+func agentDrift(desired *pb.DesiredState, diag *manager.Diagnostics) *dto.AgentDrift {
+	desiredImages := map[string]bool{}
+	for _, image := range desired.Images {
+		desiredImages[image.Id] = true
+	}
+	desiredModules := map[string]bool{}
+	for _, module := range desired.Modules {
+		desiredModules[module.Module.Id] = true
+	}
+
+	drift := &dto.AgentDrift{
+		MissingImages:     missingKeys(desiredImages, diag.PresentImages),
+		UnexpectedImages:  unexpectedKeys(desiredImages, diag.PresentImages),
+		MissingModules:    missingKeys(desiredModules, diag.PresentModules),
+		UnexpectedModules: unexpectedKeys(desiredModules, diag.PresentModules),
+	}
+	drift.InSync = len(drift.MissingImages) == 0 && len(drift.UnexpectedImages) == 0 &&
+		len(drift.MissingModules) == 0 && len(drift.UnexpectedModules) == 0
+	return drift
+}
+
+func missingKeys(desired map[string]bool, present map[string]string) []string {
+	keys := []string{}
+	for key := range desired {
+		if _, ok := present[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func unexpectedKeys(desired map[string]bool, present map[string]string) []string {
+	keys := []string{}
+	for key := range present {
+		if !desired[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
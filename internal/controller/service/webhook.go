@@ -65,13 +65,14 @@ func (svc *webhookService) RegisterWebhook(ctx context.Context, request *dto.Reg
 		return nil, errs.ErrNotFound
 	}
 
-	webhookID, err := svc.webhookManager.AddWebhook(request.ModuleID, request.URL)
+	webhookID, secret, err := svc.webhookManager.AddWebhook(request.ModuleID, request.URL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to register webhook: %v", err)
 	}
 
 	return &dto.RegisterWebhookResponse{
-		ID: webhookID,
+		ID:     webhookID,
+		Secret: secret,
 	}, nil
 }
 
@@ -226,7 +226,6 @@ var ConfigurationService_ServiceDesc = grpc.ServiceDesc{
 const (
 	ImageService_CheckImage_FullMethodName  = "/agent.ImageService/CheckImage"
 	ImageService_GetImage_FullMethodName    = "/agent.ImageService/GetImage"
-	ImageService_PushImage_FullMethodName   = "/agent.ImageService/PushImage"
 	ImageService_RemoveImage_FullMethodName = "/agent.ImageService/RemoveImage"
 )
 
@@ -236,7 +235,6 @@ const (
 type ImageServiceClient interface {
 	CheckImage(ctx context.Context, in *ImageIdentifier, opts ...grpc.CallOption) (*ResourceExistResponse, error)
 	GetImage(ctx context.Context, in *ImageIdentifier, opts ...grpc.CallOption) (*ImageInfo, error)
-	PushImage(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ImageStreamData, emptypb.Empty], error)
 	RemoveImage(ctx context.Context, in *ImageIdentifier, opts ...grpc.CallOption) (*emptypb.Empty, error)
 }
 
@@ -268,19 +266,6 @@ func (c *imageServiceClient) GetImage(ctx context.Context, in *ImageIdentifier,
 	return out, nil
 }
 
-func (c *imageServiceClient) PushImage(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ImageStreamData, emptypb.Empty], error) {
-	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &ImageService_ServiceDesc.Streams[0], ImageService_PushImage_FullMethodName, cOpts...)
-	if err != nil {
-		return nil, err
-	}
-	x := &grpc.GenericClientStream[ImageStreamData, emptypb.Empty]{ClientStream: stream}
-	return x, nil
-}
-
-// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
-type ImageService_PushImageClient = grpc.ClientStreamingClient[ImageStreamData, emptypb.Empty]
-
 func (c *imageServiceClient) RemoveImage(ctx context.Context, in *ImageIdentifier, opts ...grpc.CallOption) (*emptypb.Empty, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(emptypb.Empty)
@@ -297,7 +282,6 @@ func (c *imageServiceClient) RemoveImage(ctx context.Context, in *ImageIdentifie
 type ImageServiceServer interface {
 	CheckImage(context.Context, *ImageIdentifier) (*ResourceExistResponse, error)
 	GetImage(context.Context, *ImageIdentifier) (*ImageInfo, error)
-	PushImage(grpc.ClientStreamingServer[ImageStreamData, emptypb.Empty]) error
 	RemoveImage(context.Context, *ImageIdentifier) (*emptypb.Empty, error)
 	mustEmbedUnimplementedImageServiceServer()
 }
@@ -315,9 +299,6 @@ func (UnimplementedImageServiceServer) CheckImage(context.Context, *ImageIdentif
 func (UnimplementedImageServiceServer) GetImage(context.Context, *ImageIdentifier) (*ImageInfo, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetImage not implemented")
 }
-func (UnimplementedImageServiceServer) PushImage(grpc.ClientStreamingServer[ImageStreamData, emptypb.Empty]) error {
-	return status.Errorf(codes.Unimplemented, "method PushImage not implemented")
-}
 func (UnimplementedImageServiceServer) RemoveImage(context.Context, *ImageIdentifier) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RemoveImage not implemented")
 }
@@ -378,13 +359,6 @@ func _ImageService_GetImage_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
-func _ImageService_PushImage_Handler(srv interface{}, stream grpc.ServerStream) error {
-	return srv.(ImageServiceServer).PushImage(&grpc.GenericServerStream[ImageStreamData, emptypb.Empty]{ServerStream: stream})
-}
-
-// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
-type ImageService_PushImageServer = grpc.ClientStreamingServer[ImageStreamData, emptypb.Empty]
-
 func _ImageService_RemoveImage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ImageIdentifier)
 	if err := dec(in); err != nil {
@@ -423,19 +397,15 @@ var ImageService_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _ImageService_RemoveImage_Handler,
 		},
 	},
-	Streams: []grpc.StreamDesc{
-		{
-			StreamName:    "PushImage",
-			Handler:       _ImageService_PushImage_Handler,
-			ClientStreams: true,
-		},
-	},
+	Streams:  []grpc.StreamDesc{},
 	Metadata: "agent.proto",
 }
 
 const (
 	ModuleService_StartModule_FullMethodName = "/agent.ModuleService/StartModule"
 	ModuleService_StopModule_FullMethodName  = "/agent.ModuleService/StopModule"
+	ModuleService_StreamLogs_FullMethodName  = "/agent.ModuleService/StreamLogs"
+	ModuleService_Exec_FullMethodName        = "/agent.ModuleService/Exec"
 )
 
 // ModuleServiceClient is the client API for ModuleService service.
@@ -444,6 +414,8 @@ const (
 type ModuleServiceClient interface {
 	StartModule(ctx context.Context, in *ModuleConfiguration, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	StopModule(ctx context.Context, in *ModuleIdentifier, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	StreamLogs(ctx context.Context, in *ModuleLogsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ModuleLogChunk], error)
+	Exec(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ExecRequest, ExecResponse], error)
 }
 
 type moduleServiceClient struct {
@@ -474,12 +446,46 @@ func (c *moduleServiceClient) StopModule(ctx context.Context, in *ModuleIdentifi
 	return out, nil
 }
 
+func (c *moduleServiceClient) StreamLogs(ctx context.Context, in *ModuleLogsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ModuleLogChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ModuleService_ServiceDesc.Streams[0], ModuleService_StreamLogs_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ModuleLogsRequest, ModuleLogChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ModuleService_StreamLogsClient = grpc.ServerStreamingClient[ModuleLogChunk]
+
+func (c *moduleServiceClient) Exec(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ExecRequest, ExecResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ModuleService_ServiceDesc.Streams[1], ModuleService_Exec_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExecRequest, ExecResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ModuleService_ExecClient = grpc.BidiStreamingClient[ExecRequest, ExecResponse]
+
 // ModuleServiceServer is the server API for ModuleService service.
 // All implementations must embed UnimplementedModuleServiceServer
 // for forward compatibility.
 type ModuleServiceServer interface {
 	StartModule(context.Context, *ModuleConfiguration) (*emptypb.Empty, error)
 	StopModule(context.Context, *ModuleIdentifier) (*emptypb.Empty, error)
+	StreamLogs(*ModuleLogsRequest, grpc.ServerStreamingServer[ModuleLogChunk]) error
+	Exec(grpc.BidiStreamingServer[ExecRequest, ExecResponse]) error
 	mustEmbedUnimplementedModuleServiceServer()
 }
 
@@ -496,6 +502,12 @@ func (UnimplementedModuleServiceServer) StartModule(context.Context, *ModuleConf
 func (UnimplementedModuleServiceServer) StopModule(context.Context, *ModuleIdentifier) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method StopModule not implemented")
 }
+func (UnimplementedModuleServiceServer) StreamLogs(*ModuleLogsRequest, grpc.ServerStreamingServer[ModuleLogChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamLogs not implemented")
+}
+func (UnimplementedModuleServiceServer) Exec(grpc.BidiStreamingServer[ExecRequest, ExecResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Exec not implemented")
+}
 func (UnimplementedModuleServiceServer) mustEmbedUnimplementedModuleServiceServer() {}
 func (UnimplementedModuleServiceServer) testEmbeddedByValue()                       {}
 
@@ -553,6 +565,24 @@ func _ModuleService_StopModule_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ModuleService_StreamLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ModuleLogsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ModuleServiceServer).StreamLogs(m, &grpc.GenericServerStream[ModuleLogsRequest, ModuleLogChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ModuleService_StreamLogsServer = grpc.ServerStreamingServer[ModuleLogChunk]
+
+func _ModuleService_Exec_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ModuleServiceServer).Exec(&grpc.GenericServerStream[ExecRequest, ExecResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ModuleService_ExecServer = grpc.BidiStreamingServer[ExecRequest, ExecResponse]
+
 // ModuleService_ServiceDesc is the grpc.ServiceDesc for ModuleService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -569,19 +599,37 @@ var ModuleService_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _ModuleService_StopModule_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamLogs",
+			Handler:       _ModuleService_StreamLogs_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Exec",
+			Handler:       _ModuleService_Exec_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
 	Metadata: "agent.proto",
 }
 
 const (
-	ShareService_PushData_FullMethodName = "/agent.ShareService/PushData"
+	ShareService_PushData_FullMethodName   = "/agent.ShareService/PushData"
+	ShareService_Call_FullMethodName       = "/agent.ShareService/Call"
+	ShareService_Publish_FullMethodName    = "/agent.ShareService/Publish"
+	ShareService_PushStream_FullMethodName = "/agent.ShareService/PushStream"
 )
 
 // ShareServiceClient is the client API for ShareService service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type ShareServiceClient interface {
-	PushData(ctx context.Context, in *ShareData, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	PushData(ctx context.Context, in *ShareData, opts ...grpc.CallOption) (*DeliveryReport, error)
+	Call(ctx context.Context, in *ShareData, opts ...grpc.CallOption) (*ShareReply, error)
+	Publish(ctx context.Context, in *TopicData, opts ...grpc.CallOption) (*DeliveryReport, error)
+	PushStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ShareStreamData, DeliveryReport], error)
 }
 
 type shareServiceClient struct {
@@ -592,9 +640,9 @@ func NewShareServiceClient(cc grpc.ClientConnInterface) ShareServiceClient {
 	return &shareServiceClient{cc}
 }
 
-func (c *shareServiceClient) PushData(ctx context.Context, in *ShareData, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+func (c *shareServiceClient) PushData(ctx context.Context, in *ShareData, opts ...grpc.CallOption) (*DeliveryReport, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	out := new(emptypb.Empty)
+	out := new(DeliveryReport)
 	err := c.cc.Invoke(ctx, ShareService_PushData_FullMethodName, in, out, cOpts...)
 	if err != nil {
 		return nil, err
@@ -602,11 +650,47 @@ func (c *shareServiceClient) PushData(ctx context.Context, in *ShareData, opts .
 	return out, nil
 }
 
+func (c *shareServiceClient) Call(ctx context.Context, in *ShareData, opts ...grpc.CallOption) (*ShareReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ShareReply)
+	err := c.cc.Invoke(ctx, ShareService_Call_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shareServiceClient) Publish(ctx context.Context, in *TopicData, opts ...grpc.CallOption) (*DeliveryReport, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeliveryReport)
+	err := c.cc.Invoke(ctx, ShareService_Publish_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shareServiceClient) PushStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ShareStreamData, DeliveryReport], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ShareService_ServiceDesc.Streams[0], ShareService_PushStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ShareStreamData, DeliveryReport]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ShareService_PushStreamClient = grpc.ClientStreamingClient[ShareStreamData, DeliveryReport]
+
 // ShareServiceServer is the server API for ShareService service.
 // All implementations must embed UnimplementedShareServiceServer
 // for forward compatibility.
 type ShareServiceServer interface {
-	PushData(context.Context, *ShareData) (*emptypb.Empty, error)
+	PushData(context.Context, *ShareData) (*DeliveryReport, error)
+	Call(context.Context, *ShareData) (*ShareReply, error)
+	Publish(context.Context, *TopicData) (*DeliveryReport, error)
+	PushStream(grpc.ClientStreamingServer[ShareStreamData, DeliveryReport]) error
 	mustEmbedUnimplementedShareServiceServer()
 }
 
@@ -617,9 +701,18 @@ type ShareServiceServer interface {
 // pointer dereference when methods are called.
 type UnimplementedShareServiceServer struct{}
 
-func (UnimplementedShareServiceServer) PushData(context.Context, *ShareData) (*emptypb.Empty, error) {
+func (UnimplementedShareServiceServer) PushData(context.Context, *ShareData) (*DeliveryReport, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method PushData not implemented")
 }
+func (UnimplementedShareServiceServer) Call(context.Context, *ShareData) (*ShareReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Call not implemented")
+}
+func (UnimplementedShareServiceServer) Publish(context.Context, *TopicData) (*DeliveryReport, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Publish not implemented")
+}
+func (UnimplementedShareServiceServer) PushStream(grpc.ClientStreamingServer[ShareStreamData, DeliveryReport]) error {
+	return status.Errorf(codes.Unimplemented, "method PushStream not implemented")
+}
 func (UnimplementedShareServiceServer) mustEmbedUnimplementedShareServiceServer() {}
 func (UnimplementedShareServiceServer) testEmbeddedByValue()                      {}
 
@@ -659,6 +752,49 @@ func _ShareService_PushData_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ShareService_Call_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShareData)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShareServiceServer).Call(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShareService_Call_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShareServiceServer).Call(ctx, req.(*ShareData))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShareService_Publish_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TopicData)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShareServiceServer).Publish(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShareService_Publish_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShareServiceServer).Publish(ctx, req.(*TopicData))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShareService_PushStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ShareServiceServer).PushStream(&grpc.GenericServerStream[ShareStreamData, DeliveryReport]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ShareService_PushStreamServer = grpc.ClientStreamingServer[ShareStreamData, DeliveryReport]
+
 // ShareService_ServiceDesc is the grpc.ServiceDesc for ShareService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -670,7 +806,21 @@ var ShareService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "PushData",
 			Handler:    _ShareService_PushData_Handler,
 		},
+		{
+			MethodName: "Call",
+			Handler:    _ShareService_Call_Handler,
+		},
+		{
+			MethodName: "Publish",
+			Handler:    _ShareService_Publish_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "PushStream",
+			Handler:       _ShareService_PushStream_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "agent.proto",
 }
@@ -23,6 +23,8 @@ const (
 	SetupService_ConfigurationRequest_FullMethodName = "/controller.SetupService/ConfigurationRequest"
 	SetupService_ImageRequest_FullMethodName         = "/controller.SetupService/ImageRequest"
 	SetupService_ModuleRequest_FullMethodName        = "/controller.SetupService/ModuleRequest"
+	SetupService_ImageDataRequest_FullMethodName     = "/controller.SetupService/ImageDataRequest"
+	SetupService_ImageArchiveRequest_FullMethodName  = "/controller.SetupService/ImageArchiveRequest"
 )
 
 // SetupServiceClient is the client API for SetupService service.
@@ -32,6 +34,8 @@ type SetupServiceClient interface {
 	ConfigurationRequest(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*AgentConfiguration, error)
 	ImageRequest(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ImageStreamData], error)
 	ModuleRequest(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ModuleConfigurations, error)
+	ImageDataRequest(ctx context.Context, in *ImageChunkRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ImageStreamData], error)
+	ImageArchiveRequest(ctx context.Context, in *ImageArchiveRequest, opts ...grpc.CallOption) (*ImageArchive, error)
 }
 
 type setupServiceClient struct {
@@ -81,6 +85,35 @@ func (c *setupServiceClient) ModuleRequest(ctx context.Context, in *emptypb.Empt
 	return out, nil
 }
 
+func (c *setupServiceClient) ImageDataRequest(ctx context.Context, in *ImageChunkRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ImageStreamData], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SetupService_ServiceDesc.Streams[1], SetupService_ImageDataRequest_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ImageChunkRequest, ImageStreamData]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SetupService_ImageDataRequestClient = grpc.ServerStreamingClient[ImageStreamData]
+
+func (c *setupServiceClient) ImageArchiveRequest(ctx context.Context, in *ImageArchiveRequest, opts ...grpc.CallOption) (*ImageArchive, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ImageArchive)
+	err := c.cc.Invoke(ctx, SetupService_ImageArchiveRequest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // SetupServiceServer is the server API for SetupService service.
 // All implementations must embed UnimplementedSetupServiceServer
 // for forward compatibility.
@@ -88,6 +121,8 @@ type SetupServiceServer interface {
 	ConfigurationRequest(context.Context, *emptypb.Empty) (*AgentConfiguration, error)
 	ImageRequest(*emptypb.Empty, grpc.ServerStreamingServer[ImageStreamData]) error
 	ModuleRequest(context.Context, *emptypb.Empty) (*ModuleConfigurations, error)
+	ImageDataRequest(*ImageChunkRequest, grpc.ServerStreamingServer[ImageStreamData]) error
+	ImageArchiveRequest(context.Context, *ImageArchiveRequest) (*ImageArchive, error)
 	mustEmbedUnimplementedSetupServiceServer()
 }
 
@@ -107,6 +142,12 @@ func (UnimplementedSetupServiceServer) ImageRequest(*emptypb.Empty, grpc.ServerS
 func (UnimplementedSetupServiceServer) ModuleRequest(context.Context, *emptypb.Empty) (*ModuleConfigurations, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ModuleRequest not implemented")
 }
+func (UnimplementedSetupServiceServer) ImageDataRequest(*ImageChunkRequest, grpc.ServerStreamingServer[ImageStreamData]) error {
+	return status.Errorf(codes.Unimplemented, "method ImageDataRequest not implemented")
+}
+func (UnimplementedSetupServiceServer) ImageArchiveRequest(context.Context, *ImageArchiveRequest) (*ImageArchive, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ImageArchiveRequest not implemented")
+}
 func (UnimplementedSetupServiceServer) mustEmbedUnimplementedSetupServiceServer() {}
 func (UnimplementedSetupServiceServer) testEmbeddedByValue()                      {}
 
@@ -175,6 +216,35 @@ func _SetupService_ModuleRequest_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _SetupService_ImageDataRequest_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ImageChunkRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SetupServiceServer).ImageDataRequest(m, &grpc.GenericServerStream[ImageChunkRequest, ImageStreamData]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SetupService_ImageDataRequestServer = grpc.ServerStreamingServer[ImageStreamData]
+
+func _SetupService_ImageArchiveRequest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImageArchiveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SetupServiceServer).ImageArchiveRequest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SetupService_ImageArchiveRequest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SetupServiceServer).ImageArchiveRequest(ctx, req.(*ImageArchiveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // SetupService_ServiceDesc is the grpc.ServiceDesc for SetupService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -190,6 +260,10 @@ var SetupService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ModuleRequest",
 			Handler:    _SetupService_ModuleRequest_Handler,
 		},
+		{
+			MethodName: "ImageArchiveRequest",
+			Handler:    _SetupService_ImageArchiveRequest_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -197,6 +271,11 @@ var SetupService_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _SetupService_ImageRequest_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "ImageDataRequest",
+			Handler:       _SetupService_ImageDataRequest_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "controller.proto",
 }
@@ -209,7 +288,7 @@ const (
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type PhonehomeServiceClient interface {
-	Phonehome(ctx context.Context, in *PhonehomeData, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Phonehome(ctx context.Context, in *PhonehomeData, opts ...grpc.CallOption) (*DesiredState, error)
 }
 
 type phonehomeServiceClient struct {
@@ -220,9 +299,9 @@ func NewPhonehomeServiceClient(cc grpc.ClientConnInterface) PhonehomeServiceClie
 	return &phonehomeServiceClient{cc}
 }
 
-func (c *phonehomeServiceClient) Phonehome(ctx context.Context, in *PhonehomeData, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+func (c *phonehomeServiceClient) Phonehome(ctx context.Context, in *PhonehomeData, opts ...grpc.CallOption) (*DesiredState, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	out := new(emptypb.Empty)
+	out := new(DesiredState)
 	err := c.cc.Invoke(ctx, PhonehomeService_Phonehome_FullMethodName, in, out, cOpts...)
 	if err != nil {
 		return nil, err
@@ -234,7 +313,7 @@ func (c *phonehomeServiceClient) Phonehome(ctx context.Context, in *PhonehomeDat
 // All implementations must embed UnimplementedPhonehomeServiceServer
 // for forward compatibility.
 type PhonehomeServiceServer interface {
-	Phonehome(context.Context, *PhonehomeData) (*emptypb.Empty, error)
+	Phonehome(context.Context, *PhonehomeData) (*DesiredState, error)
 	mustEmbedUnimplementedPhonehomeServiceServer()
 }
 
@@ -245,7 +324,7 @@ type PhonehomeServiceServer interface {
 // pointer dereference when methods are called.
 type UnimplementedPhonehomeServiceServer struct{}
 
-func (UnimplementedPhonehomeServiceServer) Phonehome(context.Context, *PhonehomeData) (*emptypb.Empty, error) {
+func (UnimplementedPhonehomeServiceServer) Phonehome(context.Context, *PhonehomeData) (*DesiredState, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Phonehome not implemented")
 }
 func (UnimplementedPhonehomeServiceServer) mustEmbedUnimplementedPhonehomeServiceServer() {}
@@ -311,7 +390,7 @@ const (
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type ReceiveServiceClient interface {
-	PushData(ctx context.Context, in *ModuleControllerData, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	PushData(ctx context.Context, in *ModuleControllerData, opts ...grpc.CallOption) (*DeliveryReport, error)
 }
 
 type receiveServiceClient struct {
@@ -322,9 +401,9 @@ func NewReceiveServiceClient(cc grpc.ClientConnInterface) ReceiveServiceClient {
 	return &receiveServiceClient{cc}
 }
 
-func (c *receiveServiceClient) PushData(ctx context.Context, in *ModuleControllerData, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+func (c *receiveServiceClient) PushData(ctx context.Context, in *ModuleControllerData, opts ...grpc.CallOption) (*DeliveryReport, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	out := new(emptypb.Empty)
+	out := new(DeliveryReport)
 	err := c.cc.Invoke(ctx, ReceiveService_PushData_FullMethodName, in, out, cOpts...)
 	if err != nil {
 		return nil, err
@@ -336,7 +415,7 @@ func (c *receiveServiceClient) PushData(ctx context.Context, in *ModuleControlle
 // All implementations must embed UnimplementedReceiveServiceServer
 // for forward compatibility.
 type ReceiveServiceServer interface {
-	PushData(context.Context, *ModuleControllerData) (*emptypb.Empty, error)
+	PushData(context.Context, *ModuleControllerData) (*DeliveryReport, error)
 	mustEmbedUnimplementedReceiveServiceServer()
 }
 
@@ -347,7 +426,7 @@ type ReceiveServiceServer interface {
 // pointer dereference when methods are called.
 type UnimplementedReceiveServiceServer struct{}
 
-func (UnimplementedReceiveServiceServer) PushData(context.Context, *ModuleControllerData) (*emptypb.Empty, error) {
+func (UnimplementedReceiveServiceServer) PushData(context.Context, *ModuleControllerData) (*DeliveryReport, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method PushData not implemented")
 }
 func (UnimplementedReceiveServiceServer) mustEmbedUnimplementedReceiveServiceServer() {}
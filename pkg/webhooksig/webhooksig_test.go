@@ -0,0 +1,91 @@
+package webhooksig
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGenerateSecret(t *testing.T) {
+	first, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret() failed: %v", err)
+	}
+	second, _ := GenerateSecret()
+	if len(first) != 2*secretSize {
+		t.Errorf("GenerateSecret() returned %d characters; expected %d", len(first), 2*secretSize)
+	}
+	if first == second {
+		t.Errorf("GenerateSecret() returned the same secret twice")
+	}
+}
+
+func TestSign(t *testing.T) {
+	// reference value computed with: printf '1700000000.{"a":1}' | openssl dgst -sha256 -hmac secret
+	signature := Sign("secret", time.Unix(1700000000, 0), []byte(`{"a":1}`))
+	if expected := "sha256=49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686"; signature != expected {
+		t.Errorf("Sign() = %q; expected %q", signature, expected)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"blob":"aGk="}`)
+	header := Header("secret", now, body)
+	signature := header.Get(HeaderSignature)
+	timestamp := header.Get(HeaderTimestamp)
+
+	if err := Verify("secret", signature, timestamp, body, now.Add(time.Minute), DefaultTolerance); err != nil {
+		t.Fatalf("Verify() failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		timestamp string
+		body      []byte
+		now       time.Time
+	}{
+		{name: "wrong secret", secret: "other", signature: signature, timestamp: timestamp, body: body, now: now},
+		{name: "modified body", secret: "secret", signature: signature, timestamp: timestamp, body: []byte(`{}`), now: now},
+		{name: "modified timestamp", secret: "secret", signature: signature, timestamp: strconv.FormatInt(now.Unix()+1, 10), body: body, now: now},
+		{name: "expired", secret: "secret", signature: signature, timestamp: timestamp, body: body, now: now.Add(DefaultTolerance + time.Second)},
+		{name: "future", secret: "secret", signature: signature, timestamp: timestamp, body: body, now: now.Add(-DefaultTolerance - time.Second)},
+		{name: "missing prefix", secret: "secret", signature: signature[len(signaturePrefix):], timestamp: timestamp, body: body, now: now},
+		{name: "not hex", secret: "secret", signature: "sha256=zz", timestamp: timestamp, body: body, now: now},
+		{name: "missing headers", secret: "secret", body: body, now: now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.signature, tt.timestamp, tt.body, tt.now, DefaultTolerance)
+			if !errors.Is(err, ErrSignatureInvalid) {
+				t.Errorf("Verify() error = %v; expected %v", err, ErrSignatureInvalid)
+			}
+		})
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	body := []byte(`{"blob":"aGk="}`)
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(body))
+	for key, values := range Header("secret", time.Now(), body) {
+		req.Header[key] = values
+	}
+
+	received, err := VerifyRequest(req, "secret")
+	if err != nil {
+		t.Fatalf("VerifyRequest() failed: %v", err)
+	}
+	if !bytes.Equal(received, body) {
+		t.Errorf("VerifyRequest() = %q; expected %q", received, body)
+	}
+
+	req = httptest.NewRequest("POST", "/webhook", bytes.NewReader(body))
+	if _, err := VerifyRequest(req, "secret"); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("VerifyRequest() error = %v; expected %v", err, ErrSignatureInvalid)
+	}
+}
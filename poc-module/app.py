@@ -62,6 +62,29 @@ def webhook4():
     print(f"Webhook 4 received message: {message}")
     return jsonify({"status": "success"}), 200
 
+@app.route('/webhook5', methods=['POST'])
+def webhook5():
+    data = request.json
+    message = base64.b64decode(data["blob"].encode()).decode()
+    print(f"Webhook 5 received call from {data['sourceEndpointID']}: {message}")
+    return f"reply to '{message}'", 200
+
+@app.route('/webhook6', methods=['POST'])
+def webhook6():
+    data = request.json
+    message = base64.b64decode(data["blob"].encode()).decode()
+    print(f"Webhook 6 received message on topic {data['topic']} from {data['sourceEndpointID']}: {message}")
+    return jsonify({"status": "success"}), 200
+
+@app.route('/webhook7', methods=['POST'])
+def webhook7():
+    # the stream arrives as the raw body, it's read in chunks so it's never held in memory
+    size = 0
+    while chunk := request.stream.read(64 * 1024):
+        size += len(chunk)
+    print(f"Webhook 7 received stream of {size} bytes from {request.headers.get('X-Source-Endpoint-ID')}")
+    return jsonify({"status": "success"}), 200
+
 # Function to start Flask server
 def start_flask(host, port):
     server = make_server(host, port, app)
@@ -85,7 +108,10 @@ def register_webhooks():
         ('/webhook1', 'CONTROLLER_DATA'),
         ('/webhook2', 'CONTROLLER_DATA'),
         ('/webhook3', 'ENDPOINT_DATA'),
-        ('/webhook4', 'ENDPOINT_DATA')
+        ('/webhook4', 'ENDPOINT_DATA'),
+        ('/webhook5', 'ENDPOINT_CALL'),
+        ('/webhook6', 'TOPIC_DATA'),
+        ('/webhook7', 'ENDPOINT_STREAM')
     ]
     
     for url_path, event in webhook_configs:
@@ -116,11 +142,60 @@ def push_to_endpoint(endpoint_id, message):
     response = make_request('POST', f"{BASE_URL}/endpoint/push?id={endpoint_id}", 
                             data=message.encode(), 
                             headers=headers)
-    if response.status_code == 200:
-        print(f"Message pushed to endpoint {endpoint_id}")
+    if response.status_code == 202:
+        print(f"Message pushed to endpoint {endpoint_id}: {response.json()['id']}")
+        return response.json()['id']
     else:
         print(f"Failed to push message to endpoint {endpoint_id}")
 
+# Function to stream data to endpoint, the generator is sent as a chunked body
+def stream_to_endpoint(endpoint_id, size):
+    def chunks():
+        sent = 0
+        while sent < size:
+            chunk = os.urandom(min(64 * 1024, size - sent))
+            sent += len(chunk)
+            yield chunk
+    headers = {'Content-Type': 'application/octet-stream'}
+    response = make_request('POST', f"{BASE_URL}/endpoint/stream?id={endpoint_id}",
+                            data=chunks(),
+                            headers=headers)
+    if response.status_code == 200:
+        print(f"Streamed {response.json()['size']} bytes to endpoint {endpoint_id}, message ID: {response.json()['id']}")
+    else:
+        print(f"Failed to stream data to endpoint {endpoint_id}: {response.status_code}, message ID: {response.headers.get('X-Message-ID')}")
+
+# Function to call endpoint and wait for its reply
+def call_endpoint(endpoint_id, message):
+    headers = {'Content-Type': 'application/octet-stream'}
+    response = make_request('POST', f"{BASE_URL}/endpoint/call?id={endpoint_id}&timeout=10s",
+                            data=message.encode(),
+                            headers=headers)
+    if response.status_code == 200:
+        print(f"Endpoint {endpoint_id} replied: {response.content.decode()}")
+    else:
+        print(f"Failed to call endpoint {endpoint_id}: {response.status_code}, message ID: {response.headers.get('X-Message-ID')}")
+
+# Function to subscribe to topic
+def subscribe_topic(topic):
+    response = make_request('POST', f"{BASE_URL}/topic/{topic}/subscription")
+    if response.status_code == 204:
+        print(f"Subscribed to topic {topic}")
+    else:
+        print(f"Failed to subscribe to topic {topic}")
+
+# Function to publish message to all subscribers of topic
+def publish_topic(topic, message):
+    headers = {'Content-Type': 'application/octet-stream'}
+    response = make_request('POST', f"{BASE_URL}/topic/{topic}/publish",
+                            data=message.encode(),
+                            headers=headers)
+    if response.status_code == 202:
+        print(f"Message published to topic {topic}: {response.json()['id']}")
+        return response.json()['id']
+    else:
+        print(f"Failed to publish message to topic {topic}")
+
 # Function to push message to controller
 def push_to_controller(receiver_id, message):
     payload = {
@@ -128,32 +203,56 @@ def push_to_controller(receiver_id, message):
         "blob": base64.b64encode(message.encode()).decode()
     }
     response = make_request('POST', f"{BASE_URL}/controller/push", json=payload)
-    if response.status_code == 200:
-        print(f"Message pushed to controller for receiver {receiver_id}")
+    if response.status_code == 202:
+        print(f"Message pushed to controller for receiver {receiver_id}: {response.json()['id']}")
+        return response.json()['id']
     else:
         print(f"Failed to push message to controller for receiver {receiver_id}")
 
+# Function to print the delivery status of a pushed or published message
+def print_message_status(message_id):
+    response = make_request('GET', f"{BASE_URL}/outbox/{message_id}")
+    if response.status_code == 200:
+        message = response.json()
+        print(f"Message {message_id} is {message['status']}")
+        for recipient in message['recipients']:
+            print(f"- {recipient.get('identityID', '')}/{recipient.get('moduleID', '')}: {recipient['outcome']}")
+    else:
+        print(f"Failed to get status of message {message_id}")
+
 # Main loop
 def main_loop():
     print(f"Starting application with config: {config}")
 
     register_webhooks()
+    subscribe_topic('greetings')
     
     try:
         while True:
             list_endpoints()
+            message_ids = []
             
             # Push message to all endpoints (including this)
             response = make_request('GET', f"{BASE_URL}/endpoint")
             if response.status_code == 200:
                 endpoints = response.json()
                 for endpoint in endpoints:
-                    push_to_endpoint(endpoint['id'], 'hey there, this is module')
+                    message_ids.append(push_to_endpoint(endpoint['id'], 'hey there, this is module'))
+                    call_endpoint(endpoint['id'], 'how are you, module?')
+                    stream_to_endpoint(endpoint['id'], 8 * 1024 * 1024)
             
+            # Publish message to all modules subscribed to the topic
+            message_ids.append(publish_topic('greetings', 'hello subscribers, this is module'))
+
             # Push message to controller
-            push_to_controller('controller', 'hi controller, this is module')
+            message_ids.append(push_to_controller('controller', 'hi controller, this is module'))
             
             time.sleep(15)
+
+            # Report what happened to the messages sent in this round
+            for message_id in message_ids:
+                if message_id:
+                    print_message_status(message_id)
     except KeyboardInterrupt:
         print("Stopping the client...")
     finally:
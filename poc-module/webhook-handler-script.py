@@ -17,6 +17,8 @@ Arguments:
         Username for basic authentication
     --password : str, optional
         Password for basic authentication
+    --agent_id : str, optional
+        Send the data only to the module on this agent
 
 Note: SSL certificate verification is disabled for development use.
 """
@@ -27,6 +29,8 @@ import logging
 import sys
 import time
 import base64
+import hashlib
+import hmac
 import threading
 from http.server import HTTPServer, BaseHTTPRequestHandler
 import requests
@@ -36,19 +40,22 @@ from requests.auth import HTTPBasicAuth
 DEFAULT_API_URL = "https://localhost:6969/api/v1"
 DEFAULT_WEBHOOK_PORT = 3358
 SEND_INTERVAL = 15
+SIGNATURE_TOLERANCE = 300
 
 # Configure logging
 logging.basicConfig(level=logging.INFO, format='%(asctime)s - %(levelname)s - %(message)s')
 logger = logging.getLogger(__name__)
 
 class WebhookHandler:
-    def __init__(self, module_id, api_url, advertised_address, advertised_port, username, password):
+    def __init__(self, module_id, api_url, advertised_address, advertised_port, username, password, agent_id):
         self.module_id = module_id
+        self.agent_id = agent_id
         self.api_url = api_url
         self.advertised_address = advertised_address
         self.advertised_port = advertised_port
         self.auth = HTTPBasicAuth(username, password) if username and password else None
         self.webhook_id = None
+        self.secret = None
         self.stop_event = threading.Event()
 
     def register_webhook(self):
@@ -60,6 +67,8 @@ class WebhookHandler:
         if response.status_code == 201:
             response_data = response.json()
             self.webhook_id = response_data.get('ID')
+            # the secret is only returned on registration, deliveries are verified with it
+            self.secret = response_data.get('secret')
             if self.webhook_id:
                 logger.info(f"Webhook registered successfully with ID: {self.webhook_id}")
             else:
@@ -81,9 +90,14 @@ class WebhookHandler:
         while not self.stop_event.is_set():
             message = "hello world, I'm from outside"
             data = {"data": base64.b64encode(message.encode()).decode()}
+            if self.agent_id:
+                data["target"] = {"agentId": self.agent_id}
             response = requests.post(f"{self.api_url}/module/{self.module_id}/send", json=data, auth=self.auth, verify=False)
             if response.status_code == 200:
-                logger.info(f"Data sent successfully to module {self.module_id}")
+                response_data = response.json()
+                logger.info(f"Data sent to module {self.module_id}, message ID: {response_data['MessageID']}")
+                for recipient in response_data['Recipients']:
+                    logger.info(f"- agent {recipient['AgentID']}: {recipient['Outcome']} {recipient['Error']}")
             else:
                 logger.error(f"Failed to send data: {response.status_code}")
             time.sleep(SEND_INTERVAL)
@@ -92,14 +106,29 @@ class WebhookHandler:
         def do_POST(self):
             content_length = int(self.headers['Content-Length'])
             post_data = self.rfile.read(content_length)
+            if not self.verify_signature(post_data):
+                logger.warning("Rejected delivery with invalid signature")
+                self.send_response(401)
+                self.end_headers()
+                return
             data = json.loads(post_data.decode('utf-8'))
             logger.info(f"Received data: {json.dumps(data, indent=2)}")
             logger.info(f"Message: {base64.b64decode(data['blob'].encode()).decode()}")
             self.send_response(200)
             self.end_headers()
 
+        # same check as Verify in github.com/pajtaand/dmap-zero/pkg/webhooksig
+        def verify_signature(self, body):
+            timestamp = self.headers.get('X-Webhook-Timestamp', '')
+            signature = self.headers.get('X-Webhook-Signature', '')
+            if not timestamp.isdigit() or abs(time.time() - int(timestamp)) > SIGNATURE_TOLERANCE:
+                return False
+            expected = hmac.new(self.server.secret.encode(), timestamp.encode() + b'.' + body, hashlib.sha256).hexdigest()
+            return hmac.compare_digest(signature, f"sha256={expected}")
+
     def run_webhook_server(self):
         server = HTTPServer((self.advertised_address, int(self.advertised_port)), self.WebhookRequestHandler)
+        server.secret = self.secret
         logger.info(f"Webhook server running on http://{self.advertised_address}:{self.advertised_port}")
         while not self.stop_event.is_set():
             server.handle_request()
@@ -125,9 +154,10 @@ def parse_arguments():
     parser.add_argument("--advertised_port", default=DEFAULT_WEBHOOK_PORT, help="The advertised port of the host (e.g. 3456)")
     parser.add_argument("--username", help="Username for basic authentication")
     parser.add_argument("--password", help="Password for basic authentication")
+    parser.add_argument("--agent_id", help="Send the data only to the module on this agent")
     return parser.parse_args()
 
 if __name__ == "__main__":
     args = parse_arguments()
-    handler = WebhookHandler(args.module_id, args.api_url, args.advertised_address, args.advertised_port, args.username, args.password)
+    handler = WebhookHandler(args.module_id, args.api_url, args.advertised_address, args.advertised_port, args.username, args.password, args.agent_id)
     handler.run()
@@ -4,11 +4,17 @@
 DEFAULT_COMPOSE_FILE="./docker/node-compose.yaml"
 DEFAULT_ADVERTISED_IP="$(hostname -I | awk '{print $1}').sslip.io"
 DEFAULT_HEALTHCHECK_TIMEOUT=30
+DEFAULT_IMAGE_TRUST_ROOT="$HOME/.dmapz/image-trust-root-${NODE_NUM:-1}.pem"
+DEFAULT_SECRETS_DIR="$HOME/.dmapz/secrets-${NODE_NUM:-1}"
+DEFAULT_DATA_DIR="$HOME/.dmapz/data-${NODE_NUM:-1}"
 
 # Set variables using defaults if not already defined
 COMPOSE_FILE="${COMPOSE_FILE:-$DEFAULT_COMPOSE_FILE}"
 ADVERTISED_IP="${ADVERTISED_IP:-$DEFAULT_ADVERTISED_IP}"
 HEALTHCHECK_TIMEOUT="${HEALTHCHECK_TIMEOUT:-$DEFAULT_HEALTHCHECK_TIMEOUT}"
+IMAGE_TRUST_ROOT="${IMAGE_TRUST_ROOT:-$DEFAULT_IMAGE_TRUST_ROOT}"
+SECRETS_DIR="${SECRETS_DIR:-$DEFAULT_SECRETS_DIR}"
+DATA_DIR="${DATA_DIR:-$DEFAULT_DATA_DIR}"
 
 # IP check
 [ "$ADVERTISED_IP" = ".sslip.io" ] && { echo "Error: No IP address found."; exit 1; }
@@ -93,7 +99,10 @@ check_command "ziti"
 
 # Remove existing Docker containers and volumes
 echo "Removing existing containers and volumes..."
-AGENT_JWT="$AGENT_JWT" \
+IMAGE_TRUST_ROOT="$IMAGE_TRUST_ROOT" \
+  SECRETS_DIR="$SECRETS_DIR" \
+  DATA_DIR="$DATA_DIR" \
+  AGENT_JWT="$AGENT_JWT" \
   ROUTER_PORT="$(( NODE_NUM + 3022 ))" \
   CONTROLLER_ADDRESS="$CONTROLLER_ADDRESS" \
   NODE_NUM="$NODE_NUM" \
@@ -160,9 +169,31 @@ if [ -z "$AGENT_JWT" ]; then
   exit 1
 fi
 
+# Fetch the key images are signed with, the agent refuses images not signed by it
+echo "Fetching image signing key..."
+mkdir -p "$(dirname "$IMAGE_TRUST_ROOT")"
+curl -s -k -u "$AGENT_CONTROLLER_CREDENTIALS" \
+  https://$CONTROLLER_ADDRESS:6969/api/v1/image/signing-key \
+  | sed -n 's/.*"PublicKey":"\([^"]*\)".*/\1/p' | sed 's/\\n/\n/g' > "$IMAGE_TRUST_ROOT"
+
+# Check if the key was fetched successfully
+if ! grep -q "BEGIN PUBLIC KEY" "$IMAGE_TRUST_ROOT"; then
+  echo "Failed to fetch image signing key."
+  exit 1
+fi
+
+# Create the directory module secret files are written to, it's shared between the host and the agent
+mkdir -p -m 700 "$SECRETS_DIR"
+
+# Create the directory the agent keeps its outbox in
+mkdir -p "$DATA_DIR"
+
 # Run docker containers
 echo "Running Ziti tunneler and promtail containers..."
-AGENT_JWT="$AGENT_JWT" \
+IMAGE_TRUST_ROOT="$IMAGE_TRUST_ROOT" \
+  SECRETS_DIR="$SECRETS_DIR" \
+  DATA_DIR="$DATA_DIR" \
+  AGENT_JWT="$AGENT_JWT" \
   ROUTER_PORT="$(( NODE_NUM + 3022 ))" \
   CONTROLLER_ADDRESS="$CONTROLLER_ADDRESS" \
   NODE_NUM="$NODE_NUM" \
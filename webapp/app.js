@@ -2,8 +2,10 @@
 const HOST = getCurrentHost();
 const POPUP_MESSAGE_TIME = 4500
 const PAGE_RELOAD_INTERVAL = 2500
+const MODULE_LOGS_MAX_LENGTH = 200000
 
 credentials = null
+moduleLogsController = null
 
 // App state management
 
@@ -85,7 +87,8 @@ function showTab(tabName) {
 async function reloadAppData() {
     console.log("Loading app data");
 
-    const listAgentsRequest = fetch(`${HOST}/api/v1/agent`, {
+    const agentsSelector = document.getElementById("input-agents-selector").value.trim();
+    const listAgentsRequest = fetch(`${HOST}/api/v1/agent?selector=${encodeURIComponent(agentsSelector)}`, {
         method: "GET",
         cache: "no-cache",
         headers: {
@@ -114,6 +117,10 @@ async function reloadAppData() {
     const listModulesResponse = await listModulesRequest
     const listImagesResponse = await listImagesRequest
 
+    if (listAgentsResponse.status === 400) {
+        showError("Label selector is in invalid format!");
+        return
+    }
     if (listAgentsResponse.status !== 200) {
         showError("Failed to load agents");
         return
@@ -197,7 +204,8 @@ async function reloadAppData() {
         newItemHtml.innerHTML = agentItemTemplate.innerHTML;
         newItemHtml.style.display = "flex";
         newItemHtml.getElementsByClassName("text-horizontal")[0].innerHTML = agent.Name;
-        newItemHtml.getElementsByClassName("text-horizontal-small")[0].innerHTML = agent.IsEnrolled ? (agent.IsOnline ? "Online" : "Offline") : "Not enrolled" ;
+        let labels = Object.keys(agent.Labels).sort().map(key => agent.Labels[key] === "" ? key : `${key}=${agent.Labels[key]}`);
+        newItemHtml.getElementsByClassName("text-horizontal-small")[0].innerHTML = (agent.IsEnrolled ? (agent.IsOnline ? "Online" : "Offline") : "Not enrolled") + (labels.length > 0 ? ` | ${labels.join(", ")}` : "");
         newItemHtml.getElementsByClassName("text-horizontal-small")[0].style.color = agent.IsEnrolled ? (agent.IsOnline ? "green" : "red") : "grey";
 
         let revokeButton = newItemHtml.getElementsByClassName("button-revoke")[0];
@@ -262,6 +270,12 @@ async function reloadAppData() {
             stopButton.style.display = "none";
         }
 
+        let logsButton = newItemHtml.getElementsByClassName("button-logs")[0];
+        logsButton.setAttribute("obj-id", module.ID);
+        if (moduleMap[module.ID] === 0) {
+            logsButton.style.display = "none";
+        }
+
         modulesListHtml.appendChild(newItemHtml);
     })
 }
@@ -302,6 +316,7 @@ function showAddAgentForm() {
     showWindow("add-agent-popup");
     document.getElementById("form-add-agent-input-name").value = "";
     document.getElementById("form-add-agent-input-config").value = "";
+    document.getElementById("form-add-agent-input-labels").value = "";
 }
 
 function buttonEditAgent(button) {
@@ -333,6 +348,11 @@ function buttonEditAgent(button) {
                 cfgString += key + "=" + agent.Configuration[key] + "\n";
             } 
             document.getElementById("form-edit-agent-input-config").value = cfgString;
+            let labelsString = "";
+            for (var key in agent.Labels){
+                labelsString += key + "=" + agent.Labels[key] + "\n";
+            }
+            document.getElementById("form-edit-agent-input-labels").value = labelsString;
         });
     });
 }
@@ -531,9 +551,26 @@ function showSetupModuleForm() {
     updateImageSelection().then(showWindow("add-module-popup"));
 }
 
+function parseLabels(value) {
+    let labels = {};
+    for (let line of value.split("\n")) {
+        line = line.trim();
+        if (line === "") {
+            continue;
+        }
+        let groups = /^([A-Za-z0-9][\w.\-\/]*)(=(.*))?$/.exec(line);
+        if (groups == null) {
+            return null;
+        }
+        labels[groups[1]] = groups[3] === undefined ? "" : groups[3].trim();
+    }
+    return labels;
+}
+
 function formAddAgent(form) {
     let nameInput = form["form-add-agent-input-name"];
     let configInput = form["form-add-agent-input-config"];
+    let labelsInput = form["form-add-agent-input-labels"];
     
     // validation
     let groups = /^((\w+)=(.+))?(\n(\w+)=(.+))*(\n)?$/.exec(configInput.value);
@@ -547,6 +584,12 @@ function formAddAgent(form) {
         configuration[groups[i]] = groups[i+1];
     }
 
+    let labels = parseLabels(labelsInput.value);
+    if (labels == null) {
+        showError("Labels are in invalid format!");
+        return;
+    }
+
     fetch(`${HOST}/api/v1/agent`, {
         method: "POST",
         cache: "no-cache",
@@ -557,6 +600,7 @@ function formAddAgent(form) {
         body: JSON.stringify({
             Name: nameInput.value,
             Configuration: configuration,
+            Labels: labels,
         }),
     }).then(response => {
         if (response.status !== 200) {
@@ -580,6 +624,7 @@ function formEditAgent(form) {
 
     let nameInput = form["form-edit-agent-input-name"];
     let configInput = form["form-edit-agent-input-config"];
+    let labelsInput = form["form-edit-agent-input-labels"];
     
     // validation
     let groups = /^((\w+)=(.+))?(\n(\w+)=(.+))*(\n)?$/.exec(configInput.value);
@@ -593,6 +638,12 @@ function formEditAgent(form) {
         configuration[groups[i]] = groups[i+1];
     }
 
+    let labels = parseLabels(labelsInput.value);
+    if (labels == null) {
+        showError("Labels are in invalid format!");
+        return;
+    }
+
     fetch(`${HOST}/api/v1/agent/${agentID}`, {
         method: "PATCH",
         cache: "no-cache",
@@ -603,6 +654,7 @@ function formEditAgent(form) {
         body: JSON.stringify({
             Name: nameInput.value,
             Configuration: configuration,
+            Labels: labels,
         }),
     }).then(response => {
         if (response.status !== 200) {
@@ -750,6 +802,113 @@ async function buttonStopModule(button) {
     });
 }
 
+async function buttonShowModuleLogs(button) {
+    let moduleID = button.getAttribute("obj-id");
+    if (moduleID == null) {
+        showError("Invalid module ID!");
+        return;
+    }
+
+    const response = await fetch(`${HOST}/api/v1/agent`, {
+        method: "GET",
+        cache: "no-cache",
+        headers: {
+            "Authorization": `Basic ${credentials}`,
+            "Content-Type": "application/json",
+        },
+    });
+    if (response.status !== 200) {
+        showError("Failed to load agents");
+        return
+    }
+
+    let agents = (await response.json()).Agents.filter(agent => agent.PresentModules.includes(moduleID));
+    if (agents.length === 0) {
+        showError("Module isn't running on any agent");
+        return
+    }
+    agents.sort(function (a, b) {
+        return ('' + a.Name).localeCompare(b.Name);
+    })
+
+    let select = document.getElementById("form-module-logs-input-agent");
+    Array.from(select.options).slice(1).forEach(function(element) {
+        element.remove();
+    })
+    agents.forEach(function(agent) {
+        let option = document.createElement("option");
+        option.value = agent.ID;
+        option.text = agent.Name;
+        select.add(option);
+    })
+    select.value = agents[0].ID;
+
+    document.getElementById("form-module-logs").setAttribute("obj-id", moduleID);
+    document.getElementById("module-logs-output").textContent = "";
+    showWindow("module-logs-popup");
+}
+
+async function formModuleLogs(form) {
+    let moduleID = form.getAttribute("obj-id");
+    let agentID = form["form-module-logs-input-agent"].value;
+    let tail = form["form-module-logs-input-tail"].value;
+
+    stopModuleLogs();
+    const controller = new AbortController();
+    moduleLogsController = controller;
+
+    const output = document.getElementById("module-logs-output");
+    output.textContent = "";
+
+    try {
+        const response = await fetch(`${HOST}/api/v1/agent/${agentID}/module/${moduleID}/logs?follow=true&tail=${tail === "" ? "all" : tail}`, {
+            method: "GET",
+            cache: "no-cache",
+            headers: {
+                "Authorization": `Basic ${credentials}`,
+            },
+            signal: controller.signal,
+        });
+        if (response.status === 404) {
+            showError("Module isn't present on the agent");
+            return
+        }
+        if (response.status === 409) {
+            showError("Agent is offline");
+            return
+        }
+        if (response.status !== 200) {
+            showError("Failed to load module logs");
+            return
+        }
+
+        const reader = response.body.pipeThrough(new TextDecoderStream()).getReader();
+        while (true) {
+            const { value, done } = await reader.read();
+            if (done) {
+                break;
+            }
+            // keep following the end unless the user scrolled up
+            let atBottom = output.scrollHeight - output.scrollTop - output.clientHeight < 16;
+            output.textContent = (output.textContent + value).slice(-MODULE_LOGS_MAX_LENGTH);
+            if (atBottom) {
+                output.scrollTop = output.scrollHeight;
+            }
+        }
+    } catch (err) {
+        if (err.name !== "AbortError") {
+            showError("Module logs stream failed");
+        }
+    }
+}
+
+function stopModuleLogs() {
+    if (moduleLogsController !== null) {
+        moduleLogsController.abort();
+        moduleLogsController = null;
+    }
+}
+
 function formEditModule(form) {
     let nameInput = form["form-edit-module-input-name"];
     let imageInput = form["form-edit-module-input-image"];
@@ -1021,18 +1180,21 @@ function showWindow(htmlElementID) {
 
 function hideWindow(htmlElementID) {
     document.getElementById(htmlElementID).style.display = "none";
+    if (htmlElementID === "module-logs-popup") {
+        stopModuleLogs();
+    }
 }
 
 window.onkeydown = function (event) {
     if (event.key === "Escape") {
-        ["add-agent-popup", "add-image-popup", "add-module-popup", "edit-module-popup", "edit-agent-popup", "edit-module-popup", "enroll-agent-popup"].forEach(function(htmlElementID) {
+        ["add-agent-popup", "add-image-popup", "add-module-popup", "edit-module-popup", "edit-agent-popup", "edit-module-popup", "enroll-agent-popup", "module-logs-popup"].forEach(function(htmlElementID) {
             hideWindow(htmlElementID);
         });
     }
 }
 
 window.onclick = function (event) {
-    ["add-agent-popup", "add-image-popup", "add-module-popup", "edit-module-popup", "edit-agent-popup", "edit-module-popup", "enroll-agent-popup"].forEach(function(htmlElementID) {
+    ["add-agent-popup", "add-image-popup", "add-module-popup", "edit-module-popup", "edit-agent-popup", "edit-module-popup", "enroll-agent-popup", "module-logs-popup"].forEach(function(htmlElementID) {
         if (event.target === document.getElementById(htmlElementID)) {
             hideWindow(htmlElementID);
         }